@@ -1,7 +1,18 @@
 // Package ddqb provides a fluent API for building Datadog queries.
 package ddqb
 
-import "github.com/jonwinton/ddqb/metric"
+import (
+	"log/slog"
+	"time"
+
+	"github.com/jonwinton/ddqb/event"
+	"github.com/jonwinton/ddqb/log"
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/monitor"
+	"github.com/jonwinton/ddqb/slo"
+	"github.com/jonwinton/ddqb/timeseries"
+	"github.com/jonwinton/ddqp"
+)
 
 // Metric creates a new metric query builder.
 // This is the main entry point for building metric queries.
@@ -9,6 +20,92 @@ func Metric() metric.QueryBuilder {
 	return metric.NewMetricQueryBuilder()
 }
 
+// Log creates a new log search query builder.
+// This is the main entry point for building log queries.
+func Log() log.LogQueryBuilder {
+	return log.NewLogQueryBuilder()
+}
+
+// LogAnalytics creates a new log analytics query builder, which aggregates
+// the logs matched by a search.
+func LogAnalytics() log.LogAnalyticsBuilder {
+	return log.NewLogAnalyticsBuilder()
+}
+
+// Event creates a new event query builder.
+// This is the main entry point for building event queries.
+func Event() event.EventQueryBuilder {
+	return event.NewEventQueryBuilder()
+}
+
+// BurnRate creates a new SLO burn rate alert builder for the SLO with the
+// given ID.
+func BurnRate(sloID string) slo.BurnRateBuilder {
+	return slo.NewBurnRateBuilder(sloID)
+}
+
+// Monitor creates a new metric monitor builder, which wraps a metric query
+// in an evaluation window and threshold comparison.
+func Monitor() monitor.MonitorBuilder {
+	return monitor.NewMonitorBuilder()
+}
+
+// TraceAnalytics creates a new APM trace analytics monitor builder, which
+// aggregates the spans matched by a search and compares the result with a
+// threshold.
+func TraceAnalytics() monitor.TraceAnalyticsBuilder {
+	return monitor.NewTraceAnalyticsBuilder()
+}
+
+// LogMonitor creates a new log monitor builder, which compares a log
+// analytics query with a threshold.
+func LogMonitor() monitor.LogMonitorBuilder {
+	return monitor.NewLogMonitorBuilder()
+}
+
+// FromLogMonitor parses a log monitor query into a builder. See
+// monitor.ParseLogMonitor.
+func FromLogMonitor(query string) (monitor.LogMonitorBuilder, error) {
+	return monitor.ParseLogMonitor(query)
+}
+
+// EventMonitor creates a new event monitor builder, which compares an
+// event query with a threshold.
+func EventMonitor() monitor.EventMonitorBuilder {
+	return monitor.NewEventMonitorBuilder()
+}
+
+// FromEventMonitor parses an event monitor query into a builder. See
+// monitor.ParseEventMonitor.
+func FromEventMonitor(query string) (monitor.EventMonitorBuilder, error) {
+	return monitor.ParseEventMonitor(query)
+}
+
+// ForecastMonitor creates a new forecast monitor builder, which alerts
+// when a metric query is forecast to cross a threshold.
+func ForecastMonitor() monitor.ForecastMonitorBuilder {
+	return monitor.NewForecastMonitorBuilder()
+}
+
+// OutlierMonitor creates a new outlier monitor builder, which alerts when
+// a group of a metric query behaves differently from its peers.
+func OutlierMonitor() monitor.OutlierMonitorBuilder {
+	return monitor.NewOutlierMonitorBuilder()
+}
+
+// Timeseries creates a new builder for Datadog v2 timeseries query
+// requests, which combine named metric queries with formulas.
+func Timeseries() timeseries.RequestBuilder {
+	return timeseries.NewRequestBuilder()
+}
+
+// FromDashboardRequest parses a dashboard widget request in the formulas
+// and functions JSON format, parsing its metric queries with opts. See
+// timeseries.ParseDashboardRequest.
+func FromDashboardRequest(data []byte, opts ...metric.ParseOption) (*timeseries.DashboardRequest, error) {
+	return timeseries.ParseDashboardRequest(data, opts...)
+}
+
 // Filter creates a new filter builder with the given key.
 // This is a convenience function for creating filter builders.
 func Filter(key string) metric.FilterBuilder {
@@ -21,22 +118,322 @@ func Function(name string) metric.FunctionBuilder {
 	return metric.NewFunctionBuilder(name)
 }
 
+// Wrapper creates a new wrapping function builder with the given name,
+// for functions that take the whole query as their first argument.
+func Wrapper(name string) metric.WrapperBuilder {
+	return metric.NewWrapperBuilder(name)
+}
+
+// Top creates a top() wrapper keeping the limit series ranked highest
+// (order "desc") or lowest (order "asc") by ranking.
+func Top(limit int, ranking, order string) metric.WrapperBuilder {
+	return metric.Top(limit, ranking, order)
+}
+
+// Abs creates an abs() wrapper.
+func Abs() metric.WrapperBuilder {
+	return metric.Abs()
+}
+
+// DefaultZero creates a default_zero() wrapper, which fills gaps in the
+// query with zeros.
+func DefaultZero() metric.WrapperBuilder {
+	return metric.DefaultZero()
+}
+
+// Derivative creates a derivative() wrapper.
+func Derivative() metric.WrapperBuilder {
+	return metric.Derivative()
+}
+
+// Diff creates a diff() wrapper.
+func Diff() metric.WrapperBuilder {
+	return metric.Diff()
+}
+
+// Dt creates a dt() wrapper.
+func Dt() metric.WrapperBuilder {
+	return metric.Dt()
+}
+
+// CountNonzero creates a count_nonzero() wrapper.
+func CountNonzero() metric.WrapperBuilder {
+	return metric.CountNonzero()
+}
+
+// CountNotNull creates a count_not_null() wrapper.
+func CountNotNull() metric.WrapperBuilder {
+	return metric.CountNotNull()
+}
+
+// PerSecond creates a per_second() wrapper.
+func PerSecond() metric.WrapperBuilder {
+	return metric.PerSecond()
+}
+
+// PerMinute creates a per_minute() wrapper.
+func PerMinute() metric.WrapperBuilder {
+	return metric.PerMinute()
+}
+
+// PerHour creates a per_hour() wrapper.
+func PerHour() metric.WrapperBuilder {
+	return metric.PerHour()
+}
+
+// Cumsum creates a cumsum() wrapper.
+func Cumsum() metric.WrapperBuilder {
+	return metric.Cumsum()
+}
+
+// Integral creates an integral() wrapper.
+func Integral() metric.WrapperBuilder {
+	return metric.Integral()
+}
+
+// Log2 creates a log2() wrapper.
+func Log2() metric.WrapperBuilder {
+	return metric.Log2()
+}
+
+// Log10 creates a log10() wrapper.
+func Log10() metric.WrapperBuilder {
+	return metric.Log10()
+}
+
+// Timeshift creates a timeshift() wrapper moving the query by offset.
+func Timeshift(offset time.Duration) metric.WrapperBuilder {
+	return metric.Timeshift(offset)
+}
+
+// HourBefore creates an hour_before() wrapper.
+func HourBefore() metric.WrapperBuilder {
+	return metric.HourBefore()
+}
+
+// DayBefore creates a day_before() wrapper.
+func DayBefore() metric.WrapperBuilder {
+	return metric.DayBefore()
+}
+
+// WeekBefore creates a week_before() wrapper.
+func WeekBefore() metric.WrapperBuilder {
+	return metric.WeekBefore()
+}
+
+// MonthBefore creates a month_before() wrapper.
+func MonthBefore() metric.WrapperBuilder {
+	return metric.MonthBefore()
+}
+
+// ClampMin creates a clamp_min() wrapper raising points below v to v.
+func ClampMin(v float64) metric.WrapperBuilder {
+	return metric.ClampMin(v)
+}
+
+// ClampMax creates a clamp_max() wrapper lowering points above v to v.
+func ClampMax(v float64) metric.WrapperBuilder {
+	return metric.ClampMax(v)
+}
+
+// MovingAverage creates an exponentially weighted moving average wrapper
+// over span points, such as ewma_5().
+func MovingAverage(span int) metric.WrapperBuilder {
+	return metric.MovingAverage(span)
+}
+
+// MovingMedian creates a rolling median wrapper over span points, such as
+// median_5().
+func MovingMedian(span int) metric.WrapperBuilder {
+	return metric.MovingMedian(span)
+}
+
+// MovingRollup creates a moving_rollup() wrapper aggregating each point
+// with the points in the window before it.
+func MovingRollup(window time.Duration, aggregation metric.RollupAggregation) metric.MovingRollupBuilder {
+	return metric.MovingRollup(window, aggregation)
+}
+
+// Autosmooth creates an autosmooth() wrapper.
+func Autosmooth() metric.WrapperBuilder {
+	return metric.Autosmooth()
+}
+
+// Anomalies creates an anomalies() wrapper using algorithm with bounds
+// standard deviations.
+func Anomalies(algorithm metric.AnomalyAlgorithm, bounds float64) metric.WrapperBuilder {
+	return metric.Anomalies(algorithm, bounds)
+}
+
+// Outliers creates an outliers() wrapper using algorithm with tolerance
+// and, for the MAD algorithms, an optional pct.
+func Outliers(algorithm metric.OutlierAlgorithm, tolerance float64, pct ...float64) metric.WrapperBuilder {
+	return metric.Outliers(algorithm, tolerance, pct...)
+}
+
+// Forecast creates a forecast() wrapper using algorithm with deviations
+// standard deviations.
+func Forecast(algorithm metric.ForecastAlgorithm, deviations float64) metric.WrapperBuilder {
+	return metric.Forecast(algorithm, deviations)
+}
+
+// Fill creates a fill() function filling gaps in each series using mode,
+// optionally for at most limit seconds.
+func Fill(mode metric.FillMode, limit ...int) metric.FunctionBuilder {
+	return metric.Fill(mode, limit...)
+}
+
+// ExcludeNull creates an exclude_null() function dropping series whose tag
+// value is N/A.
+func ExcludeNull(tag string) metric.FunctionBuilder {
+	return metric.ExcludeNull(tag)
+}
+
+// Rollup creates a rollup() function aggregating each series into buckets
+// of interval, optionally with an aggregation other than avg. An interval
+// of 0 lets Datadog choose it.
+func Rollup(interval time.Duration, aggregation ...metric.RollupAggregation) metric.FunctionBuilder {
+	return metric.Rollup(interval, aggregation...)
+}
+
+// FunctionChain creates a new reusable chain of functions.
+// This is a convenience function for creating function chains.
+func FunctionChain(fns ...metric.FunctionBuilder) metric.FunctionChain {
+	return metric.NewFunctionChain(fns...)
+}
+
+// Tags returns an equality filter for each entry in tags, ordered by key.
+// This is a convenience function for scoping a query from a map:
+//
+//	ddqb.Metric().Metric("system.cpu.idle").Filters(ddqb.Tags(scope)...)
+func Tags(tags map[string]string) []metric.FilterExpression {
+	return metric.Tags(tags)
+}
+
+// Any creates a filter group joining exprs with OR.
+// This is a convenience function for building OR groups in one call.
+func Any(exprs ...metric.FilterExpression) metric.FilterGroupBuilder {
+	return metric.Any(exprs...)
+}
+
+// All creates a filter group joining exprs with AND.
+// This is a convenience function for building AND groups in one call.
+func All(exprs ...metric.FilterExpression) metric.FilterGroupBuilder {
+	return metric.All(exprs...)
+}
+
+// Scope creates a new scope builder holding filters that are shared by
+// many queries. Attach it to each query with QueryBuilder.Scope.
+func Scope() metric.ScopeBuilder {
+	return metric.NewScopeBuilder()
+}
+
 // FilterGroup creates a new filter group builder.
 // This is a convenience function for creating filter group builders.
 func FilterGroup() metric.FilterGroupBuilder {
 	return metric.NewFilterGroupBuilder()
 }
 
+// QuerySet creates a set of queries that are built together, such as the
+// queries of a dashboard widget request.
+func QuerySet(queries ...metric.QueryBuilder) *metric.QuerySet {
+	return metric.NewQuerySet(queries...)
+}
+
+// Arena creates a new arena of pooled builders for high-throughput query
+// construction. Call Release on the arena once its queries have been built.
+func Arena() *metric.Arena {
+	return metric.NewArena()
+}
+
 // FromQuery parses an existing Datadog query string and returns a QueryBuilder
 // that can be modified using the fluent API.
 //
 // Example:
 //
-//	builder, err := ddqb.FromQuery("avg(5m):system.cpu.idle{host:web-1} by {host}.fill(0)")
+//	builder, err := ddqb.FromQuery("avg(5m):system.cpu.idle{host:web-1} by {host}.fill(zero)")
 //	if err != nil {
 //		// handle error
 //	}
 //	modifiedQuery, err := builder.TimeWindow("10m").Filter(ddqb.Filter("env").Equal("prod")).Build()
-func FromQuery(queryString string) (metric.QueryBuilder, error) {
-	return metric.ParseQuery(queryString)
+func FromQuery(queryString string, opts ...metric.ParseOption) (metric.QueryBuilder, error) {
+	return metric.ParseQuery(queryString, opts...)
+}
+
+// FromQueryStrict parses a query like FromQuery, but fails with an error
+// wrapping metric.ErrUnrepresentable for queries the builders cannot fully
+// represent, so that every edit to the result applies.
+func FromQueryStrict(queryString string, opts ...metric.ParseOption) (metric.QueryBuilder, error) {
+	return metric.ParseQueryStrict(queryString, opts...)
+}
+
+// FromQueryLenient parses a query like FromQuery, but accepts syntax the
+// parser does not know; such queries build unchanged and cannot be edited.
+func FromQueryLenient(queryString string, opts ...metric.ParseOption) (metric.QueryBuilder, error) {
+	return metric.ParseQueryLenient(queryString, opts...)
+}
+
+// FromQueries parses a comma-separated list of queries, such as the q
+// field of a dashboard widget request, and returns a builder for each.
+// See metric.ParseMany.
+func FromQueries(queries string, opts ...metric.ParseOption) ([]metric.QueryBuilder, error) {
+	return metric.ParseMany(queries, opts...)
+}
+
+// FromStruct converts a struct whose fields carry ddqb tags into a
+// QueryBuilder. See metric.FromStruct for the tag format.
+//
+// Example:
+//
+//	type CPUQuery struct {
+//		_    struct{} `ddqb:"metric=system.cpu.idle,agg=avg,by=host"`
+//		Env  string   `ddqb:"filter=env"`
+//	}
+//	builder, err := ddqb.FromStruct(CPUQuery{Env: "prod"})
+func FromStruct(v any) (metric.QueryBuilder, error) {
+	return metric.FromStruct(v)
+}
+
+// FromDDQP converts a ddqp metric query AST into a QueryBuilder, for code
+// that already works with ddqp directly. Use QueryBuilder.ToDDQP for the
+// reverse conversion.
+func FromDDQP(mq *ddqp.MetricQuery) (metric.QueryBuilder, error) {
+	return metric.FromDDQP(mq)
+}
+
+// RoundTripCheck parses query, rebuilds it, re-parses the result, and
+// compares the two semantically. It returns a *metric.RoundTripError
+// describing any drift, which makes it suitable for auditing an inventory
+// of existing queries for ones that ddqb would alter.
+func RoundTripCheck(query string) error {
+	return metric.CheckRoundTrip(query)
+}
+
+// SetStrict enables or disables strict validation (aggregator whitelist,
+// function catalog and tag key validation) for all builders that have not
+// been given their own configuration. Any configured Validators and Limits
+// are kept.
+func SetStrict(strict bool) {
+	cfg := metric.LenientConfig()
+	if strict {
+		cfg = metric.StrictConfig()
+	}
+	current := metric.DefaultConfig()
+	cfg.Validators = current.Validators
+	cfg.Limits = current.Limits
+	metric.SetDefaultConfig(cfg)
+}
+
+// SetLogger sets the structured logger used to record parse and build
+// operations. Passing nil disables logging.
+func SetLogger(l *slog.Logger) {
+	metric.SetLogger(l)
+}
+
+// Anonymize returns query with every tag value replaced by a placeholder
+// while keeping its metric names, tag keys, functions and other structure,
+// so query shapes can be reported to telemetry without leaking hostnames
+// or customer identifiers. See metric.Anonymize.
+func Anonymize(query string) (string, error) {
+	return metric.Anonymize(query)
 }
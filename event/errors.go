@@ -0,0 +1,30 @@
+package event
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the builder. Use errors.Is
+// to test for them.
+var (
+	// ErrEmptyValue is returned when a source, tag or search term is empty.
+	ErrEmptyValue = errors.New("value is required")
+
+	// ErrInvalidPriority is returned for priorities other than the
+	// Priority constants.
+	ErrInvalidPriority = errors.New("invalid priority")
+
+	// ErrInvalidStatus is returned for statuses other than the Status
+	// constants.
+	ErrInvalidStatus = errors.New("invalid status")
+
+	// ErrInvalidFacetKey is returned when a group by or cardinality facet
+	// is not a valid facet name.
+	ErrInvalidFacetKey = errors.New("invalid facet key")
+
+	// ErrInvalidInterval is returned when a rollup interval is not a
+	// duration such as "5m" or "1h".
+	ErrInvalidInterval = errors.New("invalid interval")
+
+	// ErrInvalidQuery is returned when a query being parsed is malformed
+	// or uses a function the builder does not support.
+	ErrInvalidQuery = errors.New("invalid event query")
+)
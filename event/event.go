@@ -0,0 +1,335 @@
+// Package event provides builders for creating Datadog event queries.
+package event
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Priority filters events by priority.
+type Priority string
+
+const (
+	// PriorityAll matches events of every priority.
+	PriorityAll Priority = "all"
+	// PriorityNormal matches normal priority events.
+	PriorityNormal Priority = "normal"
+	// PriorityLow matches low priority events.
+	PriorityLow Priority = "low"
+)
+
+// Status filters events by alert status.
+type Status string
+
+const (
+	// StatusError matches error events.
+	StatusError Status = "error"
+	// StatusWarning matches warning events.
+	StatusWarning Status = "warning"
+	// StatusInfo matches informational events.
+	StatusInfo Status = "info"
+	// StatusSuccess matches success events.
+	StatusSuccess Status = "success"
+)
+
+var (
+	// facetKeyPattern matches a tag or facet name, with a leading '@' for
+	// attributes.
+	facetKeyPattern = regexp.MustCompile(`^@?[a-zA-Z_][a-zA-Z0-9_\-./@]*$`)
+
+	// intervalPattern matches a rollup interval such as 5m, 1h or 1d.
+	intervalPattern = regexp.MustCompile(`^[1-9][0-9]*[smhdw]$`)
+)
+
+// EventQueryBuilder provides a fluent interface for building event
+// queries in the events v2 syntax:
+//
+//	events("source:kubernetes priority:all tags:env:prod").rollup("count").by("host")
+type EventQueryBuilder interface {
+	// Source matches events from any of the given sources.
+	Source(sources ...string) EventQueryBuilder
+
+	// Priority matches events with the given priority.
+	Priority(priority Priority) EventQueryBuilder
+
+	// Status matches events with the given alert status.
+	Status(status Status) EventQueryBuilder
+
+	// Tag matches events tagged key:value.
+	Tag(key, value string) EventQueryBuilder
+
+	// RemoveTag removes the tag conditions on key, such as those of a
+	// parsed query being re-scoped.
+	RemoveTag(key string) EventQueryBuilder
+
+	// Search adds a free-text search term. Text containing whitespace is
+	// searched for as an exact phrase.
+	Search(text string) EventQueryBuilder
+
+	// Count counts matching events. This is the default rollup.
+	Count() EventQueryBuilder
+
+	// Cardinality counts the unique values of facet.
+	Cardinality(facet string) EventQueryBuilder
+
+	// GroupBy groups the results by the given facets.
+	GroupBy(facets ...string) EventQueryBuilder
+
+	// Last rolls the results up over interval (e.g. "5m", "1h").
+	Last(interval string) EventQueryBuilder
+
+	// Build returns the built query as a string.
+	Build() (string, error)
+}
+
+// condition is a single key:value (or free-text, when key is empty)
+// condition of the event search.
+type condition struct {
+	key    string
+	values []string
+	// raw marks a condition of a parsed search kept as it was written, in
+	// its only value.
+	raw bool
+}
+
+// eventQueryBuilder is the concrete implementation of the EventQueryBuilder
+// interface.
+type eventQueryBuilder struct {
+	conditions []condition
+	rollup     string
+	facet      string
+	groupBy    []string
+	interval   string
+}
+
+// NewEventQueryBuilder creates a new event query builder.
+func NewEventQueryBuilder() EventQueryBuilder {
+	return &eventQueryBuilder{
+		conditions: make([]condition, 0),
+		rollup:     "count",
+		groupBy:    make([]string, 0),
+	}
+}
+
+// Source matches events from any of the given sources.
+func (b *eventQueryBuilder) Source(sources ...string) EventQueryBuilder {
+	b.conditions = append(b.conditions, condition{key: "source", values: sources})
+	return b
+}
+
+// Priority matches events with the given priority.
+func (b *eventQueryBuilder) Priority(priority Priority) EventQueryBuilder {
+	b.conditions = append(b.conditions, condition{key: "priority", values: []string{string(priority)}})
+	return b
+}
+
+// Status matches events with the given alert status.
+func (b *eventQueryBuilder) Status(status Status) EventQueryBuilder {
+	b.conditions = append(b.conditions, condition{key: "status", values: []string{string(status)}})
+	return b
+}
+
+// Tag matches events tagged key:value.
+func (b *eventQueryBuilder) Tag(key, value string) EventQueryBuilder {
+	tag := key + ":" + value
+	if key == "" || value == "" {
+		tag = ""
+	}
+	b.conditions = append(b.conditions, condition{key: "tags", values: []string{tag}})
+	return b
+}
+
+// RemoveTag removes the tag conditions on key.
+func (b *eventQueryBuilder) RemoveTag(key string) EventQueryBuilder {
+	b.conditions = slices.DeleteFunc(b.conditions, func(c condition) bool {
+		return c.key == "tags" && !c.raw && slices.ContainsFunc(c.values, func(tag string) bool {
+			return strings.HasPrefix(tag, key+":")
+		})
+	})
+	return b
+}
+
+// Search adds a free-text search term.
+func (b *eventQueryBuilder) Search(text string) EventQueryBuilder {
+	b.conditions = append(b.conditions, condition{values: []string{text}})
+	return b
+}
+
+// Count counts matching events.
+func (b *eventQueryBuilder) Count() EventQueryBuilder {
+	b.rollup = "count"
+	b.facet = ""
+	return b
+}
+
+// Cardinality counts the unique values of facet.
+func (b *eventQueryBuilder) Cardinality(facet string) EventQueryBuilder {
+	b.rollup = "cardinality"
+	b.facet = facet
+	return b
+}
+
+// GroupBy groups the results by the given facets.
+func (b *eventQueryBuilder) GroupBy(facets ...string) EventQueryBuilder {
+	b.groupBy = append(b.groupBy, facets...)
+	return b
+}
+
+// Last rolls the results up over interval.
+func (b *eventQueryBuilder) Last(interval string) EventQueryBuilder {
+	b.interval = interval
+	return b
+}
+
+// Build returns the built query as a string.
+func (b *eventQueryBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+	for _, c := range b.conditions {
+		if err := c.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if b.rollup == "cardinality" && !facetKeyPattern.MatchString(b.facet) {
+		errs = append(errs, fmt.Errorf("%w: cardinality of %q", ErrInvalidFacetKey, b.facet))
+	}
+	for _, facet := range b.groupBy {
+		if !facetKeyPattern.MatchString(facet) {
+			errs = append(errs, fmt.Errorf("%w: group by %q", ErrInvalidFacetKey, facet))
+		}
+	}
+	if b.interval != "" && !intervalPattern.MatchString(b.interval) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidInterval, b.interval))
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var search strings.Builder
+	for i, c := range b.conditions {
+		if i > 0 {
+			search.WriteByte(' ')
+		}
+		// A search kept as written may combine conditions of its own
+		if c.raw && len(b.conditions) > 1 && strings.ContainsFunc(c.values[0], unicode.IsSpace) {
+			search.WriteByte('(')
+			c.appendTo(&search)
+			search.WriteByte(')')
+			continue
+		}
+		c.appendTo(&search)
+	}
+	if search.Len() == 0 {
+		search.WriteByte('*')
+	}
+
+	var sb strings.Builder
+	sb.WriteString("events(")
+	writeQuoted(&sb, search.String())
+	sb.WriteString(").rollup(")
+	writeQuoted(&sb, b.rollup)
+	if b.facet != "" {
+		sb.WriteString(", ")
+		writeQuoted(&sb, b.facet)
+	}
+	sb.WriteByte(')')
+
+	if len(b.groupBy) > 0 {
+		sb.WriteString(".by(")
+		writeQuoted(&sb, strings.Join(b.groupBy, ","))
+		sb.WriteByte(')')
+	}
+
+	if b.interval != "" {
+		sb.WriteString(".last(")
+		writeQuoted(&sb, b.interval)
+		sb.WriteByte(')')
+	}
+
+	return sb.String(), nil
+}
+
+// validate checks the condition's values.
+func (c condition) validate() error {
+	if len(c.values) == 0 {
+		return fmt.Errorf("%w: %s", ErrEmptyValue, c.key)
+	}
+	for _, v := range c.values {
+		if v == "" {
+			name := c.key
+			if name == "" {
+				name = "search"
+			}
+			return fmt.Errorf("%w: %s", ErrEmptyValue, name)
+		}
+	}
+	switch {
+	case c.raw:
+		return nil
+	case c.key == "priority":
+		switch Priority(c.values[0]) {
+		case PriorityAll, PriorityNormal, PriorityLow:
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidPriority, c.values[0])
+		}
+	case c.key == "status":
+		switch Status(c.values[0]) {
+		case StatusError, StatusWarning, StatusInfo, StatusSuccess:
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidStatus, c.values[0])
+		}
+	}
+	return nil
+}
+
+// appendTo renders the condition into sb. Several values are matched with
+// OR.
+func (c condition) appendTo(sb *strings.Builder) {
+	if c.raw {
+		sb.WriteString(c.values[0])
+		return
+	}
+	if c.key != "" {
+		sb.WriteString(c.key)
+		sb.WriteByte(':')
+	}
+	if len(c.values) == 1 {
+		writeValue(sb, c.values[0])
+		return
+	}
+	sb.WriteByte('(')
+	for i, v := range c.values {
+		if i > 0 {
+			sb.WriteString(" OR ")
+		}
+		writeValue(sb, v)
+	}
+	sb.WriteByte(')')
+}
+
+// writeValue renders a search value into sb, quoting it when it contains
+// whitespace or characters that would change the meaning of the search.
+func writeValue(sb *strings.Builder, value string) {
+	if strings.HasPrefix(value, "-") || strings.ContainsAny(value, " \t\r\n\"()") {
+		writeQuoted(sb, value)
+		return
+	}
+	sb.WriteString(value)
+}
+
+// writeQuoted renders s into sb as a double-quoted string, escaping
+// embedded backslashes and double quotes.
+func writeQuoted(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, c := range s {
+		if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('"')
+}
@@ -0,0 +1,96 @@
+package event_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/event"
+)
+
+func TestEventQueryBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  event.EventQueryBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "every event",
+			builder:  event.NewEventQueryBuilder(),
+			expected: `events("*").rollup("count")`,
+		},
+		{
+			name: "source, priority and tag grouped by host",
+			builder: event.NewEventQueryBuilder().
+				Source("kubernetes").
+				Priority(event.PriorityAll).
+				Tag("env", "prod").
+				GroupBy("host"),
+			expected: `events("source:kubernetes priority:all tags:env:prod").rollup("count").by("host")`,
+		},
+		{
+			name: "several sources with status and interval",
+			builder: event.NewEventQueryBuilder().
+				Source("github", "jenkins").
+				Status(event.StatusError).
+				Last("1h"),
+			expected: `events("source:(github OR jenkins) status:error").rollup("count").last("1h")`,
+		},
+		{
+			name: "phrase search and cardinality",
+			builder: event.NewEventQueryBuilder().
+				Search("deployment failed").
+				Cardinality("host").
+				GroupBy("service", "env"),
+			expected: `events("\"deployment failed\"").rollup("cardinality", "host").by("service,env")`,
+		},
+		{
+			name:    "error - empty source",
+			builder: event.NewEventQueryBuilder().Source(""),
+			wantErr: event.ErrEmptyValue,
+		},
+		{
+			name:    "error - empty tag value",
+			builder: event.NewEventQueryBuilder().Tag("env", ""),
+			wantErr: event.ErrEmptyValue,
+		},
+		{
+			name:    "error - invalid priority",
+			builder: event.NewEventQueryBuilder().Priority("high"),
+			wantErr: event.ErrInvalidPriority,
+		},
+		{
+			name:    "error - invalid status",
+			builder: event.NewEventQueryBuilder().Status("critical"),
+			wantErr: event.ErrInvalidStatus,
+		},
+		{
+			name:    "error - cardinality without facet",
+			builder: event.NewEventQueryBuilder().Cardinality(""),
+			wantErr: event.ErrInvalidFacetKey,
+		},
+		{
+			name:    "error - invalid interval",
+			builder: event.NewEventQueryBuilder().Last("5 minutes"),
+			wantErr: event.ErrInvalidInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
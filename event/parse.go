@@ -0,0 +1,292 @@
+package event
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// conditionPattern matches a key:value search condition, whose value may
+// be a parenthesized list of alternatives.
+var conditionPattern = regexp.MustCompile(`^([a-zA-Z_@][a-zA-Z0-9_\-./@]*):(.+)$`)
+
+// ParseQuery parses an event query such as
+//
+//	events("source:kubernetes priority:all tags:env:prod").rollup("count").by("host").last("1h")
+//
+// into a builder that can be edited, e.g. to re-scope it with RemoveTag and
+// Tag. Each condition of the search becomes a condition of the builder;
+// conditions it cannot represent, and searches combining conditions with
+// OR or NOT, are kept as written. Calls after events(...) may appear in
+// any order, each at most once.
+func ParseQuery(query string) (EventQueryBuilder, error) {
+	calls, err := parseCalls(query)
+	if err != nil {
+		return nil, err
+	}
+	if calls[0].name != "events" {
+		return nil, invalidQuery(query, calls[0].offset, "expected events(...)")
+	}
+
+	b := NewEventQueryBuilder().(*eventQueryBuilder)
+	if err := calls[0].expectArgs(query, 1, 1); err != nil {
+		return nil, err
+	}
+	b.conditions = append(b.conditions, parseSearch(calls[0].args[0])...)
+
+	seen := make(map[string]bool, len(calls))
+	for _, c := range calls[1:] {
+		if seen[c.name] {
+			return nil, invalidQuery(query, c.offset, fmt.Sprintf("%s(...) appears more than once", c.name))
+		}
+		seen[c.name] = true
+
+		switch c.name {
+		case "rollup":
+			if err := c.expectArgs(query, 1, 2); err != nil {
+				return nil, err
+			}
+			switch {
+			case c.args[0] == "count" && len(c.args) == 1:
+				b.Count()
+			case c.args[0] == "cardinality" && len(c.args) == 2:
+				b.Cardinality(c.args[1])
+			default:
+				return nil, invalidQuery(query, c.offset, fmt.Sprintf("unsupported rollup %q", strings.Join(c.args, ", ")))
+			}
+		case "by":
+			if err := c.expectArgs(query, 1, 1); err != nil {
+				return nil, err
+			}
+			b.groupBy = append(b.groupBy, splitList(c.args[0])...)
+		case "last":
+			if err := c.expectArgs(query, 1, 1); err != nil {
+				return nil, err
+			}
+			b.interval = c.args[0]
+		default:
+			return nil, invalidQuery(query, c.offset, fmt.Sprintf("unknown function %s(...)", c.name))
+		}
+	}
+	return b, nil
+}
+
+// parseSearch splits search into conditions. Conditions that would not
+// render as they were written, or that the builder would reject, are kept
+// verbatim, as is the whole search when it uses boolean operators.
+func parseSearch(search string) []condition {
+	search = strings.TrimSpace(search)
+	if search == "" || search == "*" {
+		return nil
+	}
+	tokens, ok := splitSearch(search)
+	if !ok {
+		return []condition{{values: []string{search}, raw: true}}
+	}
+
+	conditions := make([]condition, 0, len(tokens))
+	for _, token := range tokens {
+		c := parseCondition(token)
+		var sb strings.Builder
+		c.appendTo(&sb)
+		if sb.String() != token || c.validate() != nil {
+			c = condition{values: []string{token}, raw: true}
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+// parseCondition parses one token of a search: a key:value condition, a
+// key:(a OR b) list or free text.
+func parseCondition(token string) condition {
+	m := conditionPattern.FindStringSubmatch(token)
+	if m == nil {
+		return condition{values: []string{unquoteValue(token)}}
+	}
+	key, value := m[1], m[2]
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		var values []string
+		for _, v := range strings.Split(value[1:len(value)-1], " OR ") {
+			values = append(values, unquoteValue(v))
+		}
+		return condition{key: key, values: values}
+	}
+	return condition{key: key, values: []string{unquoteValue(value)}}
+}
+
+// unquoteValue returns v without its double quotes, if it is a quoted
+// string.
+func unquoteValue(v string) string {
+	if s, n, ok := unquote(v); ok && n == len(v) {
+		return s
+	}
+	return v
+}
+
+// splitSearch splits search at the spaces between its conditions. It
+// reports false if the search combines conditions with boolean operators
+// or its quotes or parentheses are unbalanced.
+func splitSearch(search string) ([]string, bool) {
+	var tokens []string
+	for i := 0; i < len(search); {
+		if unicode.IsSpace(rune(search[i])) {
+			i++
+			continue
+		}
+		start, depth := i, 0
+		for ; i < len(search) && (depth > 0 || !unicode.IsSpace(rune(search[i]))); i++ {
+			switch search[i] {
+			case '"':
+				_, n, ok := unquote(search[i:])
+				if !ok {
+					return nil, false
+				}
+				i += n - 1
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth < 0 {
+					return nil, false
+				}
+			}
+		}
+		if depth != 0 {
+			return nil, false
+		}
+		switch token := search[start:i]; token {
+		case "OR", "AND", "NOT":
+			return nil, false
+		default:
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, true
+}
+
+// call is one call of a query written as a chain of calls with quoted
+// arguments, such as events("*").rollup("count").
+type call struct {
+	name   string
+	args   []string
+	offset int
+}
+
+// expectArgs reports an error unless c has between least and most
+// arguments.
+func (c call) expectArgs(query string, least, most int) error {
+	if n := len(c.args); n < least || n > most {
+		want := fmt.Sprintf("%d to %d arguments", least, most)
+		if least == most {
+			want = fmt.Sprintf("%d argument", least)
+		}
+		return invalidQuery(query, c.offset, fmt.Sprintf("%s(...) takes %s, got %d", c.name, want, n))
+	}
+	return nil
+}
+
+// parseCalls splits query into its calls. It returns at least one call or
+// an error.
+func parseCalls(query string) ([]call, error) {
+	var calls []call
+	i := 0
+	skipSpace := func() {
+		for i < len(query) && unicode.IsSpace(rune(query[i])) {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if len(calls) > 0 {
+			if i == len(query) {
+				return calls, nil
+			}
+			if query[i] != '.' {
+				return nil, invalidQuery(query, i, "expected . or the end of the query")
+			}
+			i++
+			skipSpace()
+		}
+
+		start := i
+		for i < len(query) && (query[i] == '_' || unicode.IsLetter(rune(query[i]))) {
+			i++
+		}
+		if i == start {
+			return nil, invalidQuery(query, i, "expected a function name")
+		}
+		c := call{name: query[start:i], offset: start}
+		skipSpace()
+		if i == len(query) || query[i] != '(' {
+			return nil, invalidQuery(query, i, "expected (")
+		}
+		i++
+
+		skipSpace()
+		if i < len(query) && query[i] == ')' {
+			i++
+			calls = append(calls, c)
+			continue
+		}
+		for {
+			skipSpace()
+			arg, n, ok := unquote(query[i:])
+			if !ok {
+				return nil, invalidQuery(query, i, "expected a double-quoted string")
+			}
+			c.args = append(c.args, arg)
+			i += n
+			skipSpace()
+			if i < len(query) && query[i] == ',' {
+				i++
+				continue
+			}
+			if i < len(query) && query[i] == ')' {
+				i++
+				break
+			}
+			return nil, invalidQuery(query, i, "expected , or )")
+		}
+		calls = append(calls, c)
+	}
+}
+
+// unquote reads the double-quoted string at the start of s, as written by
+// writeQuoted, returning its value and length.
+func unquote(s string) (string, int, bool) {
+	if s == "" || s[0] != '"' {
+		return "", 0, false
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return sb.String(), i + 1, true
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
+
+// splitList splits a comma-separated argument such as "host,env".
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// invalidQuery returns an error wrapping ErrInvalidQuery for a problem at
+// offset in query.
+func invalidQuery(query string, offset int, reason string) error {
+	return fmt.Errorf("%w: %s at offset %d of %q", ErrInvalidQuery, reason, offset, query)
+}
@@ -0,0 +1,98 @@
+package event_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/event"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(event.EventQueryBuilder) event.EventQueryBuilder
+		expected string
+	}{
+		{
+			name:     "unmodified",
+			query:    `events("source:kubernetes priority:all tags:env:prod").rollup("count").by("host").last("1h")`,
+			expected: `events("source:kubernetes priority:all tags:env:prod").rollup("count").by("host").last("1h")`,
+		},
+		{
+			name:     "lists, phrases and cardinality",
+			query:    `events("source:(github OR jenkins) \"deploy failed\"").rollup("cardinality", "host").last("1d")`,
+			expected: `events("source:(github OR jenkins) \"deploy failed\"").rollup("cardinality", "host").last("1d")`,
+		},
+		{
+			name:     "every event",
+			query:    `events("*").rollup("count")`,
+			expected: `events("*").rollup("count")`,
+		},
+		{
+			name:  "re-scope tags",
+			query: `events("source:kubernetes tags:env:prod tags:team:core").rollup("count").last("1h")`,
+			modify: func(b event.EventQueryBuilder) event.EventQueryBuilder {
+				return b.RemoveTag("env").Tag("env", "staging")
+			},
+			expected: `events("source:kubernetes tags:team:core tags:env:staging").rollup("count").last("1h")`,
+		},
+		{
+			name:  "unrepresentable conditions are kept",
+			query: `events("-source:nagios priority:urgent tags:env:prod").rollup("count")`,
+			modify: func(b event.EventQueryBuilder) event.EventQueryBuilder {
+				return b.RemoveTag("env")
+			},
+			expected: `events("-source:nagios priority:urgent").rollup("count")`,
+		},
+		{
+			name:  "boolean search is kept as written",
+			query: `events("source:github OR source:jenkins").rollup("count")`,
+			modify: func(b event.EventQueryBuilder) event.EventQueryBuilder {
+				return b.Tag("env", "prod")
+			},
+			expected: `events("(source:github OR source:jenkins) tags:env:prod").rollup("count")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := event.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if tt.modify != nil {
+				b = tt.modify(b)
+			}
+			got, err := b.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "empty", query: ""},
+		{name: "not an event query", query: `logs("*").rollup("count")`},
+		{name: "unsupported rollup", query: `events("*").rollup("sum", "@duration")`},
+		{name: "unknown function", query: `events("*").index("main")`},
+		{name: "repeated function", query: `events("*").by("host").by("env")`},
+		{name: "unterminated string", query: `events("*).rollup("count")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := event.ParseQuery(tt.query); !errors.Is(err, event.ErrInvalidQuery) {
+				t.Errorf("ParseQuery(%q) error = %v, want %v", tt.query, err, event.ErrInvalidQuery)
+			}
+		})
+	}
+}
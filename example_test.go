@@ -46,7 +46,7 @@ func Example() {
 		Filter(ddqb.Filter("host").Equal("web-1")).
 		Filter(ddqb.Filter("env").Equal("prod")).
 		GroupBy("host").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		ApplyFunction(ddqb.Function("rollup").WithArgs("60", "sum")).
 		Build()
 	if err != nil {
@@ -58,5 +58,5 @@ func Example() {
 	// system.cpu.idle{*}
 	// avg(5m):system.cpu.idle{*}
 	// system.cpu.idle{host:web-1}
-	// avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(0).rollup(60, sum)
+	// avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(zero).rollup(60, sum)
 }
@@ -23,10 +23,9 @@ func buildDynamicQuery(metricName string, hostPattern string, environments []str
 
 	// Add host filter if provided
 	if hostPattern != "" {
-		// Use regex if it contains wildcards, otherwise use equality
-		if strings.Contains(hostPattern, "*") {
-			// Regex matching unsupported; use a representative host instead
-			builder = builder.Filter(ddqb.Filter("host").Equal("web-1"))
+		// Trailing wildcards become prefix matches, otherwise use equality
+		if prefix, ok := strings.CutSuffix(hostPattern, "*"); ok {
+			builder = builder.Filter(ddqb.Filter("host").HasPrefix(prefix))
 		} else {
 			builder = builder.Filter(ddqb.Filter("host").Equal(hostPattern))
 		}
@@ -68,7 +67,7 @@ func buildMonitoringQuery(metric string, threshold float64, windowMins int) (str
 		Metric(metric).
 		Filter(ddqb.Filter("env").Equal("prod")).
 		GroupBy("host").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		Build()
 }
 
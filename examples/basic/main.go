@@ -70,7 +70,7 @@ func main() {
 	fmt.Println("Example 6: Metric query with function")
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		Build()
 	if err != nil {
 		log.Fatalf("Failed to build query: %v", err)
@@ -86,7 +86,7 @@ func main() {
 		Filter(ddqb.Filter("host").Equal("web-1")).
 		Filter(ddqb.Filter("env").Equal("prod")).
 		GroupBy("host").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		ApplyFunction(ddqb.Function("rollup").WithArgs("60", "sum")).
 		Build()
 	if err != nil {
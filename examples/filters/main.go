@@ -81,9 +81,10 @@ func main() {
 
 	// Example 7: OR query
 	fmt.Println("Example 7: OR query")
-	orGroup := ddqb.FilterGroup()
-	orGroup.Or(ddqb.Filter("env").Equal("prod"))
-	orGroup.Or(ddqb.Filter("env").Equal("staging"))
+	orGroup := ddqb.Any(
+		ddqb.Filter("env").Equal("prod"),
+		ddqb.Filter("env").Equal("staging"),
+	)
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
 		Filter(orGroup).
@@ -95,12 +96,10 @@ func main() {
 
 	// Example 8: AND NOT query
 	fmt.Println("Example 8: AND NOT query")
-	andNotGroup := ddqb.FilterGroup()
-	andNotGroup.And(ddqb.Filter("env").Equal("prod"))
-	notGroup := ddqb.FilterGroup()
-	notGroup.And(ddqb.Filter("host").Equal("web-1"))
-	notGroup.Not()
-	andNotGroup.And(notGroup)
+	andNotGroup := ddqb.All(
+		ddqb.Filter("env").Equal("prod"),
+		ddqb.All(ddqb.Filter("host").Equal("web-1")).Not(),
+	)
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
 		Filter(andNotGroup).
@@ -112,12 +111,10 @@ func main() {
 
 	// Example 9: OR NOT query
 	fmt.Println("Example 9: OR NOT query")
-	orNotGroup := ddqb.FilterGroup()
-	orNotGroup.Or(ddqb.Filter("env").Equal("prod"))
-	notGroup2 := ddqb.FilterGroup()
-	notGroup2.And(ddqb.Filter("host").Equal("web-1"))
-	notGroup2.Not()
-	orNotGroup.Or(notGroup2)
+	orNotGroup := ddqb.Any(
+		ddqb.Filter("env").Equal("prod"),
+		ddqb.All(ddqb.Filter("host").Equal("web-1")).Not(),
+	)
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
 		Filter(orNotGroup).
@@ -129,14 +126,13 @@ func main() {
 
 	// Example 10: Nested groups (AND with nested OR)
 	fmt.Println("Example 10: Nested groups (AND with nested OR)")
-	outerGroup := ddqb.FilterGroup()
-	outerGroup.And(ddqb.Filter("env").Equal("prod"))
-
-	innerGroup := ddqb.FilterGroup()
-	innerGroup.Or(ddqb.Filter("host").Equal("web-1"))
-	innerGroup.Or(ddqb.Filter("host").Equal("web-2"))
-
-	outerGroup.And(innerGroup)
+	outerGroup := ddqb.All(
+		ddqb.Filter("env").Equal("prod"),
+		ddqb.Any(
+			ddqb.Filter("host").Equal("web-1"),
+			ddqb.Filter("host").Equal("web-2"),
+		),
+	)
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
 		Filter(outerGroup).
@@ -148,17 +144,16 @@ func main() {
 
 	// Example 11: Complex nested groups
 	fmt.Println("Example 11: Complex nested groups")
-	envGroup := ddqb.FilterGroup()
-	envGroup.Or(ddqb.Filter("env").Equal("prod"))
-	envGroup.Or(ddqb.Filter("env").Equal("staging"))
-
-	hostGroup := ddqb.FilterGroup()
-	hostGroup.Or(ddqb.Filter("host").Equal("web-1"))
-	hostGroup.Or(ddqb.Filter("host").Equal("api-1"))
-
-	complexGroup := ddqb.FilterGroup()
-	complexGroup.And(envGroup)
-	complexGroup.And(hostGroup)
+	complexGroup := ddqb.All(
+		ddqb.Any(
+			ddqb.Filter("env").Equal("prod"),
+			ddqb.Filter("env").Equal("staging"),
+		),
+		ddqb.Any(
+			ddqb.Filter("host").Equal("web-1"),
+			ddqb.Filter("host").Equal("api-1"),
+		),
+	)
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
 		Filter(complexGroup).
@@ -170,13 +165,15 @@ func main() {
 
 	// Example 12: Multiple groups combined (implicit AND)
 	fmt.Println("Example 12: Multiple groups combined (implicit AND)")
-	group1 := ddqb.FilterGroup()
-	group1.Or(ddqb.Filter("env").Equal("prod"))
-	group1.Or(ddqb.Filter("env").Equal("staging"))
-
-	group2 := ddqb.FilterGroup()
-	group2.Or(ddqb.Filter("region").Equal("us-east-1"))
-	group2.Or(ddqb.Filter("region").Equal("us-west-2"))
+	group1 := ddqb.Any(
+		ddqb.Filter("env").Equal("prod"),
+		ddqb.Filter("env").Equal("staging"),
+	)
+
+	group2 := ddqb.Any(
+		ddqb.Filter("region").Equal("us-east-1"),
+		ddqb.Filter("region").Equal("us-west-2"),
+	)
 
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
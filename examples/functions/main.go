@@ -16,7 +16,7 @@ func main() {
 	fmt.Println("Example 1: Fill function with zero")
 	query, err := ddqb.Metric().
 		Metric("system.cpu.idle").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		Build()
 	if err != nil {
 		log.Fatalf("Failed to build query: %v", err)
@@ -60,7 +60,7 @@ func main() {
 	fmt.Println("Example 5: Multiple functions chained")
 	query, err = ddqb.Metric().
 		Metric("system.cpu.idle").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		ApplyFunction(ddqb.Function("rollup").WithArgs("60", "avg")).
 		ApplyFunction(ddqb.Function("moving_average").WithArg("5")).
 		Build()
@@ -78,7 +78,7 @@ func main() {
 		Filter(ddqb.Filter("host").Equal("web-1")).
 		Filter(ddqb.Filter("env").Equal("prod")).
 		GroupBy("host").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		ApplyFunction(ddqb.Function("rollup").WithArgs("60", "avg")).
 		Build()
 	if err != nil {
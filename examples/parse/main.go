@@ -32,7 +32,7 @@ func main() {
 
 	// Example 2: Parse a complex query and change time window
 	fmt.Println("\nExample 2: Parse a complex query and change time window")
-	query2 := "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(0)"
+	query2 := "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero)"
 	builder2, err := ddqb.FromQuery(query2)
 	if err != nil {
 		log.Fatalf("Failed to parse query: %v", err)
@@ -90,7 +90,7 @@ func main() {
 
 	// Example 5: Round-trip - parse, modify, and verify
 	fmt.Println("\nExample 5: Round-trip - parse, modify, and verify")
-	originalQuery := "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(0)"
+	originalQuery := "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(zero)"
 	builder5, err := ddqb.FromQuery(originalQuery)
 	if err != nil {
 		log.Fatalf("Failed to parse query: %v", err)
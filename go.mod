@@ -2,6 +2,8 @@ module github.com/jonwinton/ddqb
 
 go 1.23.5
 
-require github.com/jonwinton/ddqp v0.1.0
-
-require github.com/alecthomas/participle/v2 v2.1.4 // indirect
+require (
+	github.com/alecthomas/participle/v2 v2.1.4
+	github.com/jonwinton/ddqp v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,236 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Aggregation is the computation applied by a log analytics query.
+type Aggregation string
+
+const (
+	// Count counts matching logs.
+	Count Aggregation = "count"
+	// Cardinality counts the unique values of a facet.
+	Cardinality Aggregation = "cardinality"
+	// Sum sums a measure.
+	Sum Aggregation = "sum"
+	// Min takes the minimum of a measure.
+	Min Aggregation = "min"
+	// Max takes the maximum of a measure.
+	Max Aggregation = "max"
+	// Avg averages a measure.
+	Avg Aggregation = "avg"
+	// P50 takes the median of a measure.
+	P50 Aggregation = "pc50"
+	// P75 takes the 75th percentile of a measure.
+	P75 Aggregation = "pc75"
+	// P90 takes the 90th percentile of a measure.
+	P90 Aggregation = "pc90"
+	// P95 takes the 95th percentile of a measure.
+	P95 Aggregation = "pc95"
+	// P98 takes the 98th percentile of a measure.
+	P98 Aggregation = "pc98"
+	// P99 takes the 99th percentile of a measure.
+	P99 Aggregation = "pc99"
+)
+
+// knownAggregations lists the aggregations supported by Datadog log
+// analytics.
+var knownAggregations = map[Aggregation]bool{
+	Count: true, Cardinality: true, Sum: true, Min: true, Max: true, Avg: true,
+	P50: true, P75: true, P90: true, P95: true, P98: true, P99: true,
+}
+
+// intervalPattern matches a rollup interval such as 5m, 1h or 1d.
+var intervalPattern = regexp.MustCompile(`^[1-9][0-9]*[smhdw]$`)
+
+// LogAnalyticsBuilder provides a fluent interface for building log
+// analytics queries, which aggregate the logs matched by a search:
+//
+//	logs("service:web status:error").index("main").rollup("pc95", "@duration").by("host").last("5m")
+type LogAnalyticsBuilder interface {
+	// Search sets the log search selecting the logs to aggregate. Without
+	// one every log is aggregated.
+	Search(search LogQueryBuilder) LogAnalyticsBuilder
+
+	// Index restricts the query to the given log indexes.
+	Index(indexes ...string) LogAnalyticsBuilder
+
+	// RemoveIndex removes the given indexes from the query, e.g. to switch
+	// a parsed query to another index along with Index.
+	RemoveIndex(indexes ...string) LogAnalyticsBuilder
+
+	// Filter adds a facet, term or group expression to the search.
+	Filter(expr Expression) LogAnalyticsBuilder
+
+	// Count counts matching logs. This is the default aggregation.
+	Count() LogAnalyticsBuilder
+
+	// Cardinality counts the unique values of facet.
+	Cardinality(facet string) LogAnalyticsBuilder
+
+	// Aggregate applies agg to measure, e.g. Aggregate(log.P95, "@duration").
+	Aggregate(agg Aggregation, measure string) LogAnalyticsBuilder
+
+	// GroupBy groups the results by the given facets.
+	GroupBy(facets ...string) LogAnalyticsBuilder
+
+	// Last rolls the results up over interval (e.g. "5m", "1h").
+	Last(interval string) LogAnalyticsBuilder
+
+	// Build returns the built query as a string.
+	Build() (string, error)
+}
+
+// logAnalyticsBuilder is the concrete implementation of the
+// LogAnalyticsBuilder interface.
+type logAnalyticsBuilder struct {
+	search      LogQueryBuilder
+	indexes     []string
+	aggregation Aggregation
+	measure     string
+	groupBy     []string
+	interval    string
+}
+
+// NewLogAnalyticsBuilder creates a new log analytics query builder.
+func NewLogAnalyticsBuilder() LogAnalyticsBuilder {
+	return &logAnalyticsBuilder{
+		indexes:     make([]string, 0),
+		aggregation: Count,
+		groupBy:     make([]string, 0),
+	}
+}
+
+// Search sets the log search selecting the logs to aggregate.
+func (b *logAnalyticsBuilder) Search(search LogQueryBuilder) LogAnalyticsBuilder {
+	b.search = search
+	return b
+}
+
+// Index restricts the query to the given log indexes.
+func (b *logAnalyticsBuilder) Index(indexes ...string) LogAnalyticsBuilder {
+	b.indexes = append(b.indexes, indexes...)
+	return b
+}
+
+// RemoveIndex removes the given indexes from the query.
+func (b *logAnalyticsBuilder) RemoveIndex(indexes ...string) LogAnalyticsBuilder {
+	b.indexes = slices.DeleteFunc(b.indexes, func(index string) bool {
+		return slices.Contains(indexes, index)
+	})
+	return b
+}
+
+// Filter adds a facet, term or group expression to the search.
+func (b *logAnalyticsBuilder) Filter(expr Expression) LogAnalyticsBuilder {
+	if b.search == nil {
+		b.search = NewLogQueryBuilder()
+	}
+	b.search.Filter(expr)
+	return b
+}
+
+// Count counts matching logs.
+func (b *logAnalyticsBuilder) Count() LogAnalyticsBuilder {
+	return b.Aggregate(Count, "")
+}
+
+// Cardinality counts the unique values of facet.
+func (b *logAnalyticsBuilder) Cardinality(facet string) LogAnalyticsBuilder {
+	return b.Aggregate(Cardinality, facet)
+}
+
+// Aggregate applies agg to measure.
+func (b *logAnalyticsBuilder) Aggregate(agg Aggregation, measure string) LogAnalyticsBuilder {
+	b.aggregation = agg
+	b.measure = measure
+	return b
+}
+
+// GroupBy groups the results by the given facets.
+func (b *logAnalyticsBuilder) GroupBy(facets ...string) LogAnalyticsBuilder {
+	b.groupBy = append(b.groupBy, facets...)
+	return b
+}
+
+// Last rolls the results up over interval.
+func (b *logAnalyticsBuilder) Last(interval string) LogAnalyticsBuilder {
+	b.interval = interval
+	return b
+}
+
+// Build returns the built query as a string.
+func (b *logAnalyticsBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	search := "*"
+	if b.search != nil {
+		s, err := b.search.Build()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error building search: %w", err))
+		}
+		search = s
+	}
+
+	switch {
+	case !knownAggregations[b.aggregation]:
+		errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownAggregation, b.aggregation))
+	case b.aggregation != Count && b.measure == "":
+		errs = append(errs, fmt.Errorf("%w: %s", ErrMissingMeasure, b.aggregation))
+	case b.measure != "" && !facetKeyPattern.MatchString(b.measure):
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidFacetKey, b.measure))
+	}
+
+	for _, facet := range b.groupBy {
+		if !facetKeyPattern.MatchString(facet) {
+			errs = append(errs, fmt.Errorf("%w: group by %q", ErrInvalidFacetKey, facet))
+		}
+	}
+
+	if b.interval != "" && !intervalPattern.MatchString(b.interval) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidInterval, b.interval))
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("logs(")
+	writeQuoted(&sb, search)
+	sb.WriteByte(')')
+
+	if len(b.indexes) > 0 {
+		sb.WriteString(".index(")
+		writeQuoted(&sb, strings.Join(b.indexes, ","))
+		sb.WriteByte(')')
+	}
+
+	sb.WriteString(".rollup(")
+	writeQuoted(&sb, string(b.aggregation))
+	if b.measure != "" {
+		sb.WriteString(", ")
+		writeQuoted(&sb, b.measure)
+	}
+	sb.WriteByte(')')
+
+	if len(b.groupBy) > 0 {
+		sb.WriteString(".by(")
+		writeQuoted(&sb, strings.Join(b.groupBy, ","))
+		sb.WriteByte(')')
+	}
+
+	if b.interval != "" {
+		sb.WriteString(".last(")
+		writeQuoted(&sb, b.interval)
+		sb.WriteByte(')')
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,99 @@
+package log_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+func TestLogAnalyticsBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  log.LogAnalyticsBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "count of every log",
+			builder:  log.NewLogAnalyticsBuilder(),
+			expected: `logs("*").rollup("count")`,
+		},
+		{
+			name: "count grouped and rolled up",
+			builder: log.NewLogAnalyticsBuilder().
+				Search(log.NewLogQueryBuilder().Facet("service", "web").Facet("status", "error")).
+				Index("main").
+				Count().
+				GroupBy("host", "env").
+				Last("5m"),
+			expected: `logs("service:web status:error").index("main").rollup("count").by("host,env").last("5m")`,
+		},
+		{
+			name: "cardinality",
+			builder: log.NewLogAnalyticsBuilder().
+				Search(log.NewLogQueryBuilder().Facet("service", "checkout")).
+				Cardinality("@usr.id").
+				Last("1h"),
+			expected: `logs("service:checkout").rollup("cardinality", "@usr.id").last("1h")`,
+		},
+		{
+			name: "percentile of a measure",
+			builder: log.NewLogAnalyticsBuilder().
+				Search(log.NewLogQueryBuilder().Facet("service", "web")).
+				Aggregate(log.P95, "@duration").
+				GroupBy("@http.url_details.path"),
+			expected: `logs("service:web").rollup("pc95", "@duration").by("@http.url_details.path")`,
+		},
+		{
+			name: "quotes in the search are escaped",
+			builder: log.NewLogAnalyticsBuilder().
+				Search(log.NewLogQueryBuilder().Term("connection reset")).
+				Index("main", "audit"),
+			expected: `logs("\"connection reset\"").index("main,audit").rollup("count")`,
+		},
+		{
+			name:    "error - measure required",
+			builder: log.NewLogAnalyticsBuilder().Aggregate(log.Avg, ""),
+			wantErr: log.ErrMissingMeasure,
+		},
+		{
+			name:    "error - unknown aggregation",
+			builder: log.NewLogAnalyticsBuilder().Aggregate("median", "@duration"),
+			wantErr: log.ErrUnknownAggregation,
+		},
+		{
+			name:    "error - invalid group by facet",
+			builder: log.NewLogAnalyticsBuilder().GroupBy("host name"),
+			wantErr: log.ErrInvalidFacetKey,
+		},
+		{
+			name:    "error - invalid interval",
+			builder: log.NewLogAnalyticsBuilder().Last("five minutes"),
+			wantErr: log.ErrInvalidInterval,
+		},
+		{
+			name:    "error - invalid search",
+			builder: log.NewLogAnalyticsBuilder().Search(log.NewLogQueryBuilder().Term("")),
+			wantErr: log.ErrEmptyTerm,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package log
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the builders. Use errors.Is
+// to test for them.
+var (
+	// ErrEmptyFacetKey is returned when a facet is built without a key.
+	ErrEmptyFacetKey = errors.New("facet key is required")
+
+	// ErrInvalidFacetKey is returned when a facet key contains characters
+	// that cannot appear in a Datadog facet or tag name.
+	ErrInvalidFacetKey = errors.New("invalid facet key")
+
+	// ErrUnknownFacetOperation is returned when a facet is built before an
+	// operation (Equal, In, Matches, ...) has been selected.
+	ErrUnknownFacetOperation = errors.New("unknown facet operation")
+
+	// ErrMissingFacetValue is returned when a facet operation has no value,
+	// or an In or NotIn list contains an empty one.
+	ErrMissingFacetValue = errors.New("facet value is required")
+
+	// ErrEmptyTerm is returned when a free-text term is empty.
+	ErrEmptyTerm = errors.New("search term is required")
+
+	// ErrEmptyGroup is returned when a group has no expressions.
+	ErrEmptyGroup = errors.New("group must contain at least one expression")
+
+	// ErrUnknownAggregation is returned when an analytics query uses an
+	// aggregation Datadog does not support.
+	ErrUnknownAggregation = errors.New("unknown aggregation")
+
+	// ErrMissingMeasure is returned when an aggregation that needs a facet
+	// or measure (every one except count) is built without one.
+	ErrMissingMeasure = errors.New("aggregation requires a facet or measure")
+
+	// ErrInvalidInterval is returned when a rollup interval is not a
+	// duration such as "5m" or "1h".
+	ErrInvalidInterval = errors.New("invalid interval")
+
+	// ErrInvalidQuery is returned when a query being parsed is malformed
+	// or uses a function the builders do not support.
+	ErrInvalidQuery = errors.New("invalid log query")
+)
@@ -0,0 +1,53 @@
+package log
+
+import "strings"
+
+// specialChars are the characters with a meaning in Datadog log search
+// syntax. Values containing them, or whitespace, must be quoted or escaped.
+const specialChars = `+=&|><!(){}[]^"~*?:\/#,`
+
+// needsQuoting reports whether value must be quoted to be matched
+// literally. A leading '-' would otherwise read as an exclusion.
+func needsQuoting(value string) bool {
+	if strings.HasPrefix(value, "-") {
+		return true
+	}
+	return strings.ContainsAny(value, specialChars+" \t\r\n")
+}
+
+// writeValue renders a literal value into sb, quoting it only when
+// required.
+func writeValue(sb *strings.Builder, value string) {
+	if !needsQuoting(value) {
+		sb.WriteString(value)
+		return
+	}
+	writeQuoted(sb, value)
+}
+
+// writePattern renders a wildcard pattern into sb. '*' and '?' keep their
+// wildcard meaning; every other special character and whitespace is
+// escaped with a backslash, because quoting would disable the wildcards.
+func writePattern(sb *strings.Builder, pattern string) {
+	for i, c := range pattern {
+		switch {
+		case c == '*' || c == '?':
+		case strings.ContainsRune(specialChars, c), c == ' ', c == '\t', c == '-' && i == 0:
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// writeQuoted renders s into sb as a double-quoted argument, escaping
+// embedded backslashes and double quotes.
+func writeQuoted(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, c := range s {
+		if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('"')
+}
@@ -0,0 +1,177 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Expression is a common interface for every part of a log search query:
+// facets, free-text terms and groups.
+type Expression interface {
+	// Build returns the built expression as a string.
+	Build() (string, error)
+}
+
+// FacetOperation represents the type of facet comparison.
+type FacetOperation int
+
+const (
+	// Equal matches logs whose facet has a value (key:value).
+	Equal FacetOperation = iota
+	// NotEqual excludes logs whose facet has a value (-key:value).
+	NotEqual
+	// In matches logs whose facet has any of several values
+	// (key:(a OR b)).
+	In
+	// NotIn excludes logs whose facet has any of several values
+	// (-key:(a OR b)).
+	NotIn
+	// Matches matches logs whose facet matches a wildcard pattern
+	// (key:web-*).
+	Matches
+	// NotMatches excludes logs whose facet matches a wildcard pattern
+	// (-key:web-*).
+	NotMatches
+)
+
+// unsetOperation marks a facet whose operation has not been chosen yet.
+const unsetOperation FacetOperation = -1
+
+// facetKeyPattern matches a tag or facet name. Attribute facets are written
+// with a leading '@', e.g. @http.status_code.
+var facetKeyPattern = regexp.MustCompile(`^@?[a-zA-Z_][a-zA-Z0-9_\-./@]*$`)
+
+// FacetBuilder provides a fluent interface for building facet and tag
+// conditions. FacetBuilder implements Expression.
+type FacetBuilder interface {
+	Expression
+
+	// Equal matches logs whose facet has value (key:value).
+	Equal(value string) FacetBuilder
+
+	// NotEqual excludes logs whose facet has value (-key:value).
+	NotEqual(value string) FacetBuilder
+
+	// In matches logs whose facet has any of values (key:(a OR b)).
+	In(values ...string) FacetBuilder
+
+	// NotIn excludes logs whose facet has any of values (-key:(a OR b)).
+	NotIn(values ...string) FacetBuilder
+
+	// Matches matches logs whose facet matches a wildcard pattern, in
+	// which '*' matches any run of characters and '?' a single character.
+	Matches(pattern string) FacetBuilder
+
+	// NotMatches excludes logs whose facet matches a wildcard pattern.
+	NotMatches(pattern string) FacetBuilder
+}
+
+// facetBuilder is the concrete implementation of the FacetBuilder interface.
+type facetBuilder struct {
+	key       string
+	operation FacetOperation // Defaults to unsetOperation
+	values    []string
+}
+
+// NewFacetBuilder creates a new facet builder for key. Tags are given by
+// name (e.g. "service") and attributes with a leading '@' (e.g.
+// "@http.status_code").
+func NewFacetBuilder(key string) FacetBuilder {
+	return &facetBuilder{
+		key:       key,
+		operation: unsetOperation,
+		values:    make([]string, 0),
+	}
+}
+
+// Equal matches logs whose facet has value (key:value).
+func (b *facetBuilder) Equal(value string) FacetBuilder {
+	return b.set(Equal, value)
+}
+
+// NotEqual excludes logs whose facet has value (-key:value).
+func (b *facetBuilder) NotEqual(value string) FacetBuilder {
+	return b.set(NotEqual, value)
+}
+
+// In matches logs whose facet has any of values (key:(a OR b)).
+func (b *facetBuilder) In(values ...string) FacetBuilder {
+	return b.set(In, values...)
+}
+
+// NotIn excludes logs whose facet has any of values (-key:(a OR b)).
+func (b *facetBuilder) NotIn(values ...string) FacetBuilder {
+	return b.set(NotIn, values...)
+}
+
+// Matches matches logs whose facet matches a wildcard pattern.
+func (b *facetBuilder) Matches(pattern string) FacetBuilder {
+	return b.set(Matches, pattern)
+}
+
+// NotMatches excludes logs whose facet matches a wildcard pattern.
+func (b *facetBuilder) NotMatches(pattern string) FacetBuilder {
+	return b.set(NotMatches, pattern)
+}
+
+// set selects the operation and its values.
+func (b *facetBuilder) set(op FacetOperation, values ...string) FacetBuilder {
+	b.operation = op
+	b.values = values
+	return b
+}
+
+// Build returns the built facet condition as a string.
+func (b *facetBuilder) Build() (string, error) {
+	var sb strings.Builder
+	if err := b.appendTo(&sb); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the facet condition into sb.
+func (b *facetBuilder) appendTo(sb *strings.Builder) error {
+	if b.key == "" {
+		return ErrEmptyFacetKey
+	}
+	if !facetKeyPattern.MatchString(b.key) {
+		return fmt.Errorf("%w: %q", ErrInvalidFacetKey, b.key)
+	}
+	if b.operation == unsetOperation || b.operation > NotMatches {
+		return fmt.Errorf("%w: facet %q", ErrUnknownFacetOperation, b.key)
+	}
+	if len(b.values) == 0 {
+		return fmt.Errorf("%w: facet %q", ErrMissingFacetValue, b.key)
+	}
+	for _, v := range b.values {
+		if v == "" {
+			return fmt.Errorf("%w: facet %q", ErrMissingFacetValue, b.key)
+		}
+	}
+
+	switch b.operation {
+	case NotEqual, NotIn, NotMatches:
+		sb.WriteByte('-')
+	}
+	sb.WriteString(b.key)
+	sb.WriteByte(':')
+
+	switch b.operation {
+	case Equal, NotEqual:
+		writeValue(sb, b.values[0])
+	case Matches, NotMatches:
+		writePattern(sb, b.values[0])
+	case In, NotIn:
+		sb.WriteByte('(')
+		for i, v := range b.values {
+			if i > 0 {
+				sb.WriteString(" OR ")
+			}
+			writeValue(sb, v)
+		}
+		sb.WriteByte(')')
+	}
+	return nil
+}
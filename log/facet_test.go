@@ -0,0 +1,111 @@
+package log_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+func TestFacetBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  log.FacetBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "equal",
+			builder:  log.NewFacetBuilder("service").Equal("web"),
+			expected: "service:web",
+		},
+		{
+			name:     "attribute",
+			builder:  log.NewFacetBuilder("@http.status_code").Equal("500"),
+			expected: "@http.status_code:500",
+		},
+		{
+			name:     "not equal",
+			builder:  log.NewFacetBuilder("env").NotEqual("staging"),
+			expected: "-env:staging",
+		},
+		{
+			name:     "value with spaces is quoted",
+			builder:  log.NewFacetBuilder("@error.message").Equal(`connection "reset" by peer`),
+			expected: `@error.message:"connection \"reset\" by peer"`,
+		},
+		{
+			name:     "value with special characters is quoted",
+			builder:  log.NewFacetBuilder("@http.url").Equal("/api/v1?id=1"),
+			expected: `@http.url:"/api/v1?id=1"`,
+		},
+		{
+			name:     "in",
+			builder:  log.NewFacetBuilder("status").In("error", "warn"),
+			expected: "status:(error OR warn)",
+		},
+		{
+			name:     "not in",
+			builder:  log.NewFacetBuilder("env").NotIn("dev", "test"),
+			expected: "-env:(dev OR test)",
+		},
+		{
+			name:     "wildcard",
+			builder:  log.NewFacetBuilder("host").Matches("web-*"),
+			expected: "host:web-*",
+		},
+		{
+			name:     "wildcard escapes special characters",
+			builder:  log.NewFacetBuilder("@http.url").Matches("/api/*/users"),
+			expected: `@http.url:\/api\/*\/users`,
+		},
+		{
+			name:     "negated wildcard",
+			builder:  log.NewFacetBuilder("host").NotMatches("canary-?"),
+			expected: "-host:canary-?",
+		},
+		{
+			name:    "error - empty key",
+			builder: log.NewFacetBuilder("").Equal("web"),
+			wantErr: log.ErrEmptyFacetKey,
+		},
+		{
+			name:    "error - invalid key",
+			builder: log.NewFacetBuilder("service name").Equal("web"),
+			wantErr: log.ErrInvalidFacetKey,
+		},
+		{
+			name:    "error - no operation",
+			builder: log.NewFacetBuilder("service"),
+			wantErr: log.ErrUnknownFacetOperation,
+		},
+		{
+			name:    "error - empty value",
+			builder: log.NewFacetBuilder("service").Equal(""),
+			wantErr: log.ErrMissingFacetValue,
+		},
+		{
+			name:    "error - empty in list",
+			builder: log.NewFacetBuilder("service").In(),
+			wantErr: log.ErrMissingFacetValue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GroupOperator represents the boolean operator used in a group.
+type GroupOperator int
+
+const (
+	// AndOperator represents an AND operation between expressions.
+	AndOperator GroupOperator = iota
+	// OrOperator represents an OR operation between expressions.
+	OrOperator
+)
+
+// GroupBuilder provides a fluent interface for building groups of
+// expressions with boolean logic. GroupBuilder implements Expression.
+type GroupBuilder interface {
+	Expression
+
+	// And adds an expression or nested group with AND operator.
+	And(expr Expression) GroupBuilder
+
+	// Or adds an expression or nested group with OR operator.
+	Or(expr Expression) GroupBuilder
+
+	// Not negates the entire group (wraps in NOT (...)).
+	Not() GroupBuilder
+}
+
+// groupBuilder is the concrete implementation of the GroupBuilder interface.
+type groupBuilder struct {
+	expressions []Expression
+	operator    GroupOperator
+	negated     bool
+}
+
+// NewGroupBuilder creates a new group builder.
+func NewGroupBuilder() GroupBuilder {
+	return &groupBuilder{
+		expressions: make([]Expression, 0),
+		operator:    AndOperator, // Default to AND
+	}
+}
+
+// And adds an expression or nested group with AND operator.
+// Sets the group operator to AND if this is the first expression added.
+func (b *groupBuilder) And(expr Expression) GroupBuilder {
+	if len(b.expressions) == 0 {
+		b.operator = AndOperator
+	}
+	b.expressions = append(b.expressions, expr)
+	return b
+}
+
+// Or adds an expression or nested group with OR operator.
+// Sets the group operator to OR if this is the first expression added.
+func (b *groupBuilder) Or(expr Expression) GroupBuilder {
+	if len(b.expressions) == 0 {
+		b.operator = OrOperator
+	}
+	b.expressions = append(b.expressions, expr)
+	return b
+}
+
+// Not negates the entire group.
+func (b *groupBuilder) Not() GroupBuilder {
+	b.negated = true
+	return b
+}
+
+// Build returns the built group as a string with proper parentheses and
+// operators.
+func (b *groupBuilder) Build() (string, error) {
+	var sb strings.Builder
+	if err := b.appendTo(&sb); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the group into sb.
+func (b *groupBuilder) appendTo(sb *strings.Builder) error {
+	if len(b.expressions) == 0 {
+		return ErrEmptyGroup
+	}
+
+	if b.negated {
+		sb.WriteString("NOT ")
+	}
+
+	// Wrap in parentheses if there are multiple expressions, or if a
+	// negation applies to the whole group
+	wrap := len(b.expressions) > 1 || b.negated
+	if wrap {
+		sb.WriteByte('(')
+	}
+
+	opStr := " AND "
+	if b.operator == OrOperator {
+		opStr = " OR "
+	}
+
+	var errs []error
+	for i, expr := range b.expressions {
+		if i > 0 {
+			sb.WriteString(opStr)
+		}
+		if err := appendExpression(sb, expr); err != nil {
+			errs = append(errs, fmt.Errorf("error building group expression: %w", err))
+		}
+	}
+
+	if wrap {
+		sb.WriteByte(')')
+	}
+	return errors.Join(errs...)
+}
+
+// appender is implemented by expressions that can render directly into a
+// shared strings.Builder.
+type appender interface {
+	appendTo(sb *strings.Builder) error
+}
+
+// appendExpression renders expr into sb, falling back to Build for
+// expressions implemented outside this package.
+func appendExpression(sb *strings.Builder, expr Expression) error {
+	if expr == nil {
+		return errors.New("expression is nil")
+	}
+	if a, ok := expr.(appender); ok {
+		return a.appendTo(sb)
+	}
+	s, err := expr.Build()
+	if err != nil {
+		return err
+	}
+	sb.WriteString(s)
+	return nil
+}
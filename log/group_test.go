@@ -0,0 +1,82 @@
+package log_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+func TestGroupBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  log.GroupBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name: "or",
+			builder: log.NewGroupBuilder().
+				Or(log.NewFacetBuilder("service").Equal("web")).
+				Or(log.NewFacetBuilder("service").Equal("api")),
+			expected: "(service:web OR service:api)",
+		},
+		{
+			name: "and",
+			builder: log.NewGroupBuilder().
+				And(log.NewFacetBuilder("env").Equal("prod")).
+				And(log.NewTermBuilder("timeout")),
+			expected: "(env:prod AND timeout)",
+		},
+		{
+			name:     "single expression is not wrapped",
+			builder:  log.NewGroupBuilder().And(log.NewFacetBuilder("env").Equal("prod")),
+			expected: "env:prod",
+		},
+		{
+			name: "negated",
+			builder: log.NewGroupBuilder().
+				Or(log.NewFacetBuilder("status").Equal("info")).
+				Or(log.NewFacetBuilder("status").Equal("debug")).
+				Not(),
+			expected: "NOT (status:info OR status:debug)",
+		},
+		{
+			name: "nested",
+			builder: log.NewGroupBuilder().
+				And(log.NewFacetBuilder("env").Equal("prod")).
+				And(log.NewGroupBuilder().
+					Or(log.NewTermBuilder("timeout")).
+					Or(log.NewTermBuilder("connection refused"))),
+			expected: `(env:prod AND (timeout OR "connection refused"))`,
+		},
+		{
+			name:    "error - empty group",
+			builder: log.NewGroupBuilder(),
+			wantErr: log.ErrEmptyGroup,
+		},
+		{
+			name:    "error - invalid member",
+			builder: log.NewGroupBuilder().Or(log.NewFacetBuilder("")),
+			wantErr: log.ErrEmptyFacetKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
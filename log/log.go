@@ -0,0 +1,89 @@
+// Package log provides builders for creating Datadog log search queries.
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LogQueryBuilder provides a fluent interface for building log search
+// queries such as:
+//
+//	service:web env:prod status:error "connection timeout"
+//
+// Expressions are joined with spaces, which Datadog treats as AND.
+type LogQueryBuilder interface {
+	// Facet adds a facet or tag equality condition (key:value).
+	Facet(key, value string) LogQueryBuilder
+
+	// Term adds a free-text search term. Text containing whitespace is
+	// searched for as an exact phrase.
+	Term(text string) LogQueryBuilder
+
+	// Filter adds a facet, term or group expression.
+	Filter(expr Expression) LogQueryBuilder
+
+	// Build returns the built query as a string.
+	Build() (string, error)
+}
+
+// logQueryBuilder is the concrete implementation of the LogQueryBuilder
+// interface.
+type logQueryBuilder struct {
+	expressions []Expression
+}
+
+// NewLogQueryBuilder creates a new log search query builder.
+func NewLogQueryBuilder() LogQueryBuilder {
+	return &logQueryBuilder{
+		expressions: make([]Expression, 0),
+	}
+}
+
+// Facet adds a facet or tag equality condition (key:value).
+func (b *logQueryBuilder) Facet(key, value string) LogQueryBuilder {
+	return b.Filter(NewFacetBuilder(key).Equal(value))
+}
+
+// Term adds a free-text search term.
+func (b *logQueryBuilder) Term(text string) LogQueryBuilder {
+	return b.Filter(NewTermBuilder(text))
+}
+
+// Filter adds a facet, term or group expression.
+func (b *logQueryBuilder) Filter(expr Expression) LogQueryBuilder {
+	b.expressions = append(b.expressions, expr)
+	return b
+}
+
+// Build returns the built query as a string. A query without expressions
+// matches every log and is rendered as "*".
+func (b *logQueryBuilder) Build() (string, error) {
+	if len(b.expressions) == 0 {
+		return "*", nil
+	}
+
+	// Collect every problem rather than stopping at the first
+	var errs []error
+	var sb strings.Builder
+	for i, expr := range b.expressions {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		// A search kept as written may combine conditions of its own
+		if raw, ok := expr.(rawSearch); ok && len(b.expressions) > 1 && raw.compound() {
+			sb.WriteByte('(')
+			sb.WriteString(string(raw))
+			sb.WriteByte(')')
+			continue
+		}
+		if err := appendExpression(&sb, expr); err != nil {
+			errs = append(errs, fmt.Errorf("error building expression: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,89 @@
+package log_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+func TestLogQueryBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  log.LogQueryBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "empty query matches everything",
+			builder:  log.NewLogQueryBuilder(),
+			expected: "*",
+		},
+		{
+			name: "facets and term",
+			builder: log.NewLogQueryBuilder().
+				Facet("service", "web").
+				Facet("env", "prod").
+				Facet("status", "error").
+				Term("timeout"),
+			expected: "service:web env:prod status:error timeout",
+		},
+		{
+			name:     "phrase",
+			builder:  log.NewLogQueryBuilder().Term("connection timed out"),
+			expected: `"connection timed out"`,
+		},
+		{
+			name: "wildcard and excluded terms",
+			builder: log.NewLogQueryBuilder().
+				Filter(log.NewTermBuilder("time*").Wildcard()).
+				Filter(log.NewTermBuilder("healthcheck").Not()),
+			expected: "time* -healthcheck",
+		},
+		{
+			name: "literal term special characters are quoted",
+			builder: log.NewLogQueryBuilder().
+				Term("a*b"),
+			expected: `"a*b"`,
+		},
+		{
+			name: "boolean grouping",
+			builder: log.NewLogQueryBuilder().
+				Facet("env", "prod").
+				Filter(log.NewGroupBuilder().
+					Or(log.NewFacetBuilder("service").Equal("web")).
+					Or(log.NewFacetBuilder("service").Matches("api-*"))),
+			expected: "env:prod (service:web OR service:api-*)",
+		},
+		{
+			name:    "error - empty term",
+			builder: log.NewLogQueryBuilder().Term("  "),
+			wantErr: log.ErrEmptyTerm,
+		},
+		{
+			name: "error - all failures reported",
+			builder: log.NewLogQueryBuilder().
+				Facet("", "web").
+				Term(""),
+			wantErr: log.ErrEmptyTerm,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
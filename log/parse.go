@@ -0,0 +1,216 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseAnalyticsQuery parses a log analytics query such as
+//
+//	logs("service:web status:error").index("main").rollup("count").by("host").last("5m")
+//
+// into a builder that can be edited, e.g. to switch its indexes. The search
+// is kept as written; expressions added with Filter are combined with it.
+// Calls after logs(...) may appear in any order, each at most once.
+func ParseAnalyticsQuery(query string) (LogAnalyticsBuilder, error) {
+	calls, err := parseCalls(query)
+	if err != nil {
+		return nil, err
+	}
+	if calls[0].name != "logs" {
+		return nil, invalidQuery(query, calls[0].offset, "expected logs(...)")
+	}
+
+	b := NewLogAnalyticsBuilder().(*logAnalyticsBuilder)
+	if err := calls[0].expectArgs(query, 1, 1); err != nil {
+		return nil, err
+	}
+	if search := strings.TrimSpace(calls[0].args[0]); search != "" && search != "*" {
+		b.search = NewLogQueryBuilder().Filter(rawSearch(search))
+	}
+
+	seen := make(map[string]bool, len(calls))
+	for _, c := range calls[1:] {
+		if seen[c.name] {
+			return nil, invalidQuery(query, c.offset, fmt.Sprintf("%s(...) appears more than once", c.name))
+		}
+		seen[c.name] = true
+
+		switch c.name {
+		case "index":
+			if err := c.expectArgs(query, 1, 1); err != nil {
+				return nil, err
+			}
+			b.indexes = append(b.indexes, splitList(c.args[0])...)
+		case "rollup":
+			if err := c.expectArgs(query, 1, 2); err != nil {
+				return nil, err
+			}
+			b.aggregation = Aggregation(c.args[0])
+			if len(c.args) == 2 {
+				b.measure = c.args[1]
+			}
+		case "by":
+			if err := c.expectArgs(query, 1, 1); err != nil {
+				return nil, err
+			}
+			b.groupBy = append(b.groupBy, splitList(c.args[0])...)
+		case "last":
+			if err := c.expectArgs(query, 1, 1); err != nil {
+				return nil, err
+			}
+			b.interval = c.args[0]
+		default:
+			return nil, invalidQuery(query, c.offset, fmt.Sprintf("unknown function %s(...)", c.name))
+		}
+	}
+	return b, nil
+}
+
+// rawSearch is a log search kept as it was written, such as the search of
+// a parsed analytics query.
+type rawSearch string
+
+// Build returns the search as it was written.
+func (s rawSearch) Build() (string, error) {
+	return string(s), nil
+}
+
+// appendTo renders the search into sb.
+func (s rawSearch) appendTo(sb *strings.Builder) error {
+	sb.WriteString(string(s))
+	return nil
+}
+
+// compound reports whether the search may combine several conditions, and
+// must be parenthesized when other expressions are added to it.
+func (s rawSearch) compound() bool {
+	return strings.ContainsFunc(string(s), unicode.IsSpace)
+}
+
+// call is one call of a query written as a chain of calls with quoted
+// arguments, such as logs("*").index("main").
+type call struct {
+	name   string
+	args   []string
+	offset int
+}
+
+// expectArgs reports an error unless c has between least and most
+// arguments.
+func (c call) expectArgs(query string, least, most int) error {
+	if n := len(c.args); n < least || n > most {
+		want := fmt.Sprintf("%d to %d arguments", least, most)
+		if least == most {
+			want = fmt.Sprintf("%d argument", least)
+		}
+		return invalidQuery(query, c.offset, fmt.Sprintf("%s(...) takes %s, got %d", c.name, want, n))
+	}
+	return nil
+}
+
+// parseCalls splits query into its calls. It returns at least one call or
+// an error.
+func parseCalls(query string) ([]call, error) {
+	var calls []call
+	i := 0
+	skipSpace := func() {
+		for i < len(query) && unicode.IsSpace(rune(query[i])) {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if len(calls) > 0 {
+			if i == len(query) {
+				return calls, nil
+			}
+			if query[i] != '.' {
+				return nil, invalidQuery(query, i, "expected . or the end of the query")
+			}
+			i++
+			skipSpace()
+		}
+
+		start := i
+		for i < len(query) && (query[i] == '_' || query[i] == '-' || unicode.IsLetter(rune(query[i]))) {
+			i++
+		}
+		if i == start {
+			return nil, invalidQuery(query, i, "expected a function name")
+		}
+		c := call{name: query[start:i], offset: start}
+		skipSpace()
+		if i == len(query) || query[i] != '(' {
+			return nil, invalidQuery(query, i, "expected (")
+		}
+		i++
+
+		skipSpace()
+		if i < len(query) && query[i] == ')' {
+			i++
+			calls = append(calls, c)
+			continue
+		}
+		for {
+			skipSpace()
+			arg, n, ok := unquote(query[i:])
+			if !ok {
+				return nil, invalidQuery(query, i, "expected a double-quoted string")
+			}
+			c.args = append(c.args, arg)
+			i += n
+			skipSpace()
+			if i < len(query) && query[i] == ',' {
+				i++
+				continue
+			}
+			if i < len(query) && query[i] == ')' {
+				i++
+				break
+			}
+			return nil, invalidQuery(query, i, "expected , or )")
+		}
+		calls = append(calls, c)
+	}
+}
+
+// unquote reads the double-quoted string at the start of s, as written by
+// writeQuoted, returning its value and length.
+func unquote(s string) (string, int, bool) {
+	if s == "" || s[0] != '"' {
+		return "", 0, false
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return sb.String(), i + 1, true
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
+
+// splitList splits a comma-separated argument such as "host,env".
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// invalidQuery returns an error wrapping ErrInvalidQuery for a problem at
+// offset in query.
+func invalidQuery(query string, offset int, reason string) error {
+	return fmt.Errorf("%w: %s at offset %d of %q", ErrInvalidQuery, reason, offset, query)
+}
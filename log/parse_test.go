@@ -0,0 +1,105 @@
+package log_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+func TestParseAnalyticsQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(log.LogAnalyticsBuilder) log.LogAnalyticsBuilder
+		expected string
+	}{
+		{
+			name:     "unmodified",
+			query:    `logs("service:web status:error").index("main").rollup("count").by("host,env").last("5m")`,
+			expected: `logs("service:web status:error").index("main").rollup("count").by("host,env").last("5m")`,
+		},
+		{
+			name:     "measure and escaped quotes",
+			query:    `logs("\"connection reset\" service:web").rollup("pc95", "@duration").last("1h")`,
+			expected: `logs("\"connection reset\" service:web").rollup("pc95", "@duration").last("1h")`,
+		},
+		{
+			name:     "spacing and call order are normalized",
+			query:    `logs( "service:web" ) .last("5m").rollup("count") .index("main, audit")`,
+			expected: `logs("service:web").index("main,audit").rollup("count").last("5m")`,
+		},
+		{
+			name:     "without rollup",
+			query:    `logs("*")`,
+			expected: `logs("*").rollup("count")`,
+		},
+		{
+			name:  "switch index",
+			query: `logs("service:web").index("main").rollup("count").last("5m")`,
+			modify: func(b log.LogAnalyticsBuilder) log.LogAnalyticsBuilder {
+				return b.RemoveIndex("main").Index("archive")
+			},
+			expected: `logs("service:web").index("archive").rollup("count").last("5m")`,
+		},
+		{
+			name:  "filter a compound search",
+			query: `logs("service:web OR service:api").rollup("count").last("5m")`,
+			modify: func(b log.LogAnalyticsBuilder) log.LogAnalyticsBuilder {
+				return b.Filter(log.NewFacetBuilder("env").Equal("prod"))
+			},
+			expected: `logs("(service:web OR service:api) env:prod").rollup("count").last("5m")`,
+		},
+		{
+			name:  "filter every log",
+			query: `logs("*").rollup("count")`,
+			modify: func(b log.LogAnalyticsBuilder) log.LogAnalyticsBuilder {
+				return b.Filter(log.NewFacetBuilder("env").Equal("prod"))
+			},
+			expected: `logs("env:prod").rollup("count")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := log.ParseAnalyticsQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseAnalyticsQuery() error = %v", err)
+			}
+			if tt.modify != nil {
+				b = tt.modify(b)
+			}
+			got, err := b.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAnalyticsQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "empty", query: ""},
+		{name: "not a log query", query: `events("*").rollup("count")`},
+		{name: "unknown function", query: `logs("*").rollup("count").top("10")`},
+		{name: "repeated function", query: `logs("*").last("5m").last("10m")`},
+		{name: "unquoted argument", query: `logs(service:web)`},
+		{name: "unterminated string", query: `logs("service:web)`},
+		{name: "too many arguments", query: `logs("*").index("main", "audit")`},
+		{name: "trailing text", query: `logs("*").rollup("count") > 10`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := log.ParseAnalyticsQuery(tt.query); !errors.Is(err, log.ErrInvalidQuery) {
+				t.Errorf("ParseAnalyticsQuery(%q) error = %v, want %v", tt.query, err, log.ErrInvalidQuery)
+			}
+		})
+	}
+}
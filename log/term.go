@@ -0,0 +1,69 @@
+package log
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TermBuilder provides a fluent interface for building free-text search
+// terms. TermBuilder implements Expression.
+type TermBuilder interface {
+	Expression
+
+	// Wildcard treats '*' and '?' in the term as wildcards rather than
+	// matching them literally.
+	Wildcard() TermBuilder
+
+	// Not excludes logs containing the term (-term).
+	Not() TermBuilder
+}
+
+// termBuilder is the concrete implementation of the TermBuilder interface.
+type termBuilder struct {
+	text     string
+	wildcard bool
+	negated  bool
+}
+
+// NewTermBuilder creates a new free-text term. Text containing whitespace
+// is searched for as an exact phrase.
+func NewTermBuilder(text string) TermBuilder {
+	return &termBuilder{text: text}
+}
+
+// Wildcard treats '*' and '?' in the term as wildcards.
+func (b *termBuilder) Wildcard() TermBuilder {
+	b.wildcard = true
+	return b
+}
+
+// Not excludes logs containing the term.
+func (b *termBuilder) Not() TermBuilder {
+	b.negated = true
+	return b
+}
+
+// Build returns the built term as a string.
+func (b *termBuilder) Build() (string, error) {
+	var sb strings.Builder
+	if err := b.appendTo(&sb); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the term into sb.
+func (b *termBuilder) appendTo(sb *strings.Builder) error {
+	if strings.TrimFunc(b.text, unicode.IsSpace) == "" {
+		return ErrEmptyTerm
+	}
+	if b.negated {
+		sb.WriteByte('-')
+	}
+	if b.wildcard {
+		writePattern(sb, b.text)
+	} else {
+		writeValue(sb, b.text)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package metric
+
+import (
+	"strings"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// AnonymizedValue replaces every tag value in queries returned by
+// Anonymize. It is a bare identifier so that anonymized queries can still
+// be parsed.
+const AnonymizedValue = "redacted"
+
+// Anonymize returns query with every tag value replaced by AnonymizedValue
+// while keeping its structure: aggregators, time windows, metric names, tag
+// keys, comparison and boolean operators, group by keys, functions and
+// arithmetic are all preserved. Each value of an IN or NOT IN list is
+// replaced individually, so the list length is kept.
+//
+// The result is suitable for reporting query shapes to telemetry without
+// leaking hostnames or customer identifiers. Queries that cannot be parsed
+// return a *ParseError.
+func Anonymize(query string) (string, error) {
+	timeWindow, cleaned := extractAndRemoveTimeWindow(query)
+	parsed, err := parseGeneric(cleaned)
+	if err != nil {
+		// An agg(window): prefix may apply to a whole expression
+		w := splitWindowedExpression(query)
+		if w == nil {
+			return "", newParseError(query, cleaned, err)
+		}
+		return w.aggregator + "(" + w.window + "):" + anonymizeParsed(w.parsed), nil
+	}
+	anonymized := anonymizeParsed(parsed)
+
+	// The cleaned query starts with "agg:", so the first colon is the
+	// aggregator separator the time window was removed from
+	if timeWindow != "" {
+		anonymized = strings.Replace(anonymized, ":", "("+timeWindow+"):", 1)
+	}
+	return anonymized, nil
+}
+
+// anonymizeParsed anonymizes parsed and returns it as a query.
+func anonymizeParsed(parsed *ddqp.GenericQuery) string {
+	switch {
+	case parsed.MetricQuery != nil:
+		anonymizeMetricQuery(parsed.MetricQuery)
+		return parsed.MetricQuery.String()
+	case parsed.MetricExpression != nil:
+		anonymizeGroupedExpression(parsed.MetricExpression.GroupedExpression)
+		return parsed.MetricExpression.String()
+	}
+	return ""
+}
+
+// anonymizeGroupedExpression anonymizes every metric query in ge.
+func anonymizeGroupedExpression(ge *ddqp.GroupedExpression) {
+	if ge == nil {
+		return
+	}
+	anonymizeTerm(ge.Left)
+	for _, rt := range ge.Right {
+		if rt != nil {
+			anonymizeTerm(rt.Term)
+		}
+	}
+}
+
+// anonymizeTerm anonymizes every metric query in t.
+func anonymizeTerm(t *ddqp.Term) {
+	if t == nil || t.Left == nil {
+		return
+	}
+	anonymizeExprValue(t.Left.Base)
+	for _, of := range t.Right {
+		if of != nil && of.Factor != nil {
+			anonymizeExprValue(of.Factor.Base)
+		}
+	}
+}
+
+// anonymizeExprValue anonymizes every metric query in v.
+func anonymizeExprValue(v *ddqp.ExprValue) {
+	switch {
+	case v == nil:
+	case v.Subexpression != nil:
+		anonymizeGroupedExpression(v.Subexpression.GroupedExpression)
+	case v.MetricQuery != nil:
+		anonymizeMetricQuery(v.MetricQuery)
+	case v.ExprAggregatorFuction != nil:
+		anonymizeGroupedExpression(v.ExprAggregatorFuction.Body)
+	}
+}
+
+// anonymizeMetricQuery anonymizes the filters of mq, descending through
+// any wrapping aggregator functions.
+func anonymizeMetricQuery(mq *ddqp.MetricQuery) {
+	for mq != nil {
+		if mq.Query != nil {
+			if f := mq.Query.Filters; f != nil {
+				anonymizeParam(f.Left)
+				anonymizeParams(f.Parameters)
+			}
+			return
+		}
+		if mq.AggregatorFuction == nil {
+			return
+		}
+		mq = mq.AggregatorFuction.Body
+	}
+}
+
+// anonymizeParams anonymizes each filter operand in params.
+func anonymizeParams(params []*ddqp.Param) {
+	for _, p := range params {
+		anonymizeParam(p)
+	}
+}
+
+// anonymizeParam replaces the values of a simple filter, or of every filter
+// in a group, with AnonymizedValue.
+func anonymizeParam(p *ddqp.Param) {
+	switch {
+	case p == nil:
+	case p.GroupedFilter != nil:
+		anonymizeParams(p.GroupedFilter.Parameters)
+	case p.SimpleFilter != nil && p.SimpleFilter.FilterValue != nil:
+		fv := p.SimpleFilter.FilterValue
+		if fv.SimpleValue != nil {
+			fv.SimpleValue = anonymizedValue()
+		}
+		for i, v := range fv.ListValue {
+			if v != nil && v.Separator == nil {
+				fv.ListValue[i] = anonymizedValue()
+			}
+		}
+	}
+}
+
+// anonymizedValue returns a fresh ddqp.Value holding AnonymizedValue.
+func anonymizedValue() *ddqp.Value {
+	v := AnonymizedValue
+	return &ddqp.Value{Identifier: &v}
+}
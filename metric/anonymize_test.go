@@ -0,0 +1,91 @@
+package metric_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb"
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestAnonymize(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "simple filters",
+			query:    "avg:system.cpu.idle{host:web-1,!env:prod}",
+			expected: "avg:system.cpu.idle{host:redacted, !env:redacted}",
+		},
+		{
+			name:     "no filters",
+			query:    "sum:requests{*}",
+			expected: "sum:requests{*}",
+		},
+		{
+			name:     "time window, grouping and functions are kept",
+			query:    "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(zero)",
+			expected: "avg(5m):system.cpu.idle{host:redacted} by {host}.fill(zero)",
+		},
+		{
+			name:     "IN list keeps its length",
+			query:    "avg:system.cpu.idle{host IN (web-1,web-2), env NOT IN (dev)}",
+			expected: "avg:system.cpu.idle{host IN (redacted, redacted), env NOT IN (redacted)}",
+		},
+		{
+			name:     "grouped boolean filters",
+			query:    "avg:system.cpu.idle{(host:a OR host:b) AND env:prod}",
+			expected: "avg:system.cpu.idle{(host:redacted OR host:redacted) AND env:redacted}",
+		},
+		{
+			name:     "quoted, numeric and wildcard values",
+			query:    `avg:http.requests{url:"https://example.com/a b", status:>500, host:web-*}`,
+			expected: "avg:http.requests{url:redacted, status:>redacted, host:redacted}",
+		},
+		{
+			name:     "expression",
+			query:    "sum:errors{service:checkout} / sum:hits{service:checkout} * 100",
+			expected: "sum:errors{service:redacted} / sum:hits{service:redacted} * 100",
+		},
+		{
+			name:     "time window over an expression",
+			query:    "avg(5m):sum:errors{env:prod} / sum:hits{*}",
+			expected: "avg(5m):sum:errors{env:redacted} / sum:hits{*}",
+		},
+		{
+			name:     "last_ time window over a metric query with its own aggregator",
+			query:    "avg(last_5m):sum:errors{host:web-1} by {host}",
+			expected: "avg(last_5m):sum:errors{host:redacted} by {host}",
+		},
+		{
+			name:    "error - invalid query",
+			query:   "avg:system.cpu.idle{",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ddqb.Anonymize(tt.query)
+			if tt.wantErr {
+				var parseErr *metric.ParseError
+				if !errors.As(err, &parseErr) {
+					t.Errorf("expected *ParseError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+			if _, err := metric.ParseQuery(got); err != nil {
+				t.Errorf("anonymized query does not parse: %v", err)
+			}
+		})
+	}
+}
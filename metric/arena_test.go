@@ -0,0 +1,60 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestArena(t *testing.T) {
+	build := func(a *metric.Arena, host string) (string, error) {
+		return a.Metric().
+			Aggregator("avg").
+			TimeWindow("5m").
+			Metric("system.cpu.idle").
+			Filter(a.Filter("host").Equal(host)).
+			Filter(a.FilterGroup().
+				Or(a.Filter("env").Equal("prod")).
+				Or(a.Filter("env").Equal("staging"))).
+			GroupBy("host").
+			ApplyFunction(a.Function("rollup").WithArgs("60", "avg")).
+			Build()
+	}
+
+	// Build repeatedly so that later iterations reuse released builders and
+	// would expose any state leaking between queries.
+	for i, host := range []string{"web-1", "web-2", "web-3"} {
+		a := metric.NewArena()
+		got, err := build(a, host)
+		a.Release()
+		if err != nil {
+			t.Fatalf("iteration %d: unexpected error: %v", i, err)
+		}
+		expected := "avg(5m):system.cpu.idle{(host:" + host + " AND (env:prod OR env:staging))} by {host}.rollup(60, avg)"
+		if got != expected {
+			t.Errorf("iteration %d: got %q, want %q", i, got, expected)
+		}
+	}
+}
+
+func TestArenaReleasedBuildersStartEmpty(t *testing.T) {
+	a := metric.NewArena()
+	_, _ = a.Metric().Metric("system.cpu.idle").GroupBy("host").Build()
+	_, _ = a.Filter("host").In("a", "b").Build()
+	a.Release()
+
+	a = metric.NewArena()
+	defer a.Release()
+
+	got, err := a.Metric().Metric("system.mem.used").Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "system.mem.used{*}" {
+		t.Errorf("got %q, want %q", got, "system.mem.used{*}")
+	}
+
+	if _, err := a.Filter("host").Build(); err == nil {
+		t.Error("expected error building filter with no operation")
+	}
+}
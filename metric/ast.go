@@ -0,0 +1,165 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QueryAST is the structured representation of a query emitted by
+// ToASTJSON, for consumption by tools outside Go such as UIs and policy
+// engines.
+type QueryAST struct {
+	// Type is "query" for structured metric queries and "expression" for
+	// metric expressions, which are kept as their source text.
+	Type       string        `json:"type"`
+	Aggregator string        `json:"aggregator,omitempty"`
+	TimeWindow string        `json:"time_window,omitempty"`
+	Metric     string        `json:"metric,omitempty"`
+	Filters    []FilterAST   `json:"filters"`
+	GroupBy    []string      `json:"group_by"`
+	Functions  []FunctionAST `json:"functions"`
+	// Wrappers holds the wrapping functions, innermost first.
+	Wrappers []FunctionAST `json:"wrappers,omitempty"`
+	// Expression holds the source text of a metric expression.
+	Expression string `json:"expression,omitempty"`
+}
+
+// FilterAST is the structured representation of a filter or filter group.
+type FilterAST struct {
+	// Type is "filter" or "group".
+	Type string `json:"type"`
+	// Key is the tag key of a filter.
+	Key string `json:"key,omitempty"`
+	// Operator is "equal", "not_equal", "in" or "not_in" for filters and
+	// "and" or "or" for groups.
+	Operator string `json:"operator"`
+	// Values holds the values of a filter.
+	Values []string `json:"values,omitempty"`
+	// Negated reports whether a group is wrapped in NOT.
+	Negated bool `json:"negated,omitempty"`
+	// Expressions holds the members of a group.
+	Expressions []FilterAST `json:"expressions,omitempty"`
+	// Operators holds, for a group with ordered operators, "and" or "or"
+	// for each expression: the operator joining it to the one before it.
+	// The first entry is empty.
+	Operators []string `json:"operators,omitempty"`
+}
+
+// FunctionAST is the structured representation of an applied function.
+type FunctionAST struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// filterOperationNames maps filter operations to their AST names.
+var filterOperationNames = map[FilterOperation]string{
+	Equal:    "equal",
+	NotEqual: "not_equal",
+	In:       "in",
+	NotIn:    "not_in",
+
+	GreaterThan:    "greater_than",
+	GreaterOrEqual: "greater_or_equal",
+	LessThan:       "less_than",
+	LessOrEqual:    "less_or_equal",
+	Regex:          "regex",
+	NotRegex:       "not_regex",
+	Exists:         "exists",
+	NotExists:      "not_exists",
+}
+
+// ToAST returns the structured representation of the query. The query is
+// built first so that invalid queries are reported rather than exported.
+func (b *metricQueryBuilder) ToAST() (*QueryAST, error) {
+	if _, err := b.Build(); err != nil {
+		return nil, err
+	}
+
+	ast := &QueryAST{
+		Type:       "query",
+		Aggregator: b.aggregator,
+		TimeWindow: b.timeWindow,
+		Metric:     b.metric,
+		Filters:    make([]FilterAST, 0, len(b.filters)),
+		GroupBy:    append(make([]string, 0, len(b.groupBy)), b.groupByKeys()...),
+		Functions:  make([]FunctionAST, 0, len(b.functions)),
+	}
+	for _, f := range b.scopedFilters() {
+		fa, err := filterToAST(f)
+		if err != nil {
+			return nil, err
+		}
+		ast.Filters = append(ast.Filters, fa)
+	}
+	for _, fn := range b.functions {
+		impl, ok := fn.(*functionBuilder)
+		if !ok {
+			return nil, fmt.Errorf("unsupported function type %T", fn)
+		}
+		ast.Functions = append(ast.Functions, FunctionAST{
+			Name: impl.name,
+			Args: append(make([]string, 0, len(impl.args)), impl.args...),
+		})
+	}
+	for _, w := range b.wrappers {
+		impl, ok := wrapperImpl(w)
+		if !ok {
+			return nil, fmt.Errorf("unsupported wrapper type %T", w)
+		}
+		ast.Wrappers = append(ast.Wrappers, FunctionAST{
+			Name: impl.name,
+			Args: append(make([]string, 0, len(impl.args)), impl.args...),
+		})
+	}
+	return ast, nil
+}
+
+// ToASTJSON returns the structured representation of the query as JSON.
+func (b *metricQueryBuilder) ToASTJSON() ([]byte, error) {
+	ast, err := b.ToAST()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ast)
+}
+
+// filterToAST converts expr into its structured representation.
+func filterToAST(expr FilterExpression) (FilterAST, error) {
+	switch e := expr.(type) {
+	case *filterBuilder:
+		return FilterAST{
+			Type:     "filter",
+			Key:      e.key,
+			Operator: filterOperationNames[e.operation],
+			Values:   append(make([]string, 0, len(e.values)), e.values...),
+		}, nil
+	case *filterGroupBuilder:
+		op := "and"
+		if e.operator == OrOperator {
+			op = "or"
+		}
+		ga := FilterAST{
+			Type:        "group",
+			Operator:    op,
+			Negated:     e.negated,
+			Expressions: make([]FilterAST, 0, len(e.expressions)),
+		}
+		for i, nested := range e.expressions {
+			na, err := filterToAST(nested)
+			if err != nil {
+				return FilterAST{}, err
+			}
+			ga.Expressions = append(ga.Expressions, na)
+			if e.ops != nil {
+				op := ""
+				if i > 0 {
+					op = strings.ToLower(e.ops[i].String())
+				}
+				ga.Operators = append(ga.Operators, op)
+			}
+		}
+		return ga, nil
+	}
+	return FilterAST{}, fmt.Errorf("unsupported filter expression type %T", expr)
+}
@@ -0,0 +1,96 @@
+package metric_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestToASTJSON(t *testing.T) {
+	builder := metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		TimeWindow("5m").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("env").In("prod", "staging")).
+		Filter(metric.NewFilterGroupBuilder().
+			Or(metric.NewFilterBuilder("host").Equal("web-1")).
+			Or(metric.NewFilterBuilder("host").NotEqual("web-2")).
+			Not()).
+		GroupBy("host").
+		ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("avg", "60"))
+
+	got, err := builder.ToASTJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"type":"query","aggregator":"avg","time_window":"5m","metric":"system.cpu.idle",` +
+		`"filters":[{"type":"filter","key":"env","operator":"in","values":["prod","staging"]},` +
+		`{"type":"group","operator":"or","negated":true,"expressions":[` +
+		`{"type":"filter","key":"host","operator":"equal","values":["web-1"]},` +
+		`{"type":"filter","key":"host","operator":"not_equal","values":["web-2"]}]}],` +
+		`"group_by":["host"],"functions":[{"name":"rollup","args":["avg","60"]}]}`
+	if string(got) != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", got, expected)
+	}
+
+	var ast metric.QueryAST
+	if err := json.Unmarshal(got, &ast); err != nil {
+		t.Fatalf("output does not unmarshal into QueryAST: %v", err)
+	}
+	if ast.Metric != "system.cpu.idle" || len(ast.Filters[1].Expressions) != 2 {
+		t.Errorf("unexpected decoded AST: %+v", ast)
+	}
+}
+
+func TestToASTJSONEmptyQuery(t *testing.T) {
+	got, err := metric.NewMetricQueryBuilder().Metric("system.load.1").ToASTJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"type":"query","metric":"system.load.1","filters":[],"group_by":[],"functions":[]}`
+	if string(got) != expected {
+		t.Errorf("got %s, want %s", got, expected)
+	}
+}
+
+func TestToASTJSONOrderedOperators(t *testing.T) {
+	builder, err := metric.ParseQuery("system.cpu.idle{env:prod AND host:a OR host:b}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ast, err := builder.ToAST()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := ast.Filters[0].Operators
+	if len(got) != 3 || got[0] != "" || got[1] != "and" || got[2] != "or" {
+		t.Errorf("Operators = %q, want [\"\" \"and\" \"or\"]", got)
+	}
+}
+
+func TestToASTJSONExpression(t *testing.T) {
+	builder, err := metric.ParseQuery("sum:a{*} / sum:b{*}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := builder.ToASTJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ast metric.QueryAST
+	if err := json.Unmarshal(got, &ast); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ast.Type != "expression" || ast.Expression != "sum:a{*} / sum:b{*}" {
+		t.Errorf("unexpected expression AST: %s", got)
+	}
+}
+
+func TestToASTJSONInvalid(t *testing.T) {
+	if _, err := metric.NewMetricQueryBuilder().Aggregator("avg").ToASTJSON(); err == nil {
+		t.Error("expected error for query without metric")
+	}
+}
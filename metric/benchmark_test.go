@@ -0,0 +1,130 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func BenchmarkBuildSimple(b *testing.B) {
+	builder := metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.cpu.idle")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildComplex(b *testing.B) {
+	builder := metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		TimeWindow("5m").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		Filter(metric.NewFilterBuilder("region").In("us-east-1", "us-west-2", "eu-west-1")).
+		Filter(metric.NewFilterBuilder("service").NotEqual("canary")).
+		GroupBy("host", "env").
+		ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
+		ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("60", "avg"))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildFilterGroups(b *testing.B) {
+	inner := metric.NewFilterGroupBuilder().
+		Or(metric.NewFilterBuilder("host").Equal("web-1")).
+		Or(metric.NewFilterBuilder("host").Equal("web-2"))
+	builder := metric.NewMetricQueryBuilder().
+		Aggregator("sum").
+		Metric("requests.count").
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		Filter(inner).
+		GroupBy("host")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseQuery(b *testing.B) {
+	query := "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero).rollup(60,avg)"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := metric.ParseQuery(query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseAndBuild(b *testing.B) {
+	query := "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero).rollup(60,avg)"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder, err := metric.ParseQuery(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildComplexArena(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		a := metric.NewArena()
+		_, err := a.Metric().
+			Aggregator("avg").
+			TimeWindow("5m").
+			Metric("system.cpu.idle").
+			Filter(a.Filter("host").Equal("web-1")).
+			Filter(a.Filter("env").Equal("prod")).
+			Filter(a.Filter("region").In("us-east-1", "us-west-2", "eu-west-1")).
+			Filter(a.Filter("service").NotEqual("canary")).
+			GroupBy("host", "env").
+			ApplyFunction(a.Function("fill").WithArg("zero")).
+			ApplyFunction(a.Function("rollup").WithArgs("60", "avg")).
+			Build()
+		a.Release()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConstructAndBuildComplex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := metric.NewMetricQueryBuilder().
+			Aggregator("avg").
+			TimeWindow("5m").
+			Metric("system.cpu.idle").
+			Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+			Filter(metric.NewFilterBuilder("env").Equal("prod")).
+			Filter(metric.NewFilterBuilder("region").In("us-east-1", "us-west-2", "eu-west-1")).
+			Filter(metric.NewFilterBuilder("service").NotEqual("canary")).
+			GroupBy("host", "env").
+			ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
+			ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("60", "avg")).
+			Build()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
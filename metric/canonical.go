@@ -0,0 +1,208 @@
+package metric
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// canonNode is a node in the canonical boolean form of a filter.
+// A node is either a leaf comparison, a negation of a single child,
+// or an AND/OR of its children.
+type canonNode struct {
+	op   string // "", "NOT", "AND" or "OR"
+	leaf string
+	kids []*canonNode
+}
+
+// String renders the node. Children of AND/OR are sorted so that operand
+// order does not affect the result.
+func (n *canonNode) String() string {
+	switch n.op {
+	case "":
+		return n.leaf
+	case "NOT":
+		return "NOT(" + n.kids[0].String() + ")"
+	}
+	parts := make([]string, len(n.kids))
+	for i, k := range n.kids {
+		parts[i] = k.String()
+	}
+	sort.Strings(parts)
+	return n.op + "(" + strings.Join(parts, "; ") + ")"
+}
+
+// canonicalFilter renders a ddqp filter as a canonical boolean expression so
+// that semantically identical filters compare equal regardless of spacing,
+// comma vs AND notation, redundant parentheses, operand order, or whether a
+// negation was written as "!key:value" or "NOT key:value".
+//
+// AND binds more tightly than OR, matching Datadog's evaluation order.
+func canonicalFilter(mf *ddqp.MetricFilter) string {
+	if mf == nil {
+		return "*"
+	}
+	params := make([]*ddqp.Param, 0, len(mf.Parameters)+1)
+	if mf.Left != nil {
+		params = append(params, mf.Left)
+	}
+	params = append(params, mf.Parameters...)
+	return canonicalParams(params).String()
+}
+
+// canonicalParams canonicalizes a flat list of operands and separators.
+func canonicalParams(params []*ddqp.Param) *canonNode {
+	// Each inner slice is a conjunction; the outer slice is a disjunction.
+	var disjuncts [][]*canonNode
+	var current []*canonNode
+	negateNext := false
+
+	for _, p := range params {
+		if p == nil {
+			continue
+		}
+
+		if p.Separator != nil {
+			sep := p.Separator
+			switch {
+			case sep.Or:
+				disjuncts = append(disjuncts, current)
+				current = nil
+			case sep.OrNot:
+				disjuncts = append(disjuncts, current)
+				current = nil
+				negateNext = true
+			case sep.AndNot, sep.Not:
+				negateNext = true
+			}
+			// Commas and AND continue the current conjunction
+			continue
+		}
+
+		operand := canonicalOperand(p)
+		if operand == nil {
+			continue
+		}
+		if negateNext {
+			operand = canonicalNot(operand)
+			negateNext = false
+		}
+		current = append(current, operand)
+	}
+	disjuncts = append(disjuncts, current)
+
+	terms := make([]*canonNode, 0, len(disjuncts))
+	for _, conj := range disjuncts {
+		terms = append(terms, canonicalJoin("AND", conj))
+	}
+	return canonicalJoin("OR", terms)
+}
+
+// canonicalOperand canonicalizes a single filter operand.
+func canonicalOperand(p *ddqp.Param) *canonNode {
+	switch {
+	case p.Asterisk:
+		return &canonNode{leaf: "*"}
+	case p.GroupedFilter != nil:
+		return canonicalParams(p.GroupedFilter.Parameters)
+	case p.SimpleFilter != nil:
+		return canonicalSimpleFilter(p.SimpleFilter)
+	}
+	return nil
+}
+
+// canonicalSimpleFilter canonicalizes a key/value comparison.
+func canonicalSimpleFilter(sf *ddqp.SimpleFilter) *canonNode {
+	var sb strings.Builder
+	negated := sf.Negative
+	sb.WriteString(sf.FilterKey)
+
+	fs := sf.FilterSeparator
+	switch {
+	case fs == nil, fs.Colon:
+		sb.WriteString(":")
+	case fs.GreaterThan:
+		sb.WriteString(":>")
+	case fs.GreaterEqual:
+		sb.WriteString(":>=")
+	case fs.LessThan:
+		sb.WriteString(":<")
+	case fs.LessEqual:
+		sb.WriteString(":<=")
+	case fs.Regex:
+		sb.WriteString(":~")
+	case fs.In:
+		sb.WriteString(" IN ")
+	case fs.NotIn:
+		sb.WriteString(" IN ")
+		negated = !negated
+	default:
+		sb.WriteString(":")
+	}
+
+	if sf.FilterValue != nil {
+		if len(sf.FilterValue.ListValue) > 0 {
+			values := []string{}
+			for _, v := range sf.FilterValue.ListValue {
+				if s := extractValueString(v); s != "" {
+					values = append(values, formatValue(s))
+				}
+			}
+			sort.Strings(values)
+			sb.WriteString("(" + strings.Join(values, ",") + ")")
+		} else {
+			sb.WriteString(formatValue(extractValueString(sf.FilterValue.SimpleValue)))
+		}
+	}
+
+	leaf := &canonNode{leaf: sb.String()}
+	if negated {
+		return canonicalNot(leaf)
+	}
+	return leaf
+}
+
+// canonicalNot negates a canonical node, removing double negation.
+func canonicalNot(n *canonNode) *canonNode {
+	if n.op == "NOT" {
+		return n.kids[0]
+	}
+	return &canonNode{op: "NOT", kids: []*canonNode{n}}
+}
+
+// canonicalJoin combines operands with op, flattening nested operations of
+// the same kind, dropping wildcards from conjunctions, and removing
+// duplicates.
+func canonicalJoin(op string, operands []*canonNode) *canonNode {
+	seen := map[string]bool{}
+	flat := []*canonNode{}
+	for _, operand := range operands {
+		if operand == nil {
+			continue
+		}
+		parts := []*canonNode{operand}
+		if operand.op == op {
+			parts = operand.kids
+		}
+		for _, part := range parts {
+			// {*} matches everything and is the identity for AND
+			if op == "AND" && part.op == "" && part.leaf == "*" {
+				continue
+			}
+			key := part.String()
+			if !seen[key] {
+				seen[key] = true
+				flat = append(flat, part)
+			}
+		}
+	}
+
+	switch len(flat) {
+	case 0:
+		return &canonNode{leaf: "*"}
+	case 1:
+		return flat[0]
+	}
+	return &canonNode{op: op, kids: flat}
+}
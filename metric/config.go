@@ -0,0 +1,133 @@
+package metric
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Config selects how strictly query builders validate their input.
+// The zero value is lenient and matches the historical behavior of
+// accepting any aggregator, function, or tag key.
+type Config struct {
+	// ValidateAggregators restricts aggregators to the known Datadog
+	// space aggregators (avg, sum, min, max, count and percentiles).
+	ValidateAggregators bool
+
+	// ValidateFunctions restricts applied functions to the known Datadog
+	// function catalog.
+	ValidateFunctions bool
+
+	// ValidateTags checks that every filter key is a legal Datadog tag key.
+	ValidateTags bool
+
+	// FunctionOrder selects whether known-bad function orderings, such as
+	// fill after rollup, are ignored, reported as diagnostics or rejected.
+	FunctionOrder FunctionOrderCheck
+
+	// Validators are run, in order, against every successfully built
+	// query. Use BuildContext or ValidateContext to bound them with a
+	// deadline.
+	Validators []Validator
+
+	// Limits bounds the complexity of built queries.
+	Limits Limits
+}
+
+// StrictConfig returns a Config with every validation enabled.
+func StrictConfig() Config {
+	return Config{
+		ValidateAggregators: true,
+		ValidateFunctions:   true,
+		ValidateTags:        true,
+	}
+}
+
+// LenientConfig returns a Config with every validation disabled.
+func LenientConfig() Config {
+	return Config{}
+}
+
+// defaultConfig holds the package-level configuration used by builders
+// that have not been given their own via WithConfig.
+var defaultConfig atomic.Pointer[Config]
+
+func init() {
+	cfg := LenientConfig()
+	defaultConfig.Store(&cfg)
+}
+
+// SetDefaultConfig sets the package-level configuration used by builders
+// that have not been given their own via WithConfig.
+// It is safe to call concurrently with Build.
+func SetDefaultConfig(cfg Config) {
+	defaultConfig.Store(&cfg)
+}
+
+// DefaultConfig returns the current package-level configuration.
+func DefaultConfig() Config {
+	return *defaultConfig.Load()
+}
+
+// knownAggregators is the set of aggregators accepted in strict mode.
+var knownAggregators = map[string]bool{
+	"avg":   true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"count": true,
+	"p50":   true,
+	"p75":   true,
+	"p90":   true,
+	"p95":   true,
+	"p99":   true,
+}
+
+// validate checks the builder's components against cfg, returning every
+// violation joined into a single error.
+func (b *metricQueryBuilder) validate(cfg Config) error {
+	var errs []error
+
+	if cfg.ValidateAggregators && b.aggregator != "" && !knownAggregators[b.aggregator] {
+		errs = append(errs, &ValidationError{Component: "aggregator", Value: b.aggregator, Reason: "not a known Datadog aggregator"})
+	}
+
+	if cfg.ValidateFunctions {
+		for _, fn := range b.functions {
+			if impl, ok := fn.(*functionBuilder); ok && !isKnownFunction(impl.name) {
+				errs = append(errs, &ValidationError{Component: "function", Value: impl.name, Reason: "not a known Datadog function"})
+			}
+		}
+	}
+
+	if cfg.FunctionOrder == FunctionOrderError {
+		for _, issue := range b.functionOrderIssues() {
+			errs = append(errs, &ValidationError{Component: "function order", Value: issue.name, Reason: issue.reason})
+		}
+	}
+
+	if cfg.ValidateTags {
+		for _, filter := range b.scopedFilters() {
+			errs = append(errs, validateFilterKeys(filter)...)
+		}
+	}
+
+	errs = append(errs, b.checkLimits(cfg.Limits)...)
+
+	return errors.Join(errs...)
+}
+
+// validateFilterKeys checks every filter key in expr, recursing into groups.
+func validateFilterKeys(expr FilterExpression) []error {
+	var errs []error
+	switch e := expr.(type) {
+	case *filterBuilder:
+		if e.key != "" && !tagKeyPattern.MatchString(e.key) {
+			errs = append(errs, &ValidationError{Component: "filter key", Value: e.key, Reason: tagKeyRules})
+		}
+	case *filterGroupBuilder:
+		for _, nested := range e.expressions {
+			errs = append(errs, validateFilterKeys(nested)...)
+		}
+	}
+	return errs
+}
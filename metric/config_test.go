@@ -0,0 +1,162 @@
+package metric_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  metric.Config
+		build   func() metric.QueryBuilder
+		wantErr bool
+	}{
+		{
+			name:   "lenient accepts unknown aggregator",
+			config: metric.LenientConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("average").Metric("system.cpu.idle")
+			},
+			wantErr: false,
+		},
+		{
+			name:   "strict rejects unknown aggregator",
+			config: metric.StrictConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("average").Metric("system.cpu.idle")
+			},
+			wantErr: true,
+		},
+		{
+			name:   "strict accepts known aggregator",
+			config: metric.StrictConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("p95").Metric("request.latency")
+			},
+			wantErr: false,
+		},
+		{
+			name:   "strict rejects unknown function",
+			config: metric.StrictConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("fil").WithArg("0"))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "function validation only",
+			config: metric.Config{ValidateFunctions: true},
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("average").
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60"))
+			},
+			wantErr: false,
+		},
+		{
+			name:   "strict rejects invalid tag key in nested group",
+			config: metric.StrictConfig(),
+			build: func() metric.QueryBuilder {
+				group := metric.NewFilterGroupBuilder().
+					Or(metric.NewFilterBuilder("env").Equal("prod")).
+					Or(metric.NewFilterBuilder("1bad").Equal("x"))
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(group)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "function order error rejects fill after rollup",
+			config: metric.Config{FunctionOrder: metric.FunctionOrderError},
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg)).
+					ApplyFunction(metric.Fill(metric.FillZero))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "function order error accepts fill before rollup",
+			config: metric.Config{FunctionOrder: metric.FunctionOrderError},
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					AsCount().
+					ApplyFunction(metric.Fill(metric.FillZero)).
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg))
+			},
+			wantErr: false,
+		},
+		{
+			name:   "function order error rejects late as_count",
+			config: metric.Config{FunctionOrder: metric.FunctionOrderError},
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("trace.http.request.errors").
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupSum)).
+					ApplyFunction(metric.NewFunctionBuilder("as_count"))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "lenient ignores function order",
+			config: metric.LenientConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg)).
+					ApplyFunction(metric.Fill(metric.FillZero))
+			},
+			wantErr: false,
+		},
+		{
+			name:   "lenient accepts invalid tag key",
+			config: metric.LenientConfig(),
+			build: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("1bad").Equal("x"))
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.build().WithConfig(tt.config).Build()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	original := metric.DefaultConfig()
+	defer metric.SetDefaultConfig(original)
+
+	newBuilder := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().Aggregator("average").Metric("system.cpu.idle")
+	}
+
+	if _, err := newBuilder().Build(); err != nil {
+		t.Fatalf("Build() with lenient default error = %v", err)
+	}
+
+	metric.SetDefaultConfig(metric.StrictConfig())
+
+	if _, err := newBuilder().Build(); err == nil {
+		t.Error("Build() with strict default expected error, got nil")
+	}
+
+	// A per-builder config overrides the package default
+	if _, err := newBuilder().WithConfig(metric.LenientConfig()).Build(); err != nil {
+		t.Errorf("Build() with lenient override error = %v", err)
+	}
+}
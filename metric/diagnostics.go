@@ -0,0 +1,174 @@
+package metric
+
+import "fmt"
+
+// Severity ranks how likely a Diagnostic is to indicate a real mistake.
+type Severity int
+
+const (
+	// SeverityInfo marks an observation that is usually harmless.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks a query that will run but is probably not
+	// what was intended.
+	SeverityWarning
+)
+
+// String returns the lower-case name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Diagnostic codes reported by BuildWithDiagnostics. Codes are stable and
+// may be used to filter or suppress specific findings.
+const (
+	// DiagTimeWindowIgnored is reported when a time window is set without an
+	// aggregator; the window is dropped from the rendered query.
+	DiagTimeWindowIgnored = "time-window-ignored"
+
+	// DiagMissingAggregator is reported when no aggregator is set, so
+	// Datadog falls back to its default space aggregation.
+	DiagMissingAggregator = "missing-aggregator"
+
+	// DiagUnknownAggregator is reported in lenient mode for aggregators
+	// outside the known Datadog set.
+	DiagUnknownAggregator = "unknown-aggregator"
+
+	// DiagUnknownFunction is reported in lenient mode for functions outside
+	// the known Datadog catalog.
+	DiagUnknownFunction = "unknown-function"
+
+	// DiagDuplicateFilter is reported when the same filter is added twice.
+	DiagDuplicateFilter = "duplicate-filter"
+
+	// DiagContradictoryFilter is reported when a tag is both required and
+	// excluded with the same value, which matches nothing.
+	DiagContradictoryFilter = "contradictory-filter"
+
+	// DiagDuplicateGroupBy is reported when a group by key is repeated;
+	// the repeat is dropped from the rendered query.
+	DiagDuplicateGroupBy = "duplicate-group-by"
+
+	// DiagDuplicateFunction is reported when a function such as rollup is
+	// applied more than once, which is rarely intended.
+	DiagDuplicateFunction = "duplicate-function"
+
+	// DiagFunctionOrder is reported when Config.FunctionOrder is
+	// FunctionOrderWarn and functions are applied in a known-bad order,
+	// such as fill after rollup.
+	DiagFunctionOrder = "function-order"
+)
+
+// Diagnostic is a non-fatal finding about a query: something that will
+// build and run but is probably wrong.
+type Diagnostic struct {
+	// Severity ranks the finding.
+	Severity Severity
+	// Code identifies the kind of finding (one of the Diag* constants).
+	Code string
+	// Message describes the finding for display.
+	Message string
+}
+
+// String returns the diagnostic formatted as "severity [code]: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s [%s]: %s", d.Severity, d.Code, d.Message)
+}
+
+// BuildWithDiagnostics returns the built query together with any non-fatal
+// diagnostics. Diagnostics are reported even when err is non-nil so that
+// editors can show them alongside the build failure.
+func (b *metricQueryBuilder) BuildWithDiagnostics() (string, []Diagnostic, error) {
+	query, err := b.Build()
+	return query, b.diagnose(), err
+}
+
+// diagnose inspects the builder for likely mistakes that do not prevent
+// the query from building.
+func (b *metricQueryBuilder) diagnose() []Diagnostic {
+	var diags []Diagnostic
+	add := func(sev Severity, code, format string, args ...any) {
+		diags = append(diags, Diagnostic{Severity: sev, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	cfg := DefaultConfig()
+	if b.config != nil {
+		cfg = *b.config
+	}
+
+	if b.aggregator == "" {
+		if b.timeWindow != "" {
+			add(SeverityWarning, DiagTimeWindowIgnored, "time window %q has no effect without an aggregator", b.timeWindow)
+		}
+		add(SeverityInfo, DiagMissingAggregator, "no aggregator set; Datadog will apply its default")
+	} else if !cfg.ValidateAggregators && !knownAggregators[b.aggregator] {
+		add(SeverityWarning, DiagUnknownAggregator, "aggregator %q is not a known Datadog aggregator", b.aggregator)
+	}
+
+	// Compare top-level filters by rendered form so duplicates and
+	// contradictions are found regardless of how they were constructed.
+	seen := make(map[string]bool)
+	for _, filter := range b.scopedFilters() {
+		f, ok := filter.(*filterBuilder)
+		if !ok {
+			continue
+		}
+		rendered, err := f.Build()
+		if err != nil {
+			continue
+		}
+		if seen[rendered] {
+			add(SeverityWarning, DiagDuplicateFilter, "filter %s is applied more than once", rendered)
+			continue
+		}
+		seen[rendered] = true
+
+		if f.operation == NotEqual || f.operation == NotExists {
+			positive := rendered[1:]
+			if seen[positive] {
+				add(SeverityWarning, DiagContradictoryFilter, "filters %s and %s can never both match", positive, rendered)
+			}
+		} else if (f.operation == Equal || f.operation == Exists) && seen["!"+rendered] {
+			add(SeverityWarning, DiagContradictoryFilter, "filters %s and !%s can never both match", rendered, rendered)
+		}
+	}
+
+	groups := make(map[string]bool)
+	for _, key := range b.groupBy {
+		if groups[key] {
+			add(SeverityInfo, DiagDuplicateGroupBy, "group by key %q is repeated and rendered once", key)
+			continue
+		}
+		groups[key] = true
+	}
+
+	functions := make(map[string]bool)
+	for _, fn := range b.functions {
+		impl, ok := fn.(*functionBuilder)
+		if !ok || impl.name == "" {
+			continue
+		}
+		if !cfg.ValidateFunctions && !isKnownFunction(impl.name) {
+			add(SeverityWarning, DiagUnknownFunction, "function %q is not a known Datadog function", impl.name)
+		}
+		if functions[impl.name] {
+			add(SeverityWarning, DiagDuplicateFunction, "function %q is applied more than once", impl.name)
+			continue
+		}
+		functions[impl.name] = true
+	}
+
+	if cfg.FunctionOrder == FunctionOrderWarn {
+		for _, issue := range b.functionOrderIssues() {
+			add(SeverityWarning, DiagFunctionOrder, "function %q %s", issue.name, issue.reason)
+		}
+	}
+
+	return diags
+}
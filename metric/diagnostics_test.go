@@ -0,0 +1,146 @@
+package metric_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestBuildWithDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		expected []string // diagnostic codes, in order
+	}{
+		{
+			name: "clean query",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					TimeWindow("5m").
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+					GroupBy("host").
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("60", "avg"))
+			},
+			expected: nil,
+		},
+		{
+			name: "time window without aggregator",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					TimeWindow("5m").
+					Metric("system.cpu.idle")
+			},
+			expected: []string{metric.DiagTimeWindowIgnored, metric.DiagMissingAggregator},
+		},
+		{
+			name: "unknown aggregator and function",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("mean").
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("smooth"))
+			},
+			expected: []string{metric.DiagUnknownAggregator, metric.DiagUnknownFunction},
+		},
+		{
+			name: "duplicate filter",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+					Filter(metric.NewFilterBuilder("host").Equal("web-1"))
+			},
+			expected: []string{metric.DiagDuplicateFilter},
+		},
+		{
+			name: "contradictory filters",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("env").NotEqual("prod")).
+					Filter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: []string{metric.DiagContradictoryFilter},
+		},
+		{
+			name: "duplicate group by and function",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					GroupBy("host", "host").
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60")).
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("300"))
+			},
+			expected: []string{metric.DiagDuplicateGroupBy, metric.DiagDuplicateFunction},
+		},
+		{
+			name: "function order warning",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					WithConfig(metric.Config{FunctionOrder: metric.FunctionOrderWarn}).
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg)).
+					ApplyFunction(metric.Fill(metric.FillZero))
+			},
+			expected: []string{metric.DiagFunctionOrder},
+		},
+		{
+			name: "function order ignored by default",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg)).
+					ApplyFunction(metric.Fill(metric.FillZero))
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags, err := tt.builder().BuildWithDiagnostics()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(diags) != len(tt.expected) {
+				t.Fatalf("got diagnostics %v, want codes %v", diags, tt.expected)
+			}
+			for i, d := range diags {
+				if d.Code != tt.expected[i] {
+					t.Errorf("diagnostic %d: got code %q, want %q", i, d.Code, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildWithDiagnosticsReportsOnError(t *testing.T) {
+	query, diags, err := metric.NewMetricQueryBuilder().
+		TimeWindow("5m").
+		BuildWithDiagnostics()
+	if err == nil {
+		t.Fatal("expected error for missing metric")
+	}
+	if query != "" {
+		t.Errorf("expected empty query on error, got %q", query)
+	}
+	if len(diags) == 0 || diags[0].Code != metric.DiagTimeWindowIgnored {
+		t.Errorf("expected %s diagnostic alongside error, got %v", metric.DiagTimeWindowIgnored, diags)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	d := metric.Diagnostic{Severity: metric.SeverityWarning, Code: metric.DiagDuplicateFilter, Message: "filter host:a is applied more than once"}
+	expected := "warning [duplicate-filter]: filter host:a is applied more than once"
+	if d.String() != expected {
+		t.Errorf("got %q, want %q", d.String(), expected)
+	}
+}
@@ -0,0 +1,97 @@
+package metric
+
+import "github.com/jonwinton/ddqp"
+
+// DivisionGuard selects how WithSafeDivision protects the denominators of
+// divisions in metric expressions.
+type DivisionGuard int
+
+const (
+	// DivisionUnguarded leaves denominators as written.
+	DivisionUnguarded DivisionGuard = iota
+	// DivisionDefaultZero wraps each denominator in default_zero(), so that
+	// gaps in it evaluate rather than leaving gaps in the ratio.
+	DivisionDefaultZero
+	// DivisionClampMin wraps each denominator in clamp_min(..., 1), so that
+	// the ratio is never divided by zero.
+	DivisionClampMin
+)
+
+// WithSafeDivision guards the denominator of every division in a metric
+// expression with guard, e.g. sum:errors{*} / sum:hits{*} renders as
+// sum:errors{*} / default_zero(sum:hits{*}) with DivisionDefaultZero.
+// Numeric denominators and denominators already wrapped in the guard
+// function are left alone. It has no effect on single metric queries.
+func WithSafeDivision(guard DivisionGuard) BuildOption {
+	return func(o *buildOptions) {
+		o.divisionGuard = guard
+	}
+}
+
+// guardDivisions wraps every denominator in ge with guard.
+func guardDivisions(ge *ddqp.GroupedExpression, guard DivisionGuard) {
+	if ge == nil || guard == DivisionUnguarded {
+		return
+	}
+	guardTerm(ge.Left, guard)
+	for _, rt := range ge.Right {
+		if rt != nil {
+			guardTerm(rt.Term, guard)
+		}
+	}
+}
+
+// guardTerm wraps every denominator in t with guard.
+func guardTerm(t *ddqp.Term, guard DivisionGuard) {
+	if t == nil || t.Left == nil {
+		return
+	}
+	guardNested(t.Left.Base, guard)
+	for _, of := range t.Right {
+		if of == nil || of.Factor == nil {
+			continue
+		}
+		guardNested(of.Factor.Base, guard)
+		if of.Operator == ddqp.OpDiv {
+			of.Factor.Base = guardDenominator(of.Factor.Base, guard)
+		}
+	}
+}
+
+// guardNested guards the divisions inside subexpressions and function
+// bodies of v.
+func guardNested(v *ddqp.ExprValue, guard DivisionGuard) {
+	switch {
+	case v == nil:
+	case v.Subexpression != nil:
+		guardDivisions(v.Subexpression.GroupedExpression, guard)
+	case v.ExprAggregatorFuction != nil:
+		guardDivisions(v.ExprAggregatorFuction.Body, guard)
+	}
+}
+
+// guardDenominator returns v wrapped in the function selected by guard.
+func guardDenominator(v *ddqp.ExprValue, guard DivisionGuard) *ddqp.ExprValue {
+	name := "default_zero"
+	var args []*ddqp.Value
+	if guard == DivisionClampMin {
+		one := 1.0
+		name = "clamp_min"
+		args = []*ddqp.Value{{Number: &one}}
+	}
+
+	switch {
+	case v == nil || v.Number != nil:
+		return v
+	case v.ExprAggregatorFuction != nil && v.ExprAggregatorFuction.Name == name:
+		return v
+	}
+
+	// A parenthesized denominator becomes the body itself rather than
+	// gaining a second pair of parentheses
+	body := &ddqp.GroupedExpression{Left: &ddqp.Term{Left: &ddqp.Factor{Base: v}}}
+	if v.Subexpression != nil {
+		body = v.Subexpression.GroupedExpression
+	}
+	return &ddqp.ExprValue{ExprAggregatorFuction: &ddqp.ExpressionAggregatorFuction{Name: name, Body: body, Args: args}}
+}
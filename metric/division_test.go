@@ -0,0 +1,97 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestWithSafeDivision(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		guard    metric.DivisionGuard
+		expected string
+	}{
+		{
+			name:     "unguarded",
+			query:    "sum:errors{*} / sum:hits{*}",
+			guard:    metric.DivisionUnguarded,
+			expected: "sum:errors{*} / sum:hits{*}",
+		},
+		{
+			name:     "default zero",
+			query:    "sum:errors{*} / sum:hits{*}",
+			guard:    metric.DivisionDefaultZero,
+			expected: "sum:errors{*} / default_zero(sum:hits{*})",
+		},
+		{
+			name:     "clamp min",
+			query:    "sum:errors{*} / sum:hits{*} * 100",
+			guard:    metric.DivisionClampMin,
+			expected: "sum:errors{*} / clamp_min(sum:hits{*}, 1) * 100",
+		},
+		{
+			name:     "parenthesized denominator",
+			query:    "sum:errors{*} / (sum:hits{*} + sum:misses{*})",
+			guard:    metric.DivisionDefaultZero,
+			expected: "sum:errors{*} / default_zero(sum:hits{*} + sum:misses{*})",
+		},
+		{
+			name:     "nested division",
+			query:    "(sum:a{*} / sum:b{*}) - (sum:c{*} / sum:d{*})",
+			guard:    metric.DivisionDefaultZero,
+			expected: "(sum:a{*} / default_zero(sum:b{*})) - (sum:c{*} / default_zero(sum:d{*}))",
+		},
+		{
+			name:     "numeric denominator",
+			query:    "sum:errors{*} / 60",
+			guard:    metric.DivisionDefaultZero,
+			expected: "sum:errors{*} / 60",
+		},
+		{
+			name:     "already guarded",
+			query:    "sum:errors{*} / default_zero(sum:hits{*})",
+			guard:    metric.DivisionDefaultZero,
+			expected: "sum:errors{*} / default_zero(sum:hits{*})",
+		},
+		{
+			name:     "single query",
+			query:    "sum:errors{*}",
+			guard:    metric.DivisionDefaultZero,
+			expected: "sum:errors{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			got, err := q.BuildWithOptions(metric.WithSafeDivision(tt.guard))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWithSafeDivisionAddedFilter(t *testing.T) {
+	q, err := metric.ParseQuery("sum:errors{service:web} / sum:hits{service:web}")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	q.Filter(metric.NewFilterBuilder("env").Equal("prod"))
+	got, err := q.BuildWithOptions(metric.WithSafeDivision(metric.DivisionDefaultZero))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "sum:errors{service:web, env:prod} / default_zero(sum:hits{service:web, env:prod})"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
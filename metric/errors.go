@@ -0,0 +1,210 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sentinel errors returned (possibly wrapped) by the builders. Use errors.Is
+// to test for them.
+var (
+	// ErrMissingMetric is returned when a query is built without a metric name.
+	ErrMissingMetric = errors.New("metric name is required")
+
+	// ErrEmptyFilterKey is returned when a filter is built without a key.
+	ErrEmptyFilterKey = errors.New("filter key is required")
+
+	// ErrUnknownFilterOperation is returned when a filter is built before an
+	// operation (Equal, In, ...) has been selected.
+	ErrUnknownFilterOperation = errors.New("unknown filter operation")
+
+	// ErrEmptyFilterGroup is returned when a filter group has no expressions.
+	ErrEmptyFilterGroup = errors.New("filter group must contain at least one expression")
+
+	// ErrMissingFunctionName is returned when a function is built without a name.
+	ErrMissingFunctionName = errors.New("function name is required")
+
+	// ErrMixedOperators is returned (wrapped in a *MixedOperatorError) when
+	// a filter group joins its expressions with both AND and OR.
+	ErrMixedOperators = errors.New("filter group mixes AND and OR operators")
+
+	// ErrFrozenBuilder is returned when building a query derived by calling
+	// a mutator on a frozen builder.
+	ErrFrozenBuilder = errors.New("builder is frozen")
+
+	// ErrUnsupportedEdit is returned when building an expression modified
+	// in a way that cannot be applied to it, such as regrouping an
+	// expression whose metric queries the structured builder cannot
+	// represent.
+	ErrUnsupportedEdit = errors.New("edit is not supported for this expression")
+
+	// ErrUnsupportedDDQP is returned by ToDDQP for valid queries the ddqp
+	// AST has no form for: time windows, wrapping functions and
+	// arithmetic expressions.
+	ErrUnsupportedDDQP = errors.New("query cannot be represented in a ddqp AST")
+
+	// ErrUnrepresentable is returned (wrapped in a *ParseError) by
+	// ParseQueryStrict for queries the builders cannot fully represent, so
+	// that some edits to them would not apply.
+	ErrUnrepresentable = errors.New("query cannot be fully represented by the builder")
+
+	// ErrLimitExceeded is returned (wrapped in a *LimitError) when a query
+	// exceeds one of the configured complexity Limits.
+	ErrLimitExceeded = errors.New("query complexity limit exceeded")
+)
+
+// ParseError is returned when a query string cannot be parsed.
+type ParseError struct {
+	// Query is the query string that failed to parse.
+	Query string
+	// Err is the underlying cause.
+	Err error
+	// Offset is the byte offset in Query at which parsing failed.
+	Offset int
+	// Line and Column locate Offset, counting lines and characters from
+	// 1. Line is 0 if the failure has no position, such as a query that
+	// parses but cannot be represented.
+	Line, Column int
+	// Token is the offending token at Offset, or empty at the end of the
+	// query.
+	Token string
+}
+
+// Error returns the parse failure message, with its position if known.
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("failed to parse query: %v", e.Err)
+	}
+	msg := e.Err.Error()
+	var syntaxErr *syntaxError
+	if errors.As(e.Err, &syntaxErr) {
+		msg = syntaxErr.msg
+	}
+	if e.Line == 1 {
+		return fmt.Sprintf("failed to parse query at column %d: %s", e.Column, msg)
+	}
+	return fmt.Sprintf("failed to parse query at line %d, column %d: %s", e.Line, e.Column, msg)
+}
+
+// Snippet returns the line of Query where parsing failed, followed by a
+// line with a caret under the failure, for display:
+//
+//	avg:system.cpu.idle{host:web-1 | top}
+//	                               ^
+//
+// It returns "" if the failure has no position.
+func (e *ParseError) Snippet() string {
+	if e.Line == 0 {
+		return ""
+	}
+	start := strings.LastIndexByte(e.Query[:e.Offset], '\n') + 1
+	end := len(e.Query)
+	if i := strings.IndexByte(e.Query[e.Offset:], '\n'); i >= 0 {
+		end = e.Offset + i
+	}
+	return e.Query[start:end] + "\n" + strings.Repeat(" ", e.Column-1) + "^"
+}
+
+// Unwrap returns the underlying cause.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when a component of a query has an invalid value.
+type ValidationError struct {
+	// Component names the part of the query that failed (e.g. "aggregator",
+	// "function", "filter key", "group by key").
+	Component string
+	// Value is the offending value.
+	Value string
+	// Reason explains why the value was rejected.
+	Reason string
+}
+
+// Error returns a description of the invalid component.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Component, e.Value, e.Reason)
+}
+
+// syntaxError is a parse failure at a known position of the query given to
+// the grammar. Grammar adapters return it so that ParseError can locate
+// failures independently of the parser in use.
+type syntaxError struct {
+	// offset is the byte offset of the failure.
+	offset int
+	// token is the offending token, or empty at the end of the query.
+	token string
+	// msg describes the failure without its position.
+	msg string
+	// err is the parser's own error.
+	err error
+}
+
+func (e *syntaxError) Error() string { return e.err.Error() }
+
+func (e *syntaxError) Unwrap() error { return e.err }
+
+// newParseError returns a *ParseError for err, the failure to parse
+// parsed, a copy of query with any agg(window): time window removed.
+// Positions reported by the grammar are translated to query.
+func newParseError(query, parsed string, err error) *ParseError {
+	pe := &ParseError{Query: query, Err: err}
+	var syntaxErr *syntaxError
+	if !errors.As(err, &syntaxErr) {
+		return pe
+	}
+
+	// The time window is the only text removed before parsing
+	offset := syntaxErr.offset
+	if removed := len(query) - len(parsed); removed > 0 && offset > commonPrefix(query, parsed) {
+		offset += removed
+	}
+	if offset < 0 || offset > len(query) {
+		return pe
+	}
+
+	pe.Token = syntaxErr.token
+	pe.locate(offset)
+	return pe
+}
+
+// locate sets the position of e to offset, a byte offset in e.Query, and
+// fills in Token if it is empty.
+func (e *ParseError) locate(offset int) {
+	e.Offset = offset
+	e.Line = strings.Count(e.Query[:offset], "\n") + 1
+	e.Column = utf8.RuneCountInString(e.Query[strings.LastIndexByte(e.Query[:offset], '\n')+1:offset]) + 1
+	if e.Token == "" {
+		e.Token = tokenAt(e.Query, offset)
+	}
+}
+
+// commonPrefix returns the length of the longest common prefix of a and b.
+func commonPrefix(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// tokenAt returns the token starting at s[offset]: a run of identifier
+// characters, or else a single character.
+func tokenAt(s string, offset int) string {
+	if offset >= len(s) {
+		return ""
+	}
+	end := offset
+	for end < len(s) && (isIdentByte(s[end]) || s[end] == '.' || s[end] == '-') {
+		end++
+	}
+	if end == offset {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		end += size
+	}
+	return s[offset:end]
+}
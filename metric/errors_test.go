@@ -0,0 +1,218 @@
+package metric_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  func() error
+		target error
+	}{
+		{
+			name: "missing metric",
+			build: func() error {
+				_, err := metric.NewMetricQueryBuilder().Aggregator("avg").Build()
+				return err
+			},
+			target: metric.ErrMissingMetric,
+		},
+		{
+			name: "empty filter key",
+			build: func() error {
+				_, err := metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("").Equal("x")).
+					Build()
+				return err
+			},
+			target: metric.ErrEmptyFilterKey,
+		},
+		{
+			name: "empty filter key inside group",
+			build: func() error {
+				_, err := metric.NewFilterGroupBuilder().
+					And(metric.NewFilterBuilder("").Equal("x")).
+					Build()
+				return err
+			},
+			target: metric.ErrEmptyFilterKey,
+		},
+		{
+			name: "unknown filter operation",
+			build: func() error {
+				_, err := metric.NewFilterBuilder("host").Build()
+				return err
+			},
+			target: metric.ErrUnknownFilterOperation,
+		},
+		{
+			name: "empty filter group",
+			build: func() error {
+				_, err := metric.NewFilterGroupBuilder().Build()
+				return err
+			},
+			target: metric.ErrEmptyFilterGroup,
+		},
+		{
+			name: "missing function name",
+			build: func() error {
+				_, err := metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("")).
+					Build()
+				return err
+			},
+			target: metric.ErrMissingFunctionName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.build()
+			if !errors.Is(err, tt.target) {
+				t.Errorf("error = %v, want errors.Is(%v)", err, tt.target)
+			}
+		})
+	}
+}
+
+func TestValidationErrorAs(t *testing.T) {
+	_, err := metric.NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		GroupBy("host:web-1").
+		Build()
+
+	var vErr *metric.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("error = %v, want *ValidationError", err)
+	}
+	if vErr.Component != "group by key" || vErr.Value != "host:web-1" {
+		t.Errorf("ValidationError = %+v, want group by key host:web-1", vErr)
+	}
+}
+
+func TestParseErrorAs(t *testing.T) {
+	query := "avg:system.cpu.idle{host:"
+	_, err := metric.ParseQuery(query)
+
+	var pErr *metric.ParseError
+	if !errors.As(err, &pErr) {
+		t.Fatalf("error = %v, want *ParseError", err)
+	}
+	if pErr.Query != query {
+		t.Errorf("ParseError.Query = %q, want %q", pErr.Query, query)
+	}
+	if pErr.Unwrap() == nil {
+		t.Error("ParseError.Unwrap() = nil, want underlying cause")
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		line    int
+		column  int
+		token   string
+		snippet string
+	}{
+		{
+			name:    "unexpected token",
+			query:   "sum:errors{*} ?? 1",
+			line:    1,
+			column:  15,
+			token:   "?",
+			snippet: "sum:errors{*} ?? 1\n              ^",
+		},
+		{
+			name:    "end of query",
+			query:   "avg:system.cpu.idle{host:",
+			line:    1,
+			column:  26,
+			token:   "",
+			snippet: "avg:system.cpu.idle{host:\n                         ^",
+		},
+		{
+			name:    "after a time window",
+			query:   "avg(5m):system.cpu.idle{host:web-1} | top",
+			line:    1,
+			column:  37,
+			token:   "|",
+			snippet: "avg(5m):system.cpu.idle{host:web-1} | top\n                                    ^",
+		},
+		{
+			name:    "after a group by template variable",
+			query:   "sum:requests{*} by {$group_by} | top",
+			line:    1,
+			column:  32,
+			token:   "|",
+			snippet: "sum:requests{*} by {$group_by} | top\n                               ^",
+		},
+		{
+			name:    "second line",
+			query:   "avg:system.cpu.idle{host:web-1}\n.rollup(avg, 60) > 5",
+			line:    2,
+			column:  18,
+			token:   ">",
+			snippet: ".rollup(avg, 60) > 5\n                 ^",
+		},
+		{
+			name:    "template variable in a filter",
+			query:   "avg:m{env:$env}",
+			line:    1,
+			column:  11,
+			token:   "$",
+			snippet: "avg:m{env:$env}\n          ^",
+		},
+		{
+			name:    "bracketed IN list",
+			query:   "avg:m{host IN [a]}",
+			line:    1,
+			column:  15,
+			token:   "[",
+			snippet: "avg:m{host IN [a]}\n              ^",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := metric.ParseQuery(tt.query)
+
+			var pErr *metric.ParseError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("error = %v, want *ParseError", err)
+			}
+			if pErr.Line != tt.line || pErr.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", pErr.Line, pErr.Column, tt.line, tt.column)
+			}
+			if pErr.Token != tt.token {
+				t.Errorf("Token = %q, want %q", pErr.Token, tt.token)
+			}
+			if got := pErr.Snippet(); got != tt.snippet {
+				t.Errorf("Snippet() =\n%s\nwant\n%s", got, tt.snippet)
+			}
+			if tt.line == 1 && !strings.Contains(err.Error(), fmt.Sprintf("at column %d", tt.column)) {
+				t.Errorf("Error() = %q, want the column", err.Error())
+			}
+		})
+	}
+}
+
+func TestParseErrorWithoutPosition(t *testing.T) {
+	_, err := metric.ParseQueryStrict("sum:errors{!version:>2} / sum:hits{*}")
+
+	var pErr *metric.ParseError
+	if !errors.As(err, &pErr) {
+		t.Fatalf("error = %v, want *ParseError", err)
+	}
+	if pErr.Line != 0 || pErr.Snippet() != "" {
+		t.Errorf("ParseError = %+v, want no position", pErr)
+	}
+}
@@ -0,0 +1,100 @@
+package metric
+
+import (
+	"strings"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// isBareValueChar reports whether c may appear in an unquoted tag value.
+func isBareValueChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '_', c == '-', c == '.', c == '/', c == '*':
+		return true
+	}
+	return false
+}
+
+// needsQuoting reports whether a tag value must be quoted to survive a
+// round trip through the parser. Values containing braces, colons, spaces
+// or other punctuation (e.g. URLs and ARNs) cannot be represented bare.
+// Template variables such as $env and $env.value are never quoted.
+func needsQuoting(value string) bool {
+	if value == "" {
+		return false
+	}
+	// Datadog substitutes a dashboard template variable only when it is
+	// bare; quoted, it is read as a literal string
+	if templateVariablePattern.MatchString(strings.TrimSuffix(value, ".value")) {
+		return false
+	}
+	// A bare value cannot start with '.' or '/'
+	if value[0] == '.' || value[0] == '/' {
+		return true
+	}
+	for _, c := range value {
+		if !isBareValueChar(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteValue returns value wrapped in double quotes, escaping any embedded
+// backslashes and double quotes.
+func quoteValue(value string) string {
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+	return `"` + escaped + `"`
+}
+
+// formatValue renders a tag value, quoting it only when required.
+func formatValue(value string) string {
+	if needsQuoting(value) {
+		return quoteValue(value)
+	}
+	return value
+}
+
+// unquoteValue reverses quoteValue. Values that are not wrapped in quotes
+// are returned unchanged; single-quoted values have their quotes removed.
+func unquoteValue(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		inner := value[1 : len(value)-1]
+		var sb strings.Builder
+		sb.Grow(len(inner))
+		for i := 0; i < len(inner); i++ {
+			if inner[i] == '\\' && i+1 < len(inner) && (inner[i+1] == '"' || inner[i+1] == '\\') {
+				i++
+			}
+			sb.WriteByte(inner[i])
+		}
+		return sb.String()
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// ddqpValue converts value, one of the filter's values, into a ddqp.Value,
+// keeping the quotes it was parsed with.
+func (b *filterBuilder) ddqpValue(value string) *ddqp.Value {
+	if b.quotes[value] == 0 {
+		return toDDQPValue(value)
+	}
+	quoted := b.formatValue(value)
+	return &ddqp.Value{Str: &quoted}
+}
+
+// toDDQPValue converts a tag value into a ddqp.Value, using a quoted string
+// literal when the value cannot be represented as a bare identifier.
+func toDDQPValue(value string) *ddqp.Value {
+	if needsQuoting(value) {
+		quoted := quoteValue(value)
+		return &ddqp.Value{Str: &quoted}
+	}
+	return &ddqp.Value{Identifier: &value}
+}
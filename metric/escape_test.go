@@ -0,0 +1,304 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb"
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestFilterValueEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func() (string, error)
+		expected string
+	}{
+		{
+			name: "plain value is not quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").Equal("web-1.example.com").Build()
+			},
+			expected: "host:web-1.example.com",
+		},
+		{
+			name: "wildcard value is not quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").Equal("web-*").Build()
+			},
+			expected: "host:web-*",
+		},
+		{
+			name: "ARN is quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("functionarn").
+					Equal("arn:aws:lambda:us-east-1:123456789012:function:my-fn").Build()
+			},
+			expected: `functionarn:"arn:aws:lambda:us-east-1:123456789012:function:my-fn"`,
+		},
+		{
+			name: "URL with braces is quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("url").NotEqual("https://example.com/users/{id}").Build()
+			},
+			expected: `!url:"https://example.com/users/{id}"`,
+		},
+		{
+			name: "embedded quotes are escaped",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("msg").Equal(`say "hi"`).Build()
+			},
+			expected: `msg:"say \"hi\""`,
+		},
+		{
+			name: "template variable is not quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("env").Equal("$env").Build()
+			},
+			expected: "env:$env",
+		},
+		{
+			name: "template variable value is not quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("env").NotEqual("$env.value").Build()
+			},
+			expected: "!env:$env.value",
+		},
+		{
+			name: "template variables in an IN list are not quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("env").In("$env", "prod").Build()
+			},
+			expected: "env IN ($env,prod)",
+		},
+		{
+			name: "IN list quotes only values that need it",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("role").In("arn:aws:iam::1:role/a", "plain").Build()
+			},
+			expected: `role IN ("arn:aws:iam::1:role/a",plain)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterValueEscapingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter metric.FilterExpression
+	}{
+		{
+			name:   "ARN",
+			filter: ddqb.Filter("functionarn").Equal("arn:aws:lambda:us-east-1:123456789012:function:my-fn"),
+		},
+		{
+			name:   "URL",
+			filter: ddqb.Filter("url").Equal("https://example.com/users/{id}?page=1"),
+		},
+		{
+			name:   "negated URL",
+			filter: ddqb.Filter("url").NotEqual("http://localhost:8080/"),
+		},
+		{
+			name:   "escaped quotes and backslashes",
+			filter: ddqb.Filter("msg").Equal(`a "quoted" \ value`),
+		},
+		{
+			name:   "IN list with ARNs",
+			filter: ddqb.Filter("role").In("arn:aws:iam::1:role/a", "arn:aws:iam::1:role/b"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			built, err := ddqb.Metric().
+				Aggregator("avg").
+				Metric("aws.lambda.invocations").
+				Filter(tt.filter).
+				Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			parsed, err := metric.ParseQuery(built)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", built, err)
+			}
+
+			rebuilt, err := parsed.Build()
+			if err != nil {
+				t.Fatalf("Build() after parse error = %v", err)
+			}
+			if rebuilt != built {
+				t.Errorf("round trip = %q, want %q", rebuilt, built)
+			}
+		})
+	}
+}
+
+func TestListQuoting(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		opts     []metric.BuildOption
+		expected string
+	}{
+		{
+			name:     "quoted members keep their quotes",
+			query:    `avg:system.cpu.idle{host IN ("web-1", web-2, "web 3")}`,
+			expected: `avg:system.cpu.idle{host IN ("web-1",web-2,"web 3")}`,
+		},
+		{
+			name:     "every member quoted",
+			query:    `avg:system.cpu.idle{host IN (web-1, "web 2")}`,
+			opts:     []metric.BuildOption{metric.WithListQuoting(metric.QuoteAlways)},
+			expected: `avg:system.cpu.idle{host IN ("web-1","web 2")}`,
+		},
+		{
+			name:     "NOT IN inside a group",
+			query:    `avg:system.cpu.idle{env:prod AND host NOT IN ("a:b", c)}`,
+			opts:     []metric.BuildOption{metric.WithListQuoting(metric.QuoteAlways)},
+			expected: `avg:system.cpu.idle{(env:prod AND host NOT IN ("a:b","c"))}`,
+		},
+		{
+			name:     "single quoted members",
+			query:    `avg:system.cpu.idle{host IN ('web-1', 'web 2')}`,
+			expected: `avg:system.cpu.idle{host IN ('web-1','web 2')}`,
+		},
+		{
+			name:     "embedded quotes are escaped",
+			query:    `avg:system.cpu.idle{msg IN ("say \"hi\"", plain)}`,
+			opts:     []metric.BuildOption{metric.WithListQuoting(metric.QuoteAlways)},
+			expected: `avg:system.cpu.idle{msg IN ("say \"hi\"","plain")}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := builder.BuildWithOptions(tt.opts...)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+
+			// The quoted form reads back to the same filters
+			reparsed, err := metric.ParseQuery(result)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", result, err)
+			}
+			if again, _ := reparsed.BuildWithOptions(tt.opts...); again != result {
+				t.Errorf("round trip = %q, want %q", again, result)
+			}
+		})
+	}
+}
+
+func TestParsedQuotingIsPreserved(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		edit     func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "value with spaces and slashes",
+			query:    `sum:trace.http.request.hits{resource_name:"GET /api/v1/users"}`,
+			expected: `sum:trace.http.request.hits{resource_name:"GET /api/v1/users"}`,
+		},
+		{
+			name:     "quoted value that does not need quotes",
+			query:    `sum:trace.http.request.hits{env:"prod"}`,
+			expected: `sum:trace.http.request.hits{env:"prod"}`,
+		},
+		{
+			name:     "single quoted value",
+			query:    `sum:trace.http.request.hits{resource_name:'GET /api/v1/users'}`,
+			expected: `sum:trace.http.request.hits{resource_name:'GET /api/v1/users'}`,
+		},
+		{
+			name:     "single quoted value containing a double quote",
+			query:    `sum:trace.http.request.hits{msg:'say "hi"'}`,
+			expected: `sum:trace.http.request.hits{msg:'say "hi"'}`,
+		},
+		{
+			name:     "empty value",
+			query:    `sum:trace.http.request.hits{resource_name:""}`,
+			expected: `sum:trace.http.request.hits{resource_name:""}`,
+		},
+		{
+			name:     "negated value with braces",
+			query:    `sum:trace.http.request.hits{!resource_name:"GET /users/{id}"}`,
+			expected: `sum:trace.http.request.hits{!resource_name:"GET /users/{id}"}`,
+		},
+		{
+			name:     "values inside a group",
+			query:    `sum:trace.http.request.hits{resource_name:"GET /a" AND env:prod}`,
+			expected: `sum:trace.http.request.hits{(resource_name:"GET /a" AND env:prod)}`,
+		},
+		{
+			name:     "value in an expression",
+			query:    `sum:trace.http.request.errors{resource_name:"GET /a"} / sum:trace.http.request.hits{resource_name:"GET /a"}`,
+			expected: `sum:trace.http.request.errors{resource_name:"GET /a"} / sum:trace.http.request.hits{resource_name:"GET /a"}`,
+		},
+		{
+			name:  "unchanged values keep their quotes after editing",
+			query: `sum:trace.http.request.hits{resource_name:"GET /a",env:"prod"}`,
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.Filter(ddqb.Filter("service").Equal("web store"))
+			},
+			expected: `sum:trace.http.request.hits{resource_name:"GET /a", env:"prod", service:"web store"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if tt.edit != nil {
+				builder = tt.edit(builder)
+			}
+			result, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterValueEscapingInExpression(t *testing.T) {
+	builder, err := metric.ParseQuery("sum:requests{*} / sum:hits{*}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	result, err := builder.Filter(ddqb.Filter("url").Equal("https://example.com/{id}")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	expected := `sum:requests{*, url:"https://example.com/{id}"} / sum:hits{*, url:"https://example.com/{id}"}`
+	if result != expected {
+		t.Errorf("Build() = %q, want %q", result, expected)
+	}
+}
@@ -0,0 +1,101 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestExpressionFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		params   map[string]string
+		expected string
+	}{
+		{
+			name:  "suffix function",
+			query: "sum:errors{*} / sum:hits{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("sum", "300"))
+			},
+			expected: "(sum:errors{*} / sum:hits{*}).rollup(sum, 300)",
+		},
+		{
+			name:  "function chain",
+			query: "sum:errors{*} - sum:retries{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ApplyChain(metric.NewFunctionChain(
+					metric.NewFunctionBuilder("rollup").WithArg("300"),
+					metric.NewFunctionBuilder("fill").WithArg("zero"),
+				))
+			},
+			expected: "(sum:errors{*} - sum:retries{*}).rollup(300).fill(zero)",
+		},
+		{
+			name:  "wrapper",
+			query: "sum:a{*} - sum:b{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.WrapWith(metric.NewWrapperBuilder("timeshift").WithArg("-3600"))
+			},
+			expected: "timeshift(sum:a{*} - sum:b{*}, -3600)",
+		},
+		{
+			name:  "wrapper outside suffix function",
+			query: "sum:a{*} / sum:b{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.WrapWith(metric.Abs()).ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60"))
+			},
+			expected: "abs((sum:a{*} / sum:b{*}).rollup(60))",
+		},
+		{
+			name:  "placeholder argument",
+			query: "sum:a{*} / sum:b{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("{{window}}"))
+			},
+			params:   map[string]string{"window": "600"},
+			expected: "(sum:a{*} / sum:b{*}).rollup(600)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			got, err := tt.modify(q).BuildWithParams(tt.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpressionFunctionHook(t *testing.T) {
+	q, err := metric.ParseQuery("sum:a{*} / sum:b{*}")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	var applied int
+	q.OnFunctionApplied(func(metric.FunctionBuilder) { applied++ })
+	q.ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60"))
+	if applied != 1 {
+		t.Errorf("hook called %d times, want 1", applied)
+	}
+}
+
+func TestExpressionFunctionMissingPlaceholder(t *testing.T) {
+	q, err := metric.ParseQuery("sum:a{*} / sum:b{*}")
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if _, err := q.ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("{{window}}")).Build(); err == nil {
+		t.Error("expected error for unresolved placeholder")
+	}
+}
@@ -1,60 +1,604 @@
 package metric
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jonwinton/ddqp"
 )
 
 // expressionQueryBuilder enables limited editing of complex metric expressions.
 // Currently supports adding filters which are applied to all metric queries
-// within the expression. Other mutators are no-ops.
+// within the expression, applying suffix and wrapping functions to the
+// whole expression, and editing each metric query through the structured
+// builders returned by SubQueries. Other mutators are no-ops.
 type expressionQueryBuilder struct {
-	original     string
-	addedFilters []FilterExpression
+	original       string
+	timeAggregator string         // aggregator of the agg(window): prefix, if any
+	timeWindow     string         // window of the agg(window): prefix, if any
+	queries        []QueryBuilder // structured builders for each metric query, if representable
+	queryBases     []string       // queries as first built, to detect edits
+	addedFilters   []FilterExpression
+	scope          ScopeBuilder // shared by reference; nil when unset
+	removedKeys    []string     // filter keys removed from the original
+	removedGroup   []string     // group by keys removed from the original
+	removedFuncs   []string     // function names removed from the original
+	countMode      string       // as_count or as_rate applied to each query, if set
+	preserve       bool         // whether edited queries are spliced into the original text
+	cleared        bool         // whether the original's filters were cleared
+	functions      []FunctionBuilder
+	wrappers       []WrapperBuilder
+	config         *Config // nil uses the package-level default
+	hooks          hooks
+	frozen         bool
+	err            error // set when derived from a mutation of a frozen builder
 }
 
 func newExpressionPassthroughBuilder(original string) QueryBuilder { // keep constructor name for minimal diff
 	return &expressionQueryBuilder{original: original, addedFilters: []FilterExpression{}}
 }
 
-func (b *expressionQueryBuilder) Metric(_ string) QueryBuilder     { return b }
-func (b *expressionQueryBuilder) Aggregator(_ string) QueryBuilder { return b }
+func (b *expressionQueryBuilder) Metric(_ string) QueryBuilder { return b }
+
+// Aggregator sets the space aggregator of every metric query in the
+// expression. The aggregator of an agg(window): prefix is unchanged.
+// Expressions whose metric queries cannot be represented by structured
+// builders fail to build with ErrUnsupportedEdit.
+func (b *expressionQueryBuilder) Aggregator(agg string) QueryBuilder {
+	return b.AggregatorWhere(agg, func(int, QueryBuilder) bool { return true })
+}
+
+// AggregatorWhere sets the space aggregator of the metric queries of the
+// expression accepted by match, which is called with the index and
+// builder of each, in the order SubQueries returns them.
+func (b *expressionQueryBuilder) AggregatorWhere(agg string, match func(index int, q QueryBuilder) bool) QueryBuilder {
+	b = b.editSubQueries("Aggregator")
+	for i, q := range b.queries {
+		if match(i, q) {
+			q.Aggregator(agg)
+		}
+	}
+	return b
+}
 func (b *expressionQueryBuilder) Filter(filter FilterExpression) QueryBuilder {
+	b = b.mutable("Filter")
 	b.addedFilters = append(b.addedFilters, filter)
+	b.hooks.fireFilterAdded(filter)
+	return b
+}
+
+func (b *expressionQueryBuilder) Filters(filters ...FilterExpression) QueryBuilder {
+	b = b.mutable("Filters")
+	for _, filter := range filters {
+		b.addedFilters = append(b.addedFilters, filter)
+		b.hooks.fireFilterAdded(filter)
+	}
 	return b
 }
+
+// Scope attaches scope, whose filters are applied to every metric query in
+// the expression ahead of the added filters.
+func (b *expressionQueryBuilder) Scope(scope ScopeBuilder) QueryBuilder {
+	b = b.mutable("Scope")
+	b.scope = scope
+	return b
+}
+
+func (b *expressionQueryBuilder) OnFilterAdded(hook FilterHook) QueryBuilder {
+	b = b.mutable("OnFilterAdded")
+	if hook != nil {
+		b.hooks.filterAdded = append(b.hooks.filterAdded, hook)
+	}
+	return b
+}
+
+func (b *expressionQueryBuilder) OnFunctionApplied(hook FunctionHook) QueryBuilder {
+	b = b.mutable("OnFunctionApplied")
+	if hook != nil {
+		b.hooks.functionApplied = append(b.hooks.functionApplied, hook)
+	}
+	return b
+}
+
 func (b *expressionQueryBuilder) GetFilters() []FilterExpression { return nil }
-func (b *expressionQueryBuilder) FindGroup(_ func(FilterGroupBuilder) bool) FilterGroupBuilder {
+func (b *expressionQueryBuilder) GetGroupBy() []string           { return nil }
+
+// FindGroup finds the first FilterGroupBuilder that matches the predicate
+// function, searching the metric queries of the expression in the order
+// they appear. Returns nil if no matching group is found.
+func (b *expressionQueryBuilder) FindGroup(predicate func(FilterGroupBuilder) bool) FilterGroupBuilder {
+	for _, q := range b.queries {
+		if group := q.FindGroup(predicate); group != nil {
+			return group
+		}
+	}
 	return nil
 }
 
-func (b *expressionQueryBuilder) AddToGroup(_ FilterGroupBuilder, _ FilterExpression) QueryBuilder {
-	// Not supported for expressions yet
+// AddToGroup adds a filter to the specified FilterGroupBuilder of whichever
+// metric query of the expression holds it. If group is nil, the filter is
+// added to every metric query, as Filter does.
+func (b *expressionQueryBuilder) AddToGroup(group FilterGroupBuilder, filter FilterExpression) QueryBuilder {
+	if b.frozen {
+		// The group belongs to the caller's copy, not to b; leave it alone.
+		return b.mutable("AddToGroup")
+	}
+	if group == nil {
+		return b.Filter(filter)
+	}
+	for _, q := range b.queries {
+		owned := q.FindGroup(func(g FilterGroupBuilder) bool { return g == group })
+		if owned != nil {
+			q.AddToGroup(group, filter)
+			b.hooks.fireFilterAdded(filter)
+			break
+		}
+	}
+	return b
+}
+func (b *expressionQueryBuilder) EmptyScope(_ ScopeMode) QueryBuilder { return b }
+
+// TimeWindow replaces the window of the expression's agg(window): prefix,
+// as in avg(5m):sum:errors{*} / sum:hits{*}. Expressions parsed without a
+// prefix are given one aggregating with avg.
+func (b *expressionQueryBuilder) TimeWindow(window string) QueryBuilder {
+	b = b.mutable("TimeWindow")
+	return b.setTimeWindow(window)
+}
+
+// EvaluationWindow replaces the window of the expression's agg(window):
+// prefix with a monitor evaluation window, as TimeWindow does. The "last_"
+// prefix may be omitted.
+func (b *expressionQueryBuilder) EvaluationWindow(window string) QueryBuilder {
+	b = b.mutable("EvaluationWindow")
+	if !strings.HasPrefix(window, evaluationWindowPrefix) {
+		window = evaluationWindowPrefix + window
+	}
+	return b.setTimeWindow(window)
+}
+
+// Last replaces the window of the expression's agg(window): prefix with
+// the evaluation window d, as TimeWindow does.
+func (b *expressionQueryBuilder) Last(d time.Duration) QueryBuilder {
+	b = b.mutable("Last")
+	return b.setTimeWindow(formatEvaluationWindow(d))
+}
+
+// defaultTimeAggregator aggregates the agg(window): prefix given to an
+// expression parsed without one when its window is set.
+const defaultTimeAggregator = "avg"
+
+// setTimeWindow sets the window of the agg(window): prefix, adding an
+// avg(window): prefix if the expression has none.
+func (b *expressionQueryBuilder) setTimeWindow(window string) QueryBuilder {
+	if b.timeAggregator == "" {
+		b.timeAggregator = defaultTimeAggregator
+	}
+	b.timeWindow = window
+	return b
+}
+
+// GroupBy adds groups to the grouping of every metric query in the
+// expression. Expressions whose metric queries cannot be represented by
+// structured builders fail to build with ErrUnsupportedEdit.
+func (b *expressionQueryBuilder) GroupBy(groups ...string) QueryBuilder {
+	b = b.editSubQueries("GroupBy")
+	for _, q := range b.queries {
+		q.GroupBy(groups...)
+	}
+	return b
+}
+
+// GroupByAll groups every metric query in the expression by {*}.
+func (b *expressionQueryBuilder) GroupByAll() QueryBuilder {
+	b = b.editSubQueries("GroupByAll")
+	for _, q := range b.queries {
+		q.GroupByAll()
+	}
+	return b
+}
+
+// ClearGroupBy removes all grouping from every metric query in the
+// expression.
+func (b *expressionQueryBuilder) ClearGroupBy() QueryBuilder {
+	b = b.editSubQueries("ClearGroupBy")
+	for _, q := range b.queries {
+		q.ClearGroupBy()
+	}
+	return b
+}
+
+// RemoveGroupBy removes keys from the grouping of every metric query in
+// the expression.
+func (b *expressionQueryBuilder) RemoveGroupBy(keys ...string) QueryBuilder {
+	b = b.mutable("RemoveGroupBy")
+	if b.queries == nil {
+		b.removedGroup = append(b.removedGroup, keys...)
+		return b
+	}
+	for _, q := range b.queries {
+		q.RemoveGroupBy(keys...)
+	}
+	return b
+}
+
+// WithConfig sets the configuration used for complexity limits and
+// validators. Aggregator, function and tag validation do not apply to
+// expressions.
+func (b *expressionQueryBuilder) WithConfig(cfg Config) QueryBuilder {
+	b = b.mutable("WithConfig")
+	b.config = &cfg
+	return b
+}
+
+func (b *expressionQueryBuilder) Clone() QueryBuilder { return b.clone() }
+
+func (b *expressionQueryBuilder) clone() *expressionQueryBuilder {
+	c := *b
+	c.addedFilters = cloneFilters(b.addedFilters)
+	c.removedKeys = append([]string(nil), b.removedKeys...)
+	c.removedGroup = append([]string(nil), b.removedGroup...)
+	c.removedFuncs = append([]string(nil), b.removedFuncs...)
+	c.functions = cloneFunctions(b.functions)
+	c.wrappers = cloneWrappers(b.wrappers)
+	c.queries = cloneSubQueries(b.queries)
+	if b.config != nil {
+		cfg := *b.config
+		c.config = &cfg
+	}
+	c.hooks = b.hooks.clone()
+	c.frozen = false
+	return &c
+}
+
+// mutable mirrors metricQueryBuilder.mutable.
+func (b *expressionQueryBuilder) mutable(method string) *expressionQueryBuilder {
+	if !b.frozen {
+		return b
+	}
+	c := b.clone()
+	if c.err == nil {
+		c.err = fmt.Errorf("frozen builder modified by %s: %w", method, ErrFrozenBuilder)
+	}
+	return c
+}
+
+// editSubQueries returns the builder a mutator that edits each metric query
+// through its structured builder should modify, as mutable does. If the
+// expression has no structured builders, the edit cannot be applied and
+// the returned builder fails to build with ErrUnsupportedEdit.
+func (b *expressionQueryBuilder) editSubQueries(method string) *expressionQueryBuilder {
+	b = b.mutable(method)
+	if b.queries == nil && b.err == nil {
+		b.err = fmt.Errorf("expression modified by %s: %w", method, ErrUnsupportedEdit)
+	}
 	return b
 }
-func (b *expressionQueryBuilder) GroupBy(_ ...string) QueryBuilder             { return b }
-func (b *expressionQueryBuilder) ApplyFunction(_ FunctionBuilder) QueryBuilder { return b }
-func (b *expressionQueryBuilder) TimeWindow(_ string) QueryBuilder             { return b }
+
+func (b *expressionQueryBuilder) Freeze() QueryBuilder {
+	if !b.frozen {
+		b.addedFilters = cloneFilters(b.addedFilters)
+		b.functions = cloneFunctions(b.functions)
+		b.wrappers = cloneWrappers(b.wrappers)
+		for i, q := range b.queries {
+			b.queries[i] = q.Clone().Freeze()
+		}
+		if b.scope != nil {
+			b.scope = b.scope.Clone()
+		}
+		b.frozen = true
+	}
+	return b
+}
+
+// BuildWithOptions honors WithSafeDivision and WithParams and ignores
+// other options: expressions are rendered by the parser.
+func (b *expressionQueryBuilder) BuildWithOptions(opts ...BuildOption) (string, error) {
+	query, err := b.build(context.Background(), newBuildOptions(opts))
+	logBuild(b, query, err)
+	return query, err
+}
+
+// BuildWithParams resolves {{name}} placeholders in the arguments of
+// functions applied to the expression.
+func (b *expressionQueryBuilder) BuildWithParams(params map[string]string) (string, error) {
+	return b.BuildWithOptions(WithParams(params))
+}
+
+// ToAST returns the expression as its rendered source text, including any
+// filters added through the builder.
+func (b *expressionQueryBuilder) ToAST() (*QueryAST, error) {
+	query, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return &QueryAST{
+		Type:       "expression",
+		Expression: query,
+		Filters:    []FilterAST{},
+		GroupBy:    []string{},
+		Functions:  []FunctionAST{},
+	}, nil
+}
+
+func (b *expressionQueryBuilder) ToASTJSON() ([]byte, error) {
+	ast, err := b.ToAST()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ast)
+}
+
+func (b *expressionQueryBuilder) BuildWithDiagnostics() (string, []Diagnostic, error) {
+	query, err := b.Build()
+	return query, nil, err
+}
 
 func (b *expressionQueryBuilder) Build() (string, error) {
-	if len(b.addedFilters) == 0 {
-		return b.original, nil
+	return b.BuildContext(context.Background())
+}
+
+func (b *expressionQueryBuilder) BuildContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
+	query, err := b.build(ctx, buildOptions{})
+	logBuild(b, query, err)
+	return query, err
+}
+
+func (b *expressionQueryBuilder) Validate() error {
+	return b.ValidateContext(context.Background())
+}
+
+func (b *expressionQueryBuilder) ValidateContext(ctx context.Context) error {
+	_, err := b.BuildContext(ctx)
+	return err
+}
+
+// build renders the expression and runs any configured Validators
+// against it.
+func (b *expressionQueryBuilder) build(ctx context.Context, opts buildOptions) (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+
+	cfg := DefaultConfig()
+	if b.config != nil {
+		cfg = *b.config
+	}
+	if err := b.checkLimits(cfg.Limits); err != nil {
+		return "", err
+	}
+
+	query, err := b.render(opts.divisionGuard)
+	if err != nil {
+		return "", err
+	}
+	if opts.format == FormatMinified {
+		query = minifyExpression(query)
+	}
+	query, err = b.applyFunctions(query, opts.params, layoutFor(opts.format).listSep)
+	if err != nil {
+		return "", err
+	}
+	query, err = wrapQuery(query, b.wrappers, opts.params, layoutFor(opts.format).listSep)
+	if err != nil {
+		return "", err
+	}
+	if b.timeAggregator != "" {
+		if err := validateTimeWindow(b.timeWindow); err != nil {
+			return "", err
+		}
+		query = b.timeAggregator + "(" + b.timeWindow + "):" + query
+	}
+	if err := runValidators(ctx, cfg.Validators, query); err != nil {
+		return "", err
+	}
+	return query, nil
+}
+
+// ApplyFunction applies a suffix function to the whole expression, which
+// is parenthesized first: (a / b).rollup(sum, 300).
+func (b *expressionQueryBuilder) ApplyFunction(fn FunctionBuilder) QueryBuilder {
+	b = b.mutable("ApplyFunction")
+	b.functions = append(b.functions, fn)
+	b.hooks.fireFunctionApplied(fn)
+	return b
+}
+
+// ApplyFunctionToQueries applies a suffix function to every metric query
+// of the expression rather than to the whole: a{*}.rollup(300) /
+// b{*}.rollup(300). The function is shared by the queries, so changing its
+// arguments later changes them all.
+func (b *expressionQueryBuilder) ApplyFunctionToQueries(fn FunctionBuilder) QueryBuilder {
+	b = b.editSubQueries("ApplyFunctionToQueries")
+	for _, q := range b.queries {
+		q.ApplyFunction(fn)
+	}
+	b.hooks.fireFunctionApplied(fn)
+	return b
+}
+
+// ApplyChain applies every function in the chain to the whole expression,
+// in order.
+func (b *expressionQueryBuilder) ApplyChain(chain FunctionChain) QueryBuilder {
+	b = b.mutable("ApplyChain")
+	if chain == nil {
+		return b
+	}
+	for _, fn := range chain.Functions() {
+		b.ApplyFunction(fn)
+	}
+	return b
+}
+
+// AsCount applies .as_count() to each metric query of the expression,
+// ahead of its other functions and replacing any .as_rate().
+func (b *expressionQueryBuilder) AsCount() QueryBuilder {
+	b = b.mutable("AsCount")
+	b.countMode = "as_count"
+	return b
+}
+
+// AsRate applies .as_rate() to each metric query of the expression, ahead
+// of its other functions and replacing any .as_count().
+func (b *expressionQueryBuilder) AsRate() QueryBuilder {
+	b = b.mutable("AsRate")
+	b.countMode = "as_rate"
+	return b
+}
+
+// GetCountModifier returns the count modifier applied with AsCount or
+// AsRate, or else the one every metric query of the expression applies.
+// It returns "" for an expression whose queries the builder cannot
+// represent.
+func (b *expressionQueryBuilder) GetCountModifier() string {
+	if b.countMode != "" || len(b.queries) == 0 {
+		return b.countMode
+	}
+	modifier := b.queries[0].GetCountModifier()
+	for _, q := range b.queries[1:] {
+		if q.GetCountModifier() != modifier {
+			return ""
+		}
+	}
+	return modifier
+}
+
+// GetFunctions returns the functions applied to the whole expression, in
+// order. Functions inside the original expression are not included. As
+// with metric queries, the functions are shared unless the builder is
+// frozen.
+func (b *expressionQueryBuilder) GetFunctions() []FunctionBuilder {
+	if b.frozen {
+		return cloneFunctions(b.functions)
+	}
+	return slices.Clone(b.functions)
+}
+
+// RemoveFunction removes every function named name from the metric
+// queries of the expression and from the functions applied to it.
+func (b *expressionQueryBuilder) RemoveFunction(name string) QueryBuilder {
+	b = b.mutable("RemoveFunction")
+	b.removedFuncs = append(b.removedFuncs, name)
+	b.functions = slices.DeleteFunc(b.functions, func(fn FunctionBuilder) bool {
+		return functionName(fn) == name
+	})
+	return b
+}
+
+// ReplaceFunction removes every function named name, as RemoveFunction
+// does, and applies fn to the whole expression.
+func (b *expressionQueryBuilder) ReplaceFunction(name string, fn FunctionBuilder) QueryBuilder {
+	return b.RemoveFunction(name).ApplyFunction(fn)
+}
+
+// applyFunctions appends the applied functions to the parenthesized
+// query, resolving placeholders from params.
+func (b *expressionQueryBuilder) applyFunctions(query string, params map[string]string, argSep string) (string, error) {
+	if len(b.functions) == 0 {
+		return query, nil
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	sb.WriteString(query)
+	sb.WriteByte(')')
+	for _, fn := range b.functions {
+		if err := appendFunction(&sb, fn, params, argSep); err != nil {
+			return "", fmt.Errorf("error building function: %w", err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// minifyExpression removes the whitespace following each comma in query,
+// outside quoted values.
+func minifyExpression(query string) string {
+	var sb strings.Builder
+	sb.Grow(len(query))
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		sb.WriteByte(c)
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(query) {
+				i++
+				sb.WriteByte(query[i])
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			for i+1 < len(query) && (query[i+1] == ' ' || query[i+1] == '\t') {
+				i++
+			}
+		}
+	}
+	return sb.String()
+}
 
-	gp := ddqp.NewGenericParser()
-	parsed, err := gp.Parse(b.original)
+// checkLimits checks the number of metric queries in the expression
+// against l.
+func (b *expressionQueryBuilder) checkLimits(l Limits) error {
+	if l.MaxSubQueries <= 0 {
+		return nil
+	}
+	_, cleaned := extractAndRemoveTimeWindow(b.original)
+	parsed, err := parseGeneric(cleaned)
+	if err != nil {
+		return newParseError(b.original, cleaned, err)
+	}
+	return checkLimit("sub-queries", l.MaxSubQueries, countSubQueries(parsed))
+}
+
+// render removes any removed filter keys from the original expression,
+// then applies the scope, any added filters, and guard to it.
+func (b *expressionQueryBuilder) render(guard DivisionGuard) (string, error) {
+	filters := b.addedFilters
+	if b.scope != nil {
+		filters = append(b.scope.GetFilters(), filters...)
+	}
+	texts, edited, err := b.editedSubQueries()
+	if err != nil {
+		return "", err
+	}
+	if len(filters) == 0 && !b.editsOriginal() && guard == DivisionUnguarded {
+		if edited == nil {
+			return b.original, nil
+		}
+		// Only the edited queries need to change
+		if b.preserve {
+			if spliced, ok := b.spliceSubQueries(texts); ok {
+				return spliced, nil
+			}
+		}
+	}
+
+	parsed, err := parseGeneric(b.original)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse expression for editing: %w", err)
+		return "", newParseError(b.original, b.original, err)
 	}
+	replaceSubQueries(parsed, edited)
 
 	// Prepare params for all added filters
-	params, err := buildParamsForFilters(b.addedFilters)
+	params, err := buildParamsForFilters(filters)
 	if err != nil {
 		return "", err
 	}
 
 	if parsed.MetricQuery != nil {
+		// Single queries have no divisions to guard
+		if len(filters) == 0 && !b.editsOriginal() && edited == nil {
+			return b.original, nil
+		}
+		walkMetricQuery(parsed.MetricQuery, b.editOriginal)
 		if err := applyFiltersToMetricQuery(parsed.MetricQuery, params); err != nil {
 			return "", err
 		}
@@ -62,9 +606,11 @@ func (b *expressionQueryBuilder) Build() (string, error) {
 	}
 
 	if parsed.MetricExpression != nil {
+		walkMetricQueries(parsed.MetricExpression.GroupedExpression, b.editOriginal)
 		if err := applyFiltersToMetricExpression(parsed.MetricExpression, params); err != nil {
 			return "", err
 		}
+		guardDivisions(parsed.MetricExpression.GroupedExpression, guard)
 		return parsed.MetricExpression.String(), nil
 	}
 
@@ -99,17 +645,17 @@ func toDDQPParam(expr FilterExpression) (*ddqp.Param, error) {
 	switch e := expr.(type) {
 	case *filterBuilder:
 		if e.key == "" {
-			return nil, fmt.Errorf("filter key is required")
+			return nil, ErrEmptyFilterKey
 		}
 		sf := &ddqp.SimpleFilter{FilterKey: e.key, FilterSeparator: &ddqp.FilterSeparator{}, FilterValue: &ddqp.FilterValue{}}
 		switch e.operation {
 		case Equal:
 			sf.FilterSeparator.Colon = true
-			sf.FilterValue.SimpleValue = &ddqp.Value{Identifier: &e.values[0]}
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
 		case NotEqual:
 			sf.Negative = true
 			sf.FilterSeparator.Colon = true
-			sf.FilterValue.SimpleValue = &ddqp.Value{Identifier: &e.values[0]}
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
 		case In, NotIn:
 			if e.operation == In {
 				sf.FilterSeparator.In = true
@@ -119,41 +665,46 @@ func toDDQPParam(expr FilterExpression) (*ddqp.Param, error) {
 			list := []*ddqp.Value{}
 			for i, v := range e.values {
 				// value
-				val := v // ensure distinct address
-				list = append(list, &ddqp.Value{Identifier: &val})
+				list = append(list, e.ddqpValue(v))
 				// comma between values except after last
 				if i < len(e.values)-1 {
 					list = append(list, &ddqp.Value{Separator: &ddqp.FilterValueSeparator{Comma: true}})
 				}
 			}
 			sf.FilterValue.ListValue = list
+		case GreaterThan:
+			sf.FilterSeparator.GreaterThan = true
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
+		case GreaterOrEqual:
+			sf.FilterSeparator.GreaterEqual = true
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
+		case LessThan:
+			sf.FilterSeparator.LessThan = true
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
+		case LessOrEqual:
+			sf.FilterSeparator.LessEqual = true
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
+		case Exists, NotExists:
+			wildcard := "*"
+			sf.Negative = e.operation == NotExists
+			sf.FilterSeparator.Colon = true
+			sf.FilterValue.SimpleValue = &ddqp.Value{Wildcard: &wildcard}
+		case Regex, NotRegex:
+			sf.Negative = e.operation == NotRegex
+			sf.FilterSeparator.Regex = true
+			sf.FilterValue.SimpleValue = e.ddqpValue(e.values[0])
 		default:
-			return nil, fmt.Errorf("unknown filter operation")
+			return nil, ErrUnknownFilterOperation
 		}
 		return &ddqp.Param{SimpleFilter: sf}, nil
 
 	case *filterGroupBuilder:
 		// Build grouped filter recursively
-		gf := &ddqp.GroupedFilter{Parameters: []*ddqp.Param{}}
-
-		for idx, sub := range e.expressions {
-			if idx > 0 {
-				// Insert group operator separator between sub-expressions
-				sep := &ddqp.FilterValueSeparator{}
-				if e.operator == AndOperator {
-					sep.And = true
-				} else {
-					sep.Or = true
-				}
-				gf.Parameters = append(gf.Parameters, &ddqp.Param{Separator: sep})
-			}
-			p, err := toDDQPParam(sub)
-			if err != nil {
-				return nil, err
-			}
-			gf.Parameters = append(gf.Parameters, p)
+		params, err := toDDQPParams(e.expressions, e.operatorAt, false)
+		if err != nil {
+			return nil, err
 		}
-		return &ddqp.Param{GroupedFilter: gf}, nil
+		return &ddqp.Param{GroupedFilter: &ddqp.GroupedFilter{Parameters: params}}, nil
 
 	default:
 		// Unknown expression type
@@ -1,7 +1,9 @@
 package metric
 
 import (
-	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -24,13 +26,47 @@ const (
 	In
 	// NotIn represents a NOT IN filter.
 	NotIn
+	// GreaterThan represents a numeric comparison filter (key:>value).
+	GreaterThan
+	// GreaterOrEqual represents a numeric comparison filter (key:>=value).
+	GreaterOrEqual
+	// LessThan represents a numeric comparison filter (key:<value).
+	LessThan
+	// LessOrEqual represents a numeric comparison filter (key:<=value).
+	LessOrEqual
+	// Regex represents a regular expression filter (key:~pattern).
+	Regex
+	// NotRegex represents a negated regular expression filter
+	// (!key:~pattern).
+	NotRegex
+	// Exists represents a filter matching series that have the tag key
+	// (key:*).
+	Exists
+	// NotExists represents a filter matching series that lack the tag key
+	// (!key:*).
+	NotExists
 )
 
+// comparisonSeparators maps comparison operations to the separator placed
+// between the key and the value.
+var comparisonSeparators = map[FilterOperation]string{
+	GreaterThan:    ":>",
+	GreaterOrEqual: ":>=",
+	LessThan:       ":<",
+	LessOrEqual:    ":<=",
+}
+
+// unsetOperation marks a filter whose operation has not been chosen yet.
+const unsetOperation FilterOperation = -1
+
 // FilterBuilder provides a fluent interface for building filter conditions.
 // FilterBuilder implements FilterExpression.
 type FilterBuilder interface {
 	FilterExpression
 
+	// Key returns the tag key the filter applies to.
+	Key() string
+
 	// Equal creates an equality filter (key:value).
 	Equal(value string) FilterBuilder
 
@@ -42,21 +78,84 @@ type FilterBuilder interface {
 
 	// NotIn creates a NOT IN filter.
 	NotIn(values ...string) FilterBuilder
+
+	// GreaterThan creates a numeric comparison filter (key:>value).
+	GreaterThan(value string) FilterBuilder
+
+	// GreaterOrEqual creates a numeric comparison filter (key:>=value).
+	GreaterOrEqual(value string) FilterBuilder
+
+	// LessThan creates a numeric comparison filter (key:<value).
+	LessThan(value string) FilterBuilder
+
+	// LessOrEqual creates a numeric comparison filter (key:<=value).
+	LessOrEqual(value string) FilterBuilder
+
+	// Regex creates a regular expression filter (key:~pattern).
+	Regex(pattern string) FilterBuilder
+
+	// NotRegex creates a negated regular expression filter (!key:~pattern).
+	NotRegex(pattern string) FilterBuilder
+
+	// HasPrefix creates a wildcard filter matching values that start with
+	// prefix (key:prefix*).
+	HasPrefix(prefix string) FilterBuilder
+
+	// HasSuffix creates a wildcard filter matching values that end with
+	// suffix (key:*suffix).
+	HasSuffix(suffix string) FilterBuilder
+
+	// Contains creates a wildcard filter matching values that contain
+	// substr (key:*substr*).
+	Contains(substr string) FilterBuilder
+
+	// Exists creates a filter matching series that have the tag key
+	// (key:*).
+	Exists() FilterBuilder
+
+	// NotExists creates a filter matching series that lack the tag key
+	// (!key:*).
+	NotExists() FilterBuilder
 }
 
 // filterBuilder is the concrete implementation of the FilterBuilder interface.
 type filterBuilder struct {
 	key       string
-	operation FilterOperation // Defaults to an invalid value
+	operation FilterOperation // Defaults to unsetOperation
 	values    []string
+	// quotes holds the quote character of each value that was written
+	// quoted in a parsed query, so that its quoting is kept on build.
+	quotes map[string]byte
 }
 
 // NewFilterBuilder creates a new filter builder with the given key.
 func NewFilterBuilder(key string) FilterBuilder {
 	return &filterBuilder{
-		key:    key,
-		values: make([]string, 0),
+		key:       key,
+		operation: unsetOperation,
+		values:    make([]string, 0),
+	}
+}
+
+// Tags returns an equality filter for each entry in tags, ordered by key so
+// that the rendered query is deterministic. Pass the result to Filters.
+func Tags(tags map[string]string) []FilterExpression {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := make([]FilterExpression, len(keys))
+	for i, key := range keys {
+		filters[i] = NewFilterBuilder(key).Equal(tags[key])
 	}
+	return filters
+}
+
+// Key returns the tag key the filter applies to.
+func (b *filterBuilder) Key() string {
+	return b.key
 }
 
 // Equal creates an equality filter (key:value).
@@ -87,36 +186,194 @@ func (b *filterBuilder) NotIn(values ...string) FilterBuilder {
 	return b
 }
 
+// GreaterThan creates a numeric comparison filter (key:>value).
+func (b *filterBuilder) GreaterThan(value string) FilterBuilder {
+	b.operation = GreaterThan
+	b.values = []string{value}
+	return b
+}
+
+// GreaterOrEqual creates a numeric comparison filter (key:>=value).
+func (b *filterBuilder) GreaterOrEqual(value string) FilterBuilder {
+	b.operation = GreaterOrEqual
+	b.values = []string{value}
+	return b
+}
+
+// LessThan creates a numeric comparison filter (key:<value).
+func (b *filterBuilder) LessThan(value string) FilterBuilder {
+	b.operation = LessThan
+	b.values = []string{value}
+	return b
+}
+
+// LessOrEqual creates a numeric comparison filter (key:<=value).
+func (b *filterBuilder) LessOrEqual(value string) FilterBuilder {
+	b.operation = LessOrEqual
+	b.values = []string{value}
+	return b
+}
+
+// Regex creates a regular expression filter (key:~pattern).
+func (b *filterBuilder) Regex(pattern string) FilterBuilder {
+	b.operation = Regex
+	b.values = []string{pattern}
+	return b
+}
+
+// NotRegex creates a negated regular expression filter (!key:~pattern).
+func (b *filterBuilder) NotRegex(pattern string) FilterBuilder {
+	b.operation = NotRegex
+	b.values = []string{pattern}
+	return b
+}
+
+// HasPrefix creates a wildcard filter matching values that start with
+// prefix (key:prefix*). It is an Equal filter on the wildcard value.
+func (b *filterBuilder) HasPrefix(prefix string) FilterBuilder {
+	return b.Equal(prefix + "*")
+}
+
+// HasSuffix creates a wildcard filter matching values that end with suffix
+// (key:*suffix). It is an Equal filter on the wildcard value.
+func (b *filterBuilder) HasSuffix(suffix string) FilterBuilder {
+	return b.Equal("*" + suffix)
+}
+
+// Contains creates a wildcard filter matching values that contain substr
+// (key:*substr*). It is an Equal filter on the wildcard value.
+func (b *filterBuilder) Contains(substr string) FilterBuilder {
+	return b.Equal("*" + substr + "*")
+}
+
+// Exists creates a filter matching series that have the tag key (key:*).
+func (b *filterBuilder) Exists() FilterBuilder {
+	b.operation = Exists
+	b.values = nil
+	return b
+}
+
+// NotExists creates a filter matching series that lack the tag key
+// (!key:*).
+func (b *filterBuilder) NotExists() FilterBuilder {
+	b.operation = NotExists
+	b.values = nil
+	return b
+}
+
 // Build returns the built filter as a string.
 func (b *filterBuilder) Build() (string, error) {
+	var sb strings.Builder
+	sb.Grow(estimateFilterSize(b))
+	if err := b.appendTo(&sb, filterStyle{}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the filter into sb in style.
+func (b *filterBuilder) appendTo(sb *strings.Builder, style filterStyle) error {
 	if b.key == "" {
-		return "", fmt.Errorf("filter key is required")
+		return ErrEmptyFilterKey
 	}
 
 	switch b.operation {
 	case Equal:
 		if len(b.values) != 1 {
-			return "", fmt.Errorf("equal filter requires exactly one value")
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "equal filter requires exactly one value"}
 		}
-		return fmt.Sprintf("%s:%s", b.key, b.values[0]), nil
+		sb.WriteString(b.key)
+		sb.WriteByte(':')
+		sb.WriteString(b.formatValue(b.values[0]))
 	case NotEqual:
 		if len(b.values) != 1 {
-			return "", fmt.Errorf("not equal filter requires exactly one value")
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "not equal filter requires exactly one value"}
 		}
-		return fmt.Sprintf("!%s:%s", b.key, b.values[0]), nil
+		style.writeNegation(sb)
+		sb.WriteString(b.key)
+		sb.WriteByte(':')
+		sb.WriteString(b.formatValue(b.values[0]))
 	case In:
 		if len(b.values) == 0 {
-			return "", fmt.Errorf("in filter requires at least one value")
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "in filter requires at least one value"}
 		}
-		valueList := strings.Join(b.values, ",")
-		return fmt.Sprintf("%s IN (%s)", b.key, valueList), nil
+		sb.WriteString(b.key)
+		sb.WriteString(" IN (")
+		b.writeValueList(sb, style.listQuoting)
+		sb.WriteByte(')')
 	case NotIn:
 		if len(b.values) == 0 {
-			return "", fmt.Errorf("not in filter requires at least one value")
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "not in filter requires at least one value"}
+		}
+		sb.WriteString(b.key)
+		sb.WriteString(" NOT IN (")
+		b.writeValueList(sb, style.listQuoting)
+		sb.WriteByte(')')
+	case GreaterThan, GreaterOrEqual, LessThan, LessOrEqual:
+		if len(b.values) != 1 {
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "comparison filter requires exactly one value"}
+		}
+		if _, err := strconv.ParseFloat(b.values[0], 64); err != nil {
+			return &ValidationError{Component: "filter value", Value: b.values[0], Reason: "comparison filter requires a numeric value"}
 		}
-		valueList := strings.Join(b.values, ",")
-		return fmt.Sprintf("%s NOT IN (%s)", b.key, valueList), nil
+		sb.WriteString(b.key)
+		sb.WriteString(comparisonSeparators[b.operation])
+		sb.WriteString(b.values[0])
+	case Regex, NotRegex:
+		if len(b.values) != 1 || b.values[0] == "" {
+			return &ValidationError{Component: "filter value", Value: b.key, Reason: "regex filter requires a pattern"}
+		}
+		if _, err := regexp.Compile(b.values[0]); err != nil {
+			return &ValidationError{Component: "filter value", Value: b.values[0], Reason: "invalid regular expression"}
+		}
+		if b.operation == NotRegex {
+			style.writeNegation(sb)
+		}
+		sb.WriteString(b.key)
+		sb.WriteString(":~")
+		sb.WriteString(b.formatValue(b.values[0]))
+	case Exists:
+		sb.WriteString(b.key)
+		sb.WriteString(":*")
+	case NotExists:
+		style.writeNegation(sb)
+		sb.WriteString(b.key)
+		sb.WriteString(":*")
 	default:
-		return "", fmt.Errorf("unknown filter operation")
+		return ErrUnknownFilterOperation
+	}
+	return nil
+}
+
+// negated reports whether the filter renders with a leading negation.
+func (b *filterBuilder) negated() bool {
+	return b.operation == NotEqual || b.operation == NotRegex || b.operation == NotExists
+}
+
+// formatValue renders value, one of the filter's values, quoting it when
+// required or when it was written quoted in a parsed query. Single quotes
+// are kept where the value allows them.
+func (b *filterBuilder) formatValue(value string) string {
+	switch q := b.quotes[value]; {
+	case q == '\'' && !strings.Contains(value, "'"):
+		return "'" + value + "'"
+	case q != 0:
+		return quoteValue(value)
+	}
+	return formatValue(value)
+}
+
+// writeValueList renders the values of an IN or NOT IN filter as a
+// comma-separated list, quoting values as selected by quoting.
+func (b *filterBuilder) writeValueList(sb *strings.Builder, quoting ListQuoting) {
+	for i, v := range b.values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if quoting == QuoteAlways {
+			sb.WriteString(quoteValue(v))
+		} else {
+			sb.WriteString(b.formatValue(v))
+		}
 	}
 }
@@ -0,0 +1,418 @@
+package metric
+
+import (
+	"slices"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// RemoveFilter removes every filter on key from the query, including
+// filters nested in groups. Groups left empty are removed as well, and a
+// query left without filters renders its empty scope. Groups are edited in
+// place, so groups obtained from GetFilters or FindGroup see the change.
+func (b *metricQueryBuilder) RemoveFilter(key string) QueryBuilder {
+	b = b.mutable("RemoveFilter")
+	b.filters = removeFilterKey(b.filters, key)
+	return b
+}
+
+// RemoveFilter removes every filter on key from the metric queries in the
+// expression, and from any filters added to it.
+func (b *expressionQueryBuilder) RemoveFilter(key string) QueryBuilder {
+	b = b.mutable("RemoveFilter")
+	b.addedFilters = removeFilterKey(b.addedFilters, key)
+	b.removedKeys = append(b.removedKeys, key)
+	return b
+}
+
+// ReplaceFilter replaces the first filter on key, at the top level or in a
+// group, with filter and removes any other filters on key. If the query
+// has no filter on key, filter is appended.
+func (b *metricQueryBuilder) ReplaceFilter(key string, filter FilterExpression) QueryBuilder {
+	b = b.mutable("ReplaceFilter")
+	replaced := false
+	b.filters = replaceFilterKey(b.filters, key, filter, &replaced)
+	if !replaced {
+		b.filters = append(b.filters, filter)
+	}
+	b.hooks.fireFilterAdded(filter)
+	return b
+}
+
+// UpsertFilter replaces the filters on filter's key with filter, or appends
+// it if the query has none. It is shorthand for
+// ReplaceFilter(filter.Key(), filter).
+func (b *metricQueryBuilder) UpsertFilter(filter FilterBuilder) QueryBuilder {
+	return b.ReplaceFilter(filter.Key(), filter)
+}
+
+// ReplaceFilter removes every filter on key from the expression, as
+// RemoveFilter does, and adds filter to each of its metric queries.
+func (b *expressionQueryBuilder) ReplaceFilter(key string, filter FilterExpression) QueryBuilder {
+	return b.RemoveFilter(key).Filter(filter)
+}
+
+// UpsertFilter is shorthand for ReplaceFilter(filter.Key(), filter).
+func (b *expressionQueryBuilder) UpsertFilter(filter FilterBuilder) QueryBuilder {
+	return b.ReplaceFilter(filter.Key(), filter)
+}
+
+// replaceFilterKey returns filters with the first filter on key replaced by
+// filter, recording the replacement in replaced, and every later filter on
+// key removed. The returned slice shares filters' backing array.
+func replaceFilterKey(filters []FilterExpression, key string, filter FilterExpression, replaced *bool) []FilterExpression {
+	out := filters[:0]
+	for _, f := range filters {
+		if f, keep := replaceFilterKeyIn(f, key, filter, replaced); keep {
+			out = append(out, f)
+		}
+	}
+	clear(filters[len(out):])
+	return out
+}
+
+// replaceFilterKeyIn applies replaceFilterKey to a single expression,
+// returning its replacement and whether it is kept.
+func replaceFilterKeyIn(f FilterExpression, key string, filter FilterExpression, replaced *bool) (FilterExpression, bool) {
+	switch e := f.(type) {
+	case *filterBuilder:
+		if e.key == key {
+			if *replaced {
+				return nil, false
+			}
+			*replaced = true
+			return filter, true
+		}
+	case *filterGroupBuilder:
+		e.edit(func(f FilterExpression) (FilterExpression, bool) {
+			return replaceFilterKeyIn(f, key, filter, replaced)
+		})
+		return e, len(e.expressions) > 0
+	}
+	return f, true
+}
+
+// ClearFilters removes every filter from the query and detaches any scope,
+// so that the query renders its empty scope ({*} by default) while keeping
+// its aggregator, group by and functions.
+func (b *metricQueryBuilder) ClearFilters() QueryBuilder {
+	b = b.mutable("ClearFilters")
+	b.filters = make([]FilterExpression, 0)
+	b.scope = nil
+	return b
+}
+
+// ClearFilters removes every filter from the metric queries in the
+// expression, reverting each to {*}, and drops any added filters and
+// scope.
+func (b *expressionQueryBuilder) ClearFilters() QueryBuilder {
+	b = b.mutable("ClearFilters")
+	b.addedFilters = []FilterExpression{}
+	b.scope = nil
+	b.removedKeys = nil
+	b.cleared = true
+	return b
+}
+
+// editsOriginal reports whether filters, group by keys or functions were
+// removed from, filters cleared in, or a count modifier applied to the
+// original expression.
+func (b *expressionQueryBuilder) editsOriginal() bool {
+	return b.cleared || len(b.removedKeys) > 0 || len(b.removedGroup) > 0 || len(b.removedFuncs) > 0 ||
+		b.countMode != ""
+}
+
+// editOriginal applies the removals recorded on b to q, a metric query of
+// the original expression.
+func (b *expressionQueryBuilder) editOriginal(q *ddqp.Query) {
+	if len(b.removedGroup) > 0 && len(q.Grouping) > 0 {
+		q.Grouping = removeGroupByKeys(q.Grouping, b.removedGroup)
+		if len(q.Grouping) == 0 {
+			q.By, q.Grouping = "", nil
+		}
+	}
+	if len(b.removedFuncs) > 0 {
+		q.Function = slices.DeleteFunc(q.Function, func(fn *ddqp.Function) bool {
+			return slices.Contains(b.removedFuncs, fn.Name)
+		})
+	}
+	if b.countMode != "" {
+		q.Function = slices.DeleteFunc(q.Function, func(fn *ddqp.Function) bool {
+			return isCountModifier(fn.Name)
+		})
+		q.Function = slices.Insert(q.Function, 0, &ddqp.Function{Name: b.countMode})
+	}
+	if b.cleared {
+		q.Filters = &ddqp.MetricFilter{Left: &ddqp.Param{Asterisk: true}}
+		return
+	}
+	removeDDQPFilterParams(q, b.removedKeys)
+}
+
+// HasFilter reports whether the query, including its scope, filters on
+// key anywhere, including inside groups.
+func (b *metricQueryBuilder) HasFilter(key string) bool {
+	return len(b.GetFiltersByKey(key)) > 0
+}
+
+// GetFiltersByKey returns every filter on key in the query, including its
+// scope and filters nested in groups, in the order they render. A frozen
+// builder returns copies.
+func (b *metricQueryBuilder) GetFiltersByKey(key string) []FilterBuilder {
+	var out []FilterBuilder
+	collectFiltersByKey(b.scopedFilters(), key, &out)
+	if b.frozen {
+		for i, f := range out {
+			out[i] = cloneFilter(f).(FilterBuilder)
+		}
+	}
+	return out
+}
+
+// HasFilter reports whether any metric query in the expression filters on
+// key, once added and removed filters are applied.
+func (b *expressionQueryBuilder) HasFilter(key string) bool {
+	return len(b.GetFiltersByKey(key)) > 0
+}
+
+// GetFiltersByKey returns every filter on key in the metric queries of the
+// expression, once added and removed filters are applied. The filters are
+// copies; changing them does not change the expression. It returns nil if
+// the expression cannot be rendered.
+func (b *expressionQueryBuilder) GetFiltersByKey(key string) []FilterBuilder {
+	query, err := b.render(DivisionUnguarded)
+	if err != nil {
+		return nil
+	}
+	parsed, err := parseGeneric(query)
+	if err != nil {
+		return nil
+	}
+
+	var out []FilterBuilder
+	collect := func(q *ddqp.Query) {
+		if q.Filters != nil {
+			collectDDQPFiltersByKey(append([]*ddqp.Param{q.Filters.Left}, q.Filters.Parameters...), key, &out)
+		}
+	}
+	switch {
+	case parsed.MetricQuery != nil:
+		walkMetricQuery(parsed.MetricQuery, collect)
+	case parsed.MetricExpression != nil:
+		walkMetricQueries(parsed.MetricExpression.GroupedExpression, collect)
+	}
+	return out
+}
+
+// collectFiltersByKey appends the filters on key in filters to out,
+// descending into groups.
+func collectFiltersByKey(filters []FilterExpression, key string, out *[]FilterBuilder) {
+	for _, f := range filters {
+		switch e := f.(type) {
+		case *filterGroupBuilder:
+			collectFiltersByKey(e.expressions, key, out)
+		case FilterBuilder:
+			if e.Key() == key {
+				*out = append(*out, e)
+			}
+		}
+	}
+}
+
+// collectDDQPFiltersByKey appends the simple filters on key in params to
+// out, descending into grouped filters. A simple filter preceded by NOT is
+// returned negated.
+func collectDDQPFiltersByKey(params []*ddqp.Param, key string, out *[]FilterBuilder) {
+	negated := false
+	for _, p := range params {
+		switch {
+		case p == nil:
+		case p.Separator != nil:
+			negated = len(leadingNegation([]*ddqp.Param{p})) > 0
+			continue
+		case p.GroupedFilter != nil:
+			collectDDQPFiltersByKey(p.GroupedFilter.Parameters, key, out)
+		case p.SimpleFilter != nil && p.SimpleFilter.FilterKey == key:
+			sf := *p.SimpleFilter
+			sf.Negative = sf.Negative != negated
+			if f, err := convertSimpleFilter(&sf); err == nil {
+				*out = append(*out, f)
+			}
+		}
+		negated = false
+	}
+}
+
+// removeFilterKey returns filters without the filters on key, descending
+// into groups. The returned slice shares filters' backing array.
+func removeFilterKey(filters []FilterExpression, key string) []FilterExpression {
+	out := filters[:0]
+	for _, f := range filters {
+		if keepWithoutKey(f, key) {
+			out = append(out, f)
+		}
+	}
+	clear(filters[len(out):])
+	return out
+}
+
+// keepWithoutKey removes the filters on key from f if it is a group and
+// reports whether f is kept: it is not a filter on key or an emptied group.
+func keepWithoutKey(f FilterExpression, key string) bool {
+	switch e := f.(type) {
+	case *filterBuilder:
+		return e.key != key
+	case *filterGroupBuilder:
+		e.edit(func(f FilterExpression) (FilterExpression, bool) {
+			return f, keepWithoutKey(f, key)
+		})
+		return len(e.expressions) > 0
+	}
+	return true
+}
+
+// removeDDQPFilterParams removes the filters on keys from q.
+func removeDDQPFilterParams(q *ddqp.Query, keys []string) {
+	if q.Filters == nil || len(keys) == 0 {
+		return
+	}
+	params := make([]*ddqp.Param, 0, len(q.Filters.Parameters)+1)
+	if q.Filters.Left != nil {
+		params = append(params, q.Filters.Left)
+	}
+	params = append(params, q.Filters.Parameters...)
+
+	for _, key := range keys {
+		params = removeDDQPParams(params, key)
+	}
+	if len(params) == 0 {
+		params = []*ddqp.Param{{Asterisk: true}}
+	}
+	q.Filters.Left, q.Filters.Parameters = params[0], params[1:]
+}
+
+// removeDDQPParams removes the simple filters on key from a flat list of
+// filter operands and separators, descending into grouped filters. The
+// separators joining a removed operand to the one before it are removed
+// with it; when the first operand is removed, only a negation is kept
+// from the separators that joined it to the next, folded into the next
+// operand's ! when it is a simple filter.
+func removeDDQPParams(params []*ddqp.Param, key string) []*ddqp.Param {
+	var out, pending []*ddqp.Param
+	operands := 0
+	for _, p := range params {
+		if p.Separator != nil {
+			pending = append(pending, p)
+			continue
+		}
+
+		switch {
+		case p.SimpleFilter != nil && p.SimpleFilter.FilterKey == key:
+			pending = nil
+			continue
+		case p.GroupedFilter != nil:
+			p.GroupedFilter.Parameters = removeDDQPParams(p.GroupedFilter.Parameters, key)
+			if len(p.GroupedFilter.Parameters) == 0 {
+				pending = nil
+				continue
+			}
+		}
+
+		if operands == 0 {
+			pending = leadingNegation(pending)
+			// Negate simple filters with ! rather than a leading NOT
+			if len(pending) > 0 && p.SimpleFilter != nil {
+				p.SimpleFilter.Negative = !p.SimpleFilter.Negative
+				pending = nil
+			}
+		}
+		out = append(out, pending...)
+		out = append(out, p)
+		pending = nil
+		operands++
+	}
+	return out
+}
+
+// leadingNegation returns a lone NOT separator if any of seps negates the
+// operand that follows them, and nil otherwise.
+func leadingNegation(seps []*ddqp.Param) []*ddqp.Param {
+	for _, s := range seps {
+		if s.Separator.Not || s.Separator.AndNot || s.Separator.OrNot {
+			return []*ddqp.Param{{Separator: &ddqp.FilterValueSeparator{Not: true}}}
+		}
+	}
+	return nil
+}
+
+// walkMetricQueries calls fn with every metric query in ge, descending
+// through subexpressions and aggregator functions.
+func walkMetricQueries(ge *ddqp.GroupedExpression, fn func(*ddqp.Query)) {
+	walkQueryNodes(ge, func(mq *ddqp.MetricQuery) { fn(mq.Query) })
+}
+
+// walkQueryNodes calls fn with the innermost node of every metric query in
+// ge, the one holding its ddqp.Query, in the order they appear.
+func walkQueryNodes(ge *ddqp.GroupedExpression, fn func(*ddqp.MetricQuery)) {
+	if ge == nil {
+		return
+	}
+	walkTerm(ge.Left, fn)
+	for _, rt := range ge.Right {
+		if rt != nil {
+			walkTerm(rt.Term, fn)
+		}
+	}
+}
+
+// walkTerm calls fn with the innermost node of every metric query in t.
+func walkTerm(t *ddqp.Term, fn func(*ddqp.MetricQuery)) {
+	if t == nil || t.Left == nil {
+		return
+	}
+	walkExprValue(t.Left.Base, fn)
+	for _, of := range t.Right {
+		if of != nil && of.Factor != nil {
+			walkExprValue(of.Factor.Base, fn)
+		}
+	}
+}
+
+// walkExprValue calls fn with the innermost node of every metric query in
+// v.
+func walkExprValue(v *ddqp.ExprValue, fn func(*ddqp.MetricQuery)) {
+	switch {
+	case v == nil:
+	case v.Subexpression != nil:
+		walkQueryNodes(v.Subexpression.GroupedExpression, fn)
+	case v.MetricQuery != nil:
+		if node := innermostQuery(v.MetricQuery); node != nil {
+			fn(node)
+		}
+	case v.ExprAggregatorFuction != nil:
+		walkQueryNodes(v.ExprAggregatorFuction.Body, fn)
+	}
+}
+
+// walkMetricQuery calls fn with the query in mq, descending through any
+// wrapping aggregator functions.
+func walkMetricQuery(mq *ddqp.MetricQuery, fn func(*ddqp.Query)) {
+	if node := innermostQuery(mq); node != nil {
+		fn(node.Query)
+	}
+}
+
+// innermostQuery returns the node of mq holding its ddqp.Query, inside any
+// wrapping aggregator functions, or nil if there is none.
+func innermostQuery(mq *ddqp.MetricQuery) *ddqp.MetricQuery {
+	for mq != nil {
+		if mq.Query != nil {
+			return mq
+		}
+		if mq.AggregatorFuction == nil {
+			return nil
+		}
+		mq = mq.AggregatorFuction.Body
+	}
+	return nil
+}
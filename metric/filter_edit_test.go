@@ -0,0 +1,326 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestRemoveFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() (metric.QueryBuilder, error)
+		key      string
+		expected string
+	}{
+		{
+			name: "top-level filters",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("avg:system.cpu.idle{availability-zone:us-east-1a, env:prod, !availability-zone:us-east-1b} by {host}")
+			},
+			key:      "availability-zone",
+			expected: "avg:system.cpu.idle{env:prod} by {host}",
+		},
+		{
+			name: "last filter reverts to wildcard",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("avg:system.cpu.idle{availability-zone:us-east-1a}")
+			},
+			key:      "availability-zone",
+			expected: "avg:system.cpu.idle{*}",
+		},
+		{
+			name: "nested groups",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("env").Equal("prod")).
+					Filter(metric.All(
+						metric.NewFilterBuilder("host").Equal("web-1"),
+						metric.Any(
+							metric.NewFilterBuilder("availability-zone").Equal("us-east-1a"),
+							metric.NewFilterBuilder("availability-zone").Equal("us-east-1b"),
+						),
+					)), nil
+			},
+			key:      "availability-zone",
+			expected: "system.cpu.idle{(env:prod AND host:web-1)}",
+		},
+		{
+			name: "missing key is a no-op",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("system.cpu.idle{env:prod}")
+			},
+			key:      "host",
+			expected: "system.cpu.idle{env:prod}",
+		},
+		{
+			name: "every query in an expression",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("sum:requests.errors{env:prod, availability-zone:a} / sum:requests.total{availability-zone:a}")
+			},
+			key:      "availability-zone",
+			expected: "sum:requests.errors{env:prod} / sum:requests.total{*}",
+		},
+		{
+			name: "expression groups keep negation",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("sum:requests.errors{availability-zone:a AND NOT env:staging} / sum:requests.total{*}")
+			},
+			key:      "availability-zone",
+			expected: "sum:requests.errors{!env:staging} / sum:requests.total{*}",
+		},
+		{
+			name: "filters added to an expression",
+			builder: func() (metric.QueryBuilder, error) {
+				b, err := metric.ParseQuery("sum:requests.errors{env:prod} / sum:requests.total{env:prod}")
+				if err != nil {
+					return nil, err
+				}
+				return b.Filter(metric.NewFilterBuilder("availability-zone").Equal("a")), nil
+			},
+			key:      "availability-zone",
+			expected: "sum:requests.errors{env:prod} / sum:requests.total{env:prod}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := tt.builder()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := builder.RemoveFilter(tt.key).Build()
+			if err != nil {
+				t.Fatalf("Build() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReplaceFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		edit     func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:  "replace in place",
+			query: "avg:system.cpu.idle{env:staging, host:web-1} by {host}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.ReplaceFilter("env", metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{env:prod, host:web-1} by {host}",
+		},
+		{
+			name:  "replace with a different expression",
+			query: "avg:system.cpu.idle{env:staging, host:web-1}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.ReplaceFilter("host", metric.NewFilterBuilder("host").In("web-1", "web-2"))
+			},
+			expected: "avg:system.cpu.idle{env:staging, host IN (web-1,web-2)}",
+		},
+		{
+			name:  "later duplicates are removed",
+			query: "avg:system.cpu.idle{env:staging, host:web-1, !env:dev}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.ReplaceFilter("env", metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{env:prod, host:web-1}",
+		},
+		{
+			name:  "replace inside a group",
+			query: "avg:system.cpu.idle{env:prod AND (host:web-1 OR host:web-2)}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.ReplaceFilter("host", metric.NewFilterBuilder("host").HasPrefix("web-"))
+			},
+			expected: "avg:system.cpu.idle{(env:prod AND host:web-*)}",
+		},
+		{
+			name:  "append when missing",
+			query: "avg:system.cpu.idle{host:web-1}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.UpsertFilter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{host:web-1, env:prod}",
+		},
+		{
+			name:  "upsert existing",
+			query: "avg:system.cpu.idle{env:staging, host:web-1}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.UpsertFilter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{env:prod, host:web-1}",
+		},
+		{
+			name:  "upsert in an expression",
+			query: "sum:requests.errors{env:staging} / sum:requests.total{env:staging}",
+			edit: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.UpsertFilter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "sum:requests.errors{*, env:prod} / sum:requests.total{*, env:prod}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error: %v", err)
+			}
+			got, err := tt.edit(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClearFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() (metric.QueryBuilder, error)
+		expected string
+	}{
+		{
+			name: "parsed query keeps other components",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.ParseQuery("avg(5m):system.cpu.idle{env:prod AND (host:web-1 OR host:web-2)} by {host}.rollup(avg, 60)")
+			},
+			expected: "avg(5m):system.cpu.idle{*} by {host}.rollup(avg, 60)",
+		},
+		{
+			name: "scope is detached",
+			builder: func() (metric.QueryBuilder, error) {
+				scope := metric.NewScopeBuilder().Filter(metric.NewFilterBuilder("env").Equal("prod"))
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Scope(scope).
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")), nil
+			},
+			expected: "system.cpu.idle{*}",
+		},
+		{
+			name: "expression",
+			builder: func() (metric.QueryBuilder, error) {
+				b, err := metric.ParseQuery("sum:requests.errors{env:prod} / sum:requests.total{env:prod, service:web}")
+				if err != nil {
+					return nil, err
+				}
+				return b.Filter(metric.NewFilterBuilder("host").Equal("web-1")).RemoveFilter("service"), nil
+			},
+			expected: "sum:requests.errors{*} / sum:requests.total{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := tt.builder()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := builder.ClearFilters().Build()
+			if err != nil {
+				t.Fatalf("Build() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	// Filters added after clearing are kept
+	builder, err := metric.ParseQuery("sum:requests.errors{env:staging} / sum:requests.total{env:staging}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error: %v", err)
+	}
+	got, err := builder.ClearFilters().Filter(metric.NewFilterBuilder("env").Equal("prod")).Build()
+	if err != nil {
+		t.Fatalf("Build() error: %v", err)
+	}
+	if expected := "sum:requests.errors{*, env:prod} / sum:requests.total{*, env:prod}"; got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+}
+
+func TestGetFiltersByKey(t *testing.T) {
+	scope := metric.NewScopeBuilder().Filter(metric.NewFilterBuilder("team").Equal("core"))
+	parsed, err := metric.ParseQuery("avg:system.cpu.idle{env:prod AND (host:web-1 OR host:web-2)}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error: %v", err)
+	}
+	expr, err := metric.ParseQuery("sum:requests.errors{host:web-1} / sum:requests.total{env:prod AND NOT host:web-2}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		builder  metric.QueryBuilder
+		key      string
+		expected []string
+	}{
+		{
+			name:     "nested groups",
+			builder:  parsed,
+			key:      "host",
+			expected: []string{"host:web-1", "host:web-2"},
+		},
+		{
+			name:     "top level",
+			builder:  parsed,
+			key:      "env",
+			expected: []string{"env:prod"},
+		},
+		{
+			name:     "missing key",
+			builder:  parsed,
+			key:      "service",
+			expected: nil,
+		},
+		{
+			name:     "scope",
+			builder:  metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Scope(scope),
+			key:      "team",
+			expected: []string{"team:core"},
+		},
+		{
+			name:     "expression",
+			builder:  expr,
+			key:      "host",
+			expected: []string{"host:web-1", "!host:web-2"},
+		},
+		{
+			name:     "expression with added and removed filters",
+			builder:  expr.Clone().RemoveFilter("host").Filter(metric.NewFilterBuilder("host").NotEqual("web-3")),
+			key:      "host",
+			expected: []string{"!host:web-3", "!host:web-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := tt.builder.GetFiltersByKey(tt.key)
+			if got := tt.builder.HasFilter(tt.key); got != (len(tt.expected) > 0) {
+				t.Errorf("HasFilter(%q) = %v, want %v", tt.key, got, len(tt.expected) > 0)
+			}
+			if len(filters) != len(tt.expected) {
+				t.Fatalf("GetFiltersByKey(%q) returned %d filters, want %d", tt.key, len(filters), len(tt.expected))
+			}
+			for i, f := range filters {
+				got, err := f.Build()
+				if err != nil {
+					t.Fatalf("Build() error: %v", err)
+				}
+				if got != tt.expected[i] {
+					t.Errorf("filter %d = %q, want %q", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package metric
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +18,54 @@ const (
 	OrOperator
 )
 
+// String returns the operator as it appears in a query, "AND" or "OR".
+func (o GroupOperator) String() string {
+	if o == OrOperator {
+		return "OR"
+	}
+	return "AND"
+}
+
+// MixedOperatorMode controls what a filter group does when And and Or are
+// both used to join its expressions.
+type MixedOperatorMode int
+
+const (
+	// MixedOperatorsOrdered keeps the operator each expression was joined
+	// with, so that And(a).And(b).Or(c).And(d) renders (a AND b OR c AND d)
+	// and Datadog's precedence, AND before OR, applies. It is the default,
+	// and how parsed groups mixing AND and OR are reconstructed.
+	MixedOperatorsOrdered MixedOperatorMode = iota
+	// MixedOperatorsError makes Build fail with a *MixedOperatorError.
+	MixedOperatorsError
+	// MixedOperatorsNest moves the expressions joined so far into a nested
+	// group whenever the operator changes, so that calls apply left to
+	// right: And(a).And(b).Or(c) renders ((a AND b) OR c).
+	MixedOperatorsNest
+)
+
+// MixedOperatorError is returned when a filter group joins its expressions
+// with both AND and OR. It wraps ErrMixedOperators.
+type MixedOperatorError struct {
+	// Index is the position in the group of the expression joined with the
+	// conflicting operator.
+	Index int
+	// Operator is the group's operator.
+	Operator GroupOperator
+	// Conflicting is the operator the expression was joined with.
+	Conflicting GroupOperator
+}
+
+// Error returns a description of the conflicting operators.
+func (e *MixedOperatorError) Error() string {
+	return fmt.Sprintf("filter group joins expression %d with %s but earlier expressions with %s; use a nested group", e.Index, e.Conflicting, e.Operator)
+}
+
+// Unwrap returns ErrMixedOperators.
+func (e *MixedOperatorError) Unwrap() error {
+	return ErrMixedOperators
+}
+
 // FilterGroupBuilder provides a fluent interface for building filter groups with boolean logic.
 // FilterGroupBuilder implements FilterExpression.
 type FilterGroupBuilder interface {
@@ -28,6 +79,26 @@ type FilterGroupBuilder interface {
 
 	// Not negates the entire group (wraps in NOT (...)).
 	Not() FilterGroupBuilder
+
+	// MixedOperators sets how the group handles And and Or both being used
+	// to join its expressions. It applies to expressions added after it is
+	// called.
+	MixedOperators(mode MixedOperatorMode) FilterGroupBuilder
+
+	// Normalize rewrites the group, and the groups nested in it, into a
+	// minimal equivalent form: single-expression groups are flattened,
+	// nested groups with the same operator are merged and repeated
+	// expressions are removed.
+	Normalize() FilterGroupBuilder
+
+	// Expressions returns the members of the group in order.
+	Expressions() []FilterExpression
+
+	// Remove removes the expression at index i.
+	Remove(i int) FilterGroupBuilder
+
+	// ReplaceAt replaces the expression at index i with expr.
+	ReplaceAt(i int, expr FilterExpression) FilterGroupBuilder
 }
 
 // filterGroupBuilder is the concrete implementation of the FilterGroupBuilder interface.
@@ -35,6 +106,15 @@ type filterGroupBuilder struct {
 	expressions []FilterExpression
 	operator    GroupOperator // The operator used in this group (AND or OR)
 	negated     bool
+	mixed       MixedOperatorMode
+	joined      bool  // set once And, Or, Any or All has set the operator
+	err         error // first error recorded while adding or editing expressions
+
+	// ops holds, in MixedOperatorsOrdered mode, the operator joining each
+	// expression to the one before it; ops[0] is unused. It is nil until
+	// the operator first changes, and in the other modes, where operator
+	// joins every expression.
+	ops []GroupOperator
 }
 
 // NewFilterGroupBuilder creates a new filter group builder.
@@ -46,36 +126,226 @@ func NewFilterGroupBuilder() FilterGroupBuilder {
 	}
 }
 
+// Any creates a filter group matching series that satisfy at least one of
+// exprs, joined with OR.
+func Any(exprs ...FilterExpression) FilterGroupBuilder {
+	return &filterGroupBuilder{
+		expressions: append(make([]FilterExpression, 0, len(exprs)), exprs...),
+		operator:    OrOperator,
+		joined:      true,
+	}
+}
+
+// All creates a filter group matching series that satisfy every one of
+// exprs, joined with AND.
+func All(exprs ...FilterExpression) FilterGroupBuilder {
+	return &filterGroupBuilder{
+		expressions: append(make([]FilterExpression, 0, len(exprs)), exprs...),
+		operator:    AndOperator,
+		joined:      true,
+	}
+}
+
 // And adds a filter or nested group with AND operator.
-// Sets the group operator to AND if this is the first expression added.
+// The first call to And or Or sets the group operator; joining later
+// expressions with OR is handled according to the group's
+// MixedOperatorMode.
 func (b *filterGroupBuilder) And(expr FilterExpression) FilterGroupBuilder {
-	if len(b.expressions) == 0 {
-		// First expression - set operator to AND
-		b.operator = AndOperator
-		b.expressions = append(b.expressions, expr)
-	} else {
-		// Mixing operators requires a nested group
-		// For now, we'll allow it but users should use nested groups for clarity
-		b.expressions = append(b.expressions, expr)
-	}
-	return b
+	return b.add(AndOperator, expr)
 }
 
 // Or adds a filter or nested group with OR operator.
-// Sets the group operator to OR if this is the first expression added.
+// The first call to And or Or sets the group operator; joining later
+// expressions with AND is handled according to the group's
+// MixedOperatorMode.
 func (b *filterGroupBuilder) Or(expr FilterExpression) FilterGroupBuilder {
-	if len(b.expressions) == 0 {
-		// First expression - set operator to OR
-		b.operator = OrOperator
-		b.expressions = append(b.expressions, expr)
-	} else {
-		// Mixing operators requires a nested group
-		// For now, we'll allow it but users should use nested groups for clarity
-		b.expressions = append(b.expressions, expr)
+	return b.add(OrOperator, expr)
+}
+
+// MixedOperators sets how the group handles And and Or both being used to
+// join its expressions.
+func (b *filterGroupBuilder) MixedOperators(mode MixedOperatorMode) FilterGroupBuilder {
+	b.mixed = mode
+	if mode == MixedOperatorsOrdered && b.ops == nil {
+		// Expressions added so far keep the group operator
+		b.ops = make([]GroupOperator, len(b.expressions))
+		for i := range b.ops {
+			b.ops[i] = b.operator
+		}
+	}
+	return b
+}
+
+// add joins expr to the group with op.
+func (b *filterGroupBuilder) add(op GroupOperator, expr FilterExpression) FilterGroupBuilder {
+	switch {
+	case b.ops != nil:
+		b.ops = append(b.ops, op)
+		if len(b.expressions) == 1 {
+			b.operator = op
+		}
+	case !b.joined && len(b.expressions) <= 1:
+		// The first call sets the operator of a group built up one
+		// expression at a time
+		b.operator = op
+	case op == b.operator:
+	case b.mixed == MixedOperatorsOrdered:
+		// Start recording operators at the first change
+		return b.MixedOperators(MixedOperatorsOrdered).(*filterGroupBuilder).add(op, expr)
+	case b.mixed == MixedOperatorsNest:
+		if len(b.expressions) > 1 {
+			nested := &filterGroupBuilder{expressions: b.expressions, operator: b.operator, joined: true}
+			b.expressions = []FilterExpression{nested}
+		}
+		b.operator = op
+	case b.err == nil:
+		b.err = &MixedOperatorError{Index: len(b.expressions), Operator: b.operator, Conflicting: op}
 	}
+	b.joined = true
+	b.expressions = append(b.expressions, expr)
 	return b
 }
 
+// operatorAt returns the operator joining the expression at i to the one
+// before it.
+func (b *filterGroupBuilder) operatorAt(i int) GroupOperator {
+	if b.ops != nil {
+		return b.ops[i]
+	}
+	return b.operator
+}
+
+// edit replaces each expression in the group with the expression fn
+// returns for it, dropping those for which fn returns false. Operators
+// recorded in MixedOperatorsOrdered mode stay with their expressions.
+func (b *filterGroupBuilder) edit(fn func(FilterExpression) (FilterExpression, bool)) {
+	out := b.expressions[:0]
+	var ops []GroupOperator
+	if b.ops != nil {
+		ops = b.ops[:0]
+	}
+	for i, expr := range b.expressions {
+		expr, keep := fn(expr)
+		if !keep {
+			continue
+		}
+		out = append(out, expr)
+		if b.ops != nil {
+			ops = append(ops, b.ops[i])
+		}
+	}
+	clear(b.expressions[len(out):])
+	b.expressions, b.ops = out, ops
+}
+
+// Normalize rewrites the group in place into a minimal equivalent form.
+// Nested groups are normalized first; a nested group that is not negated is
+// replaced by its expression when it has only one, and merged into the
+// group when it joins its expressions with the group's operator. Repeated
+// expressions are then removed, keeping the first. Groups with ordered
+// operators keep their expressions, bar flattening, since merging or
+// removing them would change how the rest combine.
+func (b *filterGroupBuilder) Normalize() FilterGroupBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	expressions := make([]FilterExpression, 0, len(b.expressions))
+	for _, expr := range b.expressions {
+		g, ok := expr.(*filterGroupBuilder)
+		if !ok {
+			expressions = append(expressions, expr)
+			continue
+		}
+		g.Normalize()
+		switch {
+		case g.negated || g.err != nil:
+			expressions = append(expressions, g)
+		case len(g.expressions) == 1:
+			expressions = append(expressions, g.expressions[0])
+		case b.ops == nil && g.ops == nil && g.operator == b.operator:
+			expressions = append(expressions, g.expressions...)
+		default:
+			expressions = append(expressions, g)
+		}
+	}
+
+	if b.ops == nil {
+		seen := make(map[string]bool, len(expressions))
+		unique := expressions[:0]
+		for _, expr := range expressions {
+			rendered, err := expr.Build()
+			if err == nil && seen[rendered] {
+				continue
+			}
+			seen[rendered] = true
+			unique = append(unique, expr)
+		}
+		expressions = unique
+	}
+
+	// A group left wrapping a single group takes on its contents
+	if g, ok := singleGroup(expressions); ok && g.err == nil {
+		expressions, b.operator, b.ops = g.expressions, g.operator, g.ops
+		b.joined = b.joined || g.joined
+		b.negated = b.negated != g.negated
+	}
+	b.expressions = expressions
+	return b
+}
+
+// singleGroup returns the group in expressions if it is their only member.
+func singleGroup(expressions []FilterExpression) (*filterGroupBuilder, bool) {
+	if len(expressions) != 1 {
+		return nil, false
+	}
+	g, ok := expressions[0].(*filterGroupBuilder)
+	return g, ok
+}
+
+// Expressions returns the members of the group in order. The slice is a
+// copy, so it stays valid while the group is edited, but the members are
+// shared: modifying a nested group modifies this one.
+func (b *filterGroupBuilder) Expressions() []FilterExpression {
+	return append([]FilterExpression(nil), b.expressions...)
+}
+
+// Remove removes the expression at index i. When the first expression is
+// removed the next becomes first; otherwise the operator joining the
+// removed expression to the one before it goes with it. An index out of
+// range is reported by Build.
+func (b *filterGroupBuilder) Remove(i int) FilterGroupBuilder {
+	if !b.checkIndex(i) {
+		return b
+	}
+	b.expressions = slices.Delete(b.expressions, i, i+1)
+	if b.ops != nil {
+		b.ops = slices.Delete(b.ops, i, i+1)
+	}
+	return b
+}
+
+// ReplaceAt replaces the expression at index i with expr, keeping the
+// operator that joins it. An index out of range is reported by Build.
+func (b *filterGroupBuilder) ReplaceAt(i int, expr FilterExpression) FilterGroupBuilder {
+	if b.checkIndex(i) {
+		b.expressions[i] = expr
+	}
+	return b
+}
+
+// checkIndex reports whether i indexes an expression of the group,
+// recording an error if it does not.
+func (b *filterGroupBuilder) checkIndex(i int) bool {
+	if i >= 0 && i < len(b.expressions) {
+		return true
+	}
+	if b.err == nil {
+		b.err = &ValidationError{Component: "filter group index", Value: strconv.Itoa(i), Reason: fmt.Sprintf("out of range for a group of %d expressions", len(b.expressions))}
+	}
+	return false
+}
+
 // Not negates the entire group.
 func (b *filterGroupBuilder) Not() FilterGroupBuilder {
 	b.negated = true
@@ -84,39 +354,53 @@ func (b *filterGroupBuilder) Not() FilterGroupBuilder {
 
 // Build returns the built filter group as a string with proper parentheses and operators.
 func (b *filterGroupBuilder) Build() (string, error) {
+	var sb strings.Builder
+	sb.Grow(estimateFilterSize(b))
+	if err := b.appendTo(&sb, filterStyle{}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the group into sb in style.
+func (b *filterGroupBuilder) appendTo(sb *strings.Builder, style filterStyle) error {
 	if len(b.expressions) == 0 {
-		return "", fmt.Errorf("filter group must contain at least one expression")
+		return ErrEmptyFilterGroup
+	}
+	if b.err != nil {
+		return b.err
 	}
 
-	// Build all expressions
-	var parts []string
-	for _, expr := range b.expressions {
-		filterStr, err := expr.Build()
-		if err != nil {
-			return "", fmt.Errorf("error building filter expression: %w", err)
-		}
-		parts = append(parts, filterStr)
+	// Apply negation if needed
+	if b.negated {
+		sb.WriteString("NOT ")
 	}
 
-	// Join parts with the appropriate operator
-	var opStr string
-	if b.operator == AndOperator {
-		opStr = " AND "
-	} else {
-		opStr = " OR "
+	// Wrap in parentheses if there are multiple expressions
+	wrap := len(b.expressions) > 1
+	if wrap {
+		sb.WriteByte('(')
 	}
 
-	groupStr := strings.Join(parts, opStr)
+	// Members of a group are part of an explicit boolean expression
+	style.boolean = true
 
-	// Wrap in parentheses if there are multiple expressions
-	if len(b.expressions) > 1 {
-		groupStr = fmt.Sprintf("(%s)", groupStr)
+	var errs []error
+	for i, expr := range b.expressions {
+		// Join expressions with the appropriate operator, collecting every failure
+		if i > 0 {
+			sb.WriteByte(' ')
+			sb.WriteString(b.operatorAt(i).String())
+			sb.WriteByte(' ')
+		}
+		if err := appendFilter(sb, expr, style); err != nil {
+			errs = append(errs, fmt.Errorf("error building filter expression: %w", err))
+		}
 	}
 
-	// Apply negation if needed
-	if b.negated {
-		groupStr = fmt.Sprintf("NOT %s", groupStr)
+	if wrap {
+		sb.WriteByte(')')
 	}
 
-	return groupStr, nil
+	return errors.Join(errs...)
 }
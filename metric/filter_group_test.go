@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -239,6 +240,394 @@ func TestFilterGroupBuilder_Nested(t *testing.T) {
 	}
 }
 
+func TestFilterGroupBuilder_AnyAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func() (string, error)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "any",
+			build: func() (string, error) {
+				return Any(NewFilterBuilder("env").Equal("prod"), NewFilterBuilder("env").Equal("staging")).Build()
+			},
+			expected: "(env:prod OR env:staging)",
+		},
+		{
+			name: "all",
+			build: func() (string, error) {
+				return All(NewFilterBuilder("env").Equal("prod"), NewFilterBuilder("host").Equal("web-1")).Build()
+			},
+			expected: "(env:prod AND host:web-1)",
+		},
+		{
+			name: "nested and negated",
+			build: func() (string, error) {
+				return All(
+					NewFilterBuilder("env").Equal("prod"),
+					Any(NewFilterBuilder("host").Equal("web-1"), NewFilterBuilder("host").Equal("web-2")).Not(),
+				).Build()
+			},
+			expected: "(env:prod AND NOT (host:web-1 OR host:web-2))",
+		},
+		{
+			name: "any keeps OR for later additions",
+			build: func() (string, error) {
+				return Any(NewFilterBuilder("env").Equal("prod")).Or(NewFilterBuilder("env").Equal("staging")).Build()
+			},
+			expected: "(env:prod OR env:staging)",
+		},
+		{
+			name: "empty group",
+			build: func() (string, error) {
+				return Any().Build()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.build()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterGroupBuilder_MixedOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func() (string, error)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "first call sets the operator",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					And(NewFilterBuilder("env").Equal("prod")).
+					Or(NewFilterBuilder("env").Equal("staging")).
+					Build()
+			},
+			expected: "(env:prod OR env:staging)",
+		},
+		{
+			name: "first call sets the operator when mixing is an error",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsError).
+					And(NewFilterBuilder("env").Equal("prod")).
+					Or(NewFilterBuilder("env").Equal("staging")).
+					Build()
+			},
+			wantErr: true,
+		},
+		{
+			name: "first call sets the operator when nesting",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsNest).
+					And(NewFilterBuilder("env").Equal("prod")).
+					Or(NewFilterBuilder("env").Equal("staging")).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Build()
+			},
+			expected: "((env:prod OR env:staging) AND host:web-1)",
+		},
+		{
+			name: "mixing keeps each operator by default",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					And(NewFilterBuilder("env").Equal("prod")).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Or(NewFilterBuilder("host").Equal("web-2")).
+					Build()
+			},
+			expected: "(env:prod AND host:web-1 OR host:web-2)",
+		},
+		{
+			name: "mixing is an error when opted in",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsError).
+					And(NewFilterBuilder("env").Equal("prod")).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Or(NewFilterBuilder("host").Equal("web-2")).
+					Build()
+			},
+			wantErr: true,
+		},
+		{
+			name: "mixing nests left to right",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsNest).
+					And(NewFilterBuilder("env").Equal("prod")).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Or(NewFilterBuilder("host").Equal("web-2")).
+					And(NewFilterBuilder("region").Equal("us-east-1")).
+					Build()
+			},
+			expected: "(((env:prod AND host:web-1) OR host:web-2) AND region:us-east-1)",
+		},
+		{
+			name: "nesting keeps negation outermost",
+			build: func() (string, error) {
+				return Any(NewFilterBuilder("env").Equal("prod"), NewFilterBuilder("env").Equal("staging")).
+					MixedOperators(MixedOperatorsNest).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Not().
+					Build()
+			},
+			expected: "NOT ((env:prod OR env:staging) AND host:web-1)",
+		},
+		{
+			name: "ordered keeps each operator",
+			build: func() (string, error) {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsOrdered).
+					And(NewFilterBuilder("env").Equal("prod")).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Or(NewFilterBuilder("host").Equal("web-2")).
+					And(Any(NewFilterBuilder("region").Equal("us-east-1")).Not()).
+					Build()
+			},
+			expected: "(env:prod AND host:web-1 OR host:web-2 AND NOT region:us-east-1)",
+		},
+		{
+			name: "ordered after expressions were added",
+			build: func() (string, error) {
+				return Any(NewFilterBuilder("env").Equal("prod"), NewFilterBuilder("env").Equal("staging")).
+					MixedOperators(MixedOperatorsOrdered).
+					And(NewFilterBuilder("host").Equal("web-1")).
+					Build()
+			},
+			expected: "(env:prod OR env:staging AND host:web-1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.build()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterGroupBuilder_MixedOperatorError(t *testing.T) {
+	_, err := NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		Filter(All(NewFilterBuilder("env").Equal("prod"), NewFilterBuilder("host").Equal("web-1")).
+			MixedOperators(MixedOperatorsError).
+			Or(NewFilterBuilder("host").Equal("web-2"))).
+		Build()
+
+	var mixedErr *MixedOperatorError
+	if !errors.As(err, &mixedErr) || !errors.Is(err, ErrMixedOperators) {
+		t.Fatalf("Build() error = %v, want *MixedOperatorError", err)
+	}
+	if mixedErr.Index != 2 || mixedErr.Operator != AndOperator || mixedErr.Conflicting != OrOperator {
+		t.Errorf("MixedOperatorError = %+v, want index 2, AND then OR", mixedErr)
+	}
+}
+
+func TestFilterGroupBuilder_MixedOperatorErrorOnSecondCall(t *testing.T) {
+	_, err := NewFilterGroupBuilder().
+		MixedOperators(MixedOperatorsError).
+		And(NewFilterBuilder("a").Equal("1")).
+		Or(NewFilterBuilder("b").Equal("2")).
+		Build()
+
+	var mixedErr *MixedOperatorError
+	if !errors.As(err, &mixedErr) {
+		t.Fatalf("Build() error = %v, want *MixedOperatorError", err)
+	}
+	if mixedErr.Index != 1 || mixedErr.Operator != AndOperator || mixedErr.Conflicting != OrOperator {
+		t.Errorf("MixedOperatorError = %+v, want index 1, AND then OR", mixedErr)
+	}
+}
+
+func TestFilterGroupBuilder_OrderedOperatorsEdits(t *testing.T) {
+	group := NewFilterGroupBuilder().
+		MixedOperators(MixedOperatorsOrdered).
+		And(NewFilterBuilder("env").Equal("prod")).
+		Or(NewFilterBuilder("host").Equal("web-1")).
+		And(NewFilterBuilder("region").Equal("us-east-1"))
+	builder := NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(group)
+
+	sorted, err := builder.BuildWithOptions(WithSortedFilters(), WithDedupedFilters())
+	if err != nil {
+		t.Fatalf("BuildWithOptions() error = %v", err)
+	}
+	if want := "system.cpu.idle{(env:prod OR host:web-1 AND region:us-east-1)}"; sorted != want {
+		t.Errorf("sorted = %q, want %q, ordered groups keep their order", sorted, want)
+	}
+
+	result, err := builder.RemoveFilter("host").Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if want := "system.cpu.idle{(env:prod AND region:us-east-1)}"; result != want {
+		t.Errorf("after RemoveFilter = %q, want %q", result, want)
+	}
+}
+
+func TestFilterGroupBuilder_Normalize(t *testing.T) {
+	env := func(v string) FilterExpression { return NewFilterBuilder("env").Equal(v) }
+	host := func(v string) FilterExpression { return NewFilterBuilder("host").Equal(v) }
+
+	tests := []struct {
+		name     string
+		group    func() FilterGroupBuilder
+		expected string
+	}{
+		{
+			name:     "single-expression groups are flattened",
+			group:    func() FilterGroupBuilder { return All(env("prod"), Any(host("web-1"))) },
+			expected: "(env:prod AND host:web-1)",
+		},
+		{
+			name:     "nested groups with the same operator are merged",
+			group:    func() FilterGroupBuilder { return Any(env("prod"), Any(env("staging"), Any(env("dev"), env("qa")))) },
+			expected: "(env:prod OR env:staging OR env:dev OR env:qa)",
+		},
+		{
+			name:     "nested groups with another operator are kept",
+			group:    func() FilterGroupBuilder { return All(env("prod"), Any(host("web-1"), host("web-2"))) },
+			expected: "(env:prod AND (host:web-1 OR host:web-2))",
+		},
+		{
+			name:     "repeated expressions are removed",
+			group:    func() FilterGroupBuilder { return Any(env("prod"), env("staging"), Any(env("prod"))) },
+			expected: "(env:prod OR env:staging)",
+		},
+		{
+			name:     "negated groups are not merged",
+			group:    func() FilterGroupBuilder { return All(env("prod"), All(host("web-1"), host("web-2")).Not()) },
+			expected: "(env:prod AND NOT (host:web-1 AND host:web-2))",
+		},
+		{
+			name:     "a group wrapping one group takes it over",
+			group:    func() FilterGroupBuilder { return All(Any(env("prod"), env("staging")).Not()).Not() },
+			expected: "(env:prod OR env:staging)",
+		},
+		{
+			name: "ordered groups keep their expressions",
+			group: func() FilterGroupBuilder {
+				return NewFilterGroupBuilder().
+					MixedOperators(MixedOperatorsOrdered).
+					And(env("prod")).
+					Or(Any(env("prod"))).
+					And(All(host("web-1"), host("web-2")))
+			},
+			expected: "(env:prod OR env:prod AND (host:web-1 AND host:web-2))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.group().Normalize().Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterGroupBuilder_EditExpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(FilterGroupBuilder) FilterGroupBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "remove the first expression",
+			edit:     func(g FilterGroupBuilder) FilterGroupBuilder { return g.Remove(0) },
+			expected: "(host:web-1 OR host:web-2 AND region:us-east-1)",
+		},
+		{
+			name:     "remove takes the operator before it",
+			edit:     func(g FilterGroupBuilder) FilterGroupBuilder { return g.Remove(2) },
+			expected: "(env:prod AND host:web-1 AND region:us-east-1)",
+		},
+		{
+			name: "replace keeps the operator",
+			edit: func(g FilterGroupBuilder) FilterGroupBuilder {
+				return g.ReplaceAt(2, Any(NewFilterBuilder("host").Equal("web-2"), NewFilterBuilder("host").Equal("web-3")))
+			},
+			expected: "(env:prod AND host:web-1 OR (host:web-2 OR host:web-3) AND region:us-east-1)",
+		},
+		{
+			name: "remove while iterating",
+			edit: func(g FilterGroupBuilder) FilterGroupBuilder {
+				exprs := g.Expressions()
+				for i := len(exprs) - 1; i >= 0; i-- {
+					if f, ok := exprs[i].(FilterBuilder); ok && f.Key() == "host" {
+						g.Remove(i)
+					}
+				}
+				return g
+			},
+			expected: "(env:prod AND region:us-east-1)",
+		},
+		{
+			name:    "index out of range",
+			edit:    func(g FilterGroupBuilder) FilterGroupBuilder { return g.Remove(4) },
+			wantErr: true,
+		},
+		{
+			name: "negative index",
+			edit: func(g FilterGroupBuilder) FilterGroupBuilder {
+				return g.ReplaceAt(-1, NewFilterBuilder("env").Equal("staging"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := NewFilterGroupBuilder().
+				MixedOperators(MixedOperatorsOrdered).
+				And(NewFilterBuilder("env").Equal("prod")).
+				And(NewFilterBuilder("host").Equal("web-1")).
+				Or(NewFilterBuilder("host").Equal("web-2")).
+				And(NewFilterBuilder("region").Equal("us-east-1"))
+
+			result, err := tt.edit(group).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var vErr *ValidationError
+				if !errors.As(err, &vErr) {
+					t.Errorf("Build() error = %v, want *ValidationError", err)
+				}
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestFilterGroupBuilder_EmptyGroup(t *testing.T) {
 	group := NewFilterGroupBuilder()
 	_, err := group.Build()
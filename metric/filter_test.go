@@ -45,6 +45,118 @@ func TestFilterBuilder(t *testing.T) {
 			expected: "host NOT IN (db-1,db-2)",
 			wantErr:  false,
 		},
+		{
+			name: "greater than filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("cores").GreaterThan("4").Build()
+			},
+			expected: "cores:>4",
+			wantErr:  false,
+		},
+		{
+			name: "greater or equal filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("cores").GreaterOrEqual("4").Build()
+			},
+			expected: "cores:>=4",
+			wantErr:  false,
+		},
+		{
+			name: "less than filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("version").LessThan("2.5").Build()
+			},
+			expected: "version:<2.5",
+			wantErr:  false,
+		},
+		{
+			name: "less or equal filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("shard").LessOrEqual("-1").Build()
+			},
+			expected: "shard:<=-1",
+			wantErr:  false,
+		},
+		{
+			name: "has prefix filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").HasPrefix("web-").Build()
+			},
+			expected: "host:web-*",
+			wantErr:  false,
+		},
+		{
+			name: "has suffix filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").HasSuffix("-prod").Build()
+			},
+			expected: "host:*-prod",
+			wantErr:  false,
+		},
+		{
+			name: "contains filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").Contains("canary").Build()
+			},
+			expected: "host:*canary*",
+			wantErr:  false,
+		},
+		{
+			name: "exists filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("team").Exists().Build()
+			},
+			expected: "team:*",
+			wantErr:  false,
+		},
+		{
+			name: "not exists filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("team").NotExists().Build()
+			},
+			expected: "!team:*",
+			wantErr:  false,
+		},
+		{
+			name: "regex filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").Regex("web.*").Build()
+			},
+			expected: "host:~web.*",
+			wantErr:  false,
+		},
+		{
+			name: "not regex filter",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").NotRegex("web.*").Build()
+			},
+			expected: "!host:~web.*",
+			wantErr:  false,
+		},
+		{
+			name: "regex filter quoted",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").NotRegex("^web-[0-9]+$").Build()
+			},
+			expected: `!host:~"^web-[0-9]+$"`,
+			wantErr:  false,
+		},
+		{
+			name: "error - invalid regex",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").Regex("web-(").Build()
+			},
+			expected: "",
+			wantErr:  true,
+		},
+		{
+			name: "error - non-numeric comparison",
+			build: func() (string, error) {
+				return metric.NewFilterBuilder("host").GreaterThan("web").Build()
+			},
+			expected: "",
+			wantErr:  true,
+		},
 		{
 			name: "error - empty key",
 			build: func() (string, error) {
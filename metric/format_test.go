@@ -0,0 +1,168 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func newFormatBuilder() metric.QueryBuilder {
+	return metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+		Filter(metric.NewFilterBuilder("env").In("prod", "staging")).
+		GroupBy("host", "env").
+		ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("avg", "60"))
+}
+
+func TestOutputFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		format   metric.OutputFormat
+		expected string
+	}{
+		{
+			name:     "standard",
+			builder:  newFormatBuilder,
+			format:   metric.FormatStandard,
+			expected: "avg:system.cpu.idle{host:web-1, env IN (prod,staging)} by {host, env}.rollup(avg, 60)",
+		},
+		{
+			name:     "minified",
+			builder:  newFormatBuilder,
+			format:   metric.FormatMinified,
+			expected: "avg:system.cpu.idle{host:web-1,env IN (prod,staging)} by {host,env}.rollup(avg,60)",
+		},
+		{
+			name: "minified wrapper",
+			builder: func() metric.QueryBuilder {
+				return newFormatBuilder().WrapWith(metric.NewWrapperBuilder("top").WithArgs("10", "'mean'", "'desc'"))
+			},
+			format:   metric.FormatMinified,
+			expected: "top(avg:system.cpu.idle{host:web-1,env IN (prod,staging)} by {host,env}.rollup(avg,60),10,'mean','desc')",
+		},
+		{
+			name: "pretty short query stays on one line",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+					GroupBy("host")
+			},
+			format:   metric.FormatPretty,
+			expected: "avg:system.cpu.idle{host:web-1} by {host}",
+		},
+		{
+			name: "pretty long query",
+			builder: func() metric.QueryBuilder {
+				return newFormatBuilder().
+					Filter(metric.NewFilterBuilder("availability-zone").NotEqual("us-east-1a")).
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero"))
+			},
+			format: metric.FormatPretty,
+			expected: "avg:system.cpu.idle{\n" +
+				"  host:web-1,\n" +
+				"  env IN (prod,staging),\n" +
+				"  !availability-zone:us-east-1a\n" +
+				"} by {host, env}\n" +
+				"  .rollup(avg, 60)\n" +
+				"  .fill(zero)",
+		},
+		{
+			name: "pretty long query with groups",
+			builder: func() metric.QueryBuilder {
+				return newFormatBuilder().
+					Filter(metric.NewFilterGroupBuilder().
+						Or(metric.NewFilterBuilder("service").Equal("checkout")).
+						Or(metric.NewFilterBuilder("service").Equal("payments")))
+			},
+			format: metric.FormatPretty,
+			expected: "avg:system.cpu.idle{\n" +
+				"  host:web-1\n" +
+				"  AND env IN (prod,staging)\n" +
+				"  AND (service:checkout OR service:payments)\n" +
+				"} by {host, env}\n" +
+				"  .rollup(avg, 60)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().BuildWithOptions(metric.WithFormat(tt.format))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinifiedRoundTrip(t *testing.T) {
+	minified, err := newFormatBuilder().BuildWithOptions(metric.WithFormat(metric.FormatMinified))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, err := metric.ParseQuery(minified)
+	if err != nil {
+		t.Fatalf("minified query failed to parse: %v", err)
+	}
+	got, err := parsed.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := newFormatBuilder().Build()
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMinifiedExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "unchanged expression",
+			build:    func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected: `sum:errors{env:prod,msg:"a, b"} by {host,env} / sum:hits{env:prod,host IN (a,b)} by {host,env}`,
+		},
+		{
+			name: "added filters and functions",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(metric.NewFilterBuilder("service").Equal("web")).
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("sum", "60"))
+			},
+			expected: `(sum:errors{env:prod,msg:"a, b",service:web} by {host,env} / sum:hits{env:prod,host IN (a,b),service:web} by {host,env}).rollup(sum,60)`,
+		},
+		{
+			name: "added wrapper",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.WrapWith(metric.NewWrapperBuilder("top").WithArgs("5", "'max'", "'desc'"))
+			},
+			expected: `top(sum:errors{env:prod,msg:"a, b"} by {host,env} / sum:hits{env:prod,host IN (a,b)} by {host,env},5,'max','desc')`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(`sum:errors{env:prod, msg:"a, b"} by {host, env} / sum:hits{env:prod, host IN (a, b)} by {host, env}`)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			got, err := tt.build(builder).BuildWithOptions(metric.WithFormat(metric.FormatMinified))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
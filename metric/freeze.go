@@ -0,0 +1,107 @@
+package metric
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Freeze makes the builder immutable and returns it. A frozen builder takes
+// private copies of its filters, functions and scope, so later changes to builders
+// that were passed to it have no effect, and it may be built and cloned
+// from many goroutines at once.
+//
+// Calling a mutator on a frozen builder leaves it untouched and returns a
+// copy whose Build fails with ErrFrozenBuilder; use Clone to derive a
+// modifiable query from a frozen base.
+func (b *metricQueryBuilder) Freeze() QueryBuilder {
+	if b.frozen {
+		return b
+	}
+	b.filters = cloneFilters(b.filters)
+	b.functions = cloneFunctions(b.functions)
+	b.wrappers = cloneWrappers(b.wrappers)
+	if b.scope != nil {
+		b.scope = b.scope.Clone()
+	}
+	b.frozen = true
+	return b
+}
+
+// Clone returns a deep copy of the builder that can be modified without
+// affecting the original. The copy is never frozen.
+func (b *metricQueryBuilder) Clone() QueryBuilder {
+	return b.clone()
+}
+
+// clone implements Clone.
+func (b *metricQueryBuilder) clone() *metricQueryBuilder {
+	c := *b
+	c.filters = cloneFilters(b.filters)
+	c.groupBy = append(make([]string, 0, len(b.groupBy)), b.groupBy...)
+	c.functions = cloneFunctions(b.functions)
+	c.wrappers = cloneWrappers(b.wrappers)
+	c.hooks = b.hooks.clone()
+	if b.config != nil {
+		cfg := *b.config
+		c.config = &cfg
+	}
+	c.frozen = false
+	return &c
+}
+
+// mutable returns the builder a mutator should modify: b itself, or, when
+// b is frozen, a copy that records the attempted mutation as an error so
+// that the shared builder is never written to.
+func (b *metricQueryBuilder) mutable(method string) *metricQueryBuilder {
+	if !b.frozen {
+		return b
+	}
+	c := b.clone()
+	if c.err == nil {
+		c.err = fmt.Errorf("frozen builder modified by %s: %w", method, ErrFrozenBuilder)
+	}
+	return c
+}
+
+// cloneFilters returns a deep copy of filters. Expressions implemented
+// outside this package are shared rather than copied.
+func cloneFilters(filters []FilterExpression) []FilterExpression {
+	out := make([]FilterExpression, len(filters))
+	for i, f := range filters {
+		out[i] = cloneFilter(f)
+	}
+	return out
+}
+
+// cloneFilter returns a deep copy of expr.
+func cloneFilter(expr FilterExpression) FilterExpression {
+	switch e := expr.(type) {
+	case *filterBuilder:
+		c := *e
+		c.values = append(make([]string, 0, len(e.values)), e.values...)
+		c.quotes = maps.Clone(e.quotes)
+		return &c
+	case *filterGroupBuilder:
+		c := *e
+		c.expressions = cloneFilters(e.expressions)
+		c.ops = append([]GroupOperator(nil), e.ops...)
+		return &c
+	}
+	return expr
+}
+
+// cloneFunctions returns a deep copy of fns. Functions implemented outside
+// this package are shared rather than copied.
+func cloneFunctions(fns []FunctionBuilder) []FunctionBuilder {
+	out := make([]FunctionBuilder, len(fns))
+	for i, fn := range fns {
+		if impl, ok := fn.(*functionBuilder); ok {
+			c := *impl
+			c.args = append(make([]string, 0, len(impl.args)), impl.args...)
+			c.argErrs = maps.Clone(impl.argErrs)
+			fn = &c
+		}
+		out[i] = fn
+	}
+	return out
+}
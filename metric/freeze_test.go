@@ -0,0 +1,120 @@
+package metric_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func newFrozenBase() metric.QueryBuilder {
+	return metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		GroupBy("host").
+		Freeze()
+}
+
+func TestFreezeMutationReturnsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(metric.QueryBuilder) metric.QueryBuilder
+	}{
+		{name: "Metric", mutate: func(q metric.QueryBuilder) metric.QueryBuilder { return q.Metric("other") }},
+		{name: "Aggregator", mutate: func(q metric.QueryBuilder) metric.QueryBuilder { return q.Aggregator("sum") }},
+		{name: "TimeWindow", mutate: func(q metric.QueryBuilder) metric.QueryBuilder { return q.TimeWindow("5m") }},
+		{name: "GroupBy", mutate: func(q metric.QueryBuilder) metric.QueryBuilder { return q.GroupBy("env") }},
+		{name: "Filter", mutate: func(q metric.QueryBuilder) metric.QueryBuilder {
+			return q.Filter(metric.NewFilterBuilder("host").Equal("web-1"))
+		}},
+		{name: "ApplyFunction", mutate: func(q metric.QueryBuilder) metric.QueryBuilder {
+			return q.ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero"))
+		}},
+		{name: "WithConfig", mutate: func(q metric.QueryBuilder) metric.QueryBuilder { return q.WithConfig(metric.StrictConfig()) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newFrozenBase()
+			if _, err := tt.mutate(base).Build(); !errors.Is(err, metric.ErrFrozenBuilder) {
+				t.Errorf("expected ErrFrozenBuilder, got %v", err)
+			}
+
+			got, err := base.Build()
+			if err != nil {
+				t.Fatalf("frozen base failed to build: %v", err)
+			}
+			if got != "avg:system.cpu.idle{env:prod} by {host}" {
+				t.Errorf("frozen base was modified: %q", got)
+			}
+		})
+	}
+}
+
+func TestFreezeSnapshotsComponents(t *testing.T) {
+	filter := metric.NewFilterBuilder("env").Equal("prod")
+	fn := metric.NewFunctionBuilder("rollup").WithArg("60")
+	base := metric.NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		Filter(filter).
+		ApplyFunction(fn).
+		Freeze()
+
+	filter.Equal("staging")
+	fn.WithArg("avg")
+
+	got, err := base.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "system.cpu.idle{env:prod}.rollup(60)" {
+		t.Errorf("frozen builder saw later changes: %q", got)
+	}
+}
+
+func TestCloneFromFrozen(t *testing.T) {
+	base := newFrozenBase()
+
+	got, err := base.Clone().Filter(metric.NewFilterBuilder("host").Equal("web-1")).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "avg:system.cpu.idle{env:prod, host:web-1} by {host}" {
+		t.Errorf("unexpected clone output: %q", got)
+	}
+}
+
+func TestFrozenConcurrentCloneAndBuild(t *testing.T) {
+	base := newFrozenBase()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			host := fmt.Sprintf("web-%d", i)
+			got, err := base.Clone().Filter(metric.NewFilterBuilder("host").Equal(host)).Build()
+			if err != nil {
+				errs <- err
+				return
+			}
+			expected := "avg:system.cpu.idle{env:prod, host:" + host + "} by {host}"
+			if got != expected {
+				errs <- fmt.Errorf("got %q, want %q", got, expected)
+			}
+			if _, err := base.Build(); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
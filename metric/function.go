@@ -2,7 +2,11 @@ package metric
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // FunctionBuilder provides a fluent interface for building functions to apply to queries.
@@ -13,14 +17,27 @@ type FunctionBuilder interface {
 	// WithArgs adds multiple arguments to the function.
 	WithArgs(args ...string) FunctionBuilder
 
+	// Name returns the function name, e.g. "rollup".
+	Name() string
+
+	// Args returns a copy of the function's arguments.
+	Args() []string
+
+	// SetArg replaces the argument at index i in place. An index outside
+	// the current arguments is reported when the query is built, unless a
+	// later SetArg at that index succeeds.
+	SetArg(i int, arg string) FunctionBuilder
+
 	// Build returns the built function as a string.
 	Build() (string, error)
 }
 
 // functionBuilder is the concrete implementation of the FunctionBuilder interface.
 type functionBuilder struct {
-	name string
-	args []string
+	name    string
+	args    []string
+	err     error         // set by constructors that validate their arguments
+	argErrs map[int]error // failed SetArg calls, by index
 }
 
 // NewFunctionBuilder creates a new function builder with the given name.
@@ -31,6 +48,116 @@ func NewFunctionBuilder(name string) FunctionBuilder {
 	}
 }
 
+// FillMode is the interpolation applied by Fill to gaps in a series.
+type FillMode string
+
+const (
+	// FillNull leaves gaps empty.
+	FillNull FillMode = "null"
+	// FillZero fills gaps with zero.
+	FillZero FillMode = "zero"
+	// FillLinear interpolates linearly between the points around a gap.
+	FillLinear FillMode = "linear"
+	// FillLast repeats the last point before a gap.
+	FillLast FillMode = "last"
+)
+
+// RollupAggregation is the aggregation applied by Rollup to each time bucket.
+type RollupAggregation string
+
+// Rollup aggregations supported by Datadog.
+const (
+	RollupAvg   RollupAggregation = "avg"
+	RollupSum   RollupAggregation = "sum"
+	RollupMin   RollupAggregation = "min"
+	RollupMax   RollupAggregation = "max"
+	RollupCount RollupAggregation = "count"
+)
+
+// Fill returns the fill() function, which fills gaps in each series using
+// mode: Fill(FillZero) renders .fill(zero). An optional limit, in seconds,
+// bounds how long a gap is filled: Fill(FillLinear, 30) renders
+// .fill(linear, 30). An unknown mode, a non-positive limit or more than
+// one limit is reported when the query is built.
+func Fill(mode FillMode, limit ...int) FunctionBuilder {
+	b := &functionBuilder{name: "fill", args: []string{string(mode)}}
+	switch mode {
+	case FillNull, FillZero, FillLinear, FillLast:
+	default:
+		b.err = &ValidationError{Component: "fill", Value: string(mode), Reason: "mode must be one of null, zero, linear or last"}
+		return b
+	}
+	switch {
+	case len(limit) > 1:
+		b.err = &ValidationError{Component: "fill", Value: fmt.Sprint(limit), Reason: "accepts at most one limit"}
+	case len(limit) == 1 && limit[0] <= 0:
+		b.err = &ValidationError{Component: "fill", Value: strconv.Itoa(limit[0]), Reason: "limit must be a positive number of seconds"}
+	case len(limit) == 1:
+		b.args = append(b.args, strconv.Itoa(limit[0]))
+	}
+	return b
+}
+
+// ExcludeNull returns the exclude_null() function, which drops the series
+// whose tag value is N/A: ExcludeNull("host") renders .exclude_null(host).
+// The tag key is written without quotes; a quoted or otherwise invalid key
+// is reported when the query is built.
+func ExcludeNull(tag string) FunctionBuilder {
+	return &functionBuilder{name: "exclude_null", args: []string{tag}}
+}
+
+// Rollup returns the rollup() function, which aggregates each series into
+// buckets of interval: Rollup(time.Minute) renders .rollup(60). An
+// optional aggregation replaces Datadog's default, avg:
+// Rollup(time.Minute, RollupSum) renders .rollup(sum, 60). An interval of
+// 0 leaves Datadog to choose it from the graphed time frame, and then
+// requires an aggregation: Rollup(0, RollupMax) renders .rollup(max).
+// Otherwise the interval must be a positive whole number of seconds. An
+// invalid interval or aggregation, or more than one aggregation, is
+// reported when the query is built.
+func Rollup(interval time.Duration, aggregation ...RollupAggregation) FunctionBuilder {
+	b := &functionBuilder{name: "rollup"}
+	switch {
+	case len(aggregation) > 1:
+		b.err = &ValidationError{Component: "rollup", Value: fmt.Sprint(aggregation), Reason: "accepts at most one aggregation"}
+		return b
+	case len(aggregation) == 1:
+		b.args = append(b.args, string(aggregation[0]))
+		if b.err = validateRollupAggregation(aggregation[0]); b.err != nil {
+			return b
+		}
+	case interval == 0:
+		b.err = &ValidationError{Component: "rollup", Value: interval.String(), Reason: "needs an interval, an aggregation or both"}
+		return b
+	}
+	switch {
+	case interval == 0:
+	case interval < 0 || interval%time.Second != 0:
+		b.err = &ValidationError{Component: "rollup", Value: interval.String(), Reason: "interval must be a positive whole number of seconds"}
+	default:
+		b.args = append(b.args, strconv.FormatInt(int64(interval/time.Second), 10))
+	}
+	return b
+}
+
+// validateRollupAggregation reports an unknown rollup aggregation.
+func validateRollupAggregation(aggregation RollupAggregation) error {
+	switch aggregation {
+	case RollupAvg, RollupSum, RollupMin, RollupMax, RollupCount:
+		return nil
+	}
+	return &ValidationError{Component: "rollup", Value: string(aggregation), Reason: "aggregation must be one of avg, sum, min, max or count"}
+}
+
+// functionName returns the name of fn, or "" for functions implemented
+// outside this package.
+func functionName(fn FunctionBuilder) string {
+	if impl, ok := fn.(*functionBuilder); ok {
+		return impl.name
+	}
+	return ""
+}
+
 // WithArg adds an argument to the function.
 func (b *functionBuilder) WithArg(arg string) FunctionBuilder {
 	b.args = append(b.args, arg)
@@ -43,17 +170,80 @@ func (b *functionBuilder) WithArgs(args ...string) FunctionBuilder {
 	return b
 }
 
+// Name returns the function name.
+func (b *functionBuilder) Name() string {
+	return b.name
+}
+
+// Args returns a copy of the function's arguments.
+func (b *functionBuilder) Args() []string {
+	return slices.Clone(b.args)
+}
+
+// SetArg replaces the argument at index i. A failed call is forgotten once
+// a later call sets index i.
+func (b *functionBuilder) SetArg(i int, arg string) FunctionBuilder {
+	if i < 0 || i >= len(b.args) {
+		if b.argErrs == nil {
+			b.argErrs = make(map[int]error)
+		}
+		b.argErrs[i] = &ValidationError{Component: b.name + " argument", Value: strconv.Itoa(i), Reason: fmt.Sprintf("index out of range for %d arguments", len(b.args))}
+		return b
+	}
+	delete(b.argErrs, i)
+	b.args[i] = arg
+	return b
+}
+
 // Build returns the built function as a string.
+// Format: .function_name(arg1, arg2, ...)
 func (b *functionBuilder) Build() (string, error) {
+	var sb strings.Builder
+	if err := b.appendTo(&sb, nil, false, ", "); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders the function into sb, separating arguments with argSep.
+// When resolve is true, {{name}} placeholders in arguments are replaced with
+// their values from params. Arguments to known functions are checked
+// against the function catalog after resolution.
+func (b *functionBuilder) appendTo(sb *strings.Builder, params map[string]string, resolve bool, argSep string) error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.argErrs) > 0 {
+		return b.argErrs[slices.Min(slices.Collect(maps.Keys(b.argErrs)))]
+	}
 	if b.name == "" {
-		return "", fmt.Errorf("function name is required")
+		return ErrMissingFunctionName
 	}
 
-	// Format: .function_name(arg1, arg2, ...)
-	if len(b.args) > 0 {
-		return fmt.Sprintf(".%s(%s)", b.name, strings.Join(b.args, ", ")), nil
+	args := b.args
+	if resolve && slices.ContainsFunc(args, hasPlaceholder) {
+		args = make([]string, len(b.args))
+		for i, arg := range b.args {
+			resolved, err := resolvePlaceholders(arg, params)
+			if err != nil {
+				return err
+			}
+			args[i] = resolved
+		}
+	}
+	if err := checkFunctionArgs(b.name, args); err != nil {
+		return err
 	}
 
-	// Format: .function_name()
-	return fmt.Sprintf(".%s()", b.name), nil
+	sb.WriteByte('.')
+	sb.WriteString(b.name)
+	sb.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			sb.WriteString(argSep)
+		}
+		sb.WriteString(arg)
+	}
+	sb.WriteByte(')')
+	return nil
 }
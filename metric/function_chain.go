@@ -0,0 +1,40 @@
+package metric
+
+// FunctionChain bundles an ordered list of functions that can be applied to
+// any query builder in a single call. This allows a standard set of functions
+// (e.g. a team's default smoothing) to be defined once and reused.
+type FunctionChain interface {
+	// Then appends a function to the end of the chain.
+	Then(fn FunctionBuilder) FunctionChain
+
+	// Functions returns the functions in the chain in application order.
+	Functions() []FunctionBuilder
+}
+
+// functionChain is the concrete implementation of the FunctionChain interface.
+type functionChain struct {
+	functions []FunctionBuilder
+}
+
+// NewFunctionChain creates a new function chain containing the given functions.
+func NewFunctionChain(fns ...FunctionBuilder) FunctionChain {
+	c := &functionChain{
+		functions: make([]FunctionBuilder, 0, len(fns)),
+	}
+	c.functions = append(c.functions, fns...)
+	return c
+}
+
+// Then appends a function to the end of the chain.
+func (c *functionChain) Then(fn FunctionBuilder) FunctionChain {
+	c.functions = append(c.functions, fn)
+	return c
+}
+
+// Functions returns the functions in the chain in application order.
+// The returned slice is a copy; appending to it does not modify the chain.
+func (c *functionChain) Functions() []FunctionBuilder {
+	out := make([]FunctionBuilder, len(c.functions))
+	copy(out, c.functions)
+	return out
+}
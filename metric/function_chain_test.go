@@ -0,0 +1,118 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb"
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestFunctionChain(t *testing.T) {
+	smoothing := metric.NewFunctionChain(
+		metric.NewFunctionBuilder("fill").WithArg("null"),
+		metric.NewFunctionBuilder("rollup").WithArgs("60", "avg"),
+	)
+
+	tests := []struct {
+		name     string
+		build    func() (string, error)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "apply chain",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyChain(smoothing).
+					Build()
+			},
+			expected: "system.cpu.idle{*}.fill(null).rollup(60, avg)",
+			wantErr:  false,
+		},
+		{
+			name: "same chain applied to a second builder",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("sum").
+					Metric("system.mem.used").
+					ApplyChain(smoothing).
+					Build()
+			},
+			expected: "sum:system.mem.used{*}.fill(null).rollup(60, avg)",
+			wantErr:  false,
+		},
+		{
+			name: "chain combined with individual functions",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("as_count")).
+					ApplyChain(smoothing).
+					Build()
+			},
+			expected: "system.cpu.idle{*}.as_count().fill(null).rollup(60, avg)",
+			wantErr:  false,
+		},
+		{
+			name: "nil chain is ignored",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyChain(nil).
+					Build()
+			},
+			expected: "system.cpu.idle{*}",
+			wantErr:  false,
+		},
+		{
+			name: "top-level chain with Then",
+			build: func() (string, error) {
+				chain := ddqb.FunctionChain(ddqb.Function("fill").WithArg("zero")).
+					Then(ddqb.Function("rollup").WithArg("300"))
+				return ddqb.Metric().
+					Metric("system.cpu.idle").
+					ApplyChain(chain).
+					Build()
+			},
+			expected: "system.cpu.idle{*}.fill(zero).rollup(300)",
+			wantErr:  false,
+		},
+		{
+			name: "error - invalid function in chain",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyChain(metric.NewFunctionChain(metric.NewFunctionBuilder(""))).
+					Build()
+			},
+			expected: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.build()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFunctionChainFunctionsIsCopy(t *testing.T) {
+	chain := metric.NewFunctionChain(metric.NewFunctionBuilder("fill").WithArg("zero"))
+	fns := chain.Functions()
+	_ = append(fns, metric.NewFunctionBuilder("rollup"))
+
+	if got := len(chain.Functions()); got != 1 {
+		t.Errorf("len(Functions()) = %d, want 1", got)
+	}
+}
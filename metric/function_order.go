@@ -0,0 +1,50 @@
+package metric
+
+// FunctionOrderCheck selects how builders treat function chains applied in
+// an order that Datadog evaluates differently from what was likely
+// intended, or that monitors reject.
+type FunctionOrderCheck int
+
+const (
+	// FunctionOrderIgnore applies functions in any order without comment.
+	// It is the default.
+	FunctionOrderIgnore FunctionOrderCheck = iota
+	// FunctionOrderWarn reports known-bad orderings as DiagFunctionOrder
+	// diagnostics from BuildWithDiagnostics.
+	FunctionOrderWarn
+	// FunctionOrderError fails Build with a *ValidationError for each
+	// known-bad ordering.
+	FunctionOrderError
+)
+
+// functionOrderIssue describes a function applied out of order.
+type functionOrderIssue struct {
+	name   string
+	reason string
+}
+
+// functionOrderIssues checks the function chain for known-bad orderings:
+//
+//   - as_count and as_rate change how the raw points are interpreted and
+//     must come before every other function; monitors reject them later in
+//     the chain.
+//   - fill after rollup interpolates the rolled-up buckets rather than the
+//     raw series, so gaps shorter than a bucket are never filled.
+//
+// Functions implemented outside this package are skipped.
+func (b *metricQueryBuilder) functionOrderIssues() []functionOrderIssue {
+	var issues []functionOrderIssue
+	rolledUp := false
+	for i, fn := range b.functions {
+		name := functionName(fn)
+		switch {
+		case isCountModifier(name) && i > 0:
+			issues = append(issues, functionOrderIssue{name: name, reason: "must be applied before any other function"})
+		case name == "fill" && rolledUp:
+			issues = append(issues, functionOrderIssue{name: name, reason: "applied after rollup fills the rolled-up series; apply fill first"})
+		case name == "rollup":
+			rolledUp = true
+		}
+	}
+	return issues
+}
@@ -0,0 +1,178 @@
+package metric
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// FunctionSpec describes the arguments a Datadog function accepts. It is
+// registered with RegisterFunction and checked when queries applying the
+// function are built.
+type FunctionSpec struct {
+	// MinArgs is the fewest arguments the function accepts.
+	MinArgs int
+	// MaxArgs is the most arguments the function accepts. A negative
+	// value means there is no upper limit.
+	MaxArgs int
+	// Args describes each positional argument. Arguments beyond the end
+	// of Args, and those whose ArgSpec has no Valid func, accept any value.
+	Args []ArgSpec
+}
+
+// ArgSpec describes the values accepted for one function argument.
+type ArgSpec struct {
+	// Description names the accepted values in error messages, e.g.
+	// "a positive integer".
+	Description string
+	// Valid reports whether arg is acceptable. Arguments still containing
+	// {{name}} placeholders are checked after they are resolved.
+	Valid func(arg string) bool
+}
+
+var (
+	fillArg = ArgSpec{
+		Description: "null, zero, linear or last",
+		Valid: func(s string) bool {
+			switch FillMode(s) {
+			case FillNull, FillZero, FillLinear, FillLast:
+				return true
+			}
+			return false
+		},
+	}
+
+	positiveIntArg = ArgSpec{
+		Description: "a positive integer",
+		Valid:       isPositiveInt,
+	}
+
+	tagKeyArg = ArgSpec{
+		Description: "a tag key without quotes",
+		Valid:       tagKeyPattern.MatchString,
+	}
+
+	rollupArg = ArgSpec{
+		Description: "avg, sum, min, max, count or a positive number of seconds",
+		Valid: func(s string) bool {
+			switch RollupAggregation(s) {
+			case RollupAvg, RollupSum, RollupMin, RollupMax, RollupCount:
+				return true
+			}
+			return isPositiveInt(s)
+		},
+	}
+)
+
+// knownFunctions holds the catalog of suffix functions accepted in strict
+// mode. Every function applied to a query is checked against its entry
+// when the query is built; functions outside the catalog pass through
+// unchecked. The builtin entries cover only the suffix functions ddqb
+// builds itself; others can be added with RegisterFunction. The map is replaced, never modified, by RegisterFunction so
+// that builds can read it without locking.
+var (
+	knownFunctions atomic.Pointer[map[string]FunctionSpec]
+	registerMu     sync.Mutex // serializes RegisterFunction
+)
+
+func init() {
+	builtin := map[string]FunctionSpec{
+		"as_count": {},
+		"as_rate":  {},
+		"weighted": {},
+		// exclude_null() or exclude_null(tag)
+		"exclude_null": {MinArgs: 0, MaxArgs: 1, Args: []ArgSpec{tagKeyArg}},
+		// fill(mode) or fill(mode, limit)
+		"fill": {MinArgs: 1, MaxArgs: 2, Args: []ArgSpec{fillArg, positiveIntArg}},
+		// rollup(method), rollup(seconds) or both, in either order
+		"rollup": {MinArgs: 1, MaxArgs: 2, Args: []ArgSpec{rollupArg, rollupArg}},
+	}
+	knownFunctions.Store(&builtin)
+}
+
+// RegisterFunction adds name to the function catalog, or replaces its
+// entry, so that organization-specific or newly released Datadog functions
+// are accepted in strict mode and have their arguments checked at build
+// time. It is safe to call concurrently with Build.
+func RegisterFunction(name string, spec FunctionSpec) error {
+	switch {
+	case name == "":
+		return ErrMissingFunctionName
+	case spec.MinArgs < 0:
+		return &ValidationError{Component: "function spec", Value: name, Reason: "MinArgs cannot be negative"}
+	case spec.MaxArgs >= 0 && spec.MaxArgs < spec.MinArgs:
+		return &ValidationError{Component: "function spec", Value: name, Reason: "MaxArgs cannot be less than MinArgs"}
+	}
+
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	catalog := maps.Clone(*knownFunctions.Load())
+	catalog[name] = spec
+	knownFunctions.Store(&catalog)
+	return nil
+}
+
+// lookupFunction returns the catalog entry for name.
+func lookupFunction(name string) (FunctionSpec, bool) {
+	spec, ok := (*knownFunctions.Load())[name]
+	return spec, ok
+}
+
+// isKnownFunction reports whether name is in the function catalog.
+func isKnownFunction(name string) bool {
+	_, ok := lookupFunction(name)
+	return ok
+}
+
+// checkFunctionArgs validates args against the catalog entry for name.
+// Unknown functions are accepted, as are arguments that still contain
+// {{name}} placeholders.
+func checkFunctionArgs(name string, args []string) error {
+	spec, ok := lookupFunction(name)
+	if !ok {
+		return nil
+	}
+
+	if n := len(args); n < spec.MinArgs || (spec.MaxArgs >= 0 && n > spec.MaxArgs) {
+		return &ValidationError{Component: "function", Value: name, Reason: fmt.Sprintf("takes %s, got %d", spec.arity(), n)}
+	}
+	for i, arg := range args {
+		if i >= len(spec.Args) {
+			break
+		}
+		a := spec.Args[i]
+		if a.Valid == nil || hasPlaceholder(arg) || a.Valid(arg) {
+			continue
+		}
+		return &ValidationError{Component: name + " argument", Value: arg, Reason: "must be " + a.Description}
+	}
+	return nil
+}
+
+// arity describes the accepted argument count, e.g. "1 or 2 arguments".
+func (s FunctionSpec) arity() string {
+	switch {
+	case s.MaxArgs < 0 && s.MinArgs == 1:
+		return "at least 1 argument"
+	case s.MaxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", s.MinArgs)
+	case s.MaxArgs == 0:
+		return "no arguments"
+	case s.MinArgs == s.MaxArgs && s.MinArgs == 1:
+		return "1 argument"
+	case s.MinArgs == s.MaxArgs:
+		return fmt.Sprintf("%d arguments", s.MinArgs)
+	case s.MaxArgs == s.MinArgs+1:
+		return fmt.Sprintf("%d or %d arguments", s.MinArgs, s.MaxArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", s.MinArgs, s.MaxArgs)
+	}
+}
+
+// isPositiveInt reports whether s is a base-10 integer greater than zero.
+func isPositiveInt(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
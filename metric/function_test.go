@@ -1,7 +1,11 @@
 package metric_test
 
 import (
+	"errors"
+	"math"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/jonwinton/ddqb/metric"
 )
@@ -16,17 +20,17 @@ func TestFunctionBuilder(t *testing.T) {
 		{
 			name: "function with no args",
 			build: func() (string, error) {
-				return metric.NewFunctionBuilder("fill").Build()
+				return metric.NewFunctionBuilder("as_count").Build()
 			},
-			expected: ".fill()",
+			expected: ".as_count()",
 			wantErr:  false,
 		},
 		{
 			name: "function with single arg",
 			build: func() (string, error) {
-				return metric.NewFunctionBuilder("fill").WithArg("0").Build()
+				return metric.NewFunctionBuilder("fill").WithArg("zero").Build()
 			},
-			expected: ".fill(0)",
+			expected: ".fill(zero)",
 			wantErr:  false,
 		},
 		{
@@ -73,3 +77,783 @@ func TestFunctionBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestFunctionCatalog(t *testing.T) {
+	query := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().Aggregator("sum").Metric("requests.count").GroupBy("service")
+	}
+
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "fill",
+			builder:  func() metric.QueryBuilder { return query().ApplyFunction(metric.Fill(metric.FillNull)) },
+			expected: "sum:requests.count{*} by {service}.fill(null)",
+		},
+		{
+			name:     "fill with limit",
+			builder:  func() metric.QueryBuilder { return query().ApplyFunction(metric.Fill(metric.FillLinear, 30)) },
+			expected: "sum:requests.count{*} by {service}.fill(linear, 30)",
+		},
+		{
+			name:     "rollup",
+			builder:  func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg)) },
+			expected: "sum:requests.count{*} by {service}.rollup(avg, 60)",
+		},
+		{
+			name:     "rollup with the default aggregation",
+			builder:  func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(5 * time.Minute)) },
+			expected: "sum:requests.count{*} by {service}.rollup(300)",
+		},
+		{
+			name:     "rollup at the default interval",
+			builder:  func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(0, metric.RollupMax)) },
+			expected: "sum:requests.count{*} by {service}.rollup(max)",
+		},
+		{
+			name:     "timeshift",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Timeshift(-time.Hour)) },
+			expected: "timeshift(sum:requests.count{*} by {service}, -3600)",
+		},
+		{
+			name:     "week before",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.WeekBefore()) },
+			expected: "week_before(sum:requests.count{*} by {service})",
+		},
+		{
+			name: "clamp without exponent notation",
+			builder: func() metric.QueryBuilder {
+				return query().WrapWith(metric.ClampMax(1e7)).WrapWith(metric.ClampMin(0.00001))
+			},
+			expected: "clamp_min(clamp_max(sum:requests.count{*} by {service}, 10000000), 0.00001)",
+		},
+		{
+			name:     "moving median",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.MovingMedian(7)) },
+			expected: "median_7(sum:requests.count{*} by {service})",
+		},
+		{
+			name:     "autosmooth",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Autosmooth()) },
+			expected: "autosmooth(sum:requests.count{*} by {service})",
+		},
+		{
+			name:     "anomalies",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Anomalies(metric.AnomalyAgile, 2)) },
+			expected: "anomalies(sum:requests.count{*} by {service}, 'agile', 2)",
+		},
+		{
+			name:     "anomalies with fractional bounds",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Anomalies(metric.AnomalyRobust, 2.5)) },
+			expected: "anomalies(sum:requests.count{*} by {service}, 'robust', 2.5)",
+		},
+		{
+			name:     "outliers",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Outliers(metric.OutlierDBSCAN, 3)) },
+			expected: "outliers(sum:requests.count{*} by {service}, 'DBSCAN', 3)",
+		},
+		{
+			name:     "outliers with pct",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.Outliers(metric.OutlierScaledMAD, 2.5, 20)) },
+			expected: "outliers(sum:requests.count{*} by {service}, 'scaledMAD', 2.5, 20)",
+		},
+		{
+			name: "moving rollup",
+			builder: func() metric.QueryBuilder {
+				return query().WrapWith(metric.MovingRollup(5*time.Minute, metric.RollupMax))
+			},
+			expected: "moving_rollup(sum:requests.count{*} by {service}, 300, 'max')",
+		},
+		{
+			name:     "moving average",
+			builder:  func() metric.QueryBuilder { return query().WrapWith(metric.MovingAverage(5)) },
+			expected: "ewma_5(sum:requests.count{*} by {service})",
+		},
+		{
+			name: "combined",
+			builder: func() metric.QueryBuilder {
+				return query().
+					ApplyFunction(metric.Rollup(5*time.Minute, metric.RollupSum)).
+					ApplyFunction(metric.Fill(metric.FillZero)).
+					WrapWith(metric.Timeshift(-24 * time.Hour))
+			},
+			expected: "timeshift(sum:requests.count{*} by {service}.rollup(sum, 300).fill(zero), -86400)",
+		},
+		{
+			name:    "error - unknown fill mode",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Fill("previous")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - non-positive fill limit",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Fill(metric.FillLast, 0)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - several fill limits",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Fill(metric.FillLast, 30, 60)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - unknown rollup aggregation",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(time.Minute, "median")) },
+			wantErr: true,
+		},
+		{
+			name: "error - negative rollup interval",
+			builder: func() metric.QueryBuilder {
+				return query().ApplyFunction(metric.Rollup(-time.Minute, metric.RollupAvg))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "error - rollup without interval or aggregation",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(0)) },
+			wantErr: true,
+		},
+		{
+			name: "error - several rollup aggregations",
+			builder: func() metric.QueryBuilder {
+				return query().ApplyFunction(metric.Rollup(time.Minute, metric.RollupAvg, metric.RollupSum))
+			},
+			wantErr: true,
+		},
+		{
+			name: "error - fractional rollup interval",
+			builder: func() metric.QueryBuilder {
+				return query().ApplyFunction(metric.Rollup(1500*time.Millisecond, metric.RollupAvg))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "error - unknown rollup aggregation at the default interval",
+			builder: func() metric.QueryBuilder { return query().ApplyFunction(metric.Rollup(0, "median")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - zero timeshift",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Timeshift(0)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - fractional timeshift",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Timeshift(-90 * time.Millisecond)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - infinite clamp bound",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.ClampMin(math.Inf(-1))) },
+			wantErr: true,
+		},
+		{
+			name:    "error - unsupported moving median span",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.MovingMedian(10)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - unknown anomaly algorithm",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Anomalies("adaptive", 2)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - non-positive anomaly bounds",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Anomalies(metric.AnomalyBasic, 0)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - unknown outlier algorithm",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Outliers("kmeans", 3)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - non-positive outlier tolerance",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Outliers(metric.OutlierMAD, -1)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - outlier pct out of range",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Outliers(metric.OutlierMAD, 3, 120)) },
+			wantErr: true,
+		},
+		{
+			name:    "error - outlier pct with DBSCAN",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.Outliers(metric.OutlierDBSCAN, 3, 20)) },
+			wantErr: true,
+		},
+		{
+			name: "error - fractional moving rollup window",
+			builder: func() metric.QueryBuilder {
+				return query().WrapWith(metric.MovingRollup(1500*time.Millisecond, metric.RollupSum))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "error - unknown moving rollup aggregation",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.MovingRollup(time.Minute, "median")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - unsupported moving average span",
+			builder: func() metric.QueryBuilder { return query().WrapWith(metric.MovingAverage(7)) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.builder().Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var vErr *metric.ValidationError
+				if !errors.As(err, &vErr) {
+					t.Errorf("Build() error = %v, want *ValidationError", err)
+				}
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       metric.FunctionBuilder
+		params   map[string]string
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "fill with limit",
+			fn:       metric.NewFunctionBuilder("fill").WithArgs("last", "300"),
+			expected: "system.cpu.idle{*}.fill(last, 300)",
+		},
+		{
+			name:     "rollup with interval only",
+			fn:       metric.NewFunctionBuilder("rollup").WithArg("60"),
+			expected: "system.cpu.idle{*}.rollup(60)",
+		},
+		{
+			name:     "unknown function passes through",
+			fn:       metric.NewFunctionBuilder("custom_fn").WithArgs("a", "b", "c"),
+			expected: "system.cpu.idle{*}.custom_fn(a, b, c)",
+		},
+		{
+			name:     "placeholder checked after resolution",
+			fn:       metric.NewFunctionBuilder("rollup").WithArgs("avg", "{{window}}"),
+			params:   map[string]string{"window": "300"},
+			expected: "system.cpu.idle{*}.rollup(avg, 300)",
+		},
+		{
+			name:     "exclude_null with tag",
+			fn:       metric.ExcludeNull("availability-zone"),
+			expected: "system.cpu.idle{*}.exclude_null(availability-zone)",
+		},
+		{
+			name:     "exclude_null without tag",
+			fn:       metric.NewFunctionBuilder("exclude_null"),
+			expected: "system.cpu.idle{*}.exclude_null()",
+		},
+		{
+			name:    "error - quoted exclude_null tag",
+			fn:      metric.ExcludeNull(`"host"`),
+			wantErr: `invalid exclude_null argument "\"host\"": must be a tag key without quotes`,
+		},
+		{
+			name:    "error - too many fill arguments",
+			fn:      metric.NewFunctionBuilder("fill").WithArgs("zero", "1", "2"),
+			wantErr: `invalid function "fill": takes 1 or 2 arguments, got 3`,
+		},
+		{
+			name:    "error - rollup without arguments",
+			fn:      metric.NewFunctionBuilder("rollup"),
+			wantErr: `invalid function "rollup": takes 1 or 2 arguments, got 0`,
+		},
+		{
+			name:    "error - as_count with an argument",
+			fn:      metric.NewFunctionBuilder("as_count").WithArg("1"),
+			wantErr: `invalid function "as_count": takes no arguments, got 1`,
+		},
+		{
+			name:    "error - bad fill mode",
+			fn:      metric.NewFunctionBuilder("fill").WithArg("previous"),
+			wantErr: `invalid fill argument "previous": must be null, zero, linear or last`,
+		},
+		{
+			name:    "error - numeric fill mode",
+			fn:      metric.NewFunctionBuilder("fill").WithArg("0"),
+			wantErr: `invalid fill argument "0": must be null, zero, linear or last`,
+		},
+		{
+			name:    "error - fractional fill limit",
+			fn:      metric.NewFunctionBuilder("fill").WithArgs("last", "1.5"),
+			wantErr: `invalid fill argument "1.5": must be a positive integer`,
+		},
+		{
+			name:    "error - bad rollup interval",
+			fn:      metric.NewFunctionBuilder("rollup").WithArgs("avg", "-60"),
+			wantErr: `invalid rollup argument "-60": must be avg, sum, min, max, count or a positive number of seconds`,
+		},
+		{
+			name:    "error - bad placeholder value",
+			fn:      metric.NewFunctionBuilder("rollup").WithArgs("avg", "{{window}}"),
+			params:  map[string]string{"window": "5m"},
+			wantErr: `invalid rollup argument "5m": must be avg, sum, min, max, count or a positive number of seconds`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := metric.NewMetricQueryBuilder().
+				Metric("system.cpu.idle").
+				ApplyFunction(tt.fn).
+				BuildWithOptions(metric.WithParams(tt.params))
+			if tt.wantErr != "" {
+				var vErr *metric.ValidationError
+				if !errors.As(err, &vErr) || vErr.Error() != tt.wantErr {
+					t.Fatalf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRemoveAndReplaceFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		edit     func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:  "remove",
+			query: "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(zero).rollup(avg, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.RemoveFunction("fill")
+			},
+			expected: "avg(5m):system.cpu.idle{host:web-1} by {host}.rollup(avg, 60)",
+		},
+		{
+			name:  "remove every occurrence",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60).fill(zero).rollup(avg, 300)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.RemoveFunction("rollup")
+			},
+			expected: "avg:system.cpu.idle{*}.fill(zero)",
+		},
+		{
+			name:  "remove missing function is a no-op",
+			query: "avg:system.cpu.idle{*}.fill(zero)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.RemoveFunction("rollup")
+			},
+			expected: "avg:system.cpu.idle{*}.fill(zero)",
+		},
+		{
+			name:  "replace keeps position",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60).fill(zero)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ReplaceFunction("rollup", metric.Rollup(5*time.Minute, metric.RollupMax))
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(max, 300).fill(zero)",
+		},
+		{
+			name:  "replace drops later occurrences",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60).fill(zero).rollup(sum, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ReplaceFunction("rollup", metric.Rollup(5*time.Minute, metric.RollupMax))
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(max, 300).fill(zero)",
+		},
+		{
+			name:  "replace missing function appends",
+			query: "avg:system.cpu.idle{*}.fill(zero)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ReplaceFunction("rollup", metric.Rollup(5*time.Minute, metric.RollupMax))
+			},
+			expected: "avg:system.cpu.idle{*}.fill(zero).rollup(max, 300)",
+		},
+		{
+			name:  "expression",
+			query: "sum:requests.errors{*}.fill(zero) / sum:requests.total{*}.fill(zero)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.RemoveFunction("fill")
+			},
+			expected: "sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:  "expression replace",
+			query: "sum:requests.errors{*}.rollup(sum, 60) / sum:requests.total{*}.rollup(sum, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ReplaceFunction("rollup", metric.Rollup(5*time.Minute, metric.RollupSum))
+			},
+			expected: "(sum:requests.errors{*} / sum:requests.total{*}).rollup(sum, 300)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.edit(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetFunctions(t *testing.T) {
+	// setRollupInterval changes the interval of every rollup to 300 seconds
+	setRollupInterval := func(q metric.QueryBuilder) metric.QueryBuilder {
+		for _, fn := range q.GetFunctions() {
+			if fn.Name() == "rollup" && len(fn.Args()) == 2 {
+				fn.SetArg(1, "300")
+			}
+		}
+		return q
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		edit     func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "adjust rollup interval",
+			query:    "avg:system.cpu.idle{*}.fill(zero).rollup(avg, 60)",
+			edit:     setRollupInterval,
+			expected: "avg:system.cpu.idle{*}.fill(zero).rollup(avg, 300)",
+		},
+		{
+			name:     "query without functions",
+			query:    "avg:system.cpu.idle{*}",
+			edit:     setRollupInterval,
+			expected: "avg:system.cpu.idle{*}",
+		},
+		{
+			name:  "frozen query is unchanged",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return setRollupInterval(q.Freeze())
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(avg, 60)",
+		},
+		{
+			name:  "invalid argument fails build",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.GetFunctions()[0].SetArg(1, "-60")
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name:  "index out of range fails build",
+			query: "avg:system.cpu.idle{*}.rollup(avg, 60)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.GetFunctions()[0].SetArg(2, "300")
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name:  "index out of range fixed by a later call",
+			query: "avg:system.cpu.idle{*}.rollup(avg)",
+			edit: func(q metric.QueryBuilder) metric.QueryBuilder {
+				fn := q.GetFunctions()[0]
+				fn.SetArg(1, "300")
+				fn.WithArg("60").SetArg(1, "300")
+				return q
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(avg, 300)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.edit(builder).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("args are copied", func(t *testing.T) {
+		fn := metric.Rollup(time.Minute, metric.RollupAvg)
+		fn.Args()[0] = "sum"
+		if got, want := fn.Args(), []string{"avg", "60"}; !slices.Equal(got, want) {
+			t.Errorf("Args() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestCountModifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func() (metric.QueryBuilder, error)
+		expected string
+	}{
+		{
+			name: "as_count before other functions",
+			build: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("sum").
+					Metric("trace.http.request.errors").
+					ApplyFunction(metric.Rollup(time.Minute, metric.RollupSum)).
+					AsCount(), nil
+			},
+			expected: "sum:trace.http.request.errors{*}.as_count().rollup(sum, 60)",
+		},
+		{
+			name: "as_rate replaces as_count",
+			build: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("sum").
+					Metric("trace.http.request.errors").
+					AsCount().
+					ApplyFunction(metric.Fill(metric.FillZero)).
+					AsRate(), nil
+			},
+			expected: "sum:trace.http.request.errors{*}.as_rate().fill(zero)",
+		},
+		{
+			name: "parsed modifier is replaced",
+			build: func() (metric.QueryBuilder, error) {
+				q, err := metric.ParseQuery("sum:trace.http.request.errors{env:prod}.rollup(sum, 60).as_rate()")
+				if err != nil {
+					return nil, err
+				}
+				return q.AsCount(), nil
+			},
+			expected: "sum:trace.http.request.errors{env:prod}.as_count().rollup(sum, 60)",
+		},
+		{
+			name: "expression",
+			build: func() (metric.QueryBuilder, error) {
+				q, err := metric.ParseQuery("sum:requests.errors{*}.rollup(sum, 60) / sum:requests.total{*}.as_rate()")
+				if err != nil {
+					return nil, err
+				}
+				return q.AsCount(), nil
+			},
+			expected: "sum:requests.errors{*}.as_count().rollup(sum,60) / sum:requests.total{*}.as_count()",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := tt.build()
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCountModifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modifier string
+		edited   string
+	}{
+		{
+			name:     "as_count",
+			query:    "sum:trace.http.request.errors{env:prod}.as_count()",
+			modifier: "as_count",
+			edited:   "sum:trace.http.request.errors{env:prod, service:web}.as_count()",
+		},
+		{
+			name:     "as_rate after group by",
+			query:    "sum:trace.http.request.errors{env:prod} by {host}.as_rate()",
+			modifier: "as_rate",
+			edited:   "sum:trace.http.request.errors{env:prod, service:web} by {host}.as_rate()",
+		},
+		{
+			name:     "after another function",
+			query:    "sum:trace.http.request.errors{env:prod}.rollup(sum, 60).as_count()",
+			modifier: "as_count",
+			edited:   "sum:trace.http.request.errors{env:prod, service:web}.rollup(sum, 60).as_count()",
+		},
+		{
+			name:     "last of several applies",
+			query:    "sum:trace.http.request.errors{env:prod}.as_count().as_rate()",
+			modifier: "as_rate",
+			edited:   "sum:trace.http.request.errors{env:prod, service:web}.as_count().as_rate()",
+		},
+		{
+			name:   "no modifier",
+			query:  "sum:trace.http.request.errors{env:prod}.rollup(sum, 60)",
+			edited: "sum:trace.http.request.errors{env:prod, service:web}.rollup(sum, 60)",
+		},
+		{
+			name:     "every query of an expression",
+			query:    "sum:requests.errors{env:prod}.as_count() / sum:requests.total{env:prod}.as_count()",
+			modifier: "as_count",
+			edited:   "sum:requests.errors{env:prod, service:web}.as_count() / sum:requests.total{env:prod, service:web}.as_count()",
+		},
+		{
+			name:   "some queries of an expression",
+			query:  "sum:requests.errors{env:prod}.as_count() / sum:requests.total{env:prod}",
+			edited: "sum:requests.errors{env:prod, service:web}.as_count() / sum:requests.total{env:prod, service:web}",
+		},
+		{
+			name:     "monitor time window",
+			query:    "sum(last_5m):sum:trace.http.request.errors{env:prod}.as_count()",
+			modifier: "as_count",
+			edited:   "sum(last_5m):sum:trace.http.request.errors{env:prod, service:web}.as_count()",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQueryStrict(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQueryStrict() error = %v", err)
+			}
+			if got := builder.GetCountModifier(); got != tt.modifier {
+				t.Errorf("GetCountModifier() = %q, want %q", got, tt.modifier)
+			}
+			if result, err := builder.Build(); err != nil || result != tt.query {
+				t.Errorf("Build() = %q, %v, want %q", result, err, tt.query)
+			}
+
+			// The modifier survives editing the query
+			result, err := builder.Filter(metric.NewFilterBuilder("service").Equal("web")).Build()
+			if err != nil {
+				t.Fatalf("Build() after edit error = %v", err)
+			}
+			if result != tt.edited {
+				t.Errorf("Build() after edit = %q, want %q", result, tt.edited)
+			}
+		})
+	}
+
+	t.Run("AsCount and AsRate set the modifier", func(t *testing.T) {
+		builder, err := metric.ParseQuery("sum:requests.errors{*}.as_count() / sum:requests.total{*}")
+		if err != nil {
+			t.Fatalf("ParseQuery() error = %v", err)
+		}
+		if got := builder.AsRate().GetCountModifier(); got != "as_rate" {
+			t.Errorf("GetCountModifier() after AsRate = %q, want %q", got, "as_rate")
+		}
+		if got := metric.NewMetricQueryBuilder().Metric("requests.total").AsCount().GetCountModifier(); got != "as_count" {
+			t.Errorf("GetCountModifier() after AsCount = %q, want %q", got, "as_count")
+		}
+	})
+}
+
+func TestRegisterFunction(t *testing.T) {
+	err := metric.RegisterFunction("test_outliers", metric.FunctionSpec{
+		MinArgs: 1,
+		MaxArgs: 2,
+		Args: []metric.ArgSpec{
+			{Description: "dbscan or mad", Valid: func(arg string) bool { return arg == "dbscan" || arg == "mad" }},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunction() error = %v", err)
+	}
+	if err := metric.RegisterFunction("test_variadic", metric.FunctionSpec{MinArgs: 1, MaxArgs: -1}); err != nil {
+		t.Fatalf("RegisterFunction() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		fn       metric.FunctionBuilder
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "registered function",
+			fn:       metric.NewFunctionBuilder("test_outliers").WithArgs("dbscan", "3"),
+			expected: "system.cpu.idle{*}.test_outliers(dbscan, 3)",
+		},
+		{
+			name:     "variadic function",
+			fn:       metric.NewFunctionBuilder("test_variadic").WithArgs("a", "b", "c", "d"),
+			expected: "system.cpu.idle{*}.test_variadic(a, b, c, d)",
+		},
+		{
+			name:    "error - bad argument",
+			fn:      metric.NewFunctionBuilder("test_outliers").WithArg("iqr"),
+			wantErr: `invalid test_outliers argument "iqr": must be dbscan or mad`,
+		},
+		{
+			name:    "error - too few variadic arguments",
+			fn:      metric.NewFunctionBuilder("test_variadic"),
+			wantErr: `invalid function "test_variadic": takes at least 1 argument, got 0`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Registered functions are accepted in strict mode
+			result, err := metric.NewMetricQueryBuilder().
+				Metric("system.cpu.idle").
+				WithConfig(metric.Config{ValidateFunctions: true}).
+				ApplyFunction(tt.fn).
+				Build()
+			if tt.wantErr != "" {
+				var vErr *metric.ValidationError
+				if !errors.As(err, &vErr) || vErr.Error() != tt.wantErr {
+					t.Fatalf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("invalid specs", func(t *testing.T) {
+		if err := metric.RegisterFunction("", metric.FunctionSpec{}); !errors.Is(err, metric.ErrMissingFunctionName) {
+			t.Errorf("RegisterFunction(\"\") error = %v, want ErrMissingFunctionName", err)
+		}
+		var vErr *metric.ValidationError
+		if err := metric.RegisterFunction("test_bad", metric.FunctionSpec{MinArgs: 2, MaxArgs: 1}); !errors.As(err, &vErr) {
+			t.Errorf("RegisterFunction() error = %v, want *ValidationError", err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/jonwinton/ddqp"
+)
+
+// grammar adapts the query parser ddqb is built on. Every parse goes
+// through activeGrammar so that ddqb can support several ddqp grammar
+// versions, or swap parsers entirely, without changing the behavior of
+// ParseQuery. The AST types of the pinned ddqp release serve as ddqb's
+// internal representation; an adapter for a different parser or grammar
+// version converts its output into them.
+//
+// Every implementation must pass the conformance suite in
+// grammar_conformance_test.go.
+type grammar interface {
+	// name identifies the grammar in test output.
+	name() string
+
+	// parse parses a metric query or metric expression. Any "agg(window):"
+	// time window prefix must already have been removed.
+	parse(query string) (*ddqp.GenericQuery, error)
+}
+
+// ddqpGrammar is the grammar implemented by the pinned ddqp release.
+type ddqpGrammar struct{}
+
+func (ddqpGrammar) name() string { return "ddqp" }
+
+func (ddqpGrammar) parse(query string) (parsed *ddqp.GenericQuery, err error) {
+	// Some malformed input, such as a bracketed IN list, panics inside the
+	// parser instead of failing
+	defer func() {
+		if r := recover(); r != nil {
+			parsed, err = nil, positionedError(query, fmt.Errorf("%v", r))
+		}
+	}()
+	parsed, err = ddqp.NewGenericParser().Parse(query)
+	var perr participle.Error
+	if errors.As(err, &perr) {
+		syntaxErr := &syntaxError{offset: sourceOffset(query, perr.Position().Offset), msg: perr.Message(), err: err}
+		var unexpected *participle.UnexpectedTokenError
+		if errors.As(err, &unexpected) && !unexpected.Unexpected.EOF() {
+			syntaxErr.token = unexpected.Unexpected.Value
+		}
+		err = syntaxErr
+	}
+	return parsed, err
+}
+
+// errorPositionPattern matches the message of a parser panic, which starts
+// with the line and column of the failure and may end by repeating them
+// with the offending token: 1:11: branch ... at 1:11 ("$").
+var errorPositionPattern = regexp.MustCompile(`^(\d+):(\d+): (.*?)(?: at \d+:\d+ \("(.*)"\))?$`)
+
+// positionedError returns err, a recovered parser panic, as a *syntaxError
+// located by the position in its message, or err itself if it has none.
+// The parser removes newlines before parsing, so the column counts
+// characters from the start of the query.
+func positionedError(query string, err error) error {
+	m := errorPositionPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	column, convErr := strconv.Atoi(m[2])
+	if convErr != nil || column < 1 {
+		return err
+	}
+	runes := []rune(strings.ReplaceAll(query, "\n", ""))
+	if column-1 > len(runes) {
+		return err
+	}
+	return &syntaxError{offset: sourceOffset(query, len(string(runes[:column-1]))), token: m[4], msg: m[3], err: err}
+}
+
+// sourceOffset translates offset, a position reported by the ddqp parser,
+// to a byte offset in query. The parser removes newlines before parsing.
+func sourceOffset(query string, offset int) int {
+	seen := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '\n' {
+			continue
+		}
+		if seen == offset {
+			return i
+		}
+		seen++
+	}
+	return len(query)
+}
+
+// nodeOffset translates offset, the position of an AST node parsed from
+// query by parseGeneric, to a byte offset in query. It reports false if
+// the position cannot be translated.
+func nodeOffset(query string, offset int) (int, bool) {
+	if encodeGroupByVariables(query) != query {
+		return 0, false
+	}
+	return sourceOffset(query, offset), true
+}
+
+// grammars lists every supported grammar; the conformance suite runs
+// against each of them.
+var grammars = []grammar{ddqpGrammar{}}
+
+// activeGrammar is the grammar used by ParseQuery and friends.
+var activeGrammar grammar = ddqpGrammar{}
+
+// parseGeneric parses query with the active grammar. Template variables in
+// group by clauses, which the grammar does not accept, are passed through
+// as group by keys.
+func parseGeneric(query string) (*ddqp.GenericQuery, error) {
+	encoded := encodeGroupByVariables(query)
+	parsed, err := activeGrammar.parse(encoded)
+	if encoded == query {
+		return parsed, err
+	}
+	if err != nil {
+		// Report positions in query rather than in its encoding
+		var syntaxErr *syntaxError
+		if errors.As(err, &syntaxErr) {
+			shift := strings.Count(encoded[:min(syntaxErr.offset, len(encoded))], groupByVariablePrefix) * (len(groupByVariablePrefix) - len("$"))
+			syntaxErr.offset -= shift
+		}
+		return nil, err
+	}
+
+	decode := func(q *ddqp.Query) {
+		for i, key := range q.Grouping {
+			q.Grouping[i] = decodeGroupByVariable(key)
+		}
+	}
+	switch {
+	case parsed.MetricQuery != nil:
+		walkMetricQuery(parsed.MetricQuery, decode)
+	case parsed.MetricExpression != nil:
+		walkMetricQueries(parsed.MetricExpression.GroupedExpression, decode)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,73 @@
+package metric
+
+import "testing"
+
+// conformanceCases pins the public ParseQuery behavior that every grammar
+// adapter must preserve.
+var conformanceCases = []struct {
+	name     string
+	query    string
+	expected string
+	wantErr  bool
+}{
+	{name: "bare metric", query: "system.cpu.idle{*}", expected: "system.cpu.idle{*}"},
+	{name: "aggregator", query: "avg:system.cpu.idle{*}", expected: "avg:system.cpu.idle{*}"},
+	{name: "time window", query: "avg(5m):system.cpu.idle{host:web-1}", expected: "avg(5m):system.cpu.idle{host:web-1}"},
+	{
+		name:     "filters and grouping",
+		query:    "sum:requests{env:prod,!service:canary} by {host,env}",
+		expected: "sum:requests{env:prod, !service:canary} by {host, env}",
+	},
+	{name: "in", query: "avg:system.cpu.idle{env IN (prod,staging)}", expected: "avg:system.cpu.idle{env IN (prod,staging)}"},
+	{name: "not in", query: "avg:system.cpu.idle{env NOT IN (dev,test)}", expected: "avg:system.cpu.idle{env NOT IN (dev,test)}"},
+	{
+		name:     "quoted value",
+		query:    `avg:http.requests{url:"https://example.com/a b"}`,
+		expected: `avg:http.requests{url:"https://example.com/a b"}`,
+	},
+	{
+		name:     "functions",
+		query:    "avg:system.cpu.idle{*}.fill(zero).rollup(60,avg)",
+		expected: "avg:system.cpu.idle{*}.fill(zero).rollup(60, avg)",
+	},
+	{name: "arithmetic expression", query: "sum:a{*} / sum:b{*}", expected: "sum:a{*} / sum:b{*}"},
+	{name: "nested expression", query: "(sum:a{*} + sum:b{*}) * 100", expected: "(sum:a{*} + sum:b{*}) * 100"},
+	{name: "error - unterminated filter", query: "avg:system.cpu.idle{", wantErr: true},
+	{name: "error - empty", query: "", wantErr: true},
+}
+
+// TestGrammarConformance runs the conformance cases against every
+// registered grammar.
+func TestGrammarConformance(t *testing.T) {
+	original := activeGrammar
+	defer func() { activeGrammar = original }()
+
+	for _, g := range grammars {
+		activeGrammar = g
+		for _, tt := range conformanceCases {
+			t.Run(g.name()+"/"+tt.name, func(t *testing.T) {
+				builder, err := ParseQuery(tt.query)
+				if tt.wantErr {
+					if err == nil {
+						t.Error("expected error but got nil")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				got, err := builder.Build()
+				if err != nil {
+					t.Fatalf("unexpected build error: %v", err)
+				}
+				if got != tt.expected {
+					t.Errorf("got %q, want %q", got, tt.expected)
+				}
+				if err := CheckRoundTrip(tt.query); err != nil {
+					t.Errorf("round trip failed: %v", err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package metric
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// tagKeyPattern matches a legal Datadog tag key: it must start with a
+// letter and may contain alphanumerics, underscores, minuses, periods and
+// slashes.
+var tagKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_\-./]*$`)
+
+// tagKeyRules describes tagKeyPattern for error messages.
+const tagKeyRules = "tag keys must start with a letter and contain only letters, digits, '_', '-', '.' or '/'"
+
+// templateVariablePattern matches a dashboard template variable such as
+// $group_by, which Datadog replaces with the selected tag key.
+var templateVariablePattern = regexp.MustCompile(`^\$[a-zA-Z_][a-zA-Z0-9_\-]*$`)
+
+// validateGroupByKey checks that key is usable in a "by {...}" clause.
+func validateGroupByKey(key string) error {
+	// by {*} is valid Datadog syntax for grouping by every tag, and
+	// template variables are resolved by the dashboard
+	if key == "*" || templateVariablePattern.MatchString(key) {
+		return nil
+	}
+
+	if key == "" {
+		return &ValidationError{Component: "group by key", Value: key, Reason: "cannot be empty"}
+	}
+
+	if strings.ContainsFunc(key, unicode.IsSpace) {
+		return &ValidationError{Component: "group by key", Value: key, Reason: "cannot contain whitespace"}
+	}
+
+	if strings.HasPrefix(key, "$") {
+		return &ValidationError{Component: "group by key", Value: key, Reason: "template variable names must start with a letter or '_' and contain only letters, digits, '_' or '-'"}
+	}
+
+	if strings.Contains(key, ":") {
+		return &ValidationError{Component: "group by key", Value: key, Reason: "looks like a key:value tag, group by the tag key only"}
+	}
+
+	if !tagKeyPattern.MatchString(key) {
+		return &ValidationError{Component: "group by key", Value: key, Reason: tagKeyRules}
+	}
+
+	return nil
+}
+
+// validateGroupByWildcard checks that by {*} is not combined with other
+// keys, which Datadog rejects.
+func validateGroupByWildcard(keys []string) error {
+	if len(keys) < 2 {
+		return nil
+	}
+	for _, key := range keys {
+		if key == "*" {
+			return &ValidationError{Component: "group by key", Value: key, Reason: "cannot be combined with other keys"}
+		}
+	}
+	return nil
+}
+
+// groupByKeys returns the group by keys to render: b.groupBy with repeated
+// keys, which Datadog rejects, removed after their first occurrence. It
+// returns b.groupBy itself when there are no repeats.
+func (b *metricQueryBuilder) groupByKeys() []string {
+	for i, key := range b.groupBy {
+		if slices.Contains(b.groupBy[:i], key) {
+			out := slices.Clone(b.groupBy[:i])
+			for _, key := range b.groupBy[i+1:] {
+				if !slices.Contains(out, key) {
+					out = append(out, key)
+				}
+			}
+			return out
+		}
+	}
+	return b.groupBy
+}
+
+// groupByClausePattern matches the braces of a "by {...}" clause.
+var groupByClausePattern = regexp.MustCompile(`\bby\s*\{[^{}]*\}`)
+
+// groupByVariablePattern matches a template variable inside a group by
+// clause.
+var groupByVariablePattern = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_\-]*)`)
+
+// groupByVariablePrefix stands in for the $ of a group by template variable
+// while a query is parsed, since the grammar only accepts identifiers.
+const groupByVariablePrefix = "__ddqb_var__"
+
+// encodeGroupByVariables rewrites the template variables in the group by
+// clauses of query into identifiers the grammar accepts.
+func encodeGroupByVariables(query string) string {
+	if !strings.Contains(query, "$") {
+		return query
+	}
+	return groupByClausePattern.ReplaceAllStringFunc(query, func(clause string) string {
+		return groupByVariablePattern.ReplaceAllString(clause, groupByVariablePrefix+"$1")
+	})
+}
+
+// decodeGroupByVariable reverses encodeGroupByVariables for a single
+// group by key.
+func decodeGroupByVariable(key string) string {
+	if name, ok := strings.CutPrefix(key, groupByVariablePrefix); ok {
+		return "$" + name
+	}
+	return key
+}
@@ -0,0 +1,355 @@
+package metric_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestGroupByValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "simple keys",
+			groups:   []string{"host", "env"},
+			expected: "system.cpu.idle{*} by {host, env}",
+			wantErr:  false,
+		},
+		{
+			name:     "keys with punctuation",
+			groups:   []string{"kube_namespace", "availability-zone", "aws.region", "team/name"},
+			expected: "system.cpu.idle{*} by {kube_namespace, availability-zone, aws.region, team/name}",
+			wantErr:  false,
+		},
+		{
+			name:     "wildcard grouping",
+			groups:   []string{"*"},
+			expected: "system.cpu.idle{*} by {*}",
+			wantErr:  false,
+		},
+		{
+			name:     "repeated keys render once in first-seen order",
+			groups:   []string{"host", "env", "host", "service", "env"},
+			expected: "system.cpu.idle{*} by {host, env, service}",
+			wantErr:  false,
+		},
+		{
+			name:     "repeated wildcard",
+			groups:   []string{"*", "*"},
+			expected: "system.cpu.idle{*} by {*}",
+			wantErr:  false,
+		},
+		{
+			name:    "error - value passed instead of key",
+			groups:  []string{"host:web-1"},
+			wantErr: true,
+		},
+		{
+			name:    "error - empty key",
+			groups:  []string{"", "host"},
+			wantErr: true,
+		},
+		{
+			name:    "error - key with a space",
+			groups:  []string{"availability zone"},
+			wantErr: true,
+		},
+		{
+			name:    "error - key with surrounding whitespace",
+			groups:  []string{" host"},
+			wantErr: true,
+		},
+		{
+			name:    "error - key starting with a digit",
+			groups:  []string{"1host"},
+			wantErr: true,
+		},
+		{
+			name:    "error - key with braces",
+			groups:  []string{"host}"},
+			wantErr: true,
+		},
+		{
+			name:    "error - one bad key among good keys",
+			groups:  []string{"host", "env:prod"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := metric.NewMetricQueryBuilder().
+				Metric("system.cpu.idle").
+				GroupBy(tt.groups...).
+				Build()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGroupByValidationReasons(t *testing.T) {
+	tests := []struct {
+		key    string
+		reason string
+	}{
+		{key: "", reason: "cannot be empty"},
+		{key: "availability zone", reason: "cannot contain whitespace"},
+		{key: "host\t", reason: "cannot contain whitespace"},
+		{key: "$1st", reason: "template variable names must start with a letter or '_' and contain only letters, digits, '_' or '-'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			_, err := metric.NewMetricQueryBuilder().
+				Metric("system.cpu.idle").
+				GroupBy("host", tt.key).
+				Build()
+
+			var vErr *metric.ValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("Build() error = %v, want *ValidationError", err)
+			}
+			if vErr.Component != "group by key" || vErr.Value != tt.key || vErr.Reason != tt.reason {
+				t.Errorf("ValidationError = %+v, want reason %q", vErr, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRemoveGroupBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		keys     []string
+		expected string
+	}{
+		{
+			name:     "one key of several",
+			query:    "avg:kubernetes.cpu.usage.total{env:prod} by {kube_namespace,pod_name,host}",
+			keys:     []string{"pod_name"},
+			expected: "avg:kubernetes.cpu.usage.total{env:prod} by {kube_namespace, host}",
+		},
+		{
+			name:     "every key drops the by clause",
+			query:    "avg:kubernetes.cpu.usage.total{env:prod} by {pod_name,host}",
+			keys:     []string{"host", "pod_name"},
+			expected: "avg:kubernetes.cpu.usage.total{env:prod}",
+		},
+		{
+			name:     "missing key is ignored",
+			query:    "avg:kubernetes.cpu.usage.total{env:prod} by {host}",
+			keys:     []string{"pod_name"},
+			expected: "avg:kubernetes.cpu.usage.total{env:prod} by {host}",
+		},
+		{
+			name:     "expression",
+			query:    "sum:requests.errors{*} by {service,pod_name} / sum:requests.total{*} by {pod_name,service}",
+			keys:     []string{"pod_name"},
+			expected: "sum:requests.errors{*} by {service} / sum:requests.total{*} by {service}",
+		},
+		{
+			name:     "expression left without grouping",
+			query:    "sum:requests.errors{*} by {pod_name} / sum:requests.total{*} by {pod_name}",
+			keys:     []string{"pod_name"},
+			expected: "sum:requests.errors{*} / sum:requests.total{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := builder.RemoveGroupBy(tt.keys...).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpressionGroupBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:  "add key to every query",
+			query: "sum:requests.errors{*} by {service} / sum:requests.total{*} by {service}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.GroupBy("env")
+			},
+			expected: "sum:requests.errors{*} by {service,env} / sum:requests.total{*} by {service,env}",
+		},
+		{
+			name:  "number operand is untouched",
+			query: "sum:requests.errors{*} * 100",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.GroupBy("service")
+			},
+			expected: "sum:requests.errors{*} by {service} * 100",
+		},
+		{
+			name:  "remove then add",
+			query: "sum:requests.errors{*} by {pod_name} / sum:requests.total{*} by {pod_name}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.RemoveGroupBy("pod_name").GroupBy("pod_name")
+			},
+			expected: "sum:requests.errors{*} by {pod_name} / sum:requests.total{*} by {pod_name}",
+		},
+		{
+			name:  "clear",
+			query: "sum:requests.errors{*} by {service} / sum:requests.total{*} by {service}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.ClearGroupBy()
+			},
+			expected: "sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:  "group by all",
+			query: "sum:requests.errors{*} / sum:requests.total{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.GroupByAll()
+			},
+			expected: "sum:requests.errors{*} by {*} / sum:requests.total{*} by {*}",
+		},
+		{
+			name:  "error - unrepresentable query",
+			query: "sum:requests.errors{!version:>2} / sum:requests.total{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.GroupBy("service")
+			},
+			wantErr: metric.ErrUnsupportedEdit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGroupByTemplateVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		build    func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "metric query",
+			query:    "avg:system.cpu.idle{env:prod} by {$group_by}",
+			build:    func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected: "avg:system.cpu.idle{env:prod} by {$group_by}",
+		},
+		{
+			name:  "mixed with tag keys",
+			query: "avg:system.cpu.idle{*} by {host,$group_by}",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{env:prod} by {host, $group_by}",
+		},
+		{
+			name:  "built",
+			query: "avg:system.cpu.idle{*}",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.GroupBy("$group_by")
+			},
+			expected: "avg:system.cpu.idle{*} by {$group_by}",
+		},
+		{
+			name:  "edited expression",
+			query: "sum:requests.errors{env:prod} by {$group_by} / sum:requests.total{env:prod} by {$group_by}",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(metric.NewFilterBuilder("service").Equal("web"))
+			},
+			expected: "sum:requests.errors{env:prod, service:web} by {$group_by} / sum:requests.total{env:prod, service:web} by {$group_by}",
+		},
+		{
+			name:  "invalid variable name",
+			query: "avg:system.cpu.idle{*}",
+			build: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.GroupBy("$1st")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.build(builder).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetGroupBy(t *testing.T) {
+	builder, err := metric.ParseQuery("avg:system.cpu.idle{*} by {host,env}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	groupBy := builder.GroupBy("host", "service").GetGroupBy()
+	if !slices.Equal(groupBy, []string{"host", "env", "service"}) {
+		t.Errorf("GetGroupBy() = %q, want [host env service]", groupBy)
+	}
+
+	// The returned slice is a copy
+	groupBy[0] = "pod_name"
+	if got := builder.GetGroupBy(); got[0] != "host" {
+		t.Errorf("GetGroupBy() after modifying the result = %q", got)
+	}
+
+	if got := builder.ClearGroupBy().GetGroupBy(); len(got) != 0 {
+		t.Errorf("GetGroupBy() after ClearGroupBy = %q, want none", got)
+	}
+}
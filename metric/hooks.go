@@ -0,0 +1,62 @@
+package metric
+
+// FilterHook is called each time a filter expression is added to a query,
+// either directly with Filter or into an existing group with AddToGroup.
+type FilterHook func(filter FilterExpression)
+
+// FunctionHook is called each time a function is applied to a query,
+// either directly with ApplyFunction or as part of ApplyChain.
+type FunctionHook func(fn FunctionBuilder)
+
+// hooks holds the observers registered on a builder.
+type hooks struct {
+	filterAdded     []FilterHook
+	functionApplied []FunctionHook
+}
+
+// clone returns a copy of h whose slices can be appended to independently.
+func (h hooks) clone() hooks {
+	return hooks{
+		filterAdded:     append([]FilterHook(nil), h.filterAdded...),
+		functionApplied: append([]FunctionHook(nil), h.functionApplied...),
+	}
+}
+
+// fireFilterAdded calls every registered FilterHook with filter.
+func (h hooks) fireFilterAdded(filter FilterExpression) {
+	for _, hook := range h.filterAdded {
+		hook(filter)
+	}
+}
+
+// fireFunctionApplied calls every registered FunctionHook with fn.
+func (h hooks) fireFunctionApplied(fn FunctionBuilder) {
+	for _, hook := range h.functionApplied {
+		hook(fn)
+	}
+}
+
+// OnFilterAdded registers hook to be called whenever a filter is added to
+// the query. Hooks run synchronously, in registration order, after the
+// filter has been added; they are useful for auditing how a dynamically
+// constructed query was assembled. Clones inherit the hooks of the builder
+// they were cloned from.
+func (b *metricQueryBuilder) OnFilterAdded(hook FilterHook) QueryBuilder {
+	b = b.mutable("OnFilterAdded")
+	if hook != nil {
+		b.hooks.filterAdded = append(b.hooks.filterAdded, hook)
+	}
+	return b
+}
+
+// OnFunctionApplied registers hook to be called whenever a function is
+// applied to the query. Hooks run synchronously, in registration order,
+// after the function has been applied. Clones inherit the hooks of the
+// builder they were cloned from.
+func (b *metricQueryBuilder) OnFunctionApplied(hook FunctionHook) QueryBuilder {
+	b = b.mutable("OnFunctionApplied")
+	if hook != nil {
+		b.hooks.functionApplied = append(b.hooks.functionApplied, hook)
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestMutationHooks(t *testing.T) {
+	var filters []string
+	var functions []string
+	recordFilter := func(f metric.FilterExpression) {
+		s, err := f.Build()
+		if err != nil {
+			t.Errorf("hook received unbuildable filter: %v", err)
+		}
+		filters = append(filters, s)
+	}
+	recordFunction := func(fn metric.FunctionBuilder) {
+		s, err := fn.Build()
+		if err != nil {
+			t.Errorf("hook received unbuildable function: %v", err)
+		}
+		functions = append(functions, s)
+	}
+
+	group := metric.NewFilterGroupBuilder().Or(metric.NewFilterBuilder("host").Equal("web-1"))
+	builder := metric.NewMetricQueryBuilder().
+		OnFilterAdded(recordFilter).
+		OnFunctionApplied(recordFunction).
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		Filter(group)
+	builder.AddToGroup(group, metric.NewFilterBuilder("host").Equal("web-2"))
+	builder.ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
+		ApplyChain(metric.NewFunctionChain(metric.NewFunctionBuilder("rollup").WithArg("60")))
+
+	wantFilters := []string{"env:prod", "host:web-1", "host:web-2"}
+	if len(filters) != len(wantFilters) {
+		t.Fatalf("got filter events %v, want %v", filters, wantFilters)
+	}
+	for i := range wantFilters {
+		if filters[i] != wantFilters[i] {
+			t.Errorf("filter event %d: got %q, want %q", i, filters[i], wantFilters[i])
+		}
+	}
+
+	wantFunctions := []string{".fill(zero)", ".rollup(60)"}
+	if len(functions) != len(wantFunctions) {
+		t.Fatalf("got function events %v, want %v", functions, wantFunctions)
+	}
+	for i := range wantFunctions {
+		if functions[i] != wantFunctions[i] {
+			t.Errorf("function event %d: got %q, want %q", i, functions[i], wantFunctions[i])
+		}
+	}
+}
+
+func TestMutationHooksInheritedByClone(t *testing.T) {
+	count := 0
+	base := metric.NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		OnFilterAdded(func(metric.FilterExpression) { count++ })
+
+	clone := base.Clone().OnFilterAdded(func(metric.FilterExpression) { count += 10 })
+	clone.Filter(metric.NewFilterBuilder("env").Equal("prod"))
+	base.Filter(metric.NewFilterBuilder("env").Equal("prod"))
+
+	// The clone fires both hooks; the base only its own.
+	if count != 12 {
+		t.Errorf("got count %d, want 12", count)
+	}
+}
@@ -0,0 +1,174 @@
+package metric
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// ToDDQP returns the query as a ddqp AST. The query is built first so that
+// invalid queries are reported rather than converted. The ddqp grammar has
+// no time window or wrapping functions, so queries with either return an
+// error wrapping ErrUnsupportedDDQP.
+func (b *metricQueryBuilder) ToDDQP() (*ddqp.MetricQuery, error) {
+	if _, err := b.Build(); err != nil {
+		return nil, err
+	}
+	if b.aggregator != "" && b.timeWindow != "" {
+		return nil, fmt.Errorf("%w: time window %q", ErrUnsupportedDDQP, b.timeWindow)
+	}
+	if len(b.wrappers) > 0 {
+		return nil, fmt.Errorf("%w: wrapping function", ErrUnsupportedDDQP)
+	}
+
+	q := &ddqp.Query{MetricName: b.metric}
+	if b.aggregator != "" {
+		q.Aggregator = &ddqp.Aggregator{Name: b.aggregator, Separator: ":"}
+	}
+
+	filters, err := b.ddqpFilters()
+	if err != nil {
+		return nil, err
+	}
+	q.Filters = filters
+
+	if groupBy := b.groupByKeys(); len(groupBy) > 0 {
+		q.By = "by"
+		q.Grouping = append([]string(nil), groupBy...)
+	}
+
+	for _, fn := range b.functions {
+		impl, ok := fn.(*functionBuilder)
+		if !ok {
+			return nil, &ValidationError{Component: "function", Value: "", Reason: "unsupported function type"}
+		}
+		f := &ddqp.Function{Name: impl.name, Args: make([]*ddqp.Value, 0, len(impl.args))}
+		for _, arg := range impl.args {
+			f.Args = append(f.Args, toDDQPArg(arg))
+		}
+		q.Function = append(q.Function, f)
+	}
+
+	return &ddqp.MetricQuery{Query: q}, nil
+}
+
+// ddqpFilters converts the top-level filters into a ddqp filter. As in
+// Build, filters are joined by commas unless any of them is a group, in
+// which case they are joined by explicit ANDs.
+func (b *metricQueryBuilder) ddqpFilters() (*ddqp.MetricFilter, error) {
+	filters := b.scopedFilters()
+	if len(filters) == 0 {
+		return &ddqp.MetricFilter{Left: &ddqp.Param{Asterisk: true}}, nil
+	}
+
+	comma := true
+	for _, filter := range filters {
+		if _, ok := filter.(FilterGroupBuilder); ok {
+			comma = false
+			break
+		}
+	}
+
+	params, err := toDDQPParams(filters, func(int) GroupOperator { return AndOperator }, comma)
+	if err != nil {
+		return nil, err
+	}
+	return &ddqp.MetricFilter{Left: params[0], Parameters: params[1:]}, nil
+}
+
+// toDDQPParams converts exprs into ddqp operands, each joined to the one
+// before it by opAt, or by commas when comma is set. Negated groups are
+// preceded by a NOT, folded into the joining separator where the grammar
+// allows it.
+func toDDQPParams(exprs []FilterExpression, opAt func(int) GroupOperator, comma bool) ([]*ddqp.Param, error) {
+	params := make([]*ddqp.Param, 0, 2*len(exprs))
+	for i, expr := range exprs {
+		g, ok := expr.(*filterGroupBuilder)
+		negate := ok && g.negated
+		op := AndOperator
+		if i > 0 && !comma {
+			op = opAt(i)
+		}
+
+		switch {
+		case i > 0 && comma:
+			params = append(params, &ddqp.Param{Separator: &ddqp.FilterValueSeparator{Comma: true}})
+			if negate {
+				params = append(params, &ddqp.Param{Separator: &ddqp.FilterValueSeparator{Not: true}})
+			}
+		case i > 0:
+			sep := &ddqp.FilterValueSeparator{}
+			switch {
+			case op == OrOperator && negate:
+				sep.OrNot = true
+			case op == OrOperator:
+				sep.Or = true
+			case negate:
+				sep.AndNot = true
+			default:
+				sep.And = true
+			}
+			params = append(params, &ddqp.Param{Separator: sep})
+		case negate:
+			params = append(params, &ddqp.Param{Separator: &ddqp.FilterValueSeparator{Not: true}})
+		}
+
+		p, err := toDDQPParam(expr)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// toDDQPArg converts a function argument into a ddqp.Value, using a number
+// where the argument renders identically as one, as the parser does.
+func toDDQPArg(arg string) *ddqp.Value {
+	if f, err := strconv.ParseFloat(arg, 64); err == nil {
+		v := &ddqp.Value{Number: &f}
+		if v.String() == arg {
+			return v
+		}
+	}
+	return &ddqp.Value{Identifier: &arg}
+}
+
+// ToDDQP returns the expression's ddqp AST when it is a single, possibly
+// wrapped, metric query. Arithmetic expressions and time windows, including
+// an agg(window): prefix over the whole expression, cannot be represented
+// as a ddqp.MetricQuery and return an error wrapping ErrUnsupportedDDQP.
+func (b *expressionQueryBuilder) ToDDQP() (*ddqp.MetricQuery, error) {
+	query, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	timeWindow, cleaned := extractAndRemoveTimeWindow(query)
+	if timeWindow != "" {
+		return nil, fmt.Errorf("%w: time window %q", ErrUnsupportedDDQP, timeWindow)
+	}
+	parsed, err := parseGeneric(cleaned)
+	if err != nil {
+		return nil, newParseError(query, cleaned, err)
+	}
+	if parsed.MetricQuery == nil {
+		return nil, fmt.Errorf("%w: expression %q", ErrUnsupportedDDQP, query)
+	}
+	return parsed.MetricQuery, nil
+}
+
+// FromDDQP converts a ddqp AST into a query builder without rendering it
+// to a string first. Queries wrapped in aggregator functions such as
+// top() are returned as expression builders, as ParseQuery does.
+func FromDDQP(mq *ddqp.MetricQuery) (QueryBuilder, error) {
+	switch {
+	case mq == nil:
+		return nil, &ValidationError{Component: "ddqp query", Value: "", Reason: "query is nil"}
+	case mq.Query != nil:
+		return fromQuery(mq.Query, "")
+	case mq.AggregatorFuction != nil:
+		return newExpressionBuilder(mq.String(), &ddqp.GenericQuery{MetricQuery: mq}, false), nil
+	}
+	return nil, &ValidationError{Component: "ddqp query", Value: "", Reason: "query is missing required Query component"}
+}
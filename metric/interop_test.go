@@ -0,0 +1,177 @@
+package metric_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb"
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqp"
+)
+
+func TestToDDQP(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  metric.QueryBuilder
+		expected string // ddqp rendering of the converted AST
+		wantErr  bool
+		errIs    error
+	}{
+		{
+			name: "full query",
+			builder: ddqb.Metric().
+				Aggregator("avg").
+				Metric("system.cpu.idle").
+				Filter(ddqb.Filter("host").Equal("web-1")).
+				Filter(ddqb.Filter("env").In("prod", "staging")).
+				GroupBy("host").
+				ApplyFunction(ddqb.Function("rollup").WithArgs("avg", "60")),
+			expected: "avg:system.cpu.idle{host:web-1, env IN (prod, staging)} by {host}.rollup(avg,60)",
+		},
+		{
+			name: "comparison filters",
+			builder: ddqb.Metric().
+				Metric("system.cpu.idle").
+				Filter(ddqb.Filter("cores").GreaterOrEqual("4")).
+				Filter(ddqb.Filter("version").LessThan("2")),
+			expected: "system.cpu.idle{cores:>=4, version:<2}",
+		},
+		{
+			name: "regex filters",
+			builder: ddqb.Metric().
+				Metric("system.cpu.idle").
+				Filter(ddqb.Filter("host").Regex("web.*")).
+				Filter(ddqb.Filter("host").NotRegex("web-canary.*")),
+			expected: "system.cpu.idle{host:~web.*, !host:~web-canary.*}",
+		},
+		{
+			name: "key existence filters",
+			builder: ddqb.Metric().
+				Metric("system.cpu.idle").
+				Filter(ddqb.Filter("team").Exists()).
+				Filter(ddqb.Filter("deprecated").NotExists()),
+			expected: "system.cpu.idle{team:*, !deprecated:*}",
+		},
+		{
+			name:     "no filters",
+			builder:  ddqb.Metric().Metric("system.cpu.idle"),
+			expected: "system.cpu.idle{*}",
+		},
+		{
+			name: "negated group",
+			builder: ddqb.Metric().
+				Metric("system.cpu.idle").
+				Filter(ddqb.Filter("env").Equal("prod")).
+				Filter(ddqb.FilterGroup().
+					Or(ddqb.Filter("host").Equal("a")).
+					Or(ddqb.Filter("host").Equal("b")).
+					Not()),
+			expected: "system.cpu.idle{env:prod AND NOT (host:a OR host:b)}",
+		},
+		{
+			name:     "expression wrapping a single query",
+			builder:  mustParse(t, "top(avg:system.cpu.idle{*} by {host}, 10, 'mean', 'desc')"),
+			expected: "top(avg:system.cpu.idle{*} by {host}, 10, 'mean', 'desc')",
+		},
+		{
+			name:    "error - time window",
+			builder: ddqb.Metric().Aggregator("avg").TimeWindow("5m").Metric("system.cpu.idle"),
+			wantErr: true,
+			errIs:   metric.ErrUnsupportedDDQP,
+		},
+		{
+			name:    "error - arithmetic expression",
+			builder: mustParse(t, "sum:a{*} / sum:b{*}"),
+			wantErr: true,
+			errIs:   metric.ErrUnsupportedDDQP,
+		},
+		{
+			name:    "error - time window over an expression",
+			builder: mustParse(t, "avg(5m):sum:a{env:prod} / sum:b{*}"),
+			wantErr: true,
+			errIs:   metric.ErrUnsupportedDDQP,
+		},
+		{
+			name:    "error - last_ time window over a metric query",
+			builder: mustParse(t, "avg(last_5m):sum:a{host:x}"),
+			wantErr: true,
+			errIs:   metric.ErrUnsupportedDDQP,
+		},
+		{
+			name:    "error - invalid query",
+			builder: ddqb.Metric(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mq, err := tt.builder.ToDDQP()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("error = %v, want %v", err, tt.errIs)
+				}
+				if tt.errIs == nil && errors.Is(err, metric.ErrUnsupportedDDQP) {
+					t.Errorf("error = %v, want an error other than %v", err, metric.ErrUnsupportedDDQP)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := mq.String(); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFromDDQP(t *testing.T) {
+	mq, err := ddqp.NewMetricQueryParser().Parse("sum:requests{env:prod,!service:canary} by {host}.rollup(sum,60)")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	builder, err := metric.FromDDQP(mq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := builder.Filter(ddqb.Filter("region").Equal("us-east-1")).Build()
+	if err != nil {
+		t.Fatalf("unexpected build error: %v", err)
+	}
+	expected := "sum:requests{env:prod, !service:canary, region:us-east-1} by {host}.rollup(sum, 60)"
+	if got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	// Converting back yields an equivalent AST
+	back, err := builder.ToDDQP()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := metric.CheckRoundTrip(back.String()); err != nil {
+		t.Errorf("converted AST does not round trip: %v", err)
+	}
+}
+
+func TestFromDDQPNil(t *testing.T) {
+	_, err := metric.FromDDQP(nil)
+	var validationErr *metric.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("expected *ValidationError, got %v", err)
+	}
+}
+
+// mustParse parses query, failing the test on error.
+func mustParse(t *testing.T, query string) metric.QueryBuilder {
+	t.Helper()
+	b, err := metric.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	return b
+}
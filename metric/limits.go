@@ -0,0 +1,159 @@
+package metric
+
+import (
+	"fmt"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// Limits bounds the complexity of queries a builder will produce. Systems
+// that let users drive query construction can use them to reject
+// pathological queries before they reach Datadog. A zero field means no
+// limit.
+type Limits struct {
+	// MaxFilters is the maximum number of individual filters, counting
+	// those nested inside groups.
+	MaxFilters int
+
+	// MaxNestingDepth is the maximum depth of filter groups. A filter at
+	// the top level has depth 1, a filter inside a group depth 2, and so on.
+	MaxNestingDepth int
+
+	// MaxFunctions is the maximum number of applied functions.
+	MaxFunctions int
+
+	// MaxSubQueries is the maximum number of metric queries in a metric
+	// expression such as "sum:a{*} / sum:b{*}".
+	MaxSubQueries int
+}
+
+// LimitError is returned when a query exceeds one of the configured Limits.
+// It wraps ErrLimitExceeded.
+type LimitError struct {
+	// Limit names the exceeded limit (e.g. "filters", "nesting depth").
+	Limit string
+	// Max is the configured maximum.
+	Max int
+	// Actual is the value found in the query.
+	Actual int
+}
+
+// Error returns a description of the exceeded limit.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("query has %d %s, exceeding the limit of %d", e.Actual, e.Limit, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// checkLimit returns a LimitError if actual exceeds max, treating a zero max as
+// unlimited.
+func checkLimit(limit string, max, actual int) error {
+	if max > 0 && actual > max {
+		return &LimitError{Limit: limit, Max: max, Actual: actual}
+	}
+	return nil
+}
+
+// checkLimits checks the builder's components against l, returning every
+// exceeded limit.
+func (b *metricQueryBuilder) checkLimits(l Limits) []error {
+	var errs []error
+
+	filters, depth := 0, 0
+	for _, f := range b.scopedFilters() {
+		n, d := filterComplexity(f)
+		filters += n
+		depth = max(depth, d)
+	}
+
+	if err := checkLimit("filters", l.MaxFilters, filters); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkLimit("levels of filter nesting", l.MaxNestingDepth, depth); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkLimit("functions", l.MaxFunctions, len(b.functions)); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// filterComplexity returns the number of individual filters in expr and
+// its nesting depth.
+func filterComplexity(expr FilterExpression) (count, depth int) {
+	g, ok := expr.(*filterGroupBuilder)
+	if !ok {
+		return 1, 1
+	}
+	for _, nested := range g.expressions {
+		n, d := filterComplexity(nested)
+		count += n
+		depth = max(depth, d)
+	}
+	return count, depth + 1
+}
+
+// countSubQueries returns the number of metric queries in a parsed query.
+func countSubQueries(parsed *ddqp.GenericQuery) int {
+	switch {
+	case parsed.MetricQuery != nil:
+		return 1
+	case parsed.MetricExpression != nil:
+		return countExpressionQueries(parsed.MetricExpression)
+	}
+	return 0
+}
+
+// countExpressionQueries returns the number of metric queries in expr.
+func countExpressionQueries(expr *ddqp.MetricExpression) int {
+	if expr == nil {
+		return 0
+	}
+	return countGroupedQueries(expr.GroupedExpression)
+}
+
+// countGroupedQueries returns the number of metric queries in ge.
+func countGroupedQueries(ge *ddqp.GroupedExpression) int {
+	if ge == nil {
+		return 0
+	}
+	n := countTermQueries(ge.Left)
+	for _, rt := range ge.Right {
+		if rt != nil {
+			n += countTermQueries(rt.Term)
+		}
+	}
+	return n
+}
+
+// countTermQueries returns the number of metric queries in t.
+func countTermQueries(t *ddqp.Term) int {
+	if t == nil || t.Left == nil {
+		return 0
+	}
+	n := countValueQueries(t.Left.Base)
+	for _, of := range t.Right {
+		if of != nil && of.Factor != nil {
+			n += countValueQueries(of.Factor.Base)
+		}
+	}
+	return n
+}
+
+// countValueQueries returns the number of metric queries in v.
+func countValueQueries(v *ddqp.ExprValue) int {
+	switch {
+	case v == nil:
+		return 0
+	case v.Subexpression != nil:
+		return countExpressionQueries(v.Subexpression)
+	case v.MetricQuery != nil:
+		return 1
+	case v.ExprAggregatorFuction != nil:
+		return countGroupedQueries(v.ExprAggregatorFuction.Body)
+	}
+	return 0
+}
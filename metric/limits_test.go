@@ -0,0 +1,117 @@
+package metric_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestLimits(t *testing.T) {
+	nested := func() metric.FilterExpression {
+		return metric.NewFilterGroupBuilder().
+			Or(metric.NewFilterBuilder("host").Equal("web-1")).
+			Or(metric.NewFilterGroupBuilder().
+				And(metric.NewFilterBuilder("env").Equal("prod")).
+				And(metric.NewFilterBuilder("region").Equal("us-east-1")))
+	}
+
+	tests := []struct {
+		name      string
+		limits    metric.Limits
+		builder   func() metric.QueryBuilder
+		wantLimit string
+	}{
+		{
+			name:   "within limits",
+			limits: metric.Limits{MaxFilters: 4, MaxNestingDepth: 3, MaxFunctions: 1},
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("team").Equal("core")).
+					Filter(nested()).
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero"))
+			},
+		},
+		{
+			name:   "zero limits are unlimited",
+			limits: metric.Limits{},
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(nested())
+			},
+		},
+		{
+			name:   "too many filters counts nested filters",
+			limits: metric.Limits{MaxFilters: 2},
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(nested())
+			},
+			wantLimit: "filters",
+		},
+		{
+			name:   "too deeply nested",
+			limits: metric.Limits{MaxNestingDepth: 2},
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(nested())
+			},
+			wantLimit: "levels of filter nesting",
+		},
+		{
+			name:   "too many functions",
+			limits: metric.Limits{MaxFunctions: 1},
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60"))
+			},
+			wantLimit: "functions",
+		},
+		{
+			name:   "too many sub-queries",
+			limits: metric.Limits{MaxSubQueries: 2},
+			builder: func() metric.QueryBuilder {
+				b, err := metric.ParseQuery("sum:a{*} + sum:b{*} + sum:c{*}")
+				if err != nil {
+					t.Fatalf("unexpected parse error: %v", err)
+				}
+				return b
+			},
+			wantLimit: "sub-queries",
+		},
+		{
+			name:   "sub-queries within limit",
+			limits: metric.Limits{MaxSubQueries: 2},
+			builder: func() metric.QueryBuilder {
+				b, err := metric.ParseQuery("sum:a{*} / sum:b{*}")
+				if err != nil {
+					t.Fatalf("unexpected parse error: %v", err)
+				}
+				return b
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder().WithConfig(metric.Config{Limits: tt.limits}).Build()
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, metric.ErrLimitExceeded) {
+				t.Fatalf("expected ErrLimitExceeded, got %v", err)
+			}
+			var le *metric.LimitError
+			if !errors.As(err, &le) {
+				t.Fatalf("expected *LimitError, got %T", err)
+			}
+			if le.Limit != tt.wantLimit {
+				t.Errorf("got limit %q, want %q", le.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QueryFile is the document format read by the loaders: a set of named
+// query definitions.
+//
+//	queries:
+//	  cpu:
+//	    aggregator: avg
+//	    metric: system.cpu.idle
+//	    filters:
+//	      - key: env
+//	        value: ${env}
+//	      - key: service
+//	        value: ${service}
+//	        not: true
+//	    group_by: [host]
+//	    functions:
+//	      - name: rollup
+//	        args: [avg, "${window}"]
+//	  errors:
+//	    query: sum:trace.http.request.errors{env:${env}}.as_count()
+type QueryFile struct {
+	Queries map[string]QueryDefinition `json:"queries" yaml:"queries"`
+}
+
+// QueryDefinition describes a single metric query, either as a raw query
+// string or as its individual components. Any string may contain ${name}
+// parameters, which are substituted when the query is instantiated.
+type QueryDefinition struct {
+	// Query is a complete query string. It is mutually exclusive with the
+	// component fields below.
+	Query string `json:"query,omitempty" yaml:"query,omitempty"`
+
+	Metric     string               `json:"metric,omitempty" yaml:"metric,omitempty"`
+	Aggregator string               `json:"aggregator,omitempty" yaml:"aggregator,omitempty"`
+	TimeWindow string               `json:"time_window,omitempty" yaml:"time_window,omitempty"`
+	Filters    []FilterDefinition   `json:"filters,omitempty" yaml:"filters,omitempty"`
+	GroupBy    []string             `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+	Functions  []FunctionDefinition `json:"functions,omitempty" yaml:"functions,omitempty"`
+}
+
+// FilterDefinition describes a single filter. Value produces an equality
+// filter and Values an IN filter; Not negates either.
+type FilterDefinition struct {
+	Key    string   `json:"key" yaml:"key"`
+	Value  string   `json:"value,omitempty" yaml:"value,omitempty"`
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+	Not    bool     `json:"not,omitempty" yaml:"not,omitempty"`
+}
+
+// FunctionDefinition describes a single function application.
+type FunctionDefinition struct {
+	Name string   `json:"name" yaml:"name"`
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// paramPattern matches ${name} parameters in query definitions.
+var paramPattern = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// QueryFactory produces query builders from a single definition, one per
+// parameter set, so that a definition can be fanned out across services
+// or environments at runtime.
+type QueryFactory struct {
+	name   string
+	def    QueryDefinition
+	params []string
+}
+
+// Name returns the name the definition was given in its file.
+func (f *QueryFactory) Name() string {
+	return f.name
+}
+
+// Params returns the sorted names of every ${name} parameter used by the
+// definition.
+func (f *QueryFactory) Params() []string {
+	out := make([]string, len(f.params))
+	copy(out, f.params)
+	return out
+}
+
+// New returns a fresh builder with every ${name} parameter replaced by its
+// value from params. It returns an error naming every missing parameter.
+func (f *QueryFactory) New(params map[string]string) (QueryBuilder, error) {
+	var missing []string
+	for _, name := range f.params {
+		if _, ok := params[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		errs := make([]error, len(missing))
+		for i, name := range missing {
+			errs[i] = &ValidationError{Component: "parameter", Value: name, Reason: "no value provided"}
+		}
+		return nil, fmt.Errorf("query %q: %w", f.name, errors.Join(errs...))
+	}
+
+	sub := func(s string) string {
+		return paramPattern.ReplaceAllStringFunc(s, func(match string) string {
+			return params[match[2:len(match)-1]]
+		})
+	}
+
+	if f.def.Query != "" {
+		return ParseQuery(sub(f.def.Query))
+	}
+
+	builder := NewMetricQueryBuilder().Metric(sub(f.def.Metric))
+	if f.def.Aggregator != "" {
+		builder.Aggregator(sub(f.def.Aggregator))
+	}
+	if f.def.TimeWindow != "" {
+		builder.TimeWindow(sub(f.def.TimeWindow))
+	}
+	for _, fd := range f.def.Filters {
+		filter := NewFilterBuilder(sub(fd.Key))
+		if len(fd.Values) > 0 {
+			values := make([]string, len(fd.Values))
+			for i, v := range fd.Values {
+				values[i] = sub(v)
+			}
+			if fd.Not {
+				filter.NotIn(values...)
+			} else {
+				filter.In(values...)
+			}
+		} else if fd.Not {
+			filter.NotEqual(sub(fd.Value))
+		} else {
+			filter.Equal(sub(fd.Value))
+		}
+		builder.Filter(filter)
+	}
+	for _, key := range f.def.GroupBy {
+		builder.GroupBy(sub(key))
+	}
+	for _, fn := range f.def.Functions {
+		function := NewFunctionBuilder(sub(fn.Name))
+		for _, arg := range fn.Args {
+			function.WithArg(sub(arg))
+		}
+		builder.ApplyFunction(function)
+	}
+	return builder, nil
+}
+
+// LoadQueriesJSON reads a JSON QueryFile from r and returns a factory for
+// each definition, keyed by name.
+func LoadQueriesJSON(r io.Reader) (map[string]*QueryFactory, error) {
+	var file QueryFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode query file: %w", err)
+	}
+	return newQueryFactories(file)
+}
+
+// LoadQueriesYAML reads a YAML QueryFile from r and returns a factory for
+// each definition, keyed by name.
+func LoadQueriesYAML(r io.Reader) (map[string]*QueryFactory, error) {
+	var file QueryFile
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode query file: %w", err)
+	}
+	return newQueryFactories(file)
+}
+
+// LoadQueriesFile reads a QueryFile from path, choosing JSON or YAML by
+// the file extension (.json, .yaml or .yml).
+func LoadQueriesFile(path string) (map[string]*QueryFactory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadQueriesJSON(bytes.NewReader(data))
+	case ".yaml", ".yml":
+		return LoadQueriesYAML(bytes.NewReader(data))
+	default:
+		return nil, &ValidationError{Component: "query file", Value: path, Reason: "extension must be .json, .yaml or .yml"}
+	}
+}
+
+// newQueryFactories validates every definition in file and wraps each in
+// a QueryFactory.
+func newQueryFactories(file QueryFile) (map[string]*QueryFactory, error) {
+	factories := make(map[string]*QueryFactory, len(file.Queries))
+	var errs []error
+	for name, def := range file.Queries {
+		if err := def.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("query %q: %w", name, err))
+			continue
+		}
+		factories[name] = &QueryFactory{name: name, def: def, params: def.paramNames()}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return factories, nil
+}
+
+// validate checks the structure of the definition. Values are validated
+// when the built query is rendered, once parameters are known.
+func (d QueryDefinition) validate() error {
+	hasComponents := d.Metric != "" || d.Aggregator != "" || d.TimeWindow != "" ||
+		len(d.Filters) > 0 || len(d.GroupBy) > 0 || len(d.Functions) > 0
+
+	switch {
+	case d.Query != "" && hasComponents:
+		return &ValidationError{Component: "query definition", Value: d.Query, Reason: "query cannot be combined with component fields"}
+	case d.Query == "" && d.Metric == "":
+		return &ValidationError{Component: "query definition", Value: "", Reason: "either query or metric is required"}
+	}
+
+	for _, f := range d.Filters {
+		if f.Value != "" && len(f.Values) > 0 {
+			return &ValidationError{Component: "filter definition", Value: f.Key, Reason: "value and values are mutually exclusive"}
+		}
+	}
+	return nil
+}
+
+// paramNames returns the sorted, de-duplicated parameter names used in d.
+func (d QueryDefinition) paramNames() []string {
+	seen := make(map[string]bool)
+	collect := func(s string) {
+		for _, m := range paramPattern.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	}
+
+	collect(d.Query)
+	collect(d.Metric)
+	collect(d.Aggregator)
+	collect(d.TimeWindow)
+	for _, f := range d.Filters {
+		collect(f.Key)
+		collect(f.Value)
+		for _, v := range f.Values {
+			collect(v)
+		}
+	}
+	for _, key := range d.GroupBy {
+		collect(key)
+	}
+	for _, fn := range d.Functions {
+		collect(fn.Name)
+		for _, arg := range fn.Args {
+			collect(arg)
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
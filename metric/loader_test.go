@@ -0,0 +1,126 @@
+package metric_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestLoadQueriesFile(t *testing.T) {
+	factories, err := metric.LoadQueriesFile("testdata/queries.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cpu := factories["cpu"]
+	if cpu == nil {
+		t.Fatal("missing cpu definition")
+	}
+	if got, want := cpu.Params(), []string{"env", "region", "window"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Params() = %v, want %v", got, want)
+	}
+
+	// The same definition fans out across environments
+	for _, env := range []string{"prod", "staging"} {
+		builder, err := cpu.New(map[string]string{"env": env, "region": "eu-west-1", "window": "300"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := builder.Build()
+		if err != nil {
+			t.Fatalf("unexpected build error: %v", err)
+		}
+		expected := "avg(5m):system.cpu.idle{env:" + env + ", region IN (us-east-1,eu-west-1), !service:canary} by {host}.rollup(avg, 300)"
+		if got != expected {
+			t.Errorf("got %q, want %q", got, expected)
+		}
+	}
+
+	builder, err := factories["errors"].New(map[string]string{"env": "prod", "service": "web"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected build error: %v", err)
+	}
+	if got != "sum:trace.http.request.errors{env:prod, service:web}.as_count()" {
+		t.Errorf("unexpected raw query output: %q", got)
+	}
+
+	factories, err = metric.LoadQueriesFile("testdata/queries.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	builder, err = factories["latency"].New(map[string]string{"service": "api"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err = builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected build error: %v", err)
+	}
+	if got != "p95:trace.http.request.duration{service:api} by {resource_name}" {
+		t.Errorf("unexpected JSON query output: %q", got)
+	}
+}
+
+func TestQueryFactoryMissingParams(t *testing.T) {
+	factories, err := metric.LoadQueriesFile("testdata/queries.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = factories["cpu"].New(map[string]string{"env": "prod"})
+	var ve *metric.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	for _, name := range []string{"region", "window"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name missing parameter %q", err, name)
+		}
+	}
+}
+
+func TestLoadQueriesInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "unknown field",
+			input: `{"queries": {"q": {"metric": "a", "aggregate": "avg"}}}`,
+		},
+		{
+			name:  "no metric or query",
+			input: `{"queries": {"q": {"aggregator": "avg"}}}`,
+		},
+		{
+			name:  "query combined with components",
+			input: `{"queries": {"q": {"query": "avg:a{*}", "metric": "a"}}}`,
+		},
+		{
+			name:  "value and values",
+			input: `{"queries": {"q": {"metric": "a", "filters": [{"key": "k", "value": "v", "values": ["v"]}]}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := metric.LoadQueriesJSON(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected error but got nil")
+			}
+		})
+	}
+
+	if _, err := metric.LoadQueriesYAML(strings.NewReader("queries:\n  q:\n    metric: a\n    unknown: b\n")); err == nil {
+		t.Error("expected error for unknown YAML field")
+	}
+	if _, err := metric.LoadQueriesFile("testdata/queries.toml"); err == nil {
+		t.Error("expected error for unsupported extension")
+	}
+}
@@ -0,0 +1,73 @@
+package metric
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// logger holds the package-level logger used to instrument parse and build
+// operations. A nil logger disables instrumentation.
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger used to record parse and build operations.
+// Successful operations are logged at debug level and failures at warn
+// level, with the query length and component counts attached so that bad
+// queries can be traced back to where they were constructed.
+// Passing nil disables logging. It is safe to call concurrently with Build.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// builderAttrs describes the components of b for log records.
+func builderAttrs(b QueryBuilder) []slog.Attr {
+	switch impl := b.(type) {
+	case *metricQueryBuilder:
+		return []slog.Attr{
+			slog.String("kind", "query"),
+			slog.String("metric", impl.metric),
+			slog.Int("filters", len(impl.filters)),
+			slog.Int("group_by", len(impl.groupBy)),
+			slog.Int("functions", len(impl.functions)),
+		}
+	case *expressionQueryBuilder:
+		return []slog.Attr{
+			slog.String("kind", "expression"),
+			slog.Int("added_filters", len(impl.addedFilters)),
+		}
+	}
+	return nil
+}
+
+// logBuild records the outcome of building b into query.
+func logBuild(b QueryBuilder, query string, err error) {
+	l := logger.Load()
+	if l == nil {
+		return
+	}
+
+	attrs := append(builderAttrs(b), slog.Int("query_length", len(query)))
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		l.LogAttrs(context.Background(), slog.LevelWarn, "ddqb: build failed", attrs...)
+		return
+	}
+	l.LogAttrs(context.Background(), slog.LevelDebug, "ddqb: built query", attrs...)
+}
+
+// logParse records the outcome of parsing query into b.
+func logParse(query string, b QueryBuilder, err error) {
+	l := logger.Load()
+	if l == nil {
+		return
+	}
+
+	attrs := []slog.Attr{slog.Int("query_length", len(query))}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		l.LogAttrs(context.Background(), slog.LevelWarn, "ddqb: parse failed", attrs...)
+		return
+	}
+	attrs = append(attrs, builderAttrs(b)...)
+	l.LogAttrs(context.Background(), slog.LevelDebug, "ddqb: parsed query", attrs...)
+}
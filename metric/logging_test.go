@@ -0,0 +1,103 @@
+package metric_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// captureLogs installs a JSON logger for the duration of the test and
+// returns a function that decodes the records written so far.
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	metric.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { metric.SetLogger(nil) })
+
+	return func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("invalid log line %q: %v", line, err)
+			}
+			records = append(records, rec)
+		}
+		return records
+	}
+}
+
+func TestLoggingBuild(t *testing.T) {
+	records := captureLogs(t)
+
+	query, err := metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+		GroupBy("host").
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = metric.NewMetricQueryBuilder().Aggregator("avg").Build()
+	if err == nil {
+		t.Fatal("expected error for missing metric")
+	}
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("got %d log records, want 2: %v", len(got), got)
+	}
+
+	ok := got[0]
+	if ok["level"] != "DEBUG" || ok["msg"] != "ddqb: built query" {
+		t.Errorf("unexpected success record: %v", ok)
+	}
+	if ok["query_length"] != float64(len(query)) || ok["filters"] != float64(1) || ok["group_by"] != float64(1) {
+		t.Errorf("unexpected success attributes: %v", ok)
+	}
+
+	failed := got[1]
+	if failed["level"] != "WARN" || failed["msg"] != "ddqb: build failed" {
+		t.Errorf("unexpected failure record: %v", failed)
+	}
+	if _, ok := failed["error"]; !ok {
+		t.Errorf("failure record missing error: %v", failed)
+	}
+}
+
+func TestLoggingParse(t *testing.T) {
+	records := captureLogs(t)
+
+	if _, err := metric.ParseQuery("avg:system.cpu.idle{host:web-1}.fill(zero)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := metric.ParseQuery("avg:system.cpu.idle{"); err == nil {
+		t.Fatal("expected parse error")
+	}
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("got %d log records, want 2: %v", len(got), got)
+	}
+	if got[0]["msg"] != "ddqb: parsed query" || got[0]["kind"] != "query" || got[0]["functions"] != float64(1) {
+		t.Errorf("unexpected parse record: %v", got[0])
+	}
+	if got[1]["level"] != "WARN" || got[1]["msg"] != "ddqb: parse failed" {
+		t.Errorf("unexpected parse failure record: %v", got[1])
+	}
+}
+
+func TestLoggingDisabled(t *testing.T) {
+	metric.SetLogger(nil)
+	if _, err := metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Build(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
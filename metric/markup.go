@@ -0,0 +1,172 @@
+package metric
+
+import (
+	"html"
+	"strings"
+)
+
+// CSS classes applied by RenderHTML. Style them to highlight queries in
+// generated runbooks and catalogs.
+const (
+	ClassQuery      = "ddqb-query"
+	ClassAggregator = "ddqb-aggregator"
+	ClassTimeWindow = "ddqb-time-window"
+	ClassMetric     = "ddqb-metric"
+	ClassFilter     = "ddqb-filter"
+	ClassOperator   = "ddqb-operator"
+	ClassGroupBy    = "ddqb-group-by"
+	ClassFunction   = "ddqb-function"
+	ClassExpression = "ddqb-expression"
+)
+
+// RenderHTML returns the query built by q as an HTML <code> element in which
+// the aggregator, time window, metric, each filter, each group by key and
+// each function is wrapped in a <span> carrying one of the Class*
+// constants. Queries parsed from metric expressions are wrapped whole in a
+// ClassExpression span, as are queries wrapped in a WrapperBuilder
+// implemented outside this package. Build errors are returned unchanged.
+func RenderHTML(q QueryBuilder) (string, error) {
+	query, err := q.Build()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<code class="` + ClassQuery + `">`)
+	if b, ok := q.(*metricQueryBuilder); ok && b.wrappersHighlightable() {
+		b.renderHTML(&sb)
+	} else {
+		writeSpan(&sb, ClassExpression, query)
+	}
+	sb.WriteString("</code>")
+	return sb.String(), nil
+}
+
+// RenderMarkdown returns the query built by q as a fenced Markdown code
+// block, using the pretty output format so that long queries stay
+// readable. The block is tagged with the "datadog" language for
+// highlighters that support it.
+func RenderMarkdown(q QueryBuilder) (string, error) {
+	query, err := q.BuildWithOptions(WithFormat(FormatPretty))
+	if err != nil {
+		return "", err
+	}
+	return "```datadog\n" + query + "\n```\n", nil
+}
+
+// renderHTML writes the highlighted components of an already validated
+// query into sb.
+func (b *metricQueryBuilder) renderHTML(sb *strings.Builder) {
+	// Wrappers were validated by Build; the outermost opens first
+	for i := len(b.wrappers) - 1; i >= 0; i-- {
+		writeSpan(sb, ClassFunction, wrapperName(b.wrappers[i])+"(")
+	}
+
+	if b.aggregator != "" {
+		writeSpan(sb, ClassAggregator, b.aggregator)
+		if b.timeWindow != "" {
+			sb.WriteByte('(')
+			writeSpan(sb, ClassTimeWindow, b.timeWindow)
+			sb.WriteByte(')')
+		}
+		sb.WriteByte(':')
+	}
+
+	writeSpan(sb, ClassMetric, b.metric)
+
+	if filters := b.scopedFilters(); len(filters) > 0 || b.scopeMode(buildOptions{}) != ScopeOmit {
+		renderHTMLScope(sb, filters)
+	}
+
+	if groupBy := b.groupByKeys(); len(groupBy) > 0 {
+		sb.WriteString(" by {")
+		for i, key := range groupBy {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeSpan(sb, ClassGroupBy, key)
+		}
+		sb.WriteByte('}')
+	}
+
+	for _, fn := range b.functions {
+		var fsb strings.Builder
+		// Placeholders were resolved successfully by Build
+		_ = appendFunction(&fsb, fn, nil, ", ")
+		writeSpan(sb, ClassFunction, fsb.String())
+	}
+
+	for _, w := range b.wrappers {
+		var wsb strings.Builder
+		impl, _ := wrapperImpl(w)
+		for _, arg := range impl.args {
+			wsb.WriteString(", ")
+			wsb.WriteString(arg)
+		}
+		wsb.WriteByte(')')
+		writeSpan(sb, ClassFunction, wsb.String())
+	}
+}
+
+// wrapperName returns the name of w, a wrapper built by this package.
+func wrapperName(w WrapperBuilder) string {
+	impl, _ := wrapperImpl(w)
+	return impl.name
+}
+
+// wrappersHighlightable reports whether every wrapper was built by this
+// package, so that its name and arguments can be highlighted separately.
+// Queries with other wrappers are highlighted whole.
+func (b *metricQueryBuilder) wrappersHighlightable() bool {
+	for _, w := range b.wrappers {
+		if _, ok := wrapperImpl(w); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// renderHTMLScope writes the highlighted filters, in braces, into sb.
+func renderHTMLScope(sb *strings.Builder, filters []FilterExpression) {
+	sb.WriteByte('{')
+	if len(filters) == 0 {
+		sb.WriteByte('*')
+	}
+	hasExplicitOperators := false
+	for _, filter := range filters {
+		if _, ok := filter.(FilterGroupBuilder); ok {
+			hasExplicitOperators = true
+			break
+		}
+	}
+	if hasExplicitOperators && len(filters) > 1 {
+		sb.WriteByte('(')
+	}
+	for i, filter := range filters {
+		if i > 0 {
+			if hasExplicitOperators {
+				sb.WriteByte(' ')
+				writeSpan(sb, ClassOperator, "AND")
+				sb.WriteByte(' ')
+			} else {
+				sb.WriteString(", ")
+			}
+		}
+		// Filters were rendered successfully by Build
+		s, _ := filter.Build()
+		writeSpan(sb, ClassFilter, s)
+	}
+	if hasExplicitOperators && len(filters) > 1 {
+		sb.WriteByte(')')
+	}
+	sb.WriteByte('}')
+}
+
+// writeSpan writes text, HTML-escaped, inside a span with class.
+func writeSpan(sb *strings.Builder, class, text string) {
+	sb.WriteString(`<span class="`)
+	sb.WriteString(class)
+	sb.WriteString(`">`)
+	sb.WriteString(html.EscapeString(text))
+	sb.WriteString("</span>")
+}
@@ -0,0 +1,115 @@
+package metric_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "all components",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Aggregator("avg").
+					TimeWindow("5m").
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+					Filter(metric.NewFilterBuilder("env").Equal("prod")).
+					GroupBy("host").
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("avg", "60"))
+			},
+			expected: `<code class="ddqb-query">` +
+				`<span class="ddqb-aggregator">avg</span>(<span class="ddqb-time-window">5m</span>):` +
+				`<span class="ddqb-metric">system.cpu.idle</span>` +
+				`{<span class="ddqb-filter">host:web-1</span>, <span class="ddqb-filter">env:prod</span>}` +
+				` by {<span class="ddqb-group-by">host</span>}` +
+				`<span class="ddqb-function">.rollup(avg, 60)</span>` +
+				`</code>`,
+		},
+		{
+			name: "groups use explicit operators and escape quotes",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("requests").
+					Filter(metric.NewFilterBuilder("url").Equal("https://example.com/a b")).
+					Filter(metric.NewFilterGroupBuilder().
+						Or(metric.NewFilterBuilder("env").Equal("prod")).
+						Or(metric.NewFilterBuilder("env").Equal("staging")))
+			},
+			expected: `<code class="ddqb-query">` +
+				`<span class="ddqb-metric">requests</span>` +
+				`{(<span class="ddqb-filter">url:&#34;https://example.com/a b&#34;</span>` +
+				` <span class="ddqb-operator">AND</span> ` +
+				`<span class="ddqb-filter">(env:prod OR env:staging)</span>)}` +
+				`</code>`,
+		},
+		{
+			name: "no filters",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.load.1")
+			},
+			expected: `<code class="ddqb-query"><span class="ddqb-metric">system.load.1</span>{*}</code>`,
+		},
+		{
+			name: "error - missing metric",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := metric.RenderHTML(tt.builder())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLExpression(t *testing.T) {
+	builder, err := metric.ParseQuery("sum:a{*} / sum:b{*}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := metric.RenderHTML(builder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(got, `<code class="ddqb-query"><span class="ddqb-expression">`) {
+		t.Errorf("unexpected expression markup: %s", got)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	got, err := metric.RenderMarkdown(metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("host").Equal("web-1")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "```datadog\navg:system.cpu.idle{host:web-1}\n```\n"
+	if got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+}
@@ -2,8 +2,12 @@
 package metric
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jonwinton/ddqp"
 )
 
 // QueryBuilder provides a fluent interface for building metric queries.
@@ -12,17 +16,52 @@ type QueryBuilder interface {
 	Metric(name string) QueryBuilder
 
 	// Aggregator sets the aggregation method for the query (e.g., "avg", "sum").
+	// On a parsed expression it sets the aggregator of every metric query.
 	Aggregator(agg string) QueryBuilder
 
+	// AggregatorWhere sets the aggregation method of the metric queries
+	// for which match returns true, given each query's index and builder
+	// as returned by SubQueries.
+	AggregatorWhere(agg string, match func(index int, q QueryBuilder) bool) QueryBuilder
+
 	// Filter adds a filter condition or filter group to the query.
 	Filter(filter FilterExpression) QueryBuilder
 
+	// Filters adds each filter condition or filter group to the query, in
+	// order. It is typically combined with Tags.
+	Filters(filters ...FilterExpression) QueryBuilder
+
+	// HasFilter reports whether the query filters on the tag key anywhere,
+	// including inside groups.
+	HasFilter(key string) bool
+
+	// GetFiltersByKey returns every filter on the tag key, including
+	// filters nested in groups.
+	GetFiltersByKey(key string) []FilterBuilder
+
+	// RemoveFilter removes every filter on the tag key, including filters
+	// nested in groups. Groups left empty are removed.
+	RemoveFilter(key string) QueryBuilder
+
+	// ClearFilters removes every filter, and any scope, so that the query
+	// renders {*} while keeping its other components.
+	ClearFilters() QueryBuilder
+
+	// ReplaceFilter replaces the filters on the tag key with filter, or
+	// appends filter if the query has none.
+	ReplaceFilter(key string, filter FilterExpression) QueryBuilder
+
+	// UpsertFilter replaces the filters on filter's key with filter, or
+	// appends it if the query has none.
+	UpsertFilter(filter FilterBuilder) QueryBuilder
+
 	// GetFilters returns all filter expressions in the query.
 	// This allows direct access to modify FilterGroupBuilder instances.
 	GetFilters() []FilterExpression
 
 	// FindGroup finds the first FilterGroupBuilder that matches the predicate function.
-	// Returns nil if no matching group is found.
+	// Returns nil if no matching group is found. On a parsed expression every
+	// metric query is searched, in order.
 	FindGroup(predicate func(FilterGroupBuilder) bool) FilterGroupBuilder
 
 	// AddToGroup adds a filter to the specified FilterGroupBuilder.
@@ -32,14 +71,151 @@ type QueryBuilder interface {
 	// GroupBy sets grouping parameters for the query.
 	GroupBy(groups ...string) QueryBuilder
 
-	// ApplyFunction applies a function to the query.
+	// GroupByAll replaces any grouping with by {*}, grouping by every tag.
+	GroupByAll() QueryBuilder
+
+	// ClearGroupBy removes all grouping, including grouping inherited from
+	// a parsed or cloned query.
+	ClearGroupBy() QueryBuilder
+
+	// RemoveGroupBy removes keys from the grouping, leaving the rest in
+	// order.
+	RemoveGroupBy(keys ...string) QueryBuilder
+
+	// GetGroupBy returns the group by keys the query renders, in order.
+	GetGroupBy() []string
+
+	// Scope attaches a shared ScopeBuilder whose filters are rendered ahead
+	// of the query's own. Changes to the scope apply to the next Build.
+	Scope(scope ScopeBuilder) QueryBuilder
+
+	// EmptyScope sets how the query renders when it has no filters:
+	// as {*} (ScopeWildcard) or without braces (ScopeOmit).
+	EmptyScope(mode ScopeMode) QueryBuilder
+
+	// ApplyFunction applies a function to the query. On a parsed expression
+	// it applies to the expression as a whole.
 	ApplyFunction(fn FunctionBuilder) QueryBuilder
 
+	// ApplyFunctionToQueries applies a function to every metric query. On
+	// a single query it is the same as ApplyFunction.
+	ApplyFunctionToQueries(fn FunctionBuilder) QueryBuilder
+
+	// ApplyChain applies every function in the chain to the query, in order.
+	ApplyChain(chain FunctionChain) QueryBuilder
+
+	// AsCount applies .as_count() ahead of any other functions, replacing
+	// .as_rate() if present.
+	AsCount() QueryBuilder
+
+	// AsRate applies .as_rate() ahead of any other functions, replacing
+	// .as_count() if present.
+	AsRate() QueryBuilder
+
+	// GetCountModifier returns "as_count" or "as_rate" if the query applies
+	// that modifier, whether with AsCount or AsRate or as parsed, and ""
+	// otherwise. An expression reports a modifier only if every metric
+	// query in it applies the same one.
+	GetCountModifier() string
+
+	// SubQueries returns a structured builder for each metric query in a
+	// parsed expression, in order; edits to them apply to the expression.
+	// A single metric query returns itself.
+	SubQueries() []QueryBuilder
+
+	// GetFunctions returns the applied functions, in order. The functions
+	// are shared with the query, so arguments changed with SetArg apply to
+	// the next Build.
+	GetFunctions() []FunctionBuilder
+
+	// RemoveFunction removes every applied function named name, including
+	// functions inherited from a parsed or cloned query.
+	RemoveFunction(name string) QueryBuilder
+
+	// ReplaceFunction replaces the functions named name with fn, or applies
+	// fn if the query has none.
+	ReplaceFunction(name string, fn FunctionBuilder) QueryBuilder
+
 	// TimeWindow sets the time window for the query (e.g., "1m", "5m").
+	// A parsed expression without an agg(window): prefix is given an
+	// avg(window): one.
 	TimeWindow(window string) QueryBuilder
 
+	// GetWrappers returns the wrapping functions, innermost first. The
+	// wrappers are shared with the query, so a MovingRollupBuilder's
+	// window or aggregation changed through it applies to the next Build.
+	GetWrappers() []WrapperBuilder
+
+	// WrapWith wraps the query in a wrapping function such as abs or top.
+	// Wrappers nest in the order they are added.
+	WrapWith(w WrapperBuilder) QueryBuilder
+
+	// EvaluationWindow sets the monitor evaluation window for the query
+	// (e.g., "last_5m", "last_1h"). The "last_" prefix may be omitted.
+	EvaluationWindow(window string) QueryBuilder
+
+	// Last sets the monitor evaluation window for the query from a
+	// duration, e.g. Last(5*time.Minute) renders avg(last_5m):.
+	Last(d time.Duration) QueryBuilder
+
+	// WithConfig sets the validation configuration for this builder,
+	// overriding the package-level default.
+	WithConfig(cfg Config) QueryBuilder
+
 	// Build returns the built query as a string.
 	Build() (string, error)
+
+	// BuildWithParams returns the built query as a string, replacing any
+	// {{name}} placeholders in function arguments with values from params.
+	BuildWithParams(params map[string]string) (string, error)
+
+	// OnFilterAdded registers a hook called whenever a filter is added to
+	// the query, for auditing how a query was assembled.
+	OnFilterAdded(hook FilterHook) QueryBuilder
+
+	// OnFunctionApplied registers a hook called whenever a function is
+	// applied to the query.
+	OnFunctionApplied(hook FunctionHook) QueryBuilder
+
+	// Clone returns a deep copy of the builder that can be modified without
+	// affecting the original.
+	Clone() QueryBuilder
+
+	// Freeze makes the builder immutable so that it can be shared, built
+	// and cloned from many goroutines. Mutators called on a frozen builder
+	// return a copy whose Build fails with ErrFrozenBuilder.
+	Freeze() QueryBuilder
+
+	// BuildWithOptions returns the built query as a string, customized by
+	// opts (e.g. WithSortedFilters, WithParams).
+	BuildWithOptions(opts ...BuildOption) (string, error)
+
+	// BuildContext returns the built query as a string. ctx bounds any
+	// configured Validators that call external services.
+	BuildContext(ctx context.Context) (string, error)
+
+	// Validate reports whether the query builds and passes every configured
+	// validation, without returning the query.
+	Validate() error
+
+	// ValidateContext is like Validate but honors ctx cancellation and
+	// deadlines while running configured Validators.
+	ValidateContext(ctx context.Context) error
+
+	// ToAST returns the structured representation of the query.
+	ToAST() (*QueryAST, error)
+
+	// ToASTJSON returns the structured representation of the query as
+	// JSON, for consumption by tools outside Go.
+	ToASTJSON() ([]byte, error)
+
+	// ToDDQP returns the query as a ddqp AST, for interoperating with code
+	// that works with ddqp directly.
+	ToDDQP() (*ddqp.MetricQuery, error)
+
+	// BuildWithDiagnostics returns the built query as a string together
+	// with non-fatal diagnostics about likely mistakes in the query.
+	BuildWithDiagnostics() (string, []Diagnostic, error)
 }
 
 // metricQueryBuilder is the concrete implementation of the QueryBuilder interface.
@@ -50,6 +226,14 @@ type metricQueryBuilder struct {
 	filters    []FilterExpression
 	groupBy    []string
 	functions  []FunctionBuilder
+	wrappers   []WrapperBuilder
+	emptyScope ScopeMode
+	scope      ScopeBuilder // shared by reference; nil when unset
+	config     *Config      // nil uses the package-level default
+	hooks      hooks
+	source     *querySource // set by PreserveFormatting; shared, never modified
+	frozen     bool
+	err        error // set when derived from a mutation of a frozen builder
 }
 
 // NewMetricQueryBuilder creates a new metric query builder.
@@ -63,33 +247,61 @@ func NewMetricQueryBuilder() QueryBuilder {
 
 // Metric sets the metric name for the query.
 func (b *metricQueryBuilder) Metric(name string) QueryBuilder {
+	b = b.mutable("Metric")
 	b.metric = name
 	return b
 }
 
 // Aggregator sets the aggregation method for the query (e.g., "avg", "sum").
 func (b *metricQueryBuilder) Aggregator(agg string) QueryBuilder {
+	b = b.mutable("Aggregator")
 	b.aggregator = agg
 	return b
 }
 
+// AggregatorWhere sets the aggregation method if match accepts the query
+// as the only metric query, at index 0.
+func (b *metricQueryBuilder) AggregatorWhere(agg string, match func(index int, q QueryBuilder) bool) QueryBuilder {
+	if !match(0, b) {
+		return b
+	}
+	return b.Aggregator(agg)
+}
+
 // Filter adds a filter condition or filter group to the query.
 func (b *metricQueryBuilder) Filter(filter FilterExpression) QueryBuilder {
+	b = b.mutable("Filter")
 	b.filters = append(b.filters, filter)
+	b.hooks.fireFilterAdded(filter)
+	return b
+}
+
+// Filters adds each filter condition or filter group to the query, in order.
+func (b *metricQueryBuilder) Filters(filters ...FilterExpression) QueryBuilder {
+	b = b.mutable("Filters")
+	for _, filter := range filters {
+		b.filters = append(b.filters, filter)
+		b.hooks.fireFilterAdded(filter)
+	}
 	return b
 }
 
 // GetFilters returns all filter expressions in the query.
 // Note: The returned slice shares the same underlying array as the builder's filters.
 // Modifying FilterGroupBuilder instances in this slice will modify the query.
+// A frozen builder returns a copy instead, so modifications have no effect.
 func (b *metricQueryBuilder) GetFilters() []FilterExpression {
+	if b.frozen {
+		return cloneFilters(b.filters)
+	}
 	return b.filters
 }
 
 // FindGroup finds the first FilterGroupBuilder that matches the predicate function.
 // It searches recursively through all filters and nested groups.
+// On a frozen builder the returned group is a copy.
 func (b *metricQueryBuilder) FindGroup(predicate func(FilterGroupBuilder) bool) FilterGroupBuilder {
-	for _, filter := range b.filters {
+	for _, filter := range b.GetFilters() {
 		if group := findGroupRecursive(filter, predicate); group != nil {
 			return group
 		}
@@ -99,9 +311,14 @@ func (b *metricQueryBuilder) FindGroup(predicate func(FilterGroupBuilder) bool)
 
 // AddToGroup adds a filter to the specified FilterGroupBuilder.
 func (b *metricQueryBuilder) AddToGroup(group FilterGroupBuilder, filter FilterExpression) QueryBuilder {
+	if b.frozen {
+		// The group belongs to the caller's copy, not to b; leave it alone.
+		return b.mutable("AddToGroup")
+	}
 	if group == nil {
 		// If group is nil, just add as a new filter
 		b.filters = append(b.filters, filter)
+		b.hooks.fireFilterAdded(filter)
 		return b
 	}
 
@@ -112,6 +329,7 @@ func (b *metricQueryBuilder) AddToGroup(group FilterGroupBuilder, filter FilterE
 		} else {
 			groupImpl.Or(filter)
 		}
+		b.hooks.fireFilterAdded(filter)
 	}
 	return b
 }
@@ -137,97 +355,298 @@ func findGroupRecursive(expr FilterExpression, predicate func(FilterGroupBuilder
 
 // GroupBy sets grouping parameters for the query.
 func (b *metricQueryBuilder) GroupBy(groups ...string) QueryBuilder {
+	b = b.mutable("GroupBy")
 	b.groupBy = append(b.groupBy, groups...)
 	return b
 }
 
+// GroupByAll replaces any grouping with by {*}, grouping by every tag.
+func (b *metricQueryBuilder) GroupByAll() QueryBuilder {
+	b = b.mutable("GroupByAll")
+	b.groupBy = append(b.groupBy[:0:0], "*")
+	return b
+}
+
+// ClearGroupBy removes all grouping, including grouping inherited from a
+// parsed or cloned query.
+func (b *metricQueryBuilder) ClearGroupBy() QueryBuilder {
+	b = b.mutable("ClearGroupBy")
+	b.groupBy = b.groupBy[:0:0]
+	return b
+}
+
+// RemoveGroupBy removes every occurrence of keys from the grouping. A
+// query left without group by keys renders without a by clause.
+func (b *metricQueryBuilder) RemoveGroupBy(keys ...string) QueryBuilder {
+	b = b.mutable("RemoveGroupBy")
+	b.groupBy = removeGroupByKeys(b.groupBy, keys)
+	return b
+}
+
+// GetGroupBy returns the group by keys the query renders, in order and
+// without repeats. The slice is a copy.
+func (b *metricQueryBuilder) GetGroupBy() []string {
+	return slices.Clone(b.groupByKeys())
+}
+
+// removeGroupByKeys returns groupBy without keys, in a new slice so that
+// slices shared with clones are untouched.
+func removeGroupByKeys(groupBy, keys []string) []string {
+	out := make([]string, 0, len(groupBy))
+	for _, key := range groupBy {
+		if !slices.Contains(keys, key) {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
 // ApplyFunction applies a function to the query.
 func (b *metricQueryBuilder) ApplyFunction(fn FunctionBuilder) QueryBuilder {
+	b = b.mutable("ApplyFunction")
 	b.functions = append(b.functions, fn)
+	b.hooks.fireFunctionApplied(fn)
+	return b
+}
+
+// ApplyFunctionToQueries applies a function to the query, as the only
+// metric query it contains.
+func (b *metricQueryBuilder) ApplyFunctionToQueries(fn FunctionBuilder) QueryBuilder {
+	return b.ApplyFunction(fn)
+}
+
+// ApplyChain applies every function in the chain to the query, in order.
+func (b *metricQueryBuilder) ApplyChain(chain FunctionChain) QueryBuilder {
+	b = b.mutable("ApplyChain")
+	if chain == nil {
+		return b
+	}
+	for _, fn := range chain.Functions() {
+		b.ApplyFunction(fn)
+	}
+	return b
+}
+
+// AsCount applies .as_count() as the first function, so that count and
+// rate metrics are reported as raw counts. Any existing .as_count() or
+// .as_rate(), including one parsed from a query, is replaced.
+func (b *metricQueryBuilder) AsCount() QueryBuilder {
+	return b.countModifier("AsCount", "as_count")
+}
+
+// AsRate applies .as_rate() as the first function, so that count and rate
+// metrics are reported per second. Any existing .as_count() or .as_rate(),
+// including one parsed from a query, is replaced.
+func (b *metricQueryBuilder) AsRate() QueryBuilder {
+	return b.countModifier("AsRate", "as_rate")
+}
+
+// countModifier moves the count modifier name to the front of the function
+// chain, where monitors require it.
+func (b *metricQueryBuilder) countModifier(method, name string) QueryBuilder {
+	b = b.mutable(method)
+	fn := NewFunctionBuilder(name)
+	b.functions = slices.DeleteFunc(b.functions, func(f FunctionBuilder) bool {
+		return isCountModifier(functionName(f))
+	})
+	b.functions = slices.Insert(b.functions, 0, fn)
+	b.hooks.fireFunctionApplied(fn)
+	return b
+}
+
+// GetCountModifier returns the count modifier the query applies, if any.
+// Of several, the last applies.
+func (b *metricQueryBuilder) GetCountModifier() string {
+	modifier := ""
+	for _, fn := range b.functions {
+		if name := functionName(fn); isCountModifier(name) {
+			modifier = name
+		}
+	}
+	return modifier
+}
+
+// isCountModifier reports whether name is as_count or as_rate.
+func isCountModifier(name string) bool {
+	return name == "as_count" || name == "as_rate"
+}
+
+// GetFunctions returns the applied functions, in order, including those
+// inherited from a parsed or cloned query. The returned slice is a copy
+// but the functions are shared, so changing their arguments modifies the
+// query. A frozen builder returns copies of the functions instead, so
+// modifications have no effect.
+func (b *metricQueryBuilder) GetFunctions() []FunctionBuilder {
+	if b.frozen {
+		return cloneFunctions(b.functions)
+	}
+	return slices.Clone(b.functions)
+}
+
+// RemoveFunction removes every applied function named name.
+func (b *metricQueryBuilder) RemoveFunction(name string) QueryBuilder {
+	b = b.mutable("RemoveFunction")
+	b.functions = slices.DeleteFunc(b.functions, func(fn FunctionBuilder) bool {
+		return functionName(fn) == name
+	})
+	return b
+}
+
+// ReplaceFunction replaces the first function named name with fn, keeping
+// its position in the chain, and removes any later ones. If no function is
+// named name, fn is applied as ApplyFunction would.
+func (b *metricQueryBuilder) ReplaceFunction(name string, fn FunctionBuilder) QueryBuilder {
+	b = b.mutable("ReplaceFunction")
+	i := slices.IndexFunc(b.functions, func(f FunctionBuilder) bool {
+		return functionName(f) == name
+	})
+	if i < 0 {
+		return b.ApplyFunction(fn)
+	}
+	b.functions[i] = fn
+	tail := slices.DeleteFunc(b.functions[i+1:], func(f FunctionBuilder) bool {
+		return functionName(f) == name
+	})
+	b.functions = b.functions[:i+1+len(tail)]
+	b.hooks.fireFunctionApplied(fn)
 	return b
 }
 
 // TimeWindow sets the time window for the query (e.g., "1m", "5m").
 func (b *metricQueryBuilder) TimeWindow(window string) QueryBuilder {
+	b = b.mutable("TimeWindow")
 	b.timeWindow = window
 	return b
 }
 
+// WithConfig sets the validation configuration for this builder,
+// overriding the package-level default.
+func (b *metricQueryBuilder) WithConfig(cfg Config) QueryBuilder {
+	b = b.mutable("WithConfig")
+	b.config = &cfg
+	return b
+}
+
 // Build returns the built query as a string.
+// Function arguments containing {{name}} placeholders must be resolved with
+// BuildWithParams; Build returns an error if any are present.
 func (b *metricQueryBuilder) Build() (string, error) {
+	return b.BuildWithParams(nil)
+}
+
+// BuildWithParams returns the built query as a string, replacing any
+// {{name}} placeholders in function arguments with values from params.
+// This allows a single builder to act as a template that is rendered
+// with different arguments (e.g. rollup windows) per environment.
+func (b *metricQueryBuilder) BuildWithParams(params map[string]string) (string, error) {
+	return b.buildContext(context.Background(), buildOptions{params: params})
+}
+
+// BuildWithOptions returns the built query as a string, customized by opts.
+func (b *metricQueryBuilder) BuildWithOptions(opts ...BuildOption) (string, error) {
+	return b.buildContext(context.Background(), newBuildOptions(opts))
+}
+
+// BuildContext returns the built query as a string. ctx bounds any
+// configured Validators that call external services.
+func (b *metricQueryBuilder) BuildContext(ctx context.Context) (string, error) {
+	return b.buildContext(ctx, buildOptions{})
+}
+
+// Validate reports whether the query builds and passes every configured
+// validation, without returning the query.
+func (b *metricQueryBuilder) Validate() error {
+	return b.ValidateContext(context.Background())
+}
+
+// ValidateContext is like Validate but honors ctx cancellation and
+// deadlines while running configured Validators.
+func (b *metricQueryBuilder) ValidateContext(ctx context.Context) error {
+	_, err := b.BuildContext(ctx)
+	return err
+}
+
+// buildContext builds the query and records the outcome.
+func (b *metricQueryBuilder) buildContext(ctx context.Context, opts buildOptions) (string, error) {
+	query, err := b.build(ctx, opts)
+	logBuild(b, query, err)
+	return query, err
+}
+
+// build renders the query and runs any configured Validators against it.
+func (b *metricQueryBuilder) build(ctx context.Context, opts buildOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Collect every problem rather than stopping at the first so that a
+	// caller fixing a generated query sees all of them in one pass.
+	var errs []error
+
+	if b.err != nil {
+		errs = append(errs, b.err)
+	}
+
 	if b.metric == "" {
-		return "", fmt.Errorf("metric name is required")
+		errs = append(errs, ErrMissingMetric)
 	}
 
-	// Start building the query
-	var parts []string
+	cfg := DefaultConfig()
+	if b.config != nil {
+		cfg = *b.config
+	}
+	if err := b.validate(cfg); err != nil {
+		errs = append(errs, err)
+	}
 
-	// Add aggregator and time window if provided
-	if b.aggregator != "" {
-		if b.timeWindow != "" {
-			parts = append(parts, fmt.Sprintf("%s(%s):", b.aggregator, b.timeWindow))
-		} else {
-			parts = append(parts, fmt.Sprintf("%s:", b.aggregator))
+	// Validate group by keys
+	groupBy := b.groupByKeys()
+	for _, key := range groupBy {
+		if err := validateGroupByKey(key); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	if err := validateGroupByWildcard(groupBy); err != nil {
+		errs = append(errs, err)
+	}
 
-	// Add metric name
-	parts = append(parts, b.metric)
+	if err := validateTimeWindow(b.timeWindow); err != nil {
+		errs = append(errs, err)
+	}
 
-	// Add filters if provided, or {*} if no filters
-	if len(b.filters) > 0 {
-		// Check if any filter uses explicit operators (FilterGroupBuilder)
-		// If so, we must wrap everything in a group with explicit AND operators
-		// to avoid mixing comma notation with explicit AND/OR (invalid syntax)
-		hasExplicitOperators := false
-		for _, filter := range b.filters {
-			if _, ok := filter.(FilterGroupBuilder); ok {
-				hasExplicitOperators = true
-				break
-			}
-		}
+	filters := b.scopedFilters()
+	if opts.dedup {
+		filters = dedupedFilters(filters)
+	}
+	if opts.sortFilters {
+		filters = sortedFilters(filters)
+	}
 
-		if hasExplicitOperators {
-			// Wrap all filters in a group with explicit AND operators
-			group := NewFilterGroupBuilder()
-			for _, filter := range b.filters {
-				group.And(filter)
-			}
-			groupStr, err := group.Build()
-			if err != nil {
-				return "", fmt.Errorf("error building filter group: %w", err)
-			}
-			parts = append(parts, fmt.Sprintf("{%s}", groupStr))
-		} else {
-			// All filters are simple - use comma notation (implicit AND)
-			var filterStrs []string
-			for _, filter := range b.filters {
-				filterStr, err := filter.Build()
-				if err != nil {
-					return "", fmt.Errorf("error building filter: %w", err)
-				}
-				filterStrs = append(filterStrs, filterStr)
-			}
-			parts = append(parts, fmt.Sprintf("{%s}", strings.Join(filterStrs, ", ")))
-		}
-	} else {
-		// Datadog requires {*} for queries without filters
-		parts = append(parts, "{*}")
+	query, renderErrs := b.render(filters, opts.params, layoutFor(opts.format), opts.filterStyle(), b.scopeMode(opts))
+	errs = append(errs, renderErrs...)
+
+	query, err := wrapQuery(query, b.wrappers, opts.params, layoutFor(opts.format).listSep)
+	if err != nil {
+		errs = append(errs, err)
 	}
 
-	// Add group by if provided
-	if len(b.groupBy) > 0 {
-		parts = append(parts, fmt.Sprintf(" by {%s}", strings.Join(b.groupBy, ", ")))
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
 	}
 
-	// Add functions if provided
-	for _, fn := range b.functions {
-		fnStr, err := fn.Build()
-		if err != nil {
-			return "", fmt.Errorf("error building function: %w", err)
-		}
-		parts = append(parts, fnStr)
+	if b.source != nil && opts.standard() {
+		query = b.source.restore(query)
+	}
+
+	if err := runValidators(ctx, cfg.Validators, query); err != nil {
+		return "", err
+	}
+
+	// Long queries are easier to review spread over several lines
+	if opts.format == FormatPretty && len(query) > prettyWidth {
+		query, _ = b.render(filters, opts.params, multiLineLayout, opts.filterStyle(), b.scopeMode(opts))
+		query, _ = wrapQuery(query, b.wrappers, opts.params, multiLineLayout.listSep)
 	}
 
-	return strings.Join(parts, ""), nil
+	return query, nil
 }
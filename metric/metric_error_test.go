@@ -1,6 +1,7 @@
 package metric_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/jonwinton/ddqb/metric"
@@ -64,3 +65,32 @@ func TestMetricBuilderErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestMetricBuilderReportsAllErrors verifies that Build reports every failing
+// component rather than stopping at the first.
+func TestMetricBuilderReportsAllErrors(t *testing.T) {
+	group := metric.NewFilterGroupBuilder().
+		Or(metric.NewFilterBuilder("").Equal("a")).
+		Or(metric.NewFilterBuilder("host").In())
+
+	_, err := metric.NewMetricQueryBuilder().
+		Filter(group).
+		GroupBy("host:web-1").
+		ApplyFunction(metric.NewFunctionBuilder("")).
+		Build()
+	if err == nil {
+		t.Fatal("Expected error but got nil")
+	}
+
+	for _, want := range []string{
+		"metric name is required",
+		"filter key is required",
+		"in filter requires at least one value",
+		"invalid group by key",
+		"function name is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Build() error = %q, want it to mention %q", err, want)
+		}
+	}
+}
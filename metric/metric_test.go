@@ -58,6 +58,28 @@ func TestQueryBuilder(t *testing.T) {
 			expected: "system.cpu.idle{host:web-1}",
 			wantErr:  false,
 		},
+		{
+			name: "metric query with tags from map",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filters(metric.Tags(map[string]string{"service": "api", "env": "prod", "team": "core"})...).
+					Build()
+			},
+			expected: "system.cpu.idle{env:prod, service:api, team:core}",
+			wantErr:  false,
+		},
+		{
+			name: "metric query with empty tags map",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filters(metric.Tags(nil)...).
+					Build()
+			},
+			expected: "system.cpu.idle{*}",
+			wantErr:  false,
+		},
 		{
 			name: "metric query with multiple filters",
 			build: func() (string, error) {
@@ -86,10 +108,10 @@ func TestQueryBuilder(t *testing.T) {
 			build: func() (string, error) {
 				return metric.NewMetricQueryBuilder().
 					Metric("system.cpu.idle").
-					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("0")).
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
 					Build()
 			},
-			expected: "system.cpu.idle{*}.fill(0)",
+			expected: "system.cpu.idle{*}.fill(zero)",
 			wantErr:  false,
 		},
 		{
@@ -102,11 +124,11 @@ func TestQueryBuilder(t *testing.T) {
 					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
 					Filter(metric.NewFilterBuilder("env").Equal("prod")).
 					GroupBy("host").
-					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("0")).
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
 					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArg("60")).
 					Build()
 			},
-			expected: "avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(0).rollup(60)",
+			expected: "avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(zero).rollup(60)",
 			wantErr:  false,
 		},
 		{
@@ -145,13 +167,13 @@ func TestTopLevelAPI(t *testing.T) {
 		Metric("system.cpu.idle").
 		Filter(ddqb.Filter("host").Equal("web-1")).
 		GroupBy("host").
-		ApplyFunction(ddqb.Function("fill").WithArg("0")).
+		ApplyFunction(ddqb.Function("fill").WithArg("zero")).
 		Build()
 	if err != nil {
 		t.Errorf("Build() returned an error: %v", err)
 	}
 
-	expected := "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(0)"
+	expected := "avg(5m):system.cpu.idle{host:web-1} by {host}.fill(zero)"
 	if query != expected {
 		t.Errorf("Build() = %q, want %q", query, expected)
 	}
@@ -0,0 +1,211 @@
+package metric
+
+import (
+	"sort"
+	"strings"
+)
+
+// BuildOption customizes a single call to BuildWithOptions.
+type BuildOption func(*buildOptions)
+
+// OutputFormat selects the whitespace used when rendering a query.
+type OutputFormat int
+
+const (
+	// FormatStandard renders a single line with a space after each comma,
+	// e.g. avg:m{host:web-1, env:prod} by {host, env}.
+	FormatStandard OutputFormat = iota
+	// FormatMinified drops every optional space, e.g.
+	// avg:m{host:web-1,env:prod} by {host,env}, for embedding in URLs. It
+	// is the canonical form the Datadog UI and dashboard exports use, so
+	// minified queries can be compared with exported ones as strings.
+	// Metric expressions drop the spaces after their commas.
+	FormatMinified
+	// FormatPretty renders like FormatStandard, but spreads queries longer
+	// than 80 characters over several lines, one filter or function per
+	// line, for human review.
+	FormatPretty
+)
+
+// buildOptions collects the settings applied by BuildOptions.
+type buildOptions struct {
+	params      map[string]string
+	sortFilters bool
+	dedup       bool
+	listQuoting ListQuoting
+	negation    NegationStyle
+	format      OutputFormat
+	emptyScope  ScopeMode
+	// divisionGuard applies to metric expressions only
+	divisionGuard DivisionGuard
+}
+
+// ListQuoting selects how the values of IN and NOT IN filters are quoted.
+type ListQuoting int
+
+const (
+	// QuoteAsNeeded quotes only values that cannot be written bare, e.g.
+	// host IN (web-1,"web 2").
+	QuoteAsNeeded ListQuoting = iota
+	// QuoteAlways quotes every value, e.g. host IN ("web-1","web 2"), for
+	// consumers that expect uniformly quoted lists.
+	QuoteAlways
+)
+
+// NegationStyle selects how negated filters (NotEqual, NotRegex and
+// NotExists) are rendered. Negated groups always render as NOT (...).
+type NegationStyle int
+
+const (
+	// NegationBang renders every negated filter with a leading !, e.g.
+	// !host:web-1. It is the default.
+	NegationBang NegationStyle = iota
+	// NegationKeyword renders every negated filter with the NOT keyword,
+	// e.g. NOT host:web-1. Because NOT cannot be mixed with comma
+	// notation, the top-level filters are then joined with explicit ANDs.
+	NegationKeyword
+	// NegationContextual renders negated filters with ! in comma-separated
+	// filter lists and with NOT inside explicit AND/OR expressions.
+	NegationContextual
+)
+
+// newBuildOptions applies opts to a zero buildOptions.
+func newBuildOptions(opts []BuildOption) buildOptions {
+	var o buildOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithParams resolves {{name}} placeholders in function arguments from
+// params, as BuildWithParams does.
+func WithParams(params map[string]string) BuildOption {
+	return func(o *buildOptions) {
+		o.params = params
+	}
+}
+
+// WithFormat renders the query using format.
+func WithFormat(format OutputFormat) BuildOption {
+	return func(o *buildOptions) {
+		o.format = format
+	}
+}
+
+// WithEmptyScope sets how queries without filters render their scope,
+// unless the builder chose a mode with EmptyScope.
+func WithEmptyScope(mode ScopeMode) BuildOption {
+	return func(o *buildOptions) {
+		o.emptyScope = mode
+	}
+}
+
+// WithListQuoting selects how the values of IN and NOT IN filters are
+// quoted. The default is QuoteAsNeeded.
+func WithListQuoting(quoting ListQuoting) BuildOption {
+	return func(o *buildOptions) {
+		o.listQuoting = quoting
+	}
+}
+
+// WithNegationStyle selects how negated filters are rendered. The default
+// is NegationBang.
+func WithNegationStyle(style NegationStyle) BuildOption {
+	return func(o *buildOptions) {
+		o.negation = style
+	}
+}
+
+// filterStyle returns the filter rendering selected by o.
+func (o buildOptions) filterStyle() filterStyle {
+	return filterStyle{listQuoting: o.listQuoting, negation: o.negation}
+}
+
+// WithSortedFilters renders filters in a deterministic order, sorted by tag
+// key and then by their rendered form, regardless of the order in which
+// they were added. Filters inside groups are sorted the same way. Use it
+// when filters are added from maps or concurrent sources so that generated
+// artifacts (Terraform, JSON dashboards) do not churn between runs.
+// The builder itself is not reordered.
+func WithSortedFilters() BuildOption {
+	return func(o *buildOptions) {
+		o.sortFilters = true
+	}
+}
+
+// WithDedupedFilters drops every filter that renders identically to one
+// added before it, at the top level and within each group, so that a query
+// assembled from several sources that each add env:prod renders env:prod
+// once. The first occurrence keeps its position. The builder itself is not
+// modified.
+func WithDedupedFilters() BuildOption {
+	return func(o *buildOptions) {
+		o.dedup = true
+	}
+}
+
+// dedupedFilters returns a copy of filters without repeated expressions.
+// Groups are copied with their own repeats removed; the originals are
+// untouched. Groups with ordered operators keep their expressions, since
+// removing one would change how the rest combine.
+func dedupedFilters(filters []FilterExpression) []FilterExpression {
+	seen := make(map[string]bool, len(filters))
+	out := make([]FilterExpression, 0, len(filters))
+	for _, f := range filters {
+		if g, ok := f.(*filterGroupBuilder); ok && g.ops == nil {
+			c := *g
+			c.expressions = dedupedFilters(g.expressions)
+			f = &c
+		}
+		rendered, err := f.Build()
+		if err == nil && seen[rendered] {
+			continue
+		}
+		seen[rendered] = true
+		out = append(out, f)
+	}
+	return out
+}
+
+// sortedFilters returns a copy of filters in deterministic order. Groups
+// are copied with their expressions sorted, except groups with ordered
+// operators; the originals are untouched.
+func sortedFilters(filters []FilterExpression) []FilterExpression {
+	type keyed struct {
+		expr     FilterExpression
+		key      string
+		rendered string
+	}
+
+	items := make([]keyed, len(filters))
+	for i, f := range filters {
+		if g, ok := f.(*filterGroupBuilder); ok && g.ops == nil {
+			c := *g
+			c.expressions = sortedFilters(g.expressions)
+			f = &c
+		}
+		// Build errors are reported when the query itself is rendered
+		rendered, _ := f.Build()
+		key := rendered
+		if fb, ok := f.(*filterBuilder); ok {
+			key = fb.key
+		}
+		items[i] = keyed{expr: f, key: key, rendered: rendered}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].key != items[j].key {
+			return items[i].key < items[j].key
+		}
+		return strings.Compare(items[i].rendered, items[j].rendered) < 0
+	})
+
+	out := make([]FilterExpression, len(items))
+	for i, item := range items {
+		out[i] = item.expr
+	}
+	return out
+}
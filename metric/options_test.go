@@ -0,0 +1,233 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestWithSortedFilters(t *testing.T) {
+	tags := map[string]string{"service": "web", "env": "prod", "host": "web-1", "region": "us-east-1"}
+	expected := "avg:system.cpu.idle{env:prod, host:web-1, region:us-east-1, service:web}"
+
+	// Map iteration order varies between runs; the output must not
+	for i := 0; i < 20; i++ {
+		builder := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.idle")
+		for k, v := range tags {
+			builder.Filter(metric.NewFilterBuilder(k).Equal(v))
+		}
+		got, err := builder.BuildWithOptions(metric.WithSortedFilters())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != expected {
+			t.Fatalf("got %q, want %q", got, expected)
+		}
+	}
+}
+
+func TestWithSortedFiltersGroupsAndTies(t *testing.T) {
+	builder := metric.NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterGroupBuilder().
+			Or(metric.NewFilterBuilder("zone").Equal("b")).
+			Or(metric.NewFilterBuilder("zone").Equal("a"))).
+		Filter(metric.NewFilterBuilder("host").Equal("web-2")).
+		Filter(metric.NewFilterBuilder("host").Equal("web-1"))
+
+	got, err := builder.BuildWithOptions(metric.WithSortedFilters())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "system.cpu.idle{((zone:a OR zone:b) AND host:web-1 AND host:web-2)}"
+	if got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	// The builder itself keeps insertion order
+	got, err = builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "system.cpu.idle{((zone:b OR zone:a) AND host:web-2 AND host:web-1)}"
+	if got != expected {
+		t.Errorf("Build reordered filters: got %q, want %q", got, expected)
+	}
+}
+
+func TestWithDedupedFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		opts     []metric.BuildOption
+		expected string
+	}{
+		{
+			name: "repeated filters render once",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("env").Equal("prod")).
+					Filter(metric.NewFilterBuilder("host").Equal("web-1")).
+					Filter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			opts:     []metric.BuildOption{metric.WithDedupedFilters()},
+			expected: "system.cpu.idle{env:prod, host:web-1}",
+		},
+		{
+			name: "repeats inside groups and repeated groups",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.Any(metric.NewFilterBuilder("zone").Equal("a"), metric.NewFilterBuilder("zone").Equal("b"), metric.NewFilterBuilder("zone").Equal("a"))).
+					Filter(metric.Any(metric.NewFilterBuilder("zone").Equal("a"), metric.NewFilterBuilder("zone").Equal("b")))
+			},
+			opts:     []metric.BuildOption{metric.WithDedupedFilters()},
+			expected: "system.cpu.idle{(zone:a OR zone:b)}",
+		},
+		{
+			name: "scope and own filters",
+			builder: func() metric.QueryBuilder {
+				scope := metric.NewScopeBuilder().Filters(metric.Tags(map[string]string{"env": "prod"})...)
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Scope(scope).
+					Filter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			opts:     []metric.BuildOption{metric.WithDedupedFilters()},
+			expected: "system.cpu.idle{env:prod}",
+		},
+		{
+			name: "combined with sorting",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("service").Equal("web")).
+					Filter(metric.NewFilterBuilder("env").Equal("prod")).
+					Filter(metric.NewFilterBuilder("service").Equal("web"))
+			},
+			opts:     []metric.BuildOption{metric.WithDedupedFilters(), metric.WithSortedFilters()},
+			expected: "system.cpu.idle{env:prod, service:web}",
+		},
+		{
+			name: "not deduplicated by default",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("env").Equal("prod")).
+					Filter(metric.NewFilterBuilder("env").Equal("prod"))
+			},
+			expected: "system.cpu.idle{env:prod, env:prod}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().BuildWithOptions(tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWithNegationStyle(t *testing.T) {
+	flat := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Metric("system.cpu.idle").
+			Filter(metric.NewFilterBuilder("env").Equal("prod")).
+			Filter(metric.NewFilterBuilder("host").NotEqual("web-1"))
+	}
+	grouped := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Metric("system.cpu.idle").
+			Filter(metric.NewFilterBuilder("env").NotEqual("staging")).
+			Filter(metric.Any(metric.NewFilterBuilder("team").NotExists(), metric.NewFilterBuilder("service").NotRegex("web-.*")))
+	}
+
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		opts     []metric.BuildOption
+		expected string
+	}{
+		{
+			name:     "bang by default",
+			builder:  grouped,
+			expected: "system.cpu.idle{(!env:staging AND (!team:* OR !service:~web-.*))}",
+		},
+		{
+			name:     "keyword in a comma list switches to explicit AND",
+			builder:  flat,
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationKeyword)},
+			expected: "system.cpu.idle{(env:prod AND NOT host:web-1)}",
+		},
+		{
+			name: "keyword for a lone filter",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").NotEqual("web-1"))
+			},
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationKeyword)},
+			expected: "system.cpu.idle{NOT host:web-1}",
+		},
+		{
+			name:     "keyword inside groups",
+			builder:  grouped,
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationKeyword)},
+			expected: "system.cpu.idle{(NOT env:staging AND (NOT team:* OR NOT service:~web-.*))}",
+		},
+		{
+			name:     "contextual keeps bang in comma lists",
+			builder:  flat,
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationContextual)},
+			expected: "system.cpu.idle{env:prod, !host:web-1}",
+		},
+		{
+			name:     "contextual uses keyword in boolean expressions",
+			builder:  grouped,
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationContextual)},
+			expected: "system.cpu.idle{(NOT env:staging AND (NOT team:* OR NOT service:~web-.*))}",
+		},
+		{
+			name: "NOT IN is unaffected",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					Filter(metric.NewFilterBuilder("host").NotIn("web-1", "web-2"))
+			},
+			opts:     []metric.BuildOption{metric.WithNegationStyle(metric.NegationKeyword)},
+			expected: "system.cpu.idle{host NOT IN (web-1,web-2)}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().BuildWithOptions(tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWithParams(t *testing.T) {
+	got, err := metric.NewMetricQueryBuilder().
+		Metric("system.cpu.idle").
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("avg", "{{window}}")).
+		BuildWithOptions(metric.WithParams(map[string]string{"window": "60"}), metric.WithSortedFilters())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "system.cpu.idle{env:prod}.rollup(avg, 60)" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
@@ -1,78 +1,327 @@
 package metric
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jonwinton/ddqp"
 )
 
 // ParseQuery parses a Datadog query string and returns a QueryBuilder
 // that can be modified using the fluent API.
-func ParseQuery(queryString string) (QueryBuilder, error) {
+func ParseQuery(queryString string, opts ...ParseOption) (QueryBuilder, error) {
+	builder, err := parseQuery(queryString, newParseOptions(opts))
+	logParse(queryString, builder, err)
+	return builder, err
+}
+
+// ParseQueryStrict parses a query like ParseQuery, but rejects queries the
+// builders cannot fully represent instead of falling back to editing them
+// as text. The error wraps ErrUnrepresentable when the query parses but an
+// expression contains a metric query the structured builder cannot
+// represent, or when rebuilding the query would change its meaning. Every
+// edit made to a builder it returns applies to the query.
+func ParseQueryStrict(queryString string, opts ...ParseOption) (QueryBuilder, error) {
+	builder, err := parseQuery(queryString, newParseOptions(opts))
+	if err == nil {
+		err = checkRepresentable(queryString, builder)
+	}
+	if err != nil {
+		builder = nil
+	}
+	logParse(queryString, builder, err)
+	return builder, err
+}
+
+// ParseQueryLenient parses a query like ParseQuery, but accepts queries
+// using syntax the parser does not know, such as a monitor threshold or a
+// function added to Datadog after this package. Such queries build
+// unchanged; edits to them fail to build. Only a blank query is rejected.
+func ParseQueryLenient(queryString string, opts ...ParseOption) (QueryBuilder, error) {
+	builder, err := parseQuery(queryString, newParseOptions(opts))
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && strings.TrimSpace(queryString) != "" {
+		builder, err = newExpressionPassthroughBuilder(queryString), nil
+	}
+	logParse(queryString, builder, err)
+	return builder, err
+}
+
+// checkRepresentable reports whether builder, parsed from query, fully
+// represents it, as ParseQueryStrict requires.
+func checkRepresentable(query string, builder QueryBuilder) error {
+	unrepresentable := func(reason string) error {
+		return &ParseError{Query: query, Err: fmt.Errorf("%w: %s", ErrUnrepresentable, reason)}
+	}
+
+	switch b := builder.(type) {
+	case *expressionQueryBuilder:
+		if b.queries == nil {
+			return unrepresentable("a metric query uses syntax the builder cannot represent")
+		}
+		parsed, err := parseGeneric(b.original)
+		if err != nil {
+			return newParseError(b.original, b.original, err)
+		}
+		var originals []string
+		walkSubQueries(parsed, func(node *ddqp.MetricQuery) {
+			originals = append(originals, node.String())
+		})
+		for i, original := range originals {
+			drift, err := roundTripDrift(original, rendered(b.queries[i], b.queryBases[i]))
+			if err != nil {
+				return err
+			}
+			if len(drift) > 0 {
+				return unrepresentable(fmt.Sprintf("sub-query %d: %s", i, strings.Join(drift, "; ")))
+			}
+		}
+	default:
+		rebuilt, err := builder.Build()
+		if err != nil {
+			return &ParseError{Query: query, Err: err}
+		}
+		drift, err := roundTripDrift(query, rendered(builder, rebuilt))
+		if err != nil {
+			return err
+		}
+		if len(drift) > 0 {
+			return unrepresentable(strings.Join(drift, "; "))
+		}
+	}
+	return nil
+}
+
+// rendered returns built, the result of building q, as the builder
+// renders it rather than as it was written, for queries parsed with
+// PreserveFormatting.
+func rendered(q QueryBuilder, built string) string {
+	if mb, ok := q.(*metricQueryBuilder); ok && mb.source != nil && built == mb.source.text {
+		return mb.source.rendered
+	}
+	return built
+}
+
+// parseQuery implements ParseQuery.
+func parseQuery(queryString string, opts parseOptions) (QueryBuilder, error) {
 	// Extract time window if present (DDQP doesn't parse avg(5m): format)
 	timeWindow, cleanedQuery := extractAndRemoveTimeWindow(queryString)
 
-	// Use the GenericParser so we can accept metric expressions and queries
-	parser := ddqp.NewGenericParser()
-	parsed, err := parser.Parse(cleanedQuery)
+	// Use the generic grammar so we can accept metric expressions and queries
+	parsed, err := parseGeneric(cleanedQuery)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse query: %w", err)
+		if b := parseWindowedExpression(queryString, opts); b != nil {
+			return b, nil
+		}
+		return nil, newParseError(queryString, cleanedQuery, err)
 	}
 
-	// If we got a plain MetricQuery without wrapper aggregator, use the structured builder
-	if parsed.MetricQuery != nil && parsed.MetricQuery.AggregatorFuction == nil {
-		mq := parsed.MetricQuery
+	// If we got a plain MetricQuery, possibly inside wrappers the builder can
+	// represent, use the structured builder
+	mq, wrappers, err := unwrapMetricQuery(parsed.MetricQuery, timeWindow)
+	if err != nil {
+		return nil, &ParseError{Query: queryString, Err: err}
+	}
+	if mq != nil && mq.AggregatorFuction == nil {
 		if mq.Query == nil {
-			return nil, fmt.Errorf("query is missing required Query component")
+			return nil, &ParseError{Query: queryString, Err: fmt.Errorf("query is missing required Query component")}
 		}
 
-		builder := NewMetricQueryBuilder()
+		builder, err := fromQuery(mq.Query, timeWindow)
+		if err != nil {
+			return nil, &ParseError{Query: queryString, Err: err}
+		}
+		for _, w := range wrappers {
+			builder = builder.WrapWith(w)
+		}
+		if opts.preserveFormatting {
+			preserveSource(builder, queryString)
+		}
+		return builder, nil
+	}
 
-		// Set aggregator if present
-		if mq.Query.Aggregator != nil {
-			builder = builder.Aggregator(mq.Query.Aggregator.Name)
-			// Set time window if we extracted one
-			if timeWindow != "" {
-				builder = builder.TimeWindow(timeWindow)
-			}
+	if b := parseWindowedExpression(queryString, opts); b != nil {
+		return b, nil
+	}
+
+	// Otherwise, it's a MetricExpression or a wrapped MetricQuery. Return an expression builder
+	// that preserves the original query string and exposes its metric queries as structured
+	// builders.
+	preserve := opts.preserveFormatting && cleanedQuery == queryString
+	return newExpressionBuilder(queryString, parsed, preserve), nil
+}
+
+// parseWindowedExpression parses an expression with an agg(window): time
+// window prefix, which applies to the whole expression; its first metric
+// query may have an aggregator of its own: avg(5m):sum:a{*} / sum:b{*}.
+// The prefix is kept apart from the expression so that the window can be
+// edited. It returns nil if query has no prefix or the rest of it does not
+// parse.
+func parseWindowedExpression(query string, opts parseOptions) *expressionQueryBuilder {
+	w := splitWindowedExpression(query)
+	if w == nil {
+		return nil
+	}
+	b := newExpressionBuilder(w.expression, w.parsed, opts.preserveFormatting).(*expressionQueryBuilder)
+	b.timeAggregator, b.timeWindow = w.aggregator, w.window
+	return b
+}
+
+// windowedExpression is an expression with an agg(window): time window
+// prefix, split as parseWindowedExpression reads it.
+type windowedExpression struct {
+	aggregator string
+	window     string
+	expression string
+	parsed     *ddqp.GenericQuery
+}
+
+// splitWindowedExpression splits the agg(window): prefix off query and
+// parses the rest. It returns nil if query has no prefix or the rest of it
+// does not parse. CheckRoundTrip and Anonymize use it to read the queries
+// ParseQuery reads with parseWindowedExpression.
+func splitWindowedExpression(query string) *windowedExpression {
+	m := timeWindowPattern.FindStringSubmatch(query)
+	if m == nil {
+		return nil
+	}
+	parsed, err := parseGeneric(m[3])
+	if err != nil {
+		return nil
+	}
+	return &windowedExpression{aggregator: m[1], window: m[2], expression: m[3], parsed: parsed}
+}
+
+// structuredWrappers lists the wrapping functions ParseQuery rebuilds as
+// WrapperBuilders on a structured builder. Queries inside other wrappers
+// are kept verbatim in an expression builder.
+var structuredWrappers = map[string]bool{
+	"per_second": true,
+	"per_minute": true,
+	"per_hour":   true,
+	// moving_rollup(query, seconds) or moving_rollup(query, seconds, 'agg')
+	"moving_rollup": true,
+}
+
+// unwrapMetricQuery peels the structured wrappers off mq, returning the
+// query inside them and the wrappers, innermost first. Wrapped queries with
+// a time window are returned unchanged, since the window belongs to the
+// whole query rather than the wrapped one.
+func unwrapMetricQuery(mq *ddqp.MetricQuery, timeWindow string) (*ddqp.MetricQuery, []WrapperBuilder, error) {
+	if mq == nil || (mq.AggregatorFuction != nil && timeWindow != "") {
+		return mq, nil, nil
+	}
+	var wrappers []WrapperBuilder
+	for mq.AggregatorFuction != nil && structuredWrappers[mq.AggregatorFuction.Name] && mq.AggregatorFuction.Body != nil {
+		fn := mq.AggregatorFuction
+		w, err := parseWrapper(fn)
+		if err != nil {
+			return nil, nil, err
 		}
+		wrappers = append(wrappers, w)
+		mq = fn.Body
+	}
+	slices.Reverse(wrappers)
+	return mq, wrappers, nil
+}
 
-		// Set metric name
-		builder = builder.Metric(mq.Query.MetricName)
+// parseWrapper rebuilds a structured wrapper with the constructor the
+// builder API uses, so that a parsed moving_rollup can be edited through
+// MovingRollupBuilder and its arguments are validated the same way.
+func parseWrapper(fn *ddqp.AggregatorFuction) (WrapperBuilder, error) {
+	args := make([]string, len(fn.Args))
+	for i, arg := range fn.Args {
+		args[i] = arg.String()
+	}
+
+	var w WrapperBuilder
+	switch fn.Name {
+	case "per_second":
+		w = PerSecond()
+	case "per_minute":
+		w = PerMinute()
+	case "per_hour":
+		w = PerHour()
+	case "moving_rollup":
+		if len(args) == 0 || len(args) > 2 {
+			return nil, &ValidationError{Component: fn.Name, Value: strings.Join(args, ", "), Reason: "takes a window and an optional aggregation"}
+		}
+		seconds, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, &ValidationError{Component: fn.Name, Value: args[0], Reason: "window must be a whole number of seconds"}
+		}
+		var aggregation RollupAggregation
+		if len(args) == 2 {
+			aggregation = RollupAggregation(strings.Trim(args[1], `'"`))
+		}
+		m := MovingRollup(time.Duration(seconds)*time.Second, aggregation)
+		if err := m.(*movingRollupBuilder).err; err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported wrapper %q", fn.Name)
+	}
+	if len(args) > 0 {
+		return nil, &ValidationError{Component: fn.Name, Value: strings.Join(args, ", "), Reason: "takes no arguments"}
+	}
+	return w, nil
+}
 
-		// Convert filters
-		if mq.Query.Filters != nil {
-			filters, err := convertFilters(mq.Query.Filters)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert filters: %w", err)
-			}
-			for _, filter := range filters {
-				builder = builder.Filter(filter)
-			}
+// fromQuery converts a parsed ddqp query into a builder. timeWindow, which
+// the ddqp grammar cannot represent, is applied when q has an aggregator.
+func fromQuery(q *ddqp.Query, timeWindow string) (QueryBuilder, error) {
+	builder := NewMetricQueryBuilder()
+
+	// Set aggregator if present
+	if q.Aggregator != nil {
+		builder = builder.Aggregator(q.Aggregator.Name)
+		// Set time window if we extracted one
+		if timeWindow != "" {
+			builder = builder.TimeWindow(timeWindow)
 		}
+	}
 
-		// Set grouping
-		if len(mq.Query.Grouping) > 0 {
-			builder = builder.GroupBy(mq.Query.Grouping...)
+	// Set metric name
+	builder = builder.Metric(q.MetricName)
+
+	// Convert filters
+	if q.Filters != nil {
+		filters, err := convertFilters(q.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert filters: %w", err)
 		}
+		for _, filter := range filters {
+			builder = builder.Filter(filter)
+		}
+	}
+
+	// Set grouping
+	if len(q.Grouping) > 0 {
+		builder = builder.GroupBy(q.Grouping...)
+	}
 
-		// Convert functions
-		for _, fn := range mq.Query.Function {
-			functionBuilder := NewFunctionBuilder(fn.Name)
-			for _, arg := range fn.Args {
-				functionBuilder = functionBuilder.WithArg(arg.String())
+	// Convert functions
+	for _, fn := range q.Function {
+		functionBuilder := NewFunctionBuilder(fn.Name)
+		for _, arg := range fn.Args {
+			value := arg.String()
+			// exclude_null takes a bare tag key, but is often written
+			// with a quoted one
+			if fn.Name == "exclude_null" {
+				value = unquoteValue(value)
 			}
-			builder = builder.ApplyFunction(functionBuilder)
+			functionBuilder = functionBuilder.WithArg(value)
 		}
-
-		return builder, nil
+		builder = builder.ApplyFunction(functionBuilder)
 	}
 
-	// Otherwise, it's a MetricExpression or a wrapped MetricQuery. Return a passthrough builder
-	// that preserves the original query string (including any time window prefix we detected).
-	return newExpressionPassthroughBuilder(queryString), nil
+	return builder, nil
 }
 
 // convertFilters converts DDQP filter structures to DDQB FilterExpression instances
@@ -80,61 +329,47 @@ func convertFilters(mf *ddqp.MetricFilter) ([]FilterExpression, error) {
 	var expressions []FilterExpression
 	var currentGroup *filterGroupBuilder
 	var groupOperator GroupOperator
-
-	// Process left parameter if present
-	if mf.Left != nil {
-		expr, err := convertParam(mf.Left)
-		if err != nil {
-			return nil, err
-		}
-		if expr != nil {
-			expressions = append(expressions, expr)
+	var negateNext bool
+	// Commas are implicit ANDs; when the filter also uses explicit AND or
+	// OR they join the same boolean expression rather than separating it
+	commas := joinsExplicitly(mf.Parameters)
+	mixed := mixesOperators(mf.Parameters, commas)
+
+	// Process the left parameter first; it is a separator when the filter
+	// starts with NOT
+	params := append([]*ddqp.Param{mf.Left}, mf.Parameters...)
+
+	// Process parameters, tracking separators to build groups
+	for _, param := range params {
+		if param == nil {
+			continue
 		}
-	}
-
-	// Process additional parameters, tracking separators to build groups
-	for _, param := range mf.Parameters {
 		// Check if this is a separator
 		if param.Separator != nil {
+			op, explicit, negate := separatorOperator(param.Separator)
+			negateNext = negateNext || negate
 			// Only create groups for explicit AND/OR operators, not for commas
 			// Commas represent implicit AND and should remain as separate expressions
-			if param.Separator.And {
-				// Start or continue an AND group
-				if currentGroup == nil {
-					// Start a new group
-					currentGroup = &filterGroupBuilder{
-						expressions: make([]FilterExpression, 0),
-						operator:    AndOperator,
-						negated:     false,
-					}
-					// Move the last expression into the group if there is one
-					if len(expressions) > 0 {
-						currentGroup.expressions = append(currentGroup.expressions, expressions[len(expressions)-1])
-						expressions = expressions[:len(expressions)-1]
-					}
+			if !explicit && !(commas && param.Separator.Comma) {
+				continue
+			}
+			if currentGroup == nil {
+				// Start a new group
+				currentGroup = &filterGroupBuilder{
+					expressions: make([]FilterExpression, 0),
+					operator:    op,
+					negated:     false,
+				}
+				// Move the last expression into the group if there is one
+				if len(expressions) > 0 {
+					currentGroup.expressions = append(currentGroup.expressions, expressions[len(expressions)-1])
+					expressions = expressions[:len(expressions)-1]
 				}
-				groupOperator = AndOperator
-				currentGroup.operator = AndOperator
-			} else if param.Separator.Or {
-				// Start or continue an OR group
-				if currentGroup == nil {
-					// Start a new group
-					currentGroup = &filterGroupBuilder{
-						expressions: make([]FilterExpression, 0),
-						operator:    OrOperator,
-						negated:     false,
-					}
-					// Move the last expression into the group if there is one
-					if len(expressions) > 0 {
-						currentGroup.expressions = append(currentGroup.expressions, expressions[len(expressions)-1])
-						expressions = expressions[:len(expressions)-1]
-					}
+				if mixed {
+					currentGroup.MixedOperators(MixedOperatorsOrdered)
 				}
-				groupOperator = OrOperator
-				currentGroup.operator = OrOperator
 			}
-			// For commas, we don't create groups - they remain as separate expressions
-			// which will be joined with commas (implicit AND) in the Build() method
+			groupOperator = op
 			continue
 		}
 
@@ -146,6 +381,10 @@ func convertFilters(mf *ddqp.MetricFilter) ([]FilterExpression, error) {
 		if expr == nil {
 			continue
 		}
+		if negateNext {
+			expr = negateFilter(expr)
+			negateNext = false
+		}
 
 		// Add to current group or as standalone expression
 		if currentGroup != nil {
@@ -169,6 +408,80 @@ func convertFilters(mf *ddqp.MetricFilter) ([]FilterExpression, error) {
 	return expressions, nil
 }
 
+// separatorOperator returns the operator a filter separator joins with,
+// whether it is an explicit AND or OR rather than a comma or a bare NOT,
+// and whether it negates the expression that follows.
+func separatorOperator(sep *ddqp.FilterValueSeparator) (op GroupOperator, explicit, negate bool) {
+	switch {
+	case sep.And:
+		return AndOperator, true, false
+	case sep.AndNot:
+		return AndOperator, true, true
+	case sep.Or:
+		return OrOperator, true, false
+	case sep.OrNot:
+		return OrOperator, true, true
+	case sep.Not:
+		return AndOperator, false, true
+	default:
+		return AndOperator, false, false
+	}
+}
+
+// joinsExplicitly reports whether any of params is an explicit AND or OR.
+func joinsExplicitly(params []*ddqp.Param) bool {
+	return slices.ContainsFunc(params, func(p *ddqp.Param) bool {
+		if p.Separator == nil {
+			return false
+		}
+		_, explicit, _ := separatorOperator(p.Separator)
+		return explicit
+	})
+}
+
+// negateFilter returns expr negated, as written after NOT. Groups are
+// negated in place; other expressions are wrapped in a negated group.
+func negateFilter(expr FilterExpression) FilterExpression {
+	group, ok := expr.(*filterGroupBuilder)
+	if !ok {
+		group = &filterGroupBuilder{expressions: []FilterExpression{expr}, operator: AndOperator}
+	}
+	group.negated = !group.negated
+	return group
+}
+
+// leadingOperator returns the operator of the first explicit AND or OR,
+// or comma, among params, or AND if there is none.
+func leadingOperator(params []*ddqp.Param) GroupOperator {
+	for _, p := range params {
+		if p.Separator == nil {
+			continue
+		}
+		if op, explicit, _ := separatorOperator(p.Separator); explicit || p.Separator.Comma {
+			return op
+		}
+	}
+	return AndOperator
+}
+
+// mixesOperators reports whether params are joined with both AND and OR,
+// counting commas as AND when comma is set.
+func mixesOperators(params []*ddqp.Param, comma bool) bool {
+	var and, or bool
+	for _, p := range params {
+		if p.Separator == nil {
+			continue
+		}
+		op, explicit, _ := separatorOperator(p.Separator)
+		if !explicit && !(comma && p.Separator.Comma) {
+			continue
+		}
+		and = and || op == AndOperator
+		or = or || op == OrOperator
+	}
+	return and && or
+}
+
 // convertParam converts a DDQP Param to a DDQB FilterExpression
 func convertParam(param *ddqp.Param) (FilterExpression, error) {
 	if param == nil {
@@ -205,17 +518,21 @@ func convertGroupedFilter(gf *ddqp.GroupedFilter) (FilterExpression, error) {
 	}
 
 	group := NewFilterGroupBuilder()
-	currentOperator := AndOperator // Default to AND
+	if mixesOperators(gf.Parameters, true) {
+		group.MixedOperators(MixedOperatorsOrdered)
+	}
+	// The first expression is joined with the operator that follows it
+	currentOperator := leadingOperator(gf.Parameters)
+	var negateNext bool
 
 	// Process parameters in the grouped filter
 	for _, param := range gf.Parameters {
-		// Check for separator to determine operator
+		// Check for separator to determine operator; commas and a bare
+		// NOT join with AND
 		if param.Separator != nil {
-			if param.Separator.And || param.Separator.Comma {
-				currentOperator = AndOperator
-			} else if param.Separator.Or {
-				currentOperator = OrOperator
-			}
+			var negate bool
+			currentOperator, _, negate = separatorOperator(param.Separator)
+			negateNext = negateNext || negate
 			continue
 		}
 
@@ -227,6 +544,10 @@ func convertGroupedFilter(gf *ddqp.GroupedFilter) (FilterExpression, error) {
 		if expr == nil {
 			continue
 		}
+		if negateNext {
+			expr = negateFilter(expr)
+			negateNext = false
+		}
 
 		// Add to group with appropriate operator
 		if currentOperator == AndOperator {
@@ -253,10 +574,11 @@ func convertSimpleFilter(sf *ddqp.SimpleFilter) (FilterBuilder, error) {
 
 	key := sf.FilterKey
 	if key == "" {
-		return nil, fmt.Errorf("filter key is empty")
+		return nil, ErrEmptyFilterKey
 	}
 
 	builder := NewFilterBuilder(key)
+	builder.(*filterBuilder).quotes = parsedQuotes(sf.FilterValue)
 
 	if sf.FilterSeparator == nil {
 		return nil, fmt.Errorf("filter separator is missing")
@@ -271,6 +593,11 @@ func convertSimpleFilter(sf *ddqp.SimpleFilter) (FilterBuilder, error) {
 	// Convert based on separator type
 	fs := sf.FilterSeparator
 	switch {
+	case fs.Colon && value == "*":
+		if sf.Negative {
+			return builder.NotExists(), nil
+		}
+		return builder.Exists(), nil
 	case fs.Colon:
 		if sf.Negative {
 			return builder.NotEqual(value), nil
@@ -290,6 +617,25 @@ func convertSimpleFilter(sf *ddqp.SimpleFilter) (FilterBuilder, error) {
 			return nil, err
 		}
 		return builder.NotIn(values...), nil
+	case fs.Regex:
+		if sf.Negative {
+			return builder.NotRegex(value), nil
+		}
+		return builder.Regex(value), nil
+	case fs.GreaterThan, fs.GreaterEqual, fs.LessThan, fs.LessEqual:
+		if sf.Negative {
+			return nil, &ValidationError{Component: "filter", Value: key, Reason: "negated comparison filters are not supported"}
+		}
+		switch {
+		case fs.GreaterThan:
+			return builder.GreaterThan(value), nil
+		case fs.GreaterEqual:
+			return builder.GreaterOrEqual(value), nil
+		case fs.LessThan:
+			return builder.LessThan(value), nil
+		default:
+			return builder.LessOrEqual(value), nil
+		}
 	default:
 		// Default to equal if separator is not recognized
 		if sf.Negative {
@@ -299,6 +645,29 @@ func convertSimpleFilter(sf *ddqp.SimpleFilter) (FilterBuilder, error) {
 	}
 }
 
+// parsedQuotes returns the quote character of each quoted value of fv, or
+// nil if none of its values is quoted.
+func parsedQuotes(fv *ddqp.FilterValue) map[string]byte {
+	if fv == nil {
+		return nil
+	}
+	values := fv.ListValue
+	if fv.SimpleValue != nil {
+		values = append(values, fv.SimpleValue)
+	}
+	var quotes map[string]byte
+	for _, v := range values {
+		if v == nil || v.Str == nil || *v.Str == "" {
+			continue
+		}
+		if quotes == nil {
+			quotes = make(map[string]byte)
+		}
+		quotes[unquoteValue(*v.Str)] = (*v.Str)[0]
+	}
+	return quotes
+}
+
 // extractFilterValue extracts a single string value from a FilterValue
 func extractFilterValue(fv *ddqp.FilterValue) (string, error) {
 	if fv == nil {
@@ -372,7 +741,7 @@ func extractValueString(v *ddqp.Value) string {
 
 	// Extract based on value type
 	if v.Str != nil {
-		return strings.Trim(*v.Str, "\"'")
+		return unquoteValue(*v.Str)
 	}
 	if v.Identifier != nil {
 		return *v.Identifier
@@ -390,14 +759,16 @@ func extractValueString(v *ddqp.Value) string {
 	return ""
 }
 
+// timeWindowPattern matches an aggregator with a time window prefix: avg(5m), sum(10m), etc.
+// Matches any aggregator name followed by (time_window) where time_window is like 5m, 10s, 1h,
+// last_5m, etc., and captures the aggregator, the window and the rest of the query.
+var timeWindowPattern = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\(([0-9]+[smhd]|last_[0-9]+[smhdw])\):(.*)$`)
+
 // extractAndRemoveTimeWindow extracts time window from query and returns both the time window
 // and the cleaned query string without the time window (for DDQP parsing)
 // DDQP doesn't support avg(5m): format, so we need to pre-process
 func extractAndRemoveTimeWindow(queryString string) (timeWindow string, cleanedQuery string) {
-	// Pattern to match aggregator with time window: avg(5m), sum(10m), etc.
-	// Matches any aggregator name followed by (time_window) where time_window is like 5m, 10s, 1h, last_5m, etc.
-	pattern := regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\(([0-9]+[smhd]|last_[0-9]+[smhd])\):(.*)$`)
-	matches := pattern.FindStringSubmatch(queryString)
+	matches := timeWindowPattern.FindStringSubmatch(queryString)
 	if len(matches) == 4 {
 		// Found time window: matches[1] is aggregator, matches[2] is time window, matches[3] is rest of query
 		aggregator := matches[1]
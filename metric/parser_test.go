@@ -1,8 +1,10 @@
 package metric_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jonwinton/ddqb"
 	"github.com/jonwinton/ddqb/metric"
@@ -30,6 +32,41 @@ func TestParseQuery(t *testing.T) {
 			expected:    "avg:system.cpu.idle{*}",
 			wantErr:     false,
 		},
+		{
+			name:        "comparison filters",
+			queryString: "avg:system.cpu.idle{cores:>4, version:<=2.5}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "avg:system.cpu.idle{cores:>4, version:<=2.5}",
+			wantErr:     false,
+		},
+		{
+			name:        "comparison filters round trip every operator",
+			queryString: "m{a:>1, b:>=2, c:<3, d:<=4}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "m{a:>1, b:>=2, c:<3, d:<=4}",
+			wantErr:     false,
+		},
+		{
+			name:        "regex filters keep negation",
+			queryString: `avg:system.cpu.idle{host:~web.*, !host:~"^web-canary-[0-9]+$"}`,
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    `avg:system.cpu.idle{host:~web.*, !host:~"^web-canary-[0-9]+$"}`,
+			wantErr:     false,
+		},
+		{
+			name:        "wildcard filters",
+			queryString: "avg:system.cpu.idle{host:web-*, service:*-api, pod:*canary*}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "avg:system.cpu.idle{host:web-*, service:*-api, pod:*canary*}",
+			wantErr:     false,
+		},
+		{
+			name:        "key existence filters",
+			queryString: "avg:system.cpu.idle{team:*, !deprecated:*}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "avg:system.cpu.idle{team:*, !deprecated:*}",
+			wantErr:     false,
+		},
 		{
 			name:        "metric query with aggregator and time window",
 			queryString: "avg(5m):system.cpu.idle{*}",
@@ -60,16 +97,16 @@ func TestParseQuery(t *testing.T) {
 		},
 		{
 			name:        "metric query with function",
-			queryString: "system.cpu.idle{*}.fill(0)",
+			queryString: "system.cpu.idle{*}.fill(zero)",
 			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
-			expected:    "system.cpu.idle{*}.fill(0)",
+			expected:    "system.cpu.idle{*}.fill(zero)",
 			wantErr:     false,
 		},
 		{
 			name:        "complex metric query",
-			queryString: "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(0).rollup(60,avg)",
+			queryString: "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero).rollup(60,avg)",
 			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
-			expected:    "avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(0).rollup(60, avg)",
+			expected:    "avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(zero).rollup(60, avg)",
 			wantErr:     false,
 		},
 		{
@@ -86,6 +123,48 @@ func TestParseQuery(t *testing.T) {
 			expected:    "system.cpu.idle{host NOT IN (db-1,db-2)}",
 			wantErr:     false,
 		},
+		{
+			name:        "group mixing AND and OR keeps each operator",
+			queryString: "system.cpu.idle{env:prod, (host:web-1 AND zone:a OR host:web-2)}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{(env:prod AND (host:web-1 AND zone:a OR host:web-2))}",
+			wantErr:     false,
+		},
+		{
+			name:        "top-level AND and OR keep each operator",
+			queryString: "system.cpu.idle{env:prod AND host:web-1 OR env:staging}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{(env:prod AND host:web-1 OR env:staging)}",
+			wantErr:     false,
+		},
+		{
+			name:        "commas mixed with OR keep their AND",
+			queryString: "system.cpu.idle{env:prod, host:web-1 OR host:web-2}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{(env:prod AND host:web-1 OR host:web-2)}",
+			wantErr:     false,
+		},
+		{
+			name:        "NOT group is kept",
+			queryString: "system.cpu.idle{env:prod AND NOT (host:web-1 OR host:web-2)}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{(env:prod AND NOT (host:web-1 OR host:web-2))}",
+			wantErr:     false,
+		},
+		{
+			name:        "leading NOT is kept",
+			queryString: "system.cpu.idle{NOT host:web-1}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{NOT host:web-1}",
+			wantErr:     false,
+		},
+		{
+			name:        "OR NOT inside a group is kept",
+			queryString: "system.cpu.idle{env:prod, (host:web-1 OR NOT zone:a)}",
+			build:       func(b metric.QueryBuilder) metric.QueryBuilder { return b },
+			expected:    "system.cpu.idle{(env:prod AND (host:web-1 OR NOT zone:a))}",
+			wantErr:     false,
+		},
 		{
 			name:        "query with not equal filter",
 			queryString: "system.cpu.idle{!host:web-1}",
@@ -158,9 +237,9 @@ func TestParseQueryModify(t *testing.T) {
 			name:        "parse and add function",
 			queryString: "system.cpu.idle{*}",
 			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
-				return b.ApplyFunction(ddqb.Function("fill").WithArg("0"))
+				return b.ApplyFunction(ddqb.Function("fill").WithArg("zero"))
 			},
-			expected: "system.cpu.idle{*}.fill(0)",
+			expected: "system.cpu.idle{*}.fill(zero)",
 		},
 		{
 			name:        "parse and modify multiple components",
@@ -170,9 +249,59 @@ func TestParseQueryModify(t *testing.T) {
 					TimeWindow("10m").
 					Filter(ddqb.Filter("env").Equal("prod")).
 					GroupBy("host").
-					ApplyFunction(ddqb.Function("fill").WithArg("0"))
+					ApplyFunction(ddqb.Function("fill").WithArg("zero"))
+			},
+			expected: "avg(10m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(zero)",
+		},
+		{
+			name:        "parse exclude_null with quoted tag",
+			queryString: `avg:system.cpu.idle{*} by {host}.exclude_null("host")`,
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(ddqb.Filter("env").Equal("prod"))
+			},
+			expected: "avg:system.cpu.idle{env:prod} by {host}.exclude_null(host)",
+		},
+		{
+			name:        "parse rate wrapper and add filter",
+			queryString: "per_second(sum:requests.count{env:prod} by {service})",
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(ddqb.Filter("region").Equal("us-east-1"))
+			},
+			expected: "per_second(sum:requests.count{env:prod, region:us-east-1} by {service})",
+		},
+		{
+			name:        "parse nested rate wrappers and regroup",
+			queryString: "per_hour(per_minute(sum:requests.count{*} by {service}))",
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.GroupBy("host")
+			},
+			expected: "per_hour(per_minute(sum:requests.count{*} by {service, host}))",
+		},
+		{
+			name:        "parse moving rollup and add filter",
+			queryString: "moving_rollup(sum:requests.count{*} by {service}, 300, 'max')",
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.Filter(ddqb.Filter("env").Equal("prod"))
+			},
+			expected: "moving_rollup(sum:requests.count{env:prod} by {service}, 300, 'max')",
+		},
+		{
+			name:        "parse moving rollup without aggregation and regroup",
+			queryString: "moving_rollup(sum:metric{*}, 60)",
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				return b.GroupBy("host")
 			},
-			expected: "avg(10m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(0)",
+			expected: "moving_rollup(sum:metric{*} by {host}, 60)",
+		},
+		{
+			name:        "parse moving rollup and change window and aggregation",
+			queryString: "moving_rollup(sum:requests.count{*} by {service}, 300, 'max')",
+			modify: func(b metric.QueryBuilder) metric.QueryBuilder {
+				m := b.GetWrappers()[0].(metric.MovingRollupBuilder)
+				m.SetWindow(10 * time.Minute).SetAggregation(metric.RollupSum)
+				return b
+			},
+			expected: "moving_rollup(sum:requests.count{*} by {service}, 600, 'sum')",
 		},
 	}
 
@@ -216,10 +345,30 @@ func TestParseQueryErrors(t *testing.T) {
 			wantErr:     true,
 		},
 		{
-			name:        "aggregator function wrapper passthrough",
+			name:        "bracketed IN list",
+			queryString: `avg:system.cpu.idle{host IN ["web-1","web-2"]}`,
+			wantErr:     true,
+		},
+		{
+			name:        "moving rollup wrapper",
 			queryString: "moving_rollup(sum:metric{*}, 60)",
 			wantErr:     false,
 		},
+		{
+			name:        "moving rollup with unknown aggregation",
+			queryString: "moving_rollup(sum:metric{*}, 60, 'median')",
+			wantErr:     true,
+		},
+		{
+			name:        "moving rollup with fractional window",
+			queryString: "moving_rollup(sum:metric{*}, 1.5)",
+			wantErr:     true,
+		},
+		{
+			name:        "rate wrapper with argument",
+			queryString: "per_second(sum:metric{*}, 60)",
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -254,8 +403,8 @@ func TestParseComplexNestedFilters(t *testing.T) {
 	// Test parsing a complex nested filter query with AND, OR, AND NOT, and OR NOT
 	// Starting query: env:prod AND (host:web-1 OR host:web-2) AND NOT (region:us-west-1)
 	queryString := "system.cpu.idle{env:prod AND (host:web-1 OR host:web-2) AND NOT (region:us-west-1)}"
-	expectedAfterParse := "system.cpu.idle{(env:prod AND (host:web-1 AND host:web-2) AND region:us-west-1)}"
-	expectedAfterAddingFilter := "system.cpu.idle{((env:prod AND (host:web-1 AND host:web-2) AND region:us-west-1) AND service:api)}"
+	expectedAfterParse := "system.cpu.idle{(env:prod AND (host:web-1 OR host:web-2) AND NOT region:us-west-1)}"
+	expectedAfterAddingFilter := "system.cpu.idle{((env:prod AND (host:web-1 OR host:web-2) AND NOT region:us-west-1) AND service:api)}"
 
 	builder, err := metric.ParseQuery(queryString)
 	if err != nil {
@@ -289,8 +438,8 @@ func TestParseComplexNestedFiltersWithORNOT(t *testing.T) {
 	// Test parsing a complex query with OR NOT as well
 	// Starting query: env:prod OR NOT (host:web-1) AND (region:us-east-1 OR region:us-west-2)
 	queryString := "avg(5m):system.cpu.idle{env:prod OR NOT (host:web-1) AND (region:us-east-1 OR region:us-west-2)}"
-	expectedAfterParse := "avg(5m):system.cpu.idle{(env:prod AND (host:web-1 AND (region:us-east-1 AND region:us-west-2)))}"
-	expectedAfterAddingFilter := "avg(5m):system.cpu.idle{(env:prod AND (host:web-1 AND (region:us-east-1 AND region:us-west-2)) AND team:backend)}"
+	expectedAfterParse := "avg(5m):system.cpu.idle{(env:prod OR NOT host:web-1 AND (region:us-east-1 OR region:us-west-2))}"
+	expectedAfterAddingFilter := "avg(5m):system.cpu.idle{((env:prod OR NOT host:web-1 AND (region:us-east-1 OR region:us-west-2)) AND team:backend)}"
 
 	builder, err := metric.ParseQuery(queryString)
 	if err != nil {
@@ -441,6 +590,41 @@ func TestFindGroupAndAddToGroup(t *testing.T) {
 	}
 }
 
+func TestExpressionFindGroupAndAddToGroup(t *testing.T) {
+	queryString := "sum:errors{env:prod} / sum:hits{env:prod AND (host:web-1 AND service:api)}"
+	builder, err := metric.ParseQuery(queryString)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	group := builder.FindGroup(func(g metric.FilterGroupBuilder) bool {
+		built, _ := g.Build()
+		return built == "(host:web-1 AND service:api)"
+	})
+	if group == nil {
+		t.Fatal("Expected to find the host group in the second query")
+	}
+
+	builder = builder.AddToGroup(group, ddqb.Filter("host").Equal("web-3"))
+
+	result, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	expected := "sum:errors{env:prod} / sum:hits{(env:prod AND (host:web-1 AND service:api AND host:web-3))}"
+	if result != expected {
+		t.Errorf("Build() after FindGroup + AddToGroup = %q, want %q", result, expected)
+	}
+
+	missing := builder.FindGroup(func(g metric.FilterGroupBuilder) bool {
+		built, _ := g.Build()
+		return strings.Contains(built, "region")
+	})
+	if missing != nil {
+		t.Errorf("FindGroup() = %v, want nil", missing)
+	}
+}
+
 func TestExpressionNormalization_MixedAndComma(t *testing.T) {
 	// Start with an expression containing comma-style filters and a negation
 	query := "top(system.cpu.idle{host:web-1, env:staging, !region:us-west-2}, 1, 'max', 'desc')"
@@ -511,3 +695,111 @@ func TestExpressionNormalization_DefaultCommaWhenNoExplicit(t *testing.T) {
 		t.Errorf("did not expect AND when no explicit boolean operators, got: %s", out)
 	}
 }
+
+func TestParseQueryStrict(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		opts      []metric.ParseOption
+		wantErr   bool
+		errIs     error
+		wantBuild string
+	}{
+		{
+			name:      "metric query",
+			query:     "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero)",
+			wantBuild: "avg(5m):system.cpu.idle{host:web-1, env:prod} by {host}.fill(zero)",
+		},
+		{
+			name:      "expression with structured queries",
+			query:     "sum:errors{env:prod} / sum:hits{env:prod}",
+			wantBuild: "sum:errors{env:prod} / sum:hits{env:prod}",
+		},
+		{
+			name:      "preserved formatting",
+			query:     "sum:requests{env:prod,service:web} by {host,env}",
+			opts:      []metric.ParseOption{metric.PreserveFormatting()},
+			wantBuild: "sum:requests{env:prod,service:web} by {host,env}",
+		},
+		{
+			name:    "expression with unrepresentable query",
+			query:   "sum:errors{!version:>2} / sum:hits{*}",
+			wantErr: true,
+			errIs:   metric.ErrUnrepresentable,
+		},
+		{
+			name:    "rebuilding changes the query",
+			query:   "system.cpu.idle{env:prod} by {host,host}",
+			wantErr: true,
+			errIs:   metric.ErrUnrepresentable,
+		},
+		{
+			name:    "unparseable query",
+			query:   "avg:system.cpu.idle{host:",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQueryStrict(tt.query, tt.opts...)
+			if tt.wantErr {
+				var parseErr *metric.ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("ParseQueryStrict() error = %v, want *ParseError", err)
+				}
+				if builder != nil {
+					t.Errorf("ParseQueryStrict() builder = %v, want nil", builder)
+				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("ParseQueryStrict() error = %v, want %v", err, tt.errIs)
+				}
+				if tt.errIs == nil && errors.Is(err, metric.ErrUnrepresentable) {
+					t.Errorf("ParseQueryStrict() error = %v, want a syntax error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQueryStrict() error = %v", err)
+			}
+			result, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.wantBuild {
+				t.Errorf("Build() = %q, want %q", result, tt.wantBuild)
+			}
+		})
+	}
+}
+
+func TestParseQueryLenient(t *testing.T) {
+	const query = "avg(last_5m):avg:system.cpu.user{*} by {host} > 90"
+	if _, err := metric.ParseQuery(query); err == nil {
+		t.Fatal("ParseQuery() succeeded, want the query to use unknown syntax")
+	}
+
+	builder, err := metric.ParseQueryLenient(query)
+	if err != nil {
+		t.Fatalf("ParseQueryLenient() error = %v", err)
+	}
+	if result, err := builder.Build(); err != nil || result != query {
+		t.Errorf("Build() = %q, %v, want %q", result, err, query)
+	}
+	if _, err := builder.Clone().GroupBy("env").Build(); !errors.Is(err, metric.ErrUnsupportedEdit) {
+		t.Errorf("Build() after GroupBy error = %v, want %v", err, metric.ErrUnsupportedEdit)
+	}
+
+	// Queries the parser knows are parsed as usual
+	builder, err = metric.ParseQueryLenient("avg:system.cpu.user{*}")
+	if err != nil {
+		t.Fatalf("ParseQueryLenient() error = %v", err)
+	}
+	if result, _ := builder.GroupBy("host").Build(); result != "avg:system.cpu.user{*} by {host}" {
+		t.Errorf("Build() = %q", result)
+	}
+
+	if _, err := metric.ParseQueryLenient("  "); err == nil {
+		t.Error("ParseQueryLenient() of a blank query succeeded, want error")
+	}
+}
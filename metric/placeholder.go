@@ -0,0 +1,43 @@
+package metric
+
+import (
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches {{name}} placeholders in function arguments.
+// Surrounding whitespace inside the braces is allowed: {{ name }}.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// resolvePlaceholders replaces every {{name}} placeholder in s with the
+// matching value from params. It returns an error naming the first
+// placeholder that has no value.
+func resolvePlaceholders(s string, params map[string]string) (string, error) {
+	if !hasPlaceholder(s) {
+		return s, nil
+	}
+
+	var missing string
+	resolved := placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		value, ok := params[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return match
+		}
+		return value
+	})
+
+	if missing != "" {
+		return "", &ValidationError{Component: "placeholder", Value: missing, Reason: "no value provided"}
+	}
+
+	return resolved, nil
+}
+
+// hasPlaceholder reports whether s may contain a {{name}} placeholder.
+func hasPlaceholder(s string) bool {
+	return strings.Contains(s, "{{")
+}
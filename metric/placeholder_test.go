@@ -0,0 +1,104 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestBuildWithParams(t *testing.T) {
+	template := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Aggregator("avg").
+			Metric("system.cpu.idle").
+			ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("{{window}}", "avg"))
+	}
+
+	tests := []struct {
+		name     string
+		build    func() (string, error)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "placeholder resolved",
+			build: func() (string, error) {
+				return template().BuildWithParams(map[string]string{"window": "60"})
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(60, avg)",
+			wantErr:  false,
+		},
+		{
+			name: "same template with different params",
+			build: func() (string, error) {
+				return template().BuildWithParams(map[string]string{"window": "300"})
+			},
+			expected: "avg:system.cpu.idle{*}.rollup(300, avg)",
+			wantErr:  false,
+		},
+		{
+			name: "whitespace inside placeholder",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("{{ fill_value }}")).
+					BuildWithParams(map[string]string{"fill_value": "zero"})
+			},
+			expected: "system.cpu.idle{*}.fill(zero)",
+			wantErr:  false,
+		},
+		{
+			name: "multiple placeholders in one function",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("{{window}}", "{{method}}")).
+					BuildWithParams(map[string]string{"window": "60", "method": "max"})
+			},
+			expected: "system.cpu.idle{*}.rollup(60, max)",
+			wantErr:  false,
+		},
+		{
+			name: "no placeholders with nil params",
+			build: func() (string, error) {
+				return metric.NewMetricQueryBuilder().
+					Metric("system.cpu.idle").
+					ApplyFunction(metric.NewFunctionBuilder("fill").WithArg("zero")).
+					BuildWithParams(nil)
+			},
+			expected: "system.cpu.idle{*}.fill(zero)",
+			wantErr:  false,
+		},
+		{
+			name: "error - missing param",
+			build: func() (string, error) {
+				return template().BuildWithParams(map[string]string{"other": "60"})
+			},
+			expected: "",
+			wantErr:  true,
+		},
+		{
+			name: "error - Build with unresolved placeholder",
+			build: func() (string, error) {
+				return template().Build()
+			},
+			expected: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.build()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BuildWithParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if result != tt.expected {
+				t.Errorf("BuildWithParams() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
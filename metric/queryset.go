@@ -0,0 +1,149 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// QuerySet holds several queries that are built together, such as the
+// queries of a single dashboard widget request.
+type QuerySet struct {
+	queries []QueryBuilder
+}
+
+// NewQuerySet returns a set holding queries.
+func NewQuerySet(queries ...QueryBuilder) *QuerySet {
+	s := &QuerySet{queries: make([]QueryBuilder, 0, len(queries))}
+	return s.Add(queries...)
+}
+
+// Add appends queries to the set. Nil queries are ignored.
+func (s *QuerySet) Add(queries ...QueryBuilder) *QuerySet {
+	for _, q := range queries {
+		if q != nil {
+			s.queries = append(s.queries, q)
+		}
+	}
+	return s
+}
+
+// Len returns the number of queries in the set.
+func (s *QuerySet) Len() int {
+	return len(s.queries)
+}
+
+// Queries returns the queries in the set, in the order they were added.
+func (s *QuerySet) Queries() []QueryBuilder {
+	out := make([]QueryBuilder, len(s.queries))
+	copy(out, s.queries)
+	return out
+}
+
+// Build builds every query in the set with opts and returns the results
+// in order. Every failing query is reported, each prefixed with its
+// position in the set, in a single joined error.
+func (s *QuerySet) Build(opts ...BuildOption) ([]string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	out := make([]string, 0, len(s.queries))
+	for i, q := range s.queries {
+		query, err := q.BuildWithOptions(opts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("query %d: %w", i, err))
+			continue
+		}
+		out = append(out, query)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return out, nil
+}
+
+// BuildString builds every query in the set with opts and joins them into
+// a comma-separated list. The separator has no space when opts select
+// FormatMinified.
+func (s *QuerySet) BuildString(opts ...BuildOption) (string, error) {
+	queries, err := s.Build(opts...)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(queries, layoutFor(newBuildOptions(opts).format).listSep), nil
+}
+
+// ParseMany parses a comma-separated list of queries, such as the q field
+// of a dashboard widget request, and returns a builder for each in order.
+// Only commas outside braces, parentheses and quoted strings separate
+// queries. Every query that fails to parse is reported, each prefixed with
+// its position in the list, in a single joined error; the positions of
+// ParseErrors are given in s. A blank list has no queries.
+func ParseMany(s string, opts ...ParseOption) ([]QueryBuilder, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	spans := splitQueryList(s)
+	out := make([]QueryBuilder, 0, len(spans))
+	for i, span := range spans {
+		query := s[span[0]:span[1]]
+		start := span[0] + len(query) - len(strings.TrimLeft(query, " \t\n"))
+		query = strings.TrimSpace(query)
+
+		builder, err := ParseQuery(query, opts...)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) && parseErr.Line > 0 {
+				located := &ParseError{Query: s, Err: parseErr.Err}
+				located.locate(start + parseErr.Offset)
+				located.Token = parseErr.Token
+				err = located
+			}
+			errs = append(errs, fmt.Errorf("query %d: %w", i, err))
+			continue
+		}
+		out = append(out, builder)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return out, nil
+}
+
+// splitQueryList returns the start and end offsets of each query in s, a
+// list separated by commas outside brackets and quoted strings.
+func splitQueryList(s string) [][2]int {
+	var (
+		spans [][2]int
+		depth int
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				spans = append(spans, [2]int{start, i})
+				start = i + 1
+			}
+		}
+	}
+	return append(spans, [2]int{start, len(s)})
+}
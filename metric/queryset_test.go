@@ -0,0 +1,190 @@
+package metric_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestQuerySet(t *testing.T) {
+	user := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.user").Filter(metric.NewFilterBuilder("env").Equal("prod"))
+	system := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.system").Filter(metric.NewFilterBuilder("env").Equal("prod"))
+
+	tests := []struct {
+		name     string
+		set      *metric.QuerySet
+		opts     []metric.BuildOption
+		expected string
+	}{
+		{
+			name:     "single query",
+			set:      metric.NewQuerySet(user),
+			expected: "avg:system.cpu.user{env:prod}",
+		},
+		{
+			name:     "comma-separated list",
+			set:      metric.NewQuerySet(user, system),
+			expected: "avg:system.cpu.user{env:prod}, avg:system.cpu.system{env:prod}",
+		},
+		{
+			name:     "minified",
+			set:      metric.NewQuerySet(user).Add(system),
+			opts:     []metric.BuildOption{metric.WithFormat(metric.FormatMinified)},
+			expected: "avg:system.cpu.user{env:prod},avg:system.cpu.system{env:prod}",
+		},
+		{
+			name:     "nil queries ignored",
+			set:      metric.NewQuerySet(nil, user),
+			expected: "avg:system.cpu.user{env:prod}",
+		},
+		{
+			name:     "empty",
+			set:      metric.NewQuerySet(),
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.set.BuildString(tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuerySetBuildSlice(t *testing.T) {
+	set := metric.NewQuerySet(
+		metric.NewMetricQueryBuilder().Metric("a"),
+		metric.NewMetricQueryBuilder().Metric("b"),
+	)
+	got, err := set.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != "a{*}" || got[1] != "b{*}" {
+		t.Errorf("got %q", got)
+	}
+	if set.Len() != 2 || len(set.Queries()) != 2 {
+		t.Errorf("Len() = %d, len(Queries()) = %d, want 2", set.Len(), len(set.Queries()))
+	}
+}
+
+func TestQuerySetErrors(t *testing.T) {
+	set := metric.NewQuerySet(
+		metric.NewMetricQueryBuilder(),
+		metric.NewMetricQueryBuilder().Metric("ok"),
+		metric.NewMetricQueryBuilder().Metric("bad").ApplyFunction(metric.NewFunctionBuilder("")),
+	)
+	_, err := set.BuildString()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !errors.Is(err, metric.ErrMissingMetric) {
+		t.Errorf("expected ErrMissingMetric, got %v", err)
+	}
+	for _, want := range []string{"query 0:", "query 2:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "query 1:") {
+		t.Errorf("error %q mentions the valid query", err)
+	}
+}
+
+func TestParseMany(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "single query",
+			input:    "avg:system.cpu.user{env:prod}",
+			expected: []string{"avg:system.cpu.user{env:prod}"},
+		},
+		{
+			name:     "comma-separated list",
+			input:    "avg:system.cpu.user{env:prod}, avg:system.cpu.system{env:prod}",
+			expected: []string{"avg:system.cpu.user{env:prod}", "avg:system.cpu.system{env:prod}"},
+		},
+		{
+			name:     "commas inside filters and group by",
+			input:    "sum:requests{env:prod,service:web} by {host,env},sum:errors{env:prod}",
+			expected: []string{"sum:requests{env:prod, service:web} by {host, env}", "sum:errors{env:prod}"},
+		},
+		{
+			name:     "commas inside function arguments",
+			input:    "sum:requests{*}.rollup(sum, 60), top(sum:errors{*} by {host}, 10, 'mean', 'desc')",
+			expected: []string{"sum:requests{*}.rollup(sum, 60)", "top(sum:errors{*} by {host}, 10, 'mean', 'desc')"},
+		},
+		{
+			name:     "expressions",
+			input:    "sum:errors{*} / sum:hits{*}, avg(5m):max:latency{*}",
+			expected: []string{"sum:errors{*} / sum:hits{*}", "avg(5m):max:latency{*}"},
+		},
+		{
+			name:     "blank",
+			input:    "  ",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builders, err := metric.ParseMany(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMany() error = %v", err)
+			}
+			if len(builders) != len(tt.expected) {
+				t.Fatalf("ParseMany() returned %d queries, want %d", len(builders), len(tt.expected))
+			}
+			for i, b := range builders {
+				got, err := b.Build()
+				if err != nil {
+					t.Fatalf("query %d: Build() error = %v", i, err)
+				}
+				if got != tt.expected[i] {
+					t.Errorf("query %d: Build() = %q, want %q", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseManyErrors(t *testing.T) {
+	const input = "sum:a{*}, sum:b{env:prod | x}, , sum:c{*}"
+	builders, err := metric.ParseMany(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if builders != nil {
+		t.Errorf("ParseMany() returned builders with an error: %v", builders)
+	}
+	for _, want := range []string{"query 1:", "query 2:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	for _, unwanted := range []string{"query 0:", "query 3:"} {
+		if strings.Contains(err.Error(), unwanted) {
+			t.Errorf("error %q mentions a valid query", err)
+		}
+	}
+
+	// Positions are reported in the whole list
+	var parseErr *metric.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a *ParseError, got %T", err)
+	}
+	if parseErr.Query != input || parseErr.Offset != strings.Index(input, "|") || parseErr.Token != "|" {
+		t.Errorf("ParseError = %q at %d (%q), want the | in the list", parseErr.Query, parseErr.Offset, parseErr.Token)
+	}
+}
@@ -0,0 +1,269 @@
+package metric
+
+import (
+	"fmt"
+	"strings"
+)
+
+// layout controls the whitespace used when rendering a query.
+type layout struct {
+	listSep     string // between group by keys and function args
+	filterSep   string // between comma-separated filters
+	filterOpen  string // after the opening brace of the filter list
+	filterClose string // before the closing brace of the filter list
+	andSep      string // between top-level filters joined with explicit AND; "" keeps them on one line
+	functionSep string // before each function
+}
+
+var (
+	// standardLayout is the default single-line rendering.
+	standardLayout = layout{listSep: ", ", filterSep: ", "}
+
+	// minifiedLayout drops every optional space.
+	minifiedLayout = layout{listSep: ",", filterSep: ","}
+
+	// multiLineLayout places each top-level filter and each function on
+	// its own line.
+	multiLineLayout = layout{
+		listSep:     ", ",
+		filterSep:   ",\n  ",
+		filterOpen:  "\n  ",
+		filterClose: "\n",
+		andSep:      "\n  AND ",
+		functionSep: "\n  ",
+	}
+)
+
+// filterStyle controls how filters are rendered, beyond whitespace.
+type filterStyle struct {
+	listQuoting ListQuoting
+	negation    NegationStyle
+	boolean     bool // rendering inside an explicit AND/OR expression
+}
+
+// writeNegation writes the prefix negating a simple filter.
+func (s filterStyle) writeNegation(sb *strings.Builder) {
+	if s.negation == NegationKeyword || (s.negation == NegationContextual && s.boolean) {
+		sb.WriteString("NOT ")
+		return
+	}
+	sb.WriteByte('!')
+}
+
+// forcesExplicitOperators reports whether filters must be joined with
+// explicit ANDs rather than commas because one of them renders with the
+// NOT keyword, which cannot be mixed with comma notation.
+func (s filterStyle) forcesExplicitOperators(filters []FilterExpression) bool {
+	if s.negation != NegationKeyword {
+		return false
+	}
+	for _, f := range filters {
+		if fb, ok := f.(*filterBuilder); ok && fb.negated() {
+			return true
+		}
+	}
+	return false
+}
+
+// prettyWidth is the length beyond which FormatPretty switches to the
+// multi-line layout.
+const prettyWidth = 80
+
+// layoutFor returns the single-line layout for format.
+func layoutFor(format OutputFormat) layout {
+	if format == FormatMinified {
+		return minifiedLayout
+	}
+	return standardLayout
+}
+
+// render writes the query into a single buffer sized up front, using l for
+// whitespace, style for filters and scope for a query without filters. It
+// returns every error encountered while rendering filters and functions.
+func (b *metricQueryBuilder) render(filters []FilterExpression, params map[string]string, l layout, style filterStyle, scope ScopeMode) (string, []error) {
+	var errs []error
+	var sb strings.Builder
+	sb.Grow(b.estimateSize())
+
+	// Add aggregator and time window if provided
+	if b.aggregator != "" {
+		sb.WriteString(b.aggregator)
+		if b.timeWindow != "" {
+			sb.WriteByte('(')
+			sb.WriteString(b.timeWindow)
+			sb.WriteByte(')')
+		}
+		sb.WriteByte(':')
+	}
+
+	// Add metric name
+	sb.WriteString(b.metric)
+
+	// Add filters if provided, or {*} if no filters unless the scope is omitted
+	switch {
+	case len(filters) > 0:
+		sb.WriteByte('{')
+		sb.WriteString(l.filterOpen)
+
+		// Check if any filter uses explicit operators (FilterGroupBuilder)
+		// If so, we must wrap everything in a group with explicit AND operators
+		// to avoid mixing comma notation with explicit AND/OR (invalid syntax)
+		hasExplicitOperators := style.forcesExplicitOperators(filters)
+		for _, filter := range filters {
+			if _, ok := filter.(FilterGroupBuilder); ok {
+				hasExplicitOperators = true
+				break
+			}
+		}
+		if hasExplicitOperators {
+			style.boolean = true
+		}
+
+		switch {
+		case hasExplicitOperators && l.andSep != "":
+			// One filter per line; the braces already delimit the group
+			for i, filter := range filters {
+				if i > 0 {
+					sb.WriteString(l.andSep)
+				}
+				if err := appendFilter(&sb, filter, style); err != nil {
+					errs = append(errs, fmt.Errorf("error building filter: %w", err))
+				}
+			}
+		case hasExplicitOperators:
+			// Wrap all filters in a group with explicit AND operators
+			group := &filterGroupBuilder{expressions: filters, operator: AndOperator}
+			if err := group.appendTo(&sb, style); err != nil {
+				errs = append(errs, fmt.Errorf("error building filter group: %w", err))
+			}
+		default:
+			// All filters are simple - use comma notation (implicit AND)
+			for i, filter := range filters {
+				if i > 0 {
+					sb.WriteString(l.filterSep)
+				}
+				if err := appendFilter(&sb, filter, style); err != nil {
+					errs = append(errs, fmt.Errorf("error building filter: %w", err))
+				}
+			}
+		}
+
+		sb.WriteString(l.filterClose)
+		sb.WriteByte('}')
+	case scope != ScopeOmit:
+		// Datadog requires {*} for queries without filters
+		sb.WriteString("{*}")
+	}
+
+	// Add group by if provided
+	if groupBy := b.groupByKeys(); len(groupBy) > 0 {
+		sb.WriteString(" by {")
+		for i, key := range groupBy {
+			if i > 0 {
+				sb.WriteString(l.listSep)
+			}
+			sb.WriteString(key)
+		}
+		sb.WriteByte('}')
+	}
+
+	// Add functions if provided
+	for _, fn := range b.functions {
+		sb.WriteString(l.functionSep)
+		if err := appendFunction(&sb, fn, params, l.listSep); err != nil {
+			errs = append(errs, fmt.Errorf("error building function: %w", err))
+		}
+	}
+
+	return sb.String(), errs
+}
+
+// filterAppender is implemented by filter expressions that can render
+// directly into a shared strings.Builder. Rendering into a single buffer
+// avoids allocating an intermediate string for every component of a query.
+type filterAppender interface {
+	appendTo(sb *strings.Builder, style filterStyle) error
+}
+
+// functionAppender is implemented by functions that can render directly into
+// a shared strings.Builder, optionally resolving placeholders in their
+// arguments and separating them with argSep.
+type functionAppender interface {
+	appendTo(sb *strings.Builder, params map[string]string, resolve bool, argSep string) error
+}
+
+// appendFilter renders expr into sb in style, falling back to Build for
+// filter expressions implemented outside this package.
+func appendFilter(sb *strings.Builder, expr FilterExpression, style filterStyle) error {
+	if a, ok := expr.(filterAppender); ok {
+		return a.appendTo(sb, style)
+	}
+	s, err := expr.Build()
+	if err != nil {
+		return err
+	}
+	sb.WriteString(s)
+	return nil
+}
+
+// appendFunction renders fn into sb with its placeholders resolved from
+// params and its arguments separated by argSep, falling back to Build for
+// functions implemented outside this package.
+func appendFunction(sb *strings.Builder, fn FunctionBuilder, params map[string]string, argSep string) error {
+	if a, ok := fn.(functionAppender); ok {
+		return a.appendTo(sb, params, true, argSep)
+	}
+	s, err := fn.Build()
+	if err != nil {
+		return err
+	}
+	s, err = resolvePlaceholders(s, params)
+	if err != nil {
+		return err
+	}
+	sb.WriteString(s)
+	return nil
+}
+
+// estimateSize returns an approximate length of the built query, used to
+// size the output buffer up front.
+func (b *metricQueryBuilder) estimateSize() int {
+	// Fixed punctuation: "(", "):", "{", "}", " by {", "}"
+	size := len(b.aggregator) + len(b.timeWindow) + len(b.metric) + 12
+	for _, f := range b.filters {
+		size += estimateFilterSize(f) + 5
+	}
+	for _, g := range b.groupBy {
+		size += len(g) + 2
+	}
+	for _, fn := range b.functions {
+		if impl, ok := fn.(*functionBuilder); ok {
+			size += len(impl.name) + 3
+			for _, arg := range impl.args {
+				size += len(arg) + 2
+			}
+		} else {
+			size += 16
+		}
+	}
+	return size
+}
+
+// estimateFilterSize returns an approximate rendered length of expr.
+func estimateFilterSize(expr FilterExpression) int {
+	switch e := expr.(type) {
+	case *filterBuilder:
+		size := len(e.key) + 10
+		for _, v := range e.values {
+			size += len(v) + 1
+		}
+		return size
+	case *filterGroupBuilder:
+		size := 6
+		for _, nested := range e.expressions {
+			size += estimateFilterSize(nested) + 5
+		}
+		return size
+	}
+	return 16
+}
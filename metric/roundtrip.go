@@ -0,0 +1,232 @@
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// RoundTripError reports that parsing a query and rebuilding it with the
+// fluent API produced a query with a different meaning.
+type RoundTripError struct {
+	// Original is the query that was parsed.
+	Original string
+	// Rebuilt is the query produced by building the parsed result.
+	Rebuilt string
+	// Drift describes each component that differs between the two queries.
+	Drift []string
+}
+
+// Error returns a summary of every detected difference.
+func (e *RoundTripError) Error() string {
+	return fmt.Sprintf("round trip changed query %q to %q: %s", e.Original, e.Rebuilt, strings.Join(e.Drift, "; "))
+}
+
+// CheckRoundTrip parses query, rebuilds it, re-parses the result, and
+// compares the two semantically. Differences in formatting (spacing, comma
+// vs AND notation, redundant parentheses, operand order) are ignored.
+//
+// It returns a *RoundTripError describing any drift, or the underlying
+// error if the query cannot be parsed or rebuilt.
+func CheckRoundTrip(query string) error {
+	builder, err := ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	rebuilt, err := builder.Build()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild query: %w", err)
+	}
+
+	drift, err := roundTripDrift(query, rebuilt)
+	if err != nil {
+		return err
+	}
+	if len(drift) > 0 {
+		return &RoundTripError{Original: query, Rebuilt: rebuilt, Drift: drift}
+	}
+
+	return nil
+}
+
+// roundTripDrift compares query with rebuilt, the query built from parsing
+// it, and describes each component whose meaning differs. It returns an
+// error only if query itself cannot be parsed.
+func roundTripDrift(query, rebuilt string) ([]string, error) {
+	original, err := summarizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	result, err := summarizeQuery(rebuilt)
+	if err != nil {
+		return []string{fmt.Sprintf("rebuilt query does not parse: %v", err)}, nil
+	}
+	return original.diff(result), nil
+}
+
+// querySummary is the semantic content of a query used for comparison.
+type querySummary struct {
+	timeWindow string
+	// timeAggregator is the aggregator of an agg(window): prefix applied
+	// to a whole expression.
+	timeAggregator string
+	aggregator     string
+	metric         string
+	filter         string
+	groupBy        string
+	functions      string
+	// expression holds the canonical form of queries that are not a single
+	// metric query (wrapped queries and arithmetic expressions).
+	expression string
+}
+
+// summarizeQuery parses query and reduces it to its semantic parts.
+func summarizeQuery(query string) (*querySummary, error) {
+	timeWindow, cleaned := extractAndRemoveTimeWindow(query)
+
+	parsed, err := parseGeneric(cleaned)
+	if err != nil {
+		// An agg(window): prefix may apply to a whole expression
+		w := splitWindowedExpression(query)
+		if w == nil {
+			return nil, newParseError(query, cleaned, err)
+		}
+		summary := &querySummary{timeWindow: w.window, timeAggregator: w.aggregator}
+		summary.summarize(w.parsed)
+		return summary, nil
+	}
+
+	summary := &querySummary{timeWindow: timeWindow}
+	summary.summarize(parsed)
+	return summary, nil
+}
+
+// summarize fills s with the semantic parts of parsed.
+func (s *querySummary) summarize(parsed *ddqp.GenericQuery) {
+	if parsed.MetricQuery != nil && parsed.MetricQuery.Query != nil {
+		q := parsed.MetricQuery.Query
+		if q.Aggregator != nil {
+			s.aggregator = q.Aggregator.Name
+		}
+		s.metric = q.MetricName
+		s.filter = canonicalFilter(q.Filters)
+		s.groupBy = canonicalGrouping(q.Grouping)
+		s.functions = canonicalFunctions(q.Function)
+		return
+	}
+
+	if parsed.MetricQuery != nil {
+		s.expression = canonicalMetricQuery(parsed.MetricQuery)
+	} else {
+		s.expression = canonicalExpression(parsed.MetricExpression.GroupedExpression)
+	}
+}
+
+// diff lists the components of s that differ from other.
+func (s *querySummary) diff(other *querySummary) []string {
+	var drift []string
+	compare := func(component, a, b string) {
+		if a != b {
+			drift = append(drift, fmt.Sprintf("%s changed from %q to %q", component, a, b))
+		}
+	}
+
+	compare("time window", s.timeWindow, other.timeWindow)
+	compare("time aggregator", s.timeAggregator, other.timeAggregator)
+	compare("aggregator", s.aggregator, other.aggregator)
+	compare("metric", s.metric, other.metric)
+	compare("filters", s.filter, other.filter)
+	compare("group by", s.groupBy, other.groupBy)
+	compare("functions", s.functions, other.functions)
+	compare("expression", s.expression, other.expression)
+	return drift
+}
+
+// canonicalGrouping renders group by keys independent of their order.
+func canonicalGrouping(groups []string) string {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// canonicalFunctions renders a function chain. Order is significant.
+func canonicalFunctions(fns []*ddqp.Function) string {
+	parts := make([]string, len(fns))
+	for i, fn := range fns {
+		parts[i] = fn.String()
+	}
+	return strings.Join(parts, ".")
+}
+
+// canonicalArgs renders wrapper function arguments.
+func canonicalArgs(args []*ddqp.Value) string {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(",")
+		sb.WriteString(arg.String())
+	}
+	return sb.String()
+}
+
+// canonicalMetricQuery renders a metric query, including wrapper functions.
+func canonicalMetricQuery(mq *ddqp.MetricQuery) string {
+	if mq.AggregatorFuction != nil {
+		w := mq.AggregatorFuction
+		return w.Name + "(" + canonicalMetricQuery(w.Body) + canonicalArgs(w.Args) + ")"
+	}
+
+	q := mq.Query
+	var sb strings.Builder
+	if q.Aggregator != nil {
+		sb.WriteString(q.Aggregator.Name + ":")
+	}
+	sb.WriteString(q.MetricName)
+	sb.WriteString("{" + canonicalFilter(q.Filters) + "}")
+	if len(q.Grouping) > 0 {
+		sb.WriteString(" by {" + canonicalGrouping(q.Grouping) + "}")
+	}
+	if len(q.Function) > 0 {
+		sb.WriteString("." + canonicalFunctions(q.Function))
+	}
+	return sb.String()
+}
+
+// canonicalExpression renders an arithmetic expression of metric queries.
+func canonicalExpression(ge *ddqp.GroupedExpression) string {
+	if ge == nil || ge.Left == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(canonicalTerm(ge.Left))
+	for _, rt := range ge.Right {
+		sb.WriteString(" " + rt.Operator.String() + " " + canonicalTerm(rt.Term))
+	}
+	return sb.String()
+}
+
+// canonicalTerm renders a multiplicative term of an expression.
+func canonicalTerm(t *ddqp.Term) string {
+	var sb strings.Builder
+	sb.WriteString(canonicalExprValue(t.Left.Base))
+	for _, of := range t.Right {
+		sb.WriteString(" " + of.Operator.String() + " " + canonicalExprValue(of.Factor.Base))
+	}
+	return sb.String()
+}
+
+// canonicalExprValue renders a single operand of an expression.
+func canonicalExprValue(v *ddqp.ExprValue) string {
+	switch {
+	case v.Subexpression != nil:
+		return "(" + canonicalExpression(v.Subexpression.GroupedExpression) + ")"
+	case v.ExprAggregatorFuction != nil:
+		w := v.ExprAggregatorFuction
+		return w.Name + "(" + canonicalExpression(w.Body) + canonicalArgs(w.Args) + ")"
+	case v.MetricQuery != nil:
+		return canonicalMetricQuery(v.MetricQuery)
+	}
+	return v.String()
+}
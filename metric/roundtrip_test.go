@@ -0,0 +1,104 @@
+package metric_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonwinton/ddqb"
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestCheckRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantDrift string // substring expected in the drift report; empty means no drift
+		wantErr   bool
+	}{
+		{
+			name:  "simple query",
+			query: "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.fill(zero).rollup(60,avg)",
+		},
+		{
+			name:  "IN and negation",
+			query: "system.cpu.idle{host IN (web-1,web-2), !env:staging}",
+		},
+		{
+			name:  "explicit AND becomes grouped AND",
+			query: "system.cpu.idle{env:prod AND host:web-1}",
+		},
+		{
+			name:  "mixed AND and OR",
+			query: "system.cpu.idle{env:prod AND host:web-1 OR env:staging AND host:web-2}",
+		},
+		{
+			name:  "group by template variable",
+			query: "avg:system.cpu.idle{env:prod} by {$group_by}",
+		},
+		{
+			name:  "quoted values",
+			query: `system.cpu.idle{url:"https://example.com/{id}"}`,
+		},
+		{
+			name:  "expression passthrough",
+			query: "sum:requests.errors{*} / sum:requests.total{*} * 100",
+		},
+		{
+			name:  "time window over an expression",
+			query: "avg(5m):sum:requests.errors{env:prod} / sum:requests.total{*}",
+		},
+		{
+			name:  "last_ time window over a metric query with its own aggregator",
+			query: "avg(last_5m):sum:requests.errors{host:web-1}",
+		},
+		{
+			name:  "NOT and OR NOT",
+			query: "system.cpu.idle{env:prod AND NOT (host:web-1 OR host:web-2) OR NOT region:us-east-1}",
+		},
+		{
+			name:  "commas mixed with OR",
+			query: "system.cpu.idle{env:prod, host:web-1 OR host:web-2}",
+		},
+		{
+			name:      "repeated group by is reported",
+			query:     "system.cpu.idle{env:prod} by {host,host}",
+			wantDrift: "group by changed",
+		},
+		{
+			name:    "unparseable query",
+			query:   "avg:system.cpu.idle{host:",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ddqb.RoundTripCheck(tt.query)
+
+			var rtErr *metric.RoundTripError
+			isDrift := errors.As(err, &rtErr)
+
+			switch {
+			case tt.wantErr:
+				if err == nil || isDrift {
+					t.Errorf("RoundTripCheck() error = %v, want parse error", err)
+				}
+			case tt.wantDrift != "":
+				if !isDrift {
+					t.Fatalf("RoundTripCheck() error = %v, want *RoundTripError", err)
+				}
+				if !strings.Contains(rtErr.Error(), tt.wantDrift) {
+					t.Errorf("RoundTripCheck() drift = %v, want mention of %q", rtErr.Drift, tt.wantDrift)
+				}
+				if rtErr.Original != tt.query || rtErr.Rebuilt == "" {
+					t.Errorf("RoundTripError = %+v, want original and rebuilt queries", rtErr)
+				}
+			default:
+				if err != nil {
+					t.Errorf("RoundTripCheck() error = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
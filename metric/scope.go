@@ -0,0 +1,131 @@
+package metric
+
+import "sync"
+
+// ScopeMode controls how a query without filters renders its scope.
+type ScopeMode int
+
+const (
+	// ScopeDefault defers to the WithEmptyScope build option, which itself
+	// defaults to ScopeWildcard.
+	ScopeDefault ScopeMode = iota
+	// ScopeWildcard renders an empty scope as {*}, which is what Datadog
+	// query strings require.
+	ScopeWildcard
+	// ScopeOmit drops the braces of an empty scope entirely, for API
+	// surfaces that reject {*}. Queries rendered this way cannot be read
+	// back with ParseQuery.
+	ScopeOmit
+)
+
+// EmptyScope sets how the query renders when it has no filters, overriding
+// the WithEmptyScope build option. It has no effect once filters are added.
+func (b *metricQueryBuilder) EmptyScope(mode ScopeMode) QueryBuilder {
+	b = b.mutable("EmptyScope")
+	b.emptyScope = mode
+	return b
+}
+
+// scopeMode resolves the empty scope rendering for a build with opts.
+func (b *metricQueryBuilder) scopeMode(opts buildOptions) ScopeMode {
+	if b.emptyScope != ScopeDefault {
+		return b.emptyScope
+	}
+	if opts.emptyScope != ScopeDefault {
+		return opts.emptyScope
+	}
+	return ScopeWildcard
+}
+
+// ScopeBuilder holds a set of filters and filter groups, such as a base
+// env/team/service scope, that is shared by many queries. Queries attached
+// with QueryBuilder.Scope hold the scope by reference and render its
+// current filters, ahead of their own, every time they are built, so a
+// change to the scope reaches every query using it. Attach scope.Clone()
+// instead to give a query a snapshot that later changes do not affect.
+//
+// A ScopeBuilder is safe for concurrent use, so a shared scope may be
+// changed while queries using it are being built elsewhere.
+type ScopeBuilder interface {
+	// Filter adds a filter condition or filter group to the scope.
+	Filter(filter FilterExpression) ScopeBuilder
+
+	// Filters adds each filter condition or filter group to the scope, in
+	// order.
+	Filters(filters ...FilterExpression) ScopeBuilder
+
+	// Clear removes every filter from the scope.
+	Clear() ScopeBuilder
+
+	// GetFilters returns a copy of the filters in the scope.
+	GetFilters() []FilterExpression
+
+	// Clone returns a deep copy of the scope that is not shared with
+	// queries the original is attached to.
+	Clone() ScopeBuilder
+}
+
+// scopeBuilder is the concrete implementation of the ScopeBuilder interface.
+type scopeBuilder struct {
+	mu      sync.RWMutex
+	filters []FilterExpression
+}
+
+// NewScopeBuilder creates a new, empty scope builder.
+func NewScopeBuilder() ScopeBuilder {
+	return &scopeBuilder{}
+}
+
+// Filter adds a filter condition or filter group to the scope.
+func (s *scopeBuilder) Filter(filter FilterExpression) ScopeBuilder {
+	return s.Filters(filter)
+}
+
+// Filters adds each filter condition or filter group to the scope, in order.
+func (s *scopeBuilder) Filters(filters ...FilterExpression) ScopeBuilder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, filters...)
+	return s
+}
+
+// Clear removes every filter from the scope.
+func (s *scopeBuilder) Clear() ScopeBuilder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = nil
+	return s
+}
+
+// GetFilters returns a copy of the filters in the scope. The filter
+// builders themselves are shared with the scope.
+func (s *scopeBuilder) GetFilters() []FilterExpression {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]FilterExpression(nil), s.filters...)
+}
+
+// Clone returns a deep copy of the scope.
+func (s *scopeBuilder) Clone() ScopeBuilder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &scopeBuilder{filters: cloneFilters(s.filters)}
+}
+
+// Scope attaches scope to the query, replacing any scope attached before.
+// Its filters are rendered ahead of the query's own filters when the query
+// is built. Passing nil detaches the scope.
+func (b *metricQueryBuilder) Scope(scope ScopeBuilder) QueryBuilder {
+	b = b.mutable("Scope")
+	b.scope = scope
+	return b
+}
+
+// scopedFilters returns the filters of the attached scope, if any,
+// followed by the query's own filters.
+func (b *metricQueryBuilder) scopedFilters() []FilterExpression {
+	if b.scope == nil {
+		return b.filters
+	}
+	return append(b.scope.GetFilters(), b.filters...)
+}
@@ -0,0 +1,205 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestEmptyScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		opts     []metric.BuildOption
+		expected string
+	}{
+		{
+			name: "wildcard by default",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle")
+			},
+			expected: "system.cpu.idle{*}",
+		},
+		{
+			name: "omitted by builder",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.idle").GroupBy("host").EmptyScope(metric.ScopeOmit)
+			},
+			expected: "avg:system.cpu.idle by {host}",
+		},
+		{
+			name: "omitted by build option",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle")
+			},
+			opts:     []metric.BuildOption{metric.WithEmptyScope(metric.ScopeOmit)},
+			expected: "system.cpu.idle",
+		},
+		{
+			name: "builder overrides build option",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").EmptyScope(metric.ScopeWildcard)
+			},
+			opts:     []metric.BuildOption{metric.WithEmptyScope(metric.ScopeOmit)},
+			expected: "system.cpu.idle{*}",
+		},
+		{
+			name: "filters are always rendered",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").Filter(metric.NewFilterBuilder("host").Equal("web-1"))
+			},
+			opts:     []metric.BuildOption{metric.WithEmptyScope(metric.ScopeOmit)},
+			expected: "system.cpu.idle{host:web-1}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().BuildWithOptions(tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGroupByEdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() (metric.QueryBuilder, error)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "group by all replaces keys",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").GroupBy("host").GroupByAll(), nil
+			},
+			expected: "system.cpu.idle{*} by {*}",
+		},
+		{
+			name: "clear parsed grouping",
+			builder: func() (metric.QueryBuilder, error) {
+				b, err := metric.ParseQuery("avg:system.cpu.idle{env:prod} by {host,pod_name}")
+				if err != nil {
+					return nil, err
+				}
+				return b.ClearGroupBy(), nil
+			},
+			expected: "avg:system.cpu.idle{env:prod}",
+		},
+		{
+			name: "regroup after clearing",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").GroupBy("host").ClearGroupBy().GroupBy("env"), nil
+			},
+			expected: "system.cpu.idle{*} by {env}",
+		},
+		{
+			name: "error - wildcard combined with keys",
+			builder: func() (metric.QueryBuilder, error) {
+				return metric.NewMetricQueryBuilder().Metric("system.cpu.idle").GroupByAll().GroupBy("host"), nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.builder()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := b.Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClearGroupByOnClone(t *testing.T) {
+	base := metric.NewMetricQueryBuilder().Metric("system.cpu.idle").GroupBy("host")
+	clone := base.Clone().ClearGroupBy()
+
+	if got, _ := clone.Build(); got != "system.cpu.idle{*}" {
+		t.Errorf("clone got %q", got)
+	}
+	if got, _ := base.Build(); got != "system.cpu.idle{*} by {host}" {
+		t.Errorf("original modified: got %q", got)
+	}
+}
+
+func TestScopeBuilder(t *testing.T) {
+	scope := metric.NewScopeBuilder().
+		Filter(metric.NewFilterBuilder("env").Equal("prod")).
+		Filter(metric.NewFilterBuilder("team").Equal("core"))
+
+	cpu := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.idle").Scope(scope).
+		Filter(metric.NewFilterBuilder("host").Equal("web-1"))
+	mem := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.mem.used").Scope(scope)
+	snapshot := metric.NewMetricQueryBuilder().Metric("system.load.1").Scope(scope.Clone())
+	frozen := metric.NewMetricQueryBuilder().Metric("system.load.5").Scope(scope).Freeze()
+	expr, err := metric.ParseQuery("sum:requests.errors{*} / sum:requests.total{*}")
+	if err != nil {
+		t.Fatalf("ParseQuery() error: %v", err)
+	}
+	expr.Scope(scope)
+
+	scope.Clear().Filters(metric.Tags(map[string]string{"env": "staging", "team": "core"})...)
+
+	tests := []struct {
+		name     string
+		builder  metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "scope renders ahead of own filters",
+			builder:  cpu,
+			expected: "avg:system.cpu.idle{env:staging, team:core, host:web-1}",
+		},
+		{
+			name:     "scope change reaches every query",
+			builder:  mem,
+			expected: "avg:system.mem.used{env:staging, team:core}",
+		},
+		{
+			name:     "cloned scope is a snapshot",
+			builder:  snapshot,
+			expected: "system.load.1{env:prod, team:core}",
+		},
+		{
+			name:     "frozen query keeps its scope",
+			builder:  frozen,
+			expected: "system.load.5{env:prod, team:core}",
+		},
+		{
+			name:     "scope applies to every query in an expression",
+			builder:  expr,
+			expected: "sum:requests.errors{*, env:staging, team:core} / sum:requests.total{*, env:staging, team:core}",
+		},
+		{
+			name:     "nil detaches the scope",
+			builder:  mem.Clone().Scope(nil),
+			expected: "avg:system.mem.used{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package metric
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// ParseOption customizes a single call to ParseQuery.
+type ParseOption func(*parseOptions)
+
+// parseOptions collects the settings applied by ParseOptions.
+type parseOptions struct {
+	preserveFormatting bool
+}
+
+// newParseOptions applies opts to a zero parseOptions.
+func newParseOptions(opts []ParseOption) parseOptions {
+	var o parseOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// PreserveFormatting records how the query was written, so that Build
+// returns it byte for byte until it is edited. Edits re-render only the
+// parts of the query they change: the aggregator and time window, the
+// metric name, the filters, the group by and the functions. The spacing,
+// separators and comma-or-AND style of the other parts are kept. It
+// applies to Build, BuildContext and BuildWithDiagnostics, not to builds
+// with parameters or other options.
+func PreserveFormatting() ParseOption {
+	return func(o *parseOptions) {
+		o.preserveFormatting = true
+	}
+}
+
+// Parts of a metric query that PreserveFormatting re-renders separately.
+const (
+	partPrefix    = iota // aggregator and time window: avg(5m):
+	partMetric           // metric name
+	partFilters          // {...}
+	partGroupBy          // by {...}, with the space before it
+	partFunctions        // .fill(zero).rollup(60)
+	numQueryParts
+)
+
+// queryParts is a metric query split into its parts, which concatenate
+// back to the query.
+type queryParts [numQueryParts]string
+
+// querySource is the text a query was parsed from, kept by
+// PreserveFormatting, and the query as the builder first rendered it.
+type querySource struct {
+	text     string
+	rendered string
+}
+
+// restore returns rendered with each part that is unchanged since the
+// query was parsed replaced by the text it was parsed from. If either
+// query cannot be split into parts, rendered is returned whole unless it
+// is unchanged.
+func (s *querySource) restore(rendered string) string {
+	if rendered == s.rendered {
+		return s.text
+	}
+	text, ok := splitQuery(s.text)
+	if !ok {
+		return rendered
+	}
+	base, ok := splitQuery(s.rendered)
+	if !ok {
+		return rendered
+	}
+	now, ok := splitQuery(rendered)
+	if !ok {
+		return rendered
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(rendered))
+	for i := range now {
+		if now[i] == base[i] {
+			sb.WriteString(text[i])
+		} else {
+			sb.WriteString(now[i])
+		}
+	}
+	return sb.String()
+}
+
+// preserveSource records query as the source of b, parsed with
+// PreserveFormatting. Builders that do not build are left without one.
+func preserveSource(b QueryBuilder, query string) {
+	mb, ok := b.(*metricQueryBuilder)
+	if !ok {
+		return
+	}
+	rendered, err := mb.Build()
+	if err != nil {
+		return
+	}
+	mb.source = &querySource{text: query, rendered: rendered}
+}
+
+// standard reports whether o renders queries as Build does, so that a
+// parsed query's original formatting can be restored.
+func (o buildOptions) standard() bool {
+	return o.params == nil && !o.sortFilters && !o.dedup &&
+		o.listQuoting == QuoteAsNeeded && o.negation == NegationBang &&
+		o.format == FormatStandard && o.emptyScope == ScopeDefault
+}
+
+// queryHeadPattern matches the text of a metric query before its filters:
+// an optional aggregator and time window, then the metric name.
+var queryHeadPattern = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*(?:\([^()]*\))?:)?([a-zA-Z0-9_.]+)$`)
+
+// splitQuery splits query, which must be a single metric query without
+// wrappers, into its parts.
+func splitQuery(query string) (queryParts, bool) {
+	parts, n, ok := scanQuery(query)
+	return parts, ok && n == len(query)
+}
+
+// scanQuery splits the metric query at the start of s into its parts,
+// returning them and the length of the query. Text after the query, such
+// as the rest of an expression, is not consumed.
+func scanQuery(s string) (parts queryParts, n int, ok bool) {
+	open := strings.IndexByte(s, '{')
+	if open < 0 {
+		return parts, 0, false
+	}
+	m := queryHeadPattern.FindStringSubmatch(s[:open])
+	if m == nil {
+		return parts, 0, false
+	}
+	closing, ok := matchClosing(s, open)
+	if !ok {
+		return parts, 0, false
+	}
+	parts[partPrefix], parts[partMetric] = m[1], m[2]
+	parts[partFilters] = s[open : closing+1]
+	i := closing + 1
+
+	// Group by: by {...}, with optional spaces around by
+	j := i
+	for j < len(s) && s[j] == ' ' {
+		j++
+	}
+	if strings.HasPrefix(s[j:], "by") {
+		j += len("by")
+		for j < len(s) && s[j] == ' ' {
+			j++
+		}
+		if j < len(s) && s[j] == '{' {
+			if end, ok := matchClosing(s, j); ok {
+				parts[partGroupBy] = s[i : end+1]
+				i = end + 1
+			}
+		}
+	}
+
+	// Functions: .name(args), repeated
+	start := i
+	for i < len(s) && s[i] == '.' {
+		j := i + 1
+		for j < len(s) && isIdentByte(s[j]) {
+			j++
+		}
+		if j == i+1 || j >= len(s) || s[j] != '(' {
+			break
+		}
+		end, ok := matchClosing(s, j)
+		if !ok {
+			break
+		}
+		i = end + 1
+	}
+	parts[partFunctions] = s[start:i]
+	return parts, i, true
+}
+
+// matchClosing returns the index of the bracket closing the one at
+// s[open], skipping over quoted strings.
+func matchClosing(s string, open int) (int, bool) {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '{', '(':
+			depth++
+		case '}', ')':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isIdentByte reports whether c may appear in a function name.
+func isIdentByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// spliceSubQueries returns the original expression with the metric
+// queries that were edited, those whose entry in edited is set, replaced
+// by their new text and everything else kept as written. It reports false
+// if a metric query cannot be located in the original text.
+func (b *expressionQueryBuilder) spliceSubQueries(edited []string) (string, bool) {
+	parsed, err := parseGeneric(b.original)
+	if err != nil {
+		return "", false
+	}
+
+	var (
+		sb   strings.Builder
+		last int
+		i    int
+		ok   = true
+	)
+	walkSubQueries(parsed, func(node *ddqp.MetricQuery) {
+		defer func() { i++ }()
+		if !ok || i >= len(edited) || edited[i] == "" {
+			return
+		}
+		start, translated := nodeOffset(b.original, node.Query.Pos.Offset)
+		if !translated || start < last {
+			ok = false
+			return
+		}
+		_, n, scanned := scanQuery(b.original[start:])
+		if !scanned {
+			ok = false
+			return
+		}
+		sb.WriteString(b.original[last:start])
+		sb.WriteString(edited[i])
+		last = start + n
+	})
+	if !ok {
+		return "", false
+	}
+	sb.WriteString(b.original[last:])
+	return sb.String(), true
+}
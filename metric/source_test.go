@@ -0,0 +1,125 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestPreserveFormatting(t *testing.T) {
+	env := func() metric.FilterBuilder { return metric.NewFilterBuilder("env").Equal("prod") }
+
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "unmodified query",
+			query:    "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host,env}.fill(zero).rollup(60,avg)",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q },
+			expected: "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host,env}.fill(zero).rollup(60,avg)",
+		},
+		{
+			name:     "unmodified explicit AND",
+			query:    "sum:requests{env:prod AND service:web}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q },
+			expected: "sum:requests{env:prod AND service:web}",
+		},
+		{
+			name:     "unmodified wrapped query",
+			query:    "per_second(sum:requests{env:prod,service:web})",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q },
+			expected: "per_second(sum:requests{env:prod,service:web})",
+		},
+		{
+			name:     "edited group by keeps filters and functions",
+			query:    "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}.rollup(60,avg)",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.GroupBy("env") },
+			expected: "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host, env}.rollup(60,avg)",
+		},
+		{
+			name:     "edited time window keeps the rest",
+			query:    "avg(5m):system.cpu.idle{host:web-1,env:prod} by {host}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.TimeWindow("10m") },
+			expected: "avg(10m):system.cpu.idle{host:web-1,env:prod} by {host}",
+		},
+		{
+			name:     "edited filters keep group by and functions",
+			query:    "sum:requests{service:web} by {host,env}.fill(zero)",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Filter(env()) },
+			expected: "sum:requests{service:web, env:prod} by {host,env}.fill(zero)",
+		},
+		{
+			name:     "unmodified expression",
+			query:    "sum:errors{env:prod}.as_count()/sum:hits{env:prod}.as_count()",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q },
+			expected: "sum:errors{env:prod}.as_count()/sum:hits{env:prod}.as_count()",
+		},
+		{
+			name:  "edited expression query keeps the others",
+			query: "sum:errors{env:prod,service:web}.as_count()/sum:hits{env:prod,service:web}.as_count()",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[1].Metric("requests")
+				return q
+			},
+			expected: "sum:errors{env:prod,service:web}.as_count()/sum:requests{env:prod,service:web}.as_count()",
+		},
+		{
+			name:     "windowed expression",
+			query:    "avg(5m):sum:errors{env:prod,service:web} /  sum:hits{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Aggregator("max") },
+			expected: "avg(5m):max:errors{env:prod,service:web} /  max:hits{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query, metric.PreserveFormatting())
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPreserveFormattingOptions(t *testing.T) {
+	const query = "system.cpu.idle{host:web-1,env:prod} by {host,env}"
+	builder, err := metric.ParseQuery(query, metric.PreserveFormatting())
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	// Build options other than the defaults render the query afresh
+	got, err := builder.BuildWithOptions(metric.WithFormat(metric.FormatStandard))
+	if err != nil {
+		t.Fatalf("BuildWithOptions() error = %v", err)
+	}
+	if got != query {
+		t.Errorf("BuildWithOptions(FormatStandard) = %q, want %q", got, query)
+	}
+	got, err = builder.BuildWithOptions(metric.WithSortedFilters())
+	if err != nil {
+		t.Fatalf("BuildWithOptions() error = %v", err)
+	}
+	if want := "system.cpu.idle{env:prod, host:web-1} by {host, env}"; got != want {
+		t.Errorf("BuildWithOptions(WithSortedFilters) = %q, want %q", got, want)
+	}
+
+	// Without the option the query is normalized
+	plain, err := metric.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if got, _ := plain.Build(); got != "system.cpu.idle{host:web-1, env:prod} by {host, env}" {
+		t.Errorf("Build() without PreserveFormatting = %q", got)
+	}
+}
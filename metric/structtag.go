@@ -0,0 +1,185 @@
+package metric
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// structTagName is the struct tag key read by FromStruct.
+const structTagName = "ddqb"
+
+// FromStruct converts a tagged struct (or pointer to struct) into a query
+// builder, allowing queries to be defined declaratively and embedded in
+// application configuration.
+//
+// Query-level settings are given on any field, conventionally a blank
+// one, whose tag contains metric=:
+//
+//	_ struct{} `ddqb:"metric=system.cpu.idle,agg=avg,window=5m,by=host|env"`
+//
+// Group by keys are separated with '|' because ',' separates tag options.
+// Other fields map to filters or functions according to their tag:
+//
+//	Host    string   `ddqb:"filter=host"`         // host:<value>
+//	Regions []string `ddqb:"filter=region"`       // region IN (<values>)
+//	Exclude string   `ddqb:"filter=service,not"` // !service:<value>
+//	Rollup  []string `ddqb:"function=rollup"`     // .rollup(<values>)
+//
+// Filter and function fields must be of string or []string type. Fields
+// holding an empty string or empty slice are skipped, so optional filters
+// need no extra handling. Anonymous embedded structs are walked
+// recursively, and fields without a ddqb tag are ignored.
+func FromStruct(v any) (QueryBuilder, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, &ValidationError{Component: "struct", Value: fmt.Sprintf("%T", v), Reason: "nil pointer"}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, &ValidationError{Component: "struct", Value: fmt.Sprintf("%T", v), Reason: "value must be a struct or pointer to struct"}
+	}
+
+	builder := NewMetricQueryBuilder()
+	hasMetric := false
+	if err := applyStructFields(builder, rv, &hasMetric); err != nil {
+		return nil, err
+	}
+	if !hasMetric {
+		return nil, &ValidationError{Component: "struct", Value: rv.Type().String(), Reason: "no field tagged with metric="}
+	}
+	return builder, nil
+}
+
+// applyStructFields applies the tagged fields of rv to builder.
+func applyStructFields(builder QueryBuilder, rv reflect.Value, hasMetric *bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup(structTagName)
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := applyStructFields(builder, rv.Field(i), hasMetric); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+
+		opts, err := parseStructTag(tag)
+		if err != nil {
+			return &ValidationError{Component: "struct tag", Value: field.Name, Reason: err.Error()}
+		}
+
+		switch {
+		case opts["metric"] != "":
+			if *hasMetric {
+				return &ValidationError{Component: "struct tag", Value: field.Name, Reason: "metric= is set on more than one field"}
+			}
+			*hasMetric = true
+			applyQueryTag(builder, opts)
+
+		case opts["filter"] != "":
+			values, err := structFieldValues(field, rv.Field(i))
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 {
+				continue
+			}
+			builder.Filter(structFilter(opts["filter"], values, field.Type.Kind() == reflect.Slice, hasOption(opts, "not")))
+
+		case opts["function"] != "":
+			values, err := structFieldValues(field, rv.Field(i))
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 {
+				continue
+			}
+			builder.ApplyFunction(NewFunctionBuilder(opts["function"]).WithArgs(values...))
+
+		default:
+			return &ValidationError{Component: "struct tag", Value: field.Name, Reason: "tag must set one of metric=, filter= or function="}
+		}
+	}
+	return nil
+}
+
+// applyQueryTag applies the query-level settings in opts to builder.
+func applyQueryTag(builder QueryBuilder, opts map[string]string) {
+	builder.Metric(opts["metric"])
+	if agg := opts["agg"]; agg != "" {
+		builder.Aggregator(agg)
+	}
+	if window := opts["window"]; window != "" {
+		builder.TimeWindow(window)
+	}
+	if by := opts["by"]; by != "" {
+		builder.GroupBy(strings.Split(by, "|")...)
+	}
+}
+
+// structFilter returns the filter for key matching values. Slice fields
+// produce IN filters even when they hold a single value.
+func structFilter(key string, values []string, list, negate bool) FilterBuilder {
+	f := NewFilterBuilder(key)
+	switch {
+	case list && negate:
+		return f.NotIn(values...)
+	case list:
+		return f.In(values...)
+	case negate:
+		return f.NotEqual(values[0])
+	default:
+		return f.Equal(values[0])
+	}
+}
+
+// structFieldValues returns the non-empty values held by a string or
+// []string field.
+func structFieldValues(field reflect.StructField, v reflect.Value) ([]string, error) {
+	switch {
+	case v.Kind() == reflect.String:
+		if v.String() == "" {
+			return nil, nil
+		}
+		return []string{v.String()}, nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		values := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).String())
+		}
+		return values, nil
+	}
+	return nil, &ValidationError{Component: "struct field", Value: field.Name, Reason: fmt.Sprintf("unsupported type %s, must be string or []string", field.Type)}
+}
+
+// parseStructTag splits a ddqb tag into its options. key=value options map
+// key to value; bare options map to the empty string.
+func parseStructTag(tag string) (map[string]string, error) {
+	opts := make(map[string]string)
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		if _, dup := opts[key]; dup {
+			return nil, fmt.Errorf("option %q is repeated", key)
+		}
+		opts[key] = value
+	}
+	return opts, nil
+}
+
+// hasOption reports whether the bare option name is present in opts.
+func hasOption(opts map[string]string, name string) bool {
+	_, ok := opts[name]
+	return ok
+}
@@ -0,0 +1,114 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+type cpuQuery struct {
+	_       struct{} `ddqb:"metric=system.cpu.idle,agg=avg,window=5m,by=host|env"`
+	Env     string   `ddqb:"filter=env"`
+	Regions []string `ddqb:"filter=region"`
+	Exclude string   `ddqb:"filter=service,not"`
+	Rollup  []string `ddqb:"function=rollup"`
+	Note    string
+}
+
+type commonFilters struct {
+	Team string `ddqb:"filter=team"`
+}
+
+type embeddedQuery struct {
+	commonFilters
+	_ struct{} `ddqb:"metric=requests.count,agg=sum"`
+}
+
+func TestFromStruct(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    any
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "all fields set",
+			input: cpuQuery{
+				Env:     "prod",
+				Regions: []string{"us-east-1", "us-west-2"},
+				Exclude: "canary",
+				Rollup:  []string{"60", "avg"},
+				Note:    "ignored",
+			},
+			expected: "avg(5m):system.cpu.idle{env:prod, region IN (us-east-1,us-west-2), !service:canary} by {host, env}.rollup(60, avg)",
+			wantErr:  false,
+		},
+		{
+			name:     "empty fields are skipped",
+			input:    &cpuQuery{Env: "staging"},
+			expected: "avg(5m):system.cpu.idle{env:staging} by {host, env}",
+			wantErr:  false,
+		},
+		{
+			name:     "embedded struct",
+			input:    embeddedQuery{commonFilters: commonFilters{Team: "core"}},
+			expected: "sum:requests.count{team:core}",
+			wantErr:  false,
+		},
+		{
+			name:    "error - not a struct",
+			input:   "system.cpu.idle",
+			wantErr: true,
+		},
+		{
+			name:    "error - nil pointer",
+			input:   (*cpuQuery)(nil),
+			wantErr: true,
+		},
+		{
+			name: "error - no metric tag",
+			input: struct {
+				Host string `ddqb:"filter=host"`
+			}{Host: "web-1"},
+			wantErr: true,
+		},
+		{
+			name: "error - unsupported field type",
+			input: struct {
+				_    struct{} `ddqb:"metric=system.cpu.idle"`
+				Port int      `ddqb:"filter=port"`
+			}{Port: 80},
+			wantErr: true,
+		},
+		{
+			name: "error - tag without a role",
+			input: struct {
+				_    struct{} `ddqb:"metric=system.cpu.idle"`
+				Host string   `ddqb:"not"`
+			}{Host: "web-1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.FromStruct(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatalf("unexpected build error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
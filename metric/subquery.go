@@ -0,0 +1,138 @@
+package metric
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jonwinton/ddqp"
+)
+
+// newExpressionBuilder returns an expression builder for query, whose parsed
+// form is parsed, with a structured builder bound to each of its metric
+// queries. If any metric query cannot be represented by a structured
+// builder, none are bound and the expression can only be edited as a whole.
+// If preserve is set, parsed must have been parsed from query, and edits
+// to the metric queries keep the formatting of the rest of the expression,
+// as PreserveFormatting describes.
+func newExpressionBuilder(query string, parsed *ddqp.GenericQuery, preserve bool) QueryBuilder {
+	b := newExpressionPassthroughBuilder(query).(*expressionQueryBuilder)
+	b.preserve = preserve
+
+	var (
+		queries []QueryBuilder
+		bases   []string
+		failed  bool
+	)
+	walkSubQueries(parsed, func(node *ddqp.MetricQuery) {
+		if failed {
+			return
+		}
+		sub, err := fromQuery(node.Query, "")
+		if err != nil {
+			failed = true
+			return
+		}
+		if start, ok := nodeOffset(query, node.Query.Pos.Offset); preserve && ok {
+			if _, n, ok := scanQuery(query[start:]); ok {
+				preserveSource(sub, query[start:start+n])
+			}
+		}
+		base, err := sub.Build()
+		if err != nil {
+			failed = true
+			return
+		}
+		queries = append(queries, sub)
+		bases = append(bases, base)
+	})
+	if !failed {
+		b.queries, b.queryBases = queries, bases
+	}
+	return b
+}
+
+// SubQueries returns a structured builder for each metric query in the
+// expression, in the order they appear. Changes made through them apply to
+// the expression on the next Build; queries that are left unchanged keep
+// their original text. A frozen builder returns frozen sub-queries. The
+// result is empty if a metric query of the expression uses syntax the
+// structured builder cannot represent.
+func (b *expressionQueryBuilder) SubQueries() []QueryBuilder {
+	return slices.Clone(b.queries)
+}
+
+// SubQueries returns the query itself, as the only metric query it
+// contains.
+func (b *metricQueryBuilder) SubQueries() []QueryBuilder {
+	return []QueryBuilder{b}
+}
+
+// editedSubQueries builds the sub-queries of the expression and parses
+// those that changed since the expression was parsed, returning their text
+// and parsed form indexed as b.queries. It returns nils if none changed.
+func (b *expressionQueryBuilder) editedSubQueries() ([]string, []*ddqp.MetricQuery, error) {
+	var (
+		texts  []string
+		edited []*ddqp.MetricQuery
+	)
+	for i, sub := range b.queries {
+		query, err := sub.Build()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error building sub-query %d: %w", i, err)
+		}
+		if query == b.queryBases[i] {
+			continue
+		}
+		parsed, err := parseGeneric(query)
+		if err != nil {
+			return nil, nil, newParseError(query, query, err)
+		}
+		if parsed.MetricQuery == nil {
+			return nil, nil, &ValidationError{Component: "sub-query", Value: query, Reason: "must be a single metric query"}
+		}
+		if edited == nil {
+			texts = make([]string, len(b.queries))
+			edited = make([]*ddqp.MetricQuery, len(b.queries))
+		}
+		texts[i] = query
+		edited[i] = parsed.MetricQuery
+	}
+	return texts, edited, nil
+}
+
+// replaceSubQueries replaces each metric query of parsed whose entry in
+// edited is set.
+func replaceSubQueries(parsed *ddqp.GenericQuery, edited []*ddqp.MetricQuery) {
+	i := 0
+	walkSubQueries(parsed, func(node *ddqp.MetricQuery) {
+		if i < len(edited) && edited[i] != nil {
+			*node = *edited[i]
+		}
+		i++
+	})
+}
+
+// walkSubQueries calls fn with the innermost node of every metric query in
+// parsed, the one holding its ddqp.Query, in the order they appear.
+func walkSubQueries(parsed *ddqp.GenericQuery, fn func(*ddqp.MetricQuery)) {
+	switch {
+	case parsed.MetricQuery != nil:
+		if node := innermostQuery(parsed.MetricQuery); node != nil {
+			fn(node)
+		}
+	case parsed.MetricExpression != nil:
+		walkQueryNodes(parsed.MetricExpression.GroupedExpression, fn)
+	}
+}
+
+// cloneSubQueries returns a deep copy of queries.
+func cloneSubQueries(queries []QueryBuilder) []QueryBuilder {
+	if queries == nil {
+		return nil
+	}
+	out := make([]QueryBuilder, len(queries))
+	for i, q := range queries {
+		out[i] = q.Clone()
+	}
+	return out
+}
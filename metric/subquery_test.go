@@ -0,0 +1,258 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestSubQueries(t *testing.T) {
+	env := func() metric.FilterBuilder { return metric.NewFilterBuilder("env").Equal("prod") }
+
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:  "unmodified expression keeps its text",
+			query: "sum:errors{*}.rollup(sum, 60)/sum:hits{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				_ = q.SubQueries()
+				return q
+			},
+			expected: "sum:errors{*}.rollup(sum, 60)/sum:hits{*}",
+		},
+		{
+			name:  "filter one operand",
+			query: "sum:errors{*} / sum:hits{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[1].Filter(env())
+				return q
+			},
+			expected: "sum:errors{*} / sum:hits{env:prod}",
+		},
+		{
+			name:  "regroup query inside wrapper",
+			query: "moving_rollup(sum:requests{*}, 60) * 100",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[0].GroupBy("service")
+				return q
+			},
+			expected: "moving_rollup(sum:requests{*} by {service}, 60) * 100",
+		},
+		{
+			name:  "edit nested operand",
+			query: "(sum:a{*} + sum:b{*}) / sum:c{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[1].Metric("d")
+				return q
+			},
+			expected: "(sum:a{*} + sum:d{*}) / sum:c{*}",
+		},
+		{
+			name:  "wrap one operand",
+			query: "sum:errors{*} / sum:hits{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[0].WrapWith(metric.Abs())
+				return q
+			},
+			expected: "abs(sum:errors{*}) / sum:hits{*}",
+		},
+		{
+			name:  "combined with expression filter",
+			query: "sum:errors{*} / sum:hits{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[0].Metric("faults")
+				return q.Filter(env())
+			},
+			expected: "sum:faults{*, env:prod} / sum:hits{*, env:prod}",
+		},
+		{
+			name:  "query inside unstructured wrapper",
+			query: "top(sum:requests{*} by {service}, 10, 'mean', 'desc')",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				q.SubQueries()[0].Filter(env())
+				return q
+			},
+			expected: "top(sum:requests{env:prod} by {service}, 10, 'mean', 'desc')",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSubQueriesCount(t *testing.T) {
+	q, err := metric.ParseQuery("(sum:a{*} + sum:b{*}) / abs(sum:c{*} - 1)")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if got := len(q.SubQueries()); got != 3 {
+		t.Errorf("len(SubQueries()) = %d, want 3", got)
+	}
+
+	single := metric.NewMetricQueryBuilder().Metric("system.cpu.user")
+	if subs := single.SubQueries(); len(subs) != 1 || subs[0] != single {
+		t.Errorf("SubQueries() = %v, want the query itself", subs)
+	}
+}
+
+func TestSubQueriesIsolation(t *testing.T) {
+	const query = "sum:errors{*} / sum:hits{*}"
+	base, err := metric.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	clone := base.Clone()
+	clone.SubQueries()[0].Metric("faults")
+	if got, _ := base.Build(); got != query {
+		t.Errorf("editing a clone changed the original: %q", got)
+	}
+	if got, _ := clone.Build(); got != "sum:faults{*} / sum:hits{*}" {
+		t.Errorf("clone Build() = %q", got)
+	}
+
+	frozen := base.Freeze()
+	frozen.SubQueries()[0].Metric("faults")
+	if got, err := frozen.Build(); err != nil || got != query {
+		t.Errorf("frozen Build() = %q, %v, want %q", got, err, query)
+	}
+}
+
+func TestExpressionAggregator(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "every query",
+			query:    "avg:requests.errors{*} / avg:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Aggregator("sum") },
+			expected: "sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:     "time window prefix is kept",
+			query:    "avg(5m):avg:requests.errors{*} / avg:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Aggregator("sum") },
+			expected: "avg(5m):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:  "by index",
+			query: "avg:requests.errors{*} / avg:requests.total{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.AggregatorWhere("sum", func(i int, _ metric.QueryBuilder) bool { return i == 1 })
+			},
+			expected: "avg:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:  "by predicate",
+			query: "(avg:requests.errors{env:prod} + avg:requests.retries{*}) / avg:requests.total{env:prod}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.AggregatorWhere("sum", func(_ int, sub metric.QueryBuilder) bool {
+					return sub.HasFilter("env")
+				})
+			},
+			expected: "(sum:requests.errors{env:prod} + avg:requests.retries{*}) / sum:requests.total{env:prod}",
+		},
+		{
+			name:  "single query",
+			query: "avg:requests.total{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.AggregatorWhere("sum", func(i int, _ metric.QueryBuilder) bool { return i == 0 })
+			},
+			expected: "sum:requests.total{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpressionApplyFunction(t *testing.T) {
+	rollup := func() metric.FunctionBuilder { return metric.NewFunctionBuilder("rollup").WithArg("300") }
+
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+	}{
+		{
+			name:     "whole expression",
+			query:    "sum:errors{*} / sum:hits{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.ApplyFunction(rollup()) },
+			expected: "(sum:errors{*} / sum:hits{*}).rollup(300)",
+		},
+		{
+			name:     "every query",
+			query:    "sum:errors{*} / sum:hits{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.ApplyFunctionToQueries(rollup()) },
+			expected: "sum:errors{*}.rollup(300) / sum:hits{*}.rollup(300)",
+		},
+		{
+			name:     "after existing functions",
+			query:    "sum:errors{*}.fill(zero) / sum:hits{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.ApplyFunctionToQueries(rollup()) },
+			expected: "sum:errors{*}.fill(zero).rollup(300) / sum:hits{*}.rollup(300)",
+		},
+		{
+			name:     "queries inside wrappers",
+			query:    "abs(sum:errors{*}) * 100",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.ApplyFunctionToQueries(rollup()) },
+			expected: "abs(sum:errors{*}.rollup(300)) * 100",
+		},
+		{
+			name:     "single query",
+			query:    "sum:errors{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.ApplyFunctionToQueries(rollup()) },
+			expected: "sum:errors{*}.rollup(300)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
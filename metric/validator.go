@@ -0,0 +1,40 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Validator checks a rendered query, typically by consulting a service
+// outside the process such as a remote query validator or a schema
+// registry of known metrics and tags. Validators run after a query has
+// been built successfully and must honor ctx cancellation and deadlines.
+type Validator interface {
+	// Validate returns an error if query is not acceptable.
+	Validate(ctx context.Context, query string) error
+}
+
+// ValidatorFunc adapts an ordinary function to the Validator interface.
+type ValidatorFunc func(ctx context.Context, query string) error
+
+// Validate calls f(ctx, query).
+func (f ValidatorFunc) Validate(ctx context.Context, query string) error {
+	return f(ctx, query)
+}
+
+// runValidators runs every validator against query, returning every
+// failure joined into a single error. It stops early if ctx is done.
+func runValidators(ctx context.Context, validators []Validator, query string) error {
+	var errs []error
+	for _, v := range validators {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := v.Validate(ctx, query); err != nil {
+			errs = append(errs, fmt.Errorf("validator: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package metric_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestValidators(t *testing.T) {
+	errUnknownMetric := errors.New("metric not in registry")
+	registry := metric.ValidatorFunc(func(_ context.Context, query string) error {
+		if query != "system.cpu.idle{*}" {
+			return errUnknownMetric
+		}
+		return nil
+	})
+	cfg := metric.Config{Validators: []metric.Validator{registry}}
+
+	if err := metric.NewMetricQueryBuilder().Metric("system.cpu.idle").WithConfig(cfg).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	query, err := metric.NewMetricQueryBuilder().Metric("system.cpu.typo").WithConfig(cfg).Build()
+	if !errors.Is(err, errUnknownMetric) {
+		t.Errorf("expected registry error, got %v", err)
+	}
+	if query != "" {
+		t.Errorf("expected empty query on error, got %q", query)
+	}
+}
+
+func TestValidatorsSkippedOnBuildError(t *testing.T) {
+	called := false
+	cfg := metric.Config{Validators: []metric.Validator{
+		metric.ValidatorFunc(func(context.Context, string) error {
+			called = true
+			return nil
+		}),
+	}}
+
+	if err := metric.NewMetricQueryBuilder().WithConfig(cfg).Validate(); !errors.Is(err, metric.ErrMissingMetric) {
+		t.Errorf("expected ErrMissingMetric, got %v", err)
+	}
+	if called {
+		t.Error("validator should not run when the query fails to build")
+	}
+}
+
+func TestBuildContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := metric.NewMetricQueryBuilder().Metric("system.cpu.idle").BuildContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	expr, err := metric.ParseQuery("sum:a{*} + sum:b{*}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := expr.ValidateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled for expression, got %v", err)
+	}
+}
+
+func TestValidateContextDeadline(t *testing.T) {
+	slow := metric.ValidatorFunc(func(ctx context.Context, _ string) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	cfg := metric.Config{Validators: []metric.Validator{slow}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := metric.NewMetricQueryBuilder().Metric("system.cpu.idle").WithConfig(cfg).ValidateContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package metric
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evaluationWindowPrefix marks a time window as a monitor evaluation
+// window, as in avg(last_5m):.
+const evaluationWindowPrefix = "last_"
+
+// evaluationWindowPattern matches evaluation windows such as last_5m.
+var evaluationWindowPattern = regexp.MustCompile(`^last_([1-9][0-9]*)([mhdw])$`)
+
+// maxEvaluationWindow is the largest count Datadog accepts for each
+// evaluation window unit: one week for minutes, hours and days, and four
+// weeks for weeks.
+var maxEvaluationWindow = map[string]int{
+	"m": 10080,
+	"h": 168,
+	"d": 7,
+	"w": 4,
+}
+
+// EvaluationWindow sets the monitor evaluation window for the query, as in
+// avg(last_5m):. The "last_" prefix may be omitted. The window is validated
+// against the ranges Datadog accepts when the query is built.
+func (b *metricQueryBuilder) EvaluationWindow(window string) QueryBuilder {
+	b = b.mutable("EvaluationWindow")
+	if !strings.HasPrefix(window, evaluationWindowPrefix) {
+		window = evaluationWindowPrefix + window
+	}
+	b.timeWindow = window
+	return b
+}
+
+// Last sets the monitor evaluation window for the query to d, rendered in
+// the largest unit that divides it exactly (e.g. 90*time.Minute becomes
+// last_90m and 2*time.Hour becomes last_2h). d must be a whole number of
+// minutes.
+func (b *metricQueryBuilder) Last(d time.Duration) QueryBuilder {
+	b = b.mutable("Last")
+	b.timeWindow = formatEvaluationWindow(d)
+	return b
+}
+
+// ValidateEvaluationWindow reports whether window is an evaluation window
+// Datadog accepts: last_#m, last_#h or last_#d of at most one week, or
+// last_#w of at most four weeks.
+func ValidateEvaluationWindow(window string) error {
+	m := evaluationWindowPattern.FindStringSubmatch(window)
+	if m == nil {
+		return &ValidationError{Component: "evaluation window", Value: window, Reason: "must be of the form last_<n><m|h|d|w>"}
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n > maxEvaluationWindow[m[2]] {
+		return &ValidationError{
+			Component: "evaluation window",
+			Value:     window,
+			Reason:    fmt.Sprintf("must be at most last_%d%s", maxEvaluationWindow[m[2]], m[2]),
+		}
+	}
+	return nil
+}
+
+// validateTimeWindow checks the time window if it is an evaluation window.
+// Plain windows such as 5m are passed through unchecked.
+func validateTimeWindow(window string) error {
+	if !strings.HasPrefix(window, evaluationWindowPrefix) {
+		return nil
+	}
+	return ValidateEvaluationWindow(window)
+}
+
+// formatEvaluationWindow renders d as an evaluation window. Durations that
+// are not a positive whole number of minutes are rendered in seconds so
+// that validation reports them with their original value.
+func formatEvaluationWindow(d time.Duration) string {
+	if d <= 0 || d%time.Minute != 0 {
+		return evaluationWindowPrefix + strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	week := 7 * 24 * time.Hour
+	day := 24 * time.Hour
+	switch {
+	case d%week == 0:
+		return fmt.Sprintf("%s%dw", evaluationWindowPrefix, d/week)
+	case d%day == 0:
+		return fmt.Sprintf("%s%dd", evaluationWindowPrefix, d/day)
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%s%dh", evaluationWindowPrefix, d/time.Hour)
+	default:
+		return fmt.Sprintf("%s%dm", evaluationWindowPrefix, d/time.Minute)
+	}
+}
@@ -0,0 +1,249 @@
+package metric_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestEvaluationWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "explicit window",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").EvaluationWindow("last_5m").Metric("system.cpu.idle")
+			},
+			expected: "avg(last_5m):system.cpu.idle{*}",
+		},
+		{
+			name: "prefix added",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("max").EvaluationWindow("1h").Metric("system.cpu.idle")
+			},
+			expected: "max(last_1h):system.cpu.idle{*}",
+		},
+		{
+			name: "duration in minutes",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Last(90 * time.Minute).Metric("system.cpu.idle")
+			},
+			expected: "avg(last_90m):system.cpu.idle{*}",
+		},
+		{
+			name: "duration in hours",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Last(4 * time.Hour).Metric("system.cpu.idle")
+			},
+			expected: "avg(last_4h):system.cpu.idle{*}",
+		},
+		{
+			name: "duration in days",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Last(48 * time.Hour).Metric("system.cpu.idle")
+			},
+			expected: "avg(last_2d):system.cpu.idle{*}",
+		},
+		{
+			name: "duration in weeks",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Last(14 * 24 * time.Hour).Metric("system.cpu.idle")
+			},
+			expected: "avg(last_2w):system.cpu.idle{*}",
+		},
+		{
+			name: "plain time window is not validated",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").TimeWindow("30s").Metric("system.cpu.idle")
+			},
+			expected: "avg(30s):system.cpu.idle{*}",
+		},
+		{
+			name: "seconds are rejected",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").Last(30 * time.Second).Metric("system.cpu.idle")
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown unit",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").EvaluationWindow("last_1y").Metric("system.cpu.idle")
+			},
+			wantErr: true,
+		},
+		{
+			name: "too long",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("avg").EvaluationWindow("last_8d").Metric("system.cpu.idle")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().Build()
+			if tt.wantErr {
+				var verr *metric.ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("expected ValidationError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateEvaluationWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		wantErr bool
+	}{
+		{window: "last_1m"},
+		{window: "last_10080m"},
+		{window: "last_168h"},
+		{window: "last_7d"},
+		{window: "last_4w"},
+		{window: "5m", wantErr: true},
+		{window: "last_0m", wantErr: true},
+		{window: "last_10081m", wantErr: true},
+		{window: "last_169h", wantErr: true},
+		{window: "last_5w", wantErr: true},
+		{window: "last_30s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			err := metric.ValidateEvaluationWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEvaluationWindow(%q) error = %v, wantErr %v", tt.window, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseEvaluationWindow(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: "avg(last_5m):system.cpu.idle{*}"},
+		{query: "sum(last_1w):trace.http.request.errors{env:prod}"},
+		{query: "avg(last_9d):system.cpu.idle{*}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			got, err := builder.Build()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.query {
+				t.Errorf("got %q, want %q", got, tt.query)
+			}
+		})
+	}
+}
+
+func TestExpressionTimeWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		modify   func(metric.QueryBuilder) metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "unmodified",
+			query:    "avg(5m):sum:requests.errors{*} / sum:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q },
+			expected: "avg(5m):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:     "replace time window",
+			query:    "avg(5m):sum:requests.errors{*} / sum:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.TimeWindow("10m") },
+			expected: "avg(10m):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:     "replace evaluation window",
+			query:    "sum(last_5m):sum:requests.errors{*} / sum:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Last(time.Hour) },
+			expected: "sum(last_1h):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:  "window kept outside other edits",
+			query: "avg(last_5m):sum:requests.errors{*} / sum:requests.total{*}",
+			modify: func(q metric.QueryBuilder) metric.QueryBuilder {
+				return q.EvaluationWindow("15m").Filter(metric.NewFilterBuilder("env").Equal("prod")).WrapWith(metric.Abs())
+			},
+			expected: "avg(last_15m):abs(sum:requests.errors{*, env:prod} / sum:requests.total{*, env:prod})",
+		},
+		{
+			name:     "wrapped query",
+			query:    "max(last_1h):top(sum:requests.total{*} by {service}, 10, 'mean', 'desc')",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Last(4 * time.Hour) },
+			expected: "max(last_4h):top(sum:requests.total{*} by {service}, 10, 'mean', 'desc')",
+		},
+		{
+			name:    "error - invalid evaluation window",
+			query:   "avg(last_5m):sum:requests.errors{*} / sum:requests.total{*}",
+			modify:  func(q metric.QueryBuilder) metric.QueryBuilder { return q.EvaluationWindow("9d") },
+			wantErr: true,
+		},
+		{
+			name:     "expression without prefix",
+			query:    "sum:requests.errors{*} / sum:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.TimeWindow("5m") },
+			expected: "avg(5m):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+		{
+			name:     "evaluation window on expression without prefix",
+			query:    "sum:requests.errors{*} / sum:requests.total{*}",
+			modify:   func(q metric.QueryBuilder) metric.QueryBuilder { return q.Last(15 * time.Minute) },
+			expected: "avg(last_15m):sum:requests.errors{*} / sum:requests.total{*}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := metric.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			result, err := tt.modify(builder).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,625 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WrapperBuilder provides a fluent interface for building wrapping
+// functions, such as abs or top, which take the whole query as their first
+// argument: abs(avg:system.cpu.user{*}).
+type WrapperBuilder interface {
+	// WithArg adds an argument after the wrapped query.
+	WithArg(arg string) WrapperBuilder
+
+	// WithArgs adds multiple arguments after the wrapped query.
+	WithArgs(args ...string) WrapperBuilder
+
+	// Wrap returns query wrapped in the function.
+	Wrap(query string) (string, error)
+}
+
+// wrapperBuilder is the concrete implementation of the WrapperBuilder
+// interface.
+type wrapperBuilder struct {
+	name string
+	args []string
+	err  error // set by constructors that validate their arguments
+}
+
+// NewWrapperBuilder creates a new wrapping function builder with the given
+// name.
+func NewWrapperBuilder(name string) WrapperBuilder {
+	return &wrapperBuilder{
+		name: name,
+		args: make([]string, 0),
+	}
+}
+
+// Abs wraps the query in abs(), the absolute value of each point.
+func Abs() WrapperBuilder {
+	return NewWrapperBuilder("abs")
+}
+
+// Log2 wraps the query in log2().
+func Log2() WrapperBuilder {
+	return NewWrapperBuilder("log2")
+}
+
+// Log10 wraps the query in log10().
+func Log10() WrapperBuilder {
+	return NewWrapperBuilder("log10")
+}
+
+// Derivative wraps the query in derivative(), the rate of change of each
+// point per second.
+func Derivative() WrapperBuilder {
+	return NewWrapperBuilder("derivative")
+}
+
+// Diff wraps the query in diff(), the difference between consecutive
+// points.
+func Diff() WrapperBuilder {
+	return NewWrapperBuilder("diff")
+}
+
+// Dt wraps the query in dt(), the time in seconds between consecutive
+// points.
+func Dt() WrapperBuilder {
+	return NewWrapperBuilder("dt")
+}
+
+// CountNonzero wraps the query in count_nonzero(), the number of series
+// with a non-zero value at each point.
+func CountNonzero() WrapperBuilder {
+	return NewWrapperBuilder("count_nonzero")
+}
+
+// CountNotNull wraps the query in count_not_null(), the number of series
+// with a value at each point.
+func CountNotNull() WrapperBuilder {
+	return NewWrapperBuilder("count_not_null")
+}
+
+// argumentlessWrappers lists the wrappers that take only the query; extra
+// arguments added with WithArg are reported when the query is built.
+var argumentlessWrappers = map[string]bool{
+	"count_nonzero":  true,
+	"count_not_null": true,
+	"per_second":     true,
+	"per_minute":     true,
+	"per_hour":       true,
+}
+
+// PerSecond wraps the query in per_second(), the rate of change of each
+// point per second.
+func PerSecond() WrapperBuilder {
+	return NewWrapperBuilder("per_second")
+}
+
+// PerMinute wraps the query in per_minute(), the rate of change of each
+// point per minute.
+func PerMinute() WrapperBuilder {
+	return NewWrapperBuilder("per_minute")
+}
+
+// PerHour wraps the query in per_hour(), the rate of change of each point
+// per hour.
+func PerHour() WrapperBuilder {
+	return NewWrapperBuilder("per_hour")
+}
+
+// Cumsum wraps the query in cumsum(), the cumulative sum over the visible
+// time window.
+func Cumsum() WrapperBuilder {
+	return NewWrapperBuilder("cumsum")
+}
+
+// Integral wraps the query in integral(), the cumulative sum of each
+// point multiplied by its interval.
+func Integral() WrapperBuilder {
+	return NewWrapperBuilder("integral")
+}
+
+// DefaultZero wraps the query in default_zero(), which fills gaps with
+// zeros so that monitors on sparse metrics evaluate instead of reporting no
+// data.
+func DefaultZero() WrapperBuilder {
+	return NewWrapperBuilder("default_zero")
+}
+
+// Timeshift wraps the query in timeshift(), moving it by offset: a
+// negative offset compares with the past, e.g. Timeshift(-time.Hour)
+// renders timeshift(<query>, -3600), the query an hour earlier. The offset
+// must be a non-zero whole number of seconds.
+func Timeshift(offset time.Duration) WrapperBuilder {
+	seconds := int64(offset / time.Second)
+	w := &wrapperBuilder{name: "timeshift", args: []string{strconv.FormatInt(seconds, 10)}}
+	if offset == 0 || offset%time.Second != 0 {
+		w.err = &ValidationError{Component: "timeshift", Value: offset.String(), Reason: "offset must be a non-zero whole number of seconds"}
+	}
+	return w
+}
+
+// HourBefore wraps the query in hour_before(), the query one hour earlier.
+func HourBefore() WrapperBuilder {
+	return NewWrapperBuilder("hour_before")
+}
+
+// DayBefore wraps the query in day_before(), the query one day earlier.
+func DayBefore() WrapperBuilder {
+	return NewWrapperBuilder("day_before")
+}
+
+// WeekBefore wraps the query in week_before(), the query seven days
+// earlier.
+func WeekBefore() WrapperBuilder {
+	return NewWrapperBuilder("week_before")
+}
+
+// MonthBefore wraps the query in month_before(), the query 28 days
+// earlier.
+func MonthBefore() WrapperBuilder {
+	return NewWrapperBuilder("month_before")
+}
+
+// ClampMin wraps the query in clamp_min(), raising every point below v to
+// v, e.g. ClampMin(0) renders clamp_min(<query>, 0).
+func ClampMin(v float64) WrapperBuilder {
+	return clamp("clamp_min", v)
+}
+
+// ClampMax wraps the query in clamp_max(), lowering every point above v to
+// v, e.g. ClampMax(100) renders clamp_max(<query>, 100).
+func ClampMax(v float64) WrapperBuilder {
+	return clamp("clamp_max", v)
+}
+
+// clamp returns the clamping wrapper name with bound v, written in plain
+// decimal notation because Datadog does not accept exponents. NaN and
+// infinite bounds are reported when the query is built.
+func clamp(name string, v float64) WrapperBuilder {
+	w := &wrapperBuilder{name: name, args: []string{strconv.FormatFloat(v, 'f', -1, 64)}}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		w.err = &ValidationError{Component: name, Value: strconv.FormatFloat(v, 'f', -1, 64), Reason: "bound must be a finite number"}
+	}
+	return w
+}
+
+// MovingAverage wraps the query in Datadog's exponentially weighted moving
+// average over span points, e.g. MovingAverage(5) renders
+// ewma_5(<query>). Datadog supports spans of 3, 5, 10 and 20; others are
+// reported when the query is built.
+func MovingAverage(span int) WrapperBuilder {
+	w := NewWrapperBuilder("ewma_" + strconv.Itoa(span)).(*wrapperBuilder)
+	switch span {
+	case 3, 5, 10, 20:
+	default:
+		w.err = &ValidationError{Component: "moving average", Value: strconv.Itoa(span), Reason: "span must be one of 3, 5, 10 or 20"}
+	}
+	return w
+}
+
+// MovingMedian wraps the query in Datadog's rolling median over span
+// points, e.g. MovingMedian(5) renders median_5(<query>). Datadog supports
+// spans of 3, 5, 7 and 9; others are reported when the query is built.
+func MovingMedian(span int) WrapperBuilder {
+	w := NewWrapperBuilder("median_" + strconv.Itoa(span)).(*wrapperBuilder)
+	switch span {
+	case 3, 5, 7, 9:
+	default:
+		w.err = &ValidationError{Component: "moving median", Value: strconv.Itoa(span), Reason: "span must be one of 3, 5, 7 or 9"}
+	}
+	return w
+}
+
+// MovingRollupBuilder is a moving_rollup() wrapper whose window and
+// aggregation can be inspected and changed, including on a parsed query,
+// whose wrappers GetWrappers returns.
+type MovingRollupBuilder interface {
+	WrapperBuilder
+
+	// Window returns the window each point is aggregated over.
+	Window() time.Duration
+
+	// Aggregation returns the aggregation, or "" if it is left to
+	// Datadog's default, avg.
+	Aggregation() RollupAggregation
+
+	// SetWindow changes the window.
+	SetWindow(window time.Duration) MovingRollupBuilder
+
+	// SetAggregation changes the aggregation; "" omits it.
+	SetAggregation(aggregation RollupAggregation) MovingRollupBuilder
+}
+
+// movingRollupBuilder is the concrete implementation of the
+// MovingRollupBuilder interface. The embedded wrapperBuilder holds the
+// rendered arguments, kept in step with window and aggregation.
+type movingRollupBuilder struct {
+	wrapperBuilder
+	window      time.Duration
+	aggregation RollupAggregation
+	extra       []string // arguments added with WithArg
+}
+
+// MovingRollup wraps the query in moving_rollup(), which aggregates each
+// point with the points in the window before it using aggregation, e.g.
+// MovingRollup(time.Minute, RollupSum) renders
+// moving_rollup(<query>, 60, 'sum'). The window must be a positive whole
+// number of seconds; an empty aggregation is omitted, leaving Datadog's
+// default. Invalid arguments are reported when the query is built.
+func MovingRollup(window time.Duration, aggregation RollupAggregation) MovingRollupBuilder {
+	m := &movingRollupBuilder{
+		wrapperBuilder: wrapperBuilder{name: "moving_rollup"},
+		window:         window,
+		aggregation:    aggregation,
+	}
+	m.update()
+	return m
+}
+
+// Window returns the window each point is aggregated over.
+func (m *movingRollupBuilder) Window() time.Duration {
+	return m.window
+}
+
+// Aggregation returns the aggregation, or "" if it is omitted.
+func (m *movingRollupBuilder) Aggregation() RollupAggregation {
+	return m.aggregation
+}
+
+// SetWindow changes the window. An invalid window is reported when the
+// query is built.
+func (m *movingRollupBuilder) SetWindow(window time.Duration) MovingRollupBuilder {
+	m.window = window
+	m.update()
+	return m
+}
+
+// SetAggregation changes the aggregation. An invalid aggregation is
+// reported when the query is built.
+func (m *movingRollupBuilder) SetAggregation(aggregation RollupAggregation) MovingRollupBuilder {
+	m.aggregation = aggregation
+	m.update()
+	return m
+}
+
+// WithArg adds an argument after the window and aggregation.
+func (m *movingRollupBuilder) WithArg(arg string) WrapperBuilder {
+	return m.WithArgs(arg)
+}
+
+// WithArgs adds multiple arguments after the window and aggregation.
+func (m *movingRollupBuilder) WithArgs(args ...string) WrapperBuilder {
+	m.extra = append(m.extra, args...)
+	m.update()
+	return m
+}
+
+// update renders the window and aggregation into the wrapper's arguments
+// and validates them.
+func (m *movingRollupBuilder) update() {
+	m.args = append(m.args[:0], strconv.FormatInt(int64(m.window/time.Second), 10))
+	if m.aggregation != "" {
+		m.args = append(m.args, "'"+string(m.aggregation)+"'")
+	}
+	m.args = append(m.args, m.extra...)
+
+	m.err = nil
+	switch {
+	case m.window <= 0 || m.window%time.Second != 0:
+		m.err = &ValidationError{Component: "moving_rollup", Value: m.window.String(), Reason: "window must be a positive whole number of seconds"}
+	case m.aggregation != "" && validateRollupAggregation(m.aggregation) != nil:
+		m.err = &ValidationError{Component: "moving_rollup", Value: string(m.aggregation), Reason: "aggregation must be one of avg, sum, min, max or count"}
+	case len(m.extra) > 0:
+		m.err = &ValidationError{Component: "moving_rollup", Value: strings.Join(m.extra, ", "), Reason: "takes only a window and an aggregation"}
+	}
+}
+
+// Autosmooth wraps the query in autosmooth(), which picks a moving average
+// span that removes noise while keeping the trend.
+func Autosmooth() WrapperBuilder {
+	return NewWrapperBuilder("autosmooth")
+}
+
+// AnomalyAlgorithm is the algorithm anomalies() uses to predict the
+// expected range of a series.
+type AnomalyAlgorithm string
+
+const (
+	// AnomalyBasic uses a lagging rolling quantile, for metrics without
+	// seasonality.
+	AnomalyBasic AnomalyAlgorithm = "basic"
+	// AnomalyAgile follows level shifts quickly, for seasonal metrics that
+	// are expected to shift.
+	AnomalyAgile AnomalyAlgorithm = "agile"
+	// AnomalyRobust is stable against long-lasting anomalies, for seasonal
+	// metrics with a steady baseline.
+	AnomalyRobust AnomalyAlgorithm = "robust"
+)
+
+// Anomalies wraps the query in anomalies(), which flags points outside the
+// range predicted by algorithm, widened by bounds standard deviations,
+// e.g. Anomalies(AnomalyAgile, 2) renders anomalies(<query>, 'agile', 2).
+// An unknown algorithm or non-positive bounds are reported when the query
+// is built.
+func Anomalies(algorithm AnomalyAlgorithm, bounds float64) WrapperBuilder {
+	w := &wrapperBuilder{
+		name: "anomalies",
+		args: []string{"'" + string(algorithm) + "'", strconv.FormatFloat(bounds, 'f', -1, 64)},
+	}
+	switch {
+	case algorithm != AnomalyBasic && algorithm != AnomalyAgile && algorithm != AnomalyRobust:
+		w.err = &ValidationError{Component: "anomalies", Value: string(algorithm), Reason: "algorithm must be one of basic, agile or robust"}
+	case !(bounds > 0):
+		w.err = &ValidationError{Component: "anomalies", Value: strconv.FormatFloat(bounds, 'f', -1, 64), Reason: "bounds must be positive"}
+	}
+	return w
+}
+
+// OutlierAlgorithm is the algorithm outliers() uses to find series that
+// behave differently from their peers.
+type OutlierAlgorithm string
+
+const (
+	// OutlierDBSCAN clusters the series and flags those outside the main
+	// cluster.
+	OutlierDBSCAN OutlierAlgorithm = "DBSCAN"
+	// OutlierMAD flags points far from the median of all series, measured
+	// in median absolute deviations.
+	OutlierMAD OutlierAlgorithm = "MAD"
+	// OutlierScaledDBSCAN is OutlierDBSCAN with distances scaled to the
+	// size of the series, for metrics on very different scales.
+	OutlierScaledDBSCAN OutlierAlgorithm = "scaledDBSCAN"
+	// OutlierScaledMAD is OutlierMAD with deviations scaled to the size of
+	// the series.
+	OutlierScaledMAD OutlierAlgorithm = "scaledMAD"
+)
+
+// Outliers wraps the query in outliers(), which flags the groups whose
+// series differ from the rest according to algorithm and tolerance, e.g.
+// Outliers(OutlierDBSCAN, 3) renders outliers(<query>, 'DBSCAN', 3). The
+// MAD algorithms accept an optional pct, the percentage of points that
+// must be outlying for a series to be flagged:
+// Outliers(OutlierMAD, 3, 20) renders outliers(<query>, 'MAD', 3, 20).
+// An unknown algorithm, a non-positive tolerance, or a pct outside 0-100,
+// repeated or given to a DBSCAN algorithm is reported when the query is
+// built.
+func Outliers(algorithm OutlierAlgorithm, tolerance float64, pct ...float64) WrapperBuilder {
+	w := &wrapperBuilder{
+		name: "outliers",
+		args: []string{"'" + string(algorithm) + "'", strconv.FormatFloat(tolerance, 'f', -1, 64)},
+	}
+	switch algorithm {
+	case OutlierDBSCAN, OutlierScaledDBSCAN:
+		if len(pct) > 0 {
+			w.err = &ValidationError{Component: "outliers", Value: string(algorithm), Reason: "pct applies only to the MAD algorithms"}
+			return w
+		}
+	case OutlierMAD, OutlierScaledMAD:
+	default:
+		w.err = &ValidationError{Component: "outliers", Value: string(algorithm), Reason: "algorithm must be one of DBSCAN, MAD, scaledDBSCAN or scaledMAD"}
+		return w
+	}
+	switch {
+	case !(tolerance > 0) || math.IsInf(tolerance, 1):
+		w.err = &ValidationError{Component: "outliers", Value: strconv.FormatFloat(tolerance, 'f', -1, 64), Reason: "tolerance must be a positive number"}
+	case len(pct) > 1:
+		w.err = &ValidationError{Component: "outliers", Value: fmt.Sprint(pct), Reason: "accepts at most one pct"}
+	case len(pct) == 1 && !(pct[0] >= 0 && pct[0] <= 100):
+		w.err = &ValidationError{Component: "outliers", Value: strconv.FormatFloat(pct[0], 'f', -1, 64), Reason: "pct must be between 0 and 100"}
+	case len(pct) == 1:
+		w.args = append(w.args, strconv.FormatFloat(pct[0], 'f', -1, 64))
+	}
+	return w
+}
+
+// ForecastAlgorithm is the algorithm forecast() uses to project a series.
+type ForecastAlgorithm string
+
+const (
+	// ForecastLinear projects the trend of metrics without seasonality.
+	ForecastLinear ForecastAlgorithm = "linear"
+	// ForecastSeasonal projects metrics with a daily or weekly pattern.
+	ForecastSeasonal ForecastAlgorithm = "seasonal"
+)
+
+// Forecast wraps the query in forecast(), which projects it into the
+// future with algorithm, bounded by deviations standard deviations, e.g.
+// Forecast(ForecastLinear, 1) renders forecast(<query>, 'linear', 1). An
+// unknown algorithm or non-positive deviations are reported when the query
+// is built.
+func Forecast(algorithm ForecastAlgorithm, deviations float64) WrapperBuilder {
+	w := &wrapperBuilder{
+		name: "forecast",
+		args: []string{"'" + string(algorithm) + "'", strconv.FormatFloat(deviations, 'f', -1, 64)},
+	}
+	switch {
+	case algorithm != ForecastLinear && algorithm != ForecastSeasonal:
+		w.err = &ValidationError{Component: "forecast", Value: string(algorithm), Reason: "algorithm must be linear or seasonal"}
+	case !(deviations > 0):
+		w.err = &ValidationError{Component: "forecast", Value: strconv.FormatFloat(deviations, 'f', -1, 64), Reason: "deviations must be positive"}
+	}
+	return w
+}
+
+// topLimits, topRankings and topOrders list the arguments Datadog accepts
+// for top().
+var (
+	topLimits   = map[int]bool{5: true, 10: true, 20: true, 25: true, 50: true, 100: true}
+	topRankings = map[string]bool{"max": true, "min": true, "last": true, "l2norm": true, "area": true, "mean": true, "norm": true}
+	topOrders   = map[string]bool{"asc": true, "desc": true}
+)
+
+// Top wraps the query in top(), keeping the limit series ranked highest
+// (order "desc") or lowest (order "asc") by ranking, e.g.
+// Top(10, "mean", "desc") renders top(<query>, 10, 'mean', 'desc').
+// Invalid arguments are reported when the query is built.
+func Top(limit int, ranking, order string) WrapperBuilder {
+	w := &wrapperBuilder{
+		name: "top",
+		args: []string{strconv.Itoa(limit), "'" + ranking + "'", "'" + order + "'"},
+	}
+	switch {
+	case !topLimits[limit]:
+		w.err = &ValidationError{Component: "top", Value: strconv.Itoa(limit), Reason: "limit must be one of 5, 10, 20, 25, 50 or 100"}
+	case !topRankings[ranking]:
+		w.err = &ValidationError{Component: "top", Value: ranking, Reason: "ranking must be one of max, min, last, l2norm, area, mean or norm"}
+	case !topOrders[order]:
+		w.err = &ValidationError{Component: "top", Value: order, Reason: "order must be asc or desc"}
+	}
+	return w
+}
+
+// WithArg adds an argument after the wrapped query.
+func (w *wrapperBuilder) WithArg(arg string) WrapperBuilder {
+	w.args = append(w.args, arg)
+	return w
+}
+
+// WithArgs adds multiple arguments after the wrapped query.
+func (w *wrapperBuilder) WithArgs(args ...string) WrapperBuilder {
+	w.args = append(w.args, args...)
+	return w
+}
+
+// Wrap returns query wrapped in the function.
+// Format: function_name(query, arg1, arg2, ...)
+func (w *wrapperBuilder) Wrap(query string) (string, error) {
+	var sb strings.Builder
+	if err := w.appendTo(&sb, query, nil, false, ", "); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// appendTo renders query wrapped in the function into sb, separating the
+// query and arguments with argSep. When resolve is true, {{name}}
+// placeholders in arguments are replaced with their values from params.
+func (w *wrapperBuilder) appendTo(sb *strings.Builder, query string, params map[string]string, resolve bool, argSep string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.name == "" {
+		return ErrMissingFunctionName
+	}
+	if len(w.args) > 0 && argumentlessWrappers[w.name] {
+		return &ValidationError{Component: "function", Value: w.name, Reason: "takes no arguments besides the query"}
+	}
+
+	sb.WriteString(w.name)
+	sb.WriteByte('(')
+	sb.WriteString(query)
+	for _, arg := range w.args {
+		if resolve {
+			resolved, err := resolvePlaceholders(arg, params)
+			if err != nil {
+				return err
+			}
+			arg = resolved
+		}
+		sb.WriteString(argSep)
+		sb.WriteString(arg)
+	}
+	sb.WriteByte(')')
+	return nil
+}
+
+// wrapQuery wraps query in each of wrappers in turn, so that the first
+// wrapper is innermost, resolving placeholders from params and separating
+// arguments with argSep.
+func wrapQuery(query string, wrappers []WrapperBuilder, params map[string]string, argSep string) (string, error) {
+	for _, w := range wrappers {
+		var err error
+		if impl, ok := wrapperImpl(w); ok {
+			var sb strings.Builder
+			err = impl.appendTo(&sb, query, params, true, argSep)
+			query = sb.String()
+		} else {
+			query, err = w.Wrap(query)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error building wrapper: %w", err)
+		}
+	}
+	return query, nil
+}
+
+// wrapperImpl returns the wrapperBuilder rendering w, if w was built by
+// this package.
+func wrapperImpl(w WrapperBuilder) (*wrapperBuilder, bool) {
+	switch impl := w.(type) {
+	case *wrapperBuilder:
+		return impl, true
+	case *movingRollupBuilder:
+		return &impl.wrapperBuilder, true
+	}
+	return nil, false
+}
+
+// cloneWrappers returns a deep copy of wrappers. Wrappers implemented
+// outside this package are shared rather than copied.
+func cloneWrappers(wrappers []WrapperBuilder) []WrapperBuilder {
+	out := make([]WrapperBuilder, len(wrappers))
+	for i, w := range wrappers {
+		switch impl := w.(type) {
+		case *wrapperBuilder:
+			c := *impl
+			c.args = append(make([]string, 0, len(impl.args)), impl.args...)
+			w = &c
+		case *movingRollupBuilder:
+			c := *impl
+			c.args = append(make([]string, 0, len(impl.args)), impl.args...)
+			c.extra = append([]string(nil), impl.extra...)
+			w = &c
+		}
+		out[i] = w
+	}
+	return out
+}
+
+// GetWrappers returns the wrapping functions, innermost first, including
+// those rebuilt from a parsed query. As with GetFunctions, the wrappers
+// are shared, so changing them, e.g. the window of a MovingRollupBuilder,
+// modifies the query, unless the builder is frozen.
+func (b *metricQueryBuilder) GetWrappers() []WrapperBuilder {
+	if b.frozen {
+		return cloneWrappers(b.wrappers)
+	}
+	return slices.Clone(b.wrappers)
+}
+
+// GetWrappers returns the wrapping functions added to the whole expression
+// with WrapWith, innermost first. Wrappers inside the original expression
+// are not included.
+func (b *expressionQueryBuilder) GetWrappers() []WrapperBuilder {
+	if b.frozen {
+		return cloneWrappers(b.wrappers)
+	}
+	return slices.Clone(b.wrappers)
+}
+
+// WrapWith wraps the query in w. Wrappers nest in the order they are
+// added, so WrapWith(Abs()).WrapWith(Top(10, "mean", "desc")) renders
+// top(abs(<query>), 10, 'mean', 'desc').
+func (b *metricQueryBuilder) WrapWith(w WrapperBuilder) QueryBuilder {
+	b = b.mutable("WrapWith")
+	if w != nil {
+		b.wrappers = append(b.wrappers, w)
+	}
+	return b
+}
+
+// WrapWith wraps the whole expression in w.
+func (b *expressionQueryBuilder) WrapWith(w WrapperBuilder) QueryBuilder {
+	b = b.mutable("WrapWith")
+	if w != nil {
+		b.wrappers = append(b.wrappers, w)
+	}
+	return b
+}
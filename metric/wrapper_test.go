@@ -0,0 +1,206 @@
+package metric_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+func TestWrapWith(t *testing.T) {
+	cpu := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.user").GroupBy("host")
+	}
+
+	tests := []struct {
+		name     string
+		builder  func() metric.QueryBuilder
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "abs",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Abs()) },
+			expected: "abs(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "log10",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Log10()) },
+			expected: "log10(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "top",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Top(10, "mean", "desc")) },
+			expected: "top(avg:system.cpu.user{*} by {host}, 10, 'mean', 'desc')",
+		},
+		{
+			name:     "default zero",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.DefaultZero()) },
+			expected: "default_zero(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name: "default zero inside top",
+			builder: func() metric.QueryBuilder {
+				return cpu().WrapWith(metric.DefaultZero()).WrapWith(metric.Top(10, "mean", "desc"))
+			},
+			expected: "top(default_zero(avg:system.cpu.user{*} by {host}), 10, 'mean', 'desc')",
+		},
+		{
+			name: "default zero expression",
+			builder: func() metric.QueryBuilder {
+				q, err := metric.ParseQuery("sum:errors{*}.as_count() / sum:hits{*}.as_count()")
+				if err != nil {
+					t.Fatalf("unexpected parse error: %v", err)
+				}
+				return q.WrapWith(metric.DefaultZero())
+			},
+			expected: "default_zero(sum:errors{*}.as_count() / sum:hits{*}.as_count())",
+		},
+		{
+			name: "wrappers nest in order",
+			builder: func() metric.QueryBuilder {
+				return cpu().WrapWith(metric.Abs()).WrapWith(metric.Top(5, "max", "asc"))
+			},
+			expected: "top(abs(avg:system.cpu.user{*} by {host}), 5, 'max', 'asc')",
+		},
+		{
+			name: "suffix functions stay inside",
+			builder: func() metric.QueryBuilder {
+				return cpu().ApplyFunction(metric.NewFunctionBuilder("rollup").WithArgs("avg", "60")).WrapWith(metric.Cumsum())
+			},
+			expected: "cumsum(avg:system.cpu.user{*} by {host}.rollup(avg, 60))",
+		},
+		{
+			name: "derivative of a count",
+			builder: func() metric.QueryBuilder {
+				return metric.NewMetricQueryBuilder().Aggregator("sum").Metric("requests").AsCount().WrapWith(metric.Derivative())
+			},
+			expected: "derivative(sum:requests{*}.as_count())",
+		},
+		{
+			name:     "diff",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Diff()) },
+			expected: "diff(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "dt",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Dt()) },
+			expected: "dt(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "integral",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.Integral()) },
+			expected: "integral(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "per second",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.PerSecond()) },
+			expected: "per_second(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "count nonzero",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.CountNonzero()) },
+			expected: "count_nonzero(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name:     "count not null",
+			builder:  func() metric.QueryBuilder { return cpu().WrapWith(metric.CountNotNull()) },
+			expected: "count_not_null(avg:system.cpu.user{*} by {host})",
+		},
+		{
+			name: "custom wrapper",
+			builder: func() metric.QueryBuilder {
+				return cpu().WrapWith(metric.NewWrapperBuilder("timeshift").WithArg("-3600"))
+			},
+			expected: "timeshift(avg:system.cpu.user{*} by {host}, -3600)",
+		},
+		{
+			name: "expression",
+			builder: func() metric.QueryBuilder {
+				q, err := metric.ParseQuery("sum:errors{*} / sum:hits{*}")
+				if err != nil {
+					t.Fatalf("unexpected parse error: %v", err)
+				}
+				return q.WrapWith(metric.Abs())
+			},
+			expected: "abs(sum:errors{*} / sum:hits{*})",
+		},
+		{
+			name:    "error - count nonzero with argument",
+			builder: func() metric.QueryBuilder { return cpu().WrapWith(metric.CountNonzero().WithArg("host")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - invalid top limit",
+			builder: func() metric.QueryBuilder { return cpu().WrapWith(metric.Top(7, "mean", "desc")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - invalid top ranking",
+			builder: func() metric.QueryBuilder { return cpu().WrapWith(metric.Top(10, "median", "desc")) },
+			wantErr: true,
+		},
+		{
+			name:    "error - invalid top order",
+			builder: func() metric.QueryBuilder { return cpu().WrapWith(metric.Top(10, "mean", "up")) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder().Build()
+			if tt.wantErr {
+				var verr *metric.ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("expected ValidationError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWrapWithRoundTrip(t *testing.T) {
+	q := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.user").GroupBy("host").WrapWith(metric.Top(10, "mean", "desc"))
+	built, err := q.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := metric.ParseQuery(built)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) failed: %v", built, err)
+	}
+	reparsed, err := parsed.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reparsed != built {
+		t.Errorf("got %q, want %q", reparsed, built)
+	}
+}
+
+func TestWrapWithMissingName(t *testing.T) {
+	_, err := metric.NewMetricQueryBuilder().Metric("system.cpu.user").WrapWith(metric.NewWrapperBuilder("")).Build()
+	if !errors.Is(err, metric.ErrMissingFunctionName) {
+		t.Errorf("expected ErrMissingFunctionName, got %v", err)
+	}
+}
+
+func TestRenderHTMLWrapper(t *testing.T) {
+	q := metric.NewMetricQueryBuilder().Aggregator("avg").Metric("m").WrapWith(metric.Top(10, "mean", "desc"))
+	got, err := metric.RenderHTML(q)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `<code class="ddqb-query"><span class="ddqb-function">top(</span><span class="ddqb-aggregator">avg</span>:<span class="ddqb-metric">m</span>{*}<span class="ddqb-function">, 10, &#39;mean&#39;, &#39;desc&#39;)</span></code>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the builders. Use errors.Is
+// to test for them.
+var (
+	// ErrMissingQuery is returned when a monitor is built without a query.
+	ErrMissingQuery = errors.New("monitor query is required")
+
+	// ErrMissingThreshold is returned when a monitor is built without a
+	// threshold comparison.
+	ErrMissingThreshold = errors.New("monitor threshold is required")
+
+	// ErrInvalidThreshold is returned when a parsed monitor query compares
+	// its value with something other than a number.
+	ErrInvalidThreshold = errors.New("invalid monitor threshold")
+
+	// ErrInvalidAggregation is returned for time aggregations other than
+	// avg, sum, min and max.
+	ErrInvalidAggregation = errors.New("invalid time aggregation")
+
+	// ErrInvalidEvaluationWindow is returned when the evaluation window is
+	// missing or malformed.
+	ErrInvalidEvaluationWindow = errors.New("invalid evaluation window")
+
+	// ErrInvalidRollup is returned for trace analytics rollups Datadog does
+	// not support.
+	ErrInvalidRollup = errors.New("invalid rollup aggregation")
+
+	// ErrMissingMeasure is returned when a trace analytics rollup other
+	// than count is built without a measure or facet.
+	ErrMissingMeasure = errors.New("rollup requires a measure")
+
+	// ErrNestedEvaluationWindow is returned when the wrapped query already
+	// carries an aggregation(window): prefix of its own.
+	ErrNestedEvaluationWindow = errors.New("query already has an evaluation window")
+)
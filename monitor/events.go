@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonwinton/ddqb/event"
+)
+
+// EventMonitorBuilder provides a fluent interface for building event
+// monitor queries of the form
+//
+//	events("source:kubernetes status:error tags:env:prod").rollup("count").by("host").last("1h") > 10
+type EventMonitorBuilder interface {
+	// Query sets the event query to monitor. It must roll the events up
+	// over an evaluation window with Last.
+	Query(q event.EventQueryBuilder) EventMonitorBuilder
+
+	// Events returns the monitored query, so that a parsed monitor can be
+	// edited, or nil if none is set.
+	Events() event.EventQueryBuilder
+
+	// Above alerts when the value is greater than threshold.
+	Above(threshold float64) EventMonitorBuilder
+
+	// AboveOrEqual alerts when the value is greater than or equal to
+	// threshold.
+	AboveOrEqual(threshold float64) EventMonitorBuilder
+
+	// Below alerts when the value is less than threshold.
+	Below(threshold float64) EventMonitorBuilder
+
+	// BelowOrEqual alerts when the value is less than or equal to
+	// threshold.
+	BelowOrEqual(threshold float64) EventMonitorBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// eventMonitorBuilder is the concrete implementation of the
+// EventMonitorBuilder interface.
+type eventMonitorBuilder struct {
+	query      event.EventQueryBuilder
+	comparator Comparator
+	threshold  float64
+}
+
+// NewEventMonitorBuilder creates a new event monitor builder.
+func NewEventMonitorBuilder() EventMonitorBuilder {
+	return &eventMonitorBuilder{}
+}
+
+// ParseEventMonitor parses an event monitor query, such as one exported
+// from the Datadog API, into a builder. The event query is parsed with
+// event.ParseQuery and can be edited through Events.
+func ParseEventMonitor(query string) (EventMonitorBuilder, error) {
+	query, c, threshold, err := splitThreshold(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := event.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	b := &eventMonitorBuilder{query: q}
+	return b.compare(c, threshold), nil
+}
+
+// Query sets the event query to monitor.
+func (b *eventMonitorBuilder) Query(q event.EventQueryBuilder) EventMonitorBuilder {
+	b.query = q
+	return b
+}
+
+// Events returns the monitored query.
+func (b *eventMonitorBuilder) Events() event.EventQueryBuilder {
+	return b.query
+}
+
+// Above alerts when the value is greater than threshold.
+func (b *eventMonitorBuilder) Above(threshold float64) EventMonitorBuilder {
+	return b.compare(Above, threshold)
+}
+
+// AboveOrEqual alerts when the value is greater than or equal to threshold.
+func (b *eventMonitorBuilder) AboveOrEqual(threshold float64) EventMonitorBuilder {
+	return b.compare(AboveOrEqual, threshold)
+}
+
+// Below alerts when the value is less than threshold.
+func (b *eventMonitorBuilder) Below(threshold float64) EventMonitorBuilder {
+	return b.compare(Below, threshold)
+}
+
+// BelowOrEqual alerts when the value is less than or equal to threshold.
+func (b *eventMonitorBuilder) BelowOrEqual(threshold float64) EventMonitorBuilder {
+	return b.compare(BelowOrEqual, threshold)
+}
+
+// compare sets the threshold comparison.
+func (b *eventMonitorBuilder) compare(c Comparator, threshold float64) EventMonitorBuilder {
+	b.comparator = c
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *eventMonitorBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	var query string
+	if b.query == nil {
+		errs = append(errs, ErrMissingQuery)
+	} else {
+		var err error
+		query, err = b.query.Build()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("error building query: %w", err))
+		case !lastWindowPattern.MatchString(query):
+			errs = append(errs, fmt.Errorf("%w: event monitors require last(...)", ErrInvalidEvaluationWindow))
+		}
+	}
+	if b.comparator == "" {
+		errs = append(errs, ErrMissingThreshold)
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(query)
+	writeThreshold(&sb, b.comparator, b.threshold)
+	return sb.String(), nil
+}
@@ -0,0 +1,93 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/event"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestEventMonitorBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  monitor.EventMonitorBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name: "count above threshold",
+			builder: monitor.NewEventMonitorBuilder().
+				Query(event.NewEventQueryBuilder().Source("kubernetes").Status(event.StatusError).GroupBy("host").Last("1h")).
+				Above(10),
+			expected: `events("source:kubernetes status:error").rollup("count").by("host").last("1h") > 10`,
+		},
+		{
+			name:    "error - no query",
+			builder: monitor.NewEventMonitorBuilder().Above(10),
+			wantErr: monitor.ErrMissingQuery,
+		},
+		{
+			name:    "error - no window",
+			builder: monitor.NewEventMonitorBuilder().Query(event.NewEventQueryBuilder()).Above(10),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - no threshold",
+			builder: monitor.NewEventMonitorBuilder().Query(event.NewEventQueryBuilder().Last("1h")),
+			wantErr: monitor.ErrMissingThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseEventMonitor(t *testing.T) {
+	const query = `events("source:kubernetes status:error tags:env:prod").rollup("count").by("host").last("1h") > 10`
+
+	b, err := monitor.ParseEventMonitor(query)
+	if err != nil {
+		t.Fatalf("ParseEventMonitor() error = %v", err)
+	}
+	if got, err := b.Build(); err != nil || got != query {
+		t.Errorf("Build() = %s, %v, want %s", got, err, query)
+	}
+
+	b.Events().RemoveTag("env").Tag("env", "staging")
+	got, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if want := `events("source:kubernetes status:error tags:env:staging").rollup("count").by("host").last("1h") > 10`; got != want {
+		t.Errorf("Build() = %s, want %s", got, want)
+	}
+
+	for _, tt := range []struct {
+		query   string
+		wantErr error
+	}{
+		{query: `events("*").rollup("count").last("1h")`, wantErr: monitor.ErrMissingThreshold},
+		{query: `events("*").rollup("count").last("1h") > ten`, wantErr: monitor.ErrInvalidThreshold},
+		{query: `events("*").rollup("avg").last("1h") > 1`, wantErr: event.ErrInvalidQuery},
+	} {
+		if _, err := monitor.ParseEventMonitor(tt.query); !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseEventMonitor(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// ForecastMonitorBuilder provides a fluent interface for building forecast
+// monitor queries of the form
+//
+//	max(next_1w):forecast(avg:system.disk.in_use{*} by {host}, 'linear', 1) >= 0.9
+type ForecastMonitorBuilder interface {
+	// Query sets the metric query to forecast. The query must not carry a
+	// time window of its own.
+	Query(q metric.QueryBuilder) ForecastMonitorBuilder
+
+	// Forecast selects the forecast algorithm and the number of standard
+	// deviations bounding it. The default is linear with 1 deviation.
+	Forecast(algorithm metric.ForecastAlgorithm, deviations float64) ForecastMonitorBuilder
+
+	// Aggregation sets how forecast values are aggregated over the
+	// window: "max" (the default), "min", "avg" or "sum".
+	Aggregation(agg string) ForecastMonitorBuilder
+
+	// Window sets how far ahead to forecast (e.g. "next_1w").
+	Window(window string) ForecastMonitorBuilder
+
+	// Above alerts when the forecast is greater than threshold.
+	Above(threshold float64) ForecastMonitorBuilder
+
+	// AboveOrEqual alerts when the forecast is greater than or equal to
+	// threshold.
+	AboveOrEqual(threshold float64) ForecastMonitorBuilder
+
+	// Below alerts when the forecast is less than threshold.
+	Below(threshold float64) ForecastMonitorBuilder
+
+	// BelowOrEqual alerts when the forecast is less than or equal to
+	// threshold.
+	BelowOrEqual(threshold float64) ForecastMonitorBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// forecastMonitorBuilder is the concrete implementation of the
+// ForecastMonitorBuilder interface.
+type forecastMonitorBuilder struct {
+	query       metric.QueryBuilder
+	algorithm   metric.ForecastAlgorithm
+	deviations  float64
+	aggregation string
+	window      string
+	comparator  Comparator
+	threshold   float64
+}
+
+// NewForecastMonitorBuilder creates a new forecast monitor builder.
+func NewForecastMonitorBuilder() ForecastMonitorBuilder {
+	return &forecastMonitorBuilder{
+		algorithm:   metric.ForecastLinear,
+		deviations:  1,
+		aggregation: "max",
+	}
+}
+
+// Query sets the metric query to forecast.
+func (b *forecastMonitorBuilder) Query(q metric.QueryBuilder) ForecastMonitorBuilder {
+	b.query = q
+	return b
+}
+
+// Forecast selects the forecast algorithm and deviations.
+func (b *forecastMonitorBuilder) Forecast(algorithm metric.ForecastAlgorithm, deviations float64) ForecastMonitorBuilder {
+	b.algorithm = algorithm
+	b.deviations = deviations
+	return b
+}
+
+// Aggregation sets how forecast values are aggregated over the window.
+func (b *forecastMonitorBuilder) Aggregation(agg string) ForecastMonitorBuilder {
+	b.aggregation = agg
+	return b
+}
+
+// Window sets how far ahead to forecast. It takes the next_ prefix and
+// accepts the same ranges as metric evaluation windows.
+func (b *forecastMonitorBuilder) Window(window string) ForecastMonitorBuilder {
+	b.window = window
+	return b
+}
+
+// Above alerts when the forecast is greater than threshold.
+func (b *forecastMonitorBuilder) Above(threshold float64) ForecastMonitorBuilder {
+	return b.compare(Above, threshold)
+}
+
+// AboveOrEqual alerts when the forecast is greater than or equal to
+// threshold.
+func (b *forecastMonitorBuilder) AboveOrEqual(threshold float64) ForecastMonitorBuilder {
+	return b.compare(AboveOrEqual, threshold)
+}
+
+// Below alerts when the forecast is less than threshold.
+func (b *forecastMonitorBuilder) Below(threshold float64) ForecastMonitorBuilder {
+	return b.compare(Below, threshold)
+}
+
+// BelowOrEqual alerts when the forecast is less than or equal to threshold.
+func (b *forecastMonitorBuilder) BelowOrEqual(threshold float64) ForecastMonitorBuilder {
+	return b.compare(BelowOrEqual, threshold)
+}
+
+// compare sets the threshold comparison.
+func (b *forecastMonitorBuilder) compare(c Comparator, threshold float64) ForecastMonitorBuilder {
+	b.comparator = c
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *forecastMonitorBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	var query string
+	if b.query == nil {
+		errs = append(errs, ErrMissingQuery)
+	} else {
+		var err error
+		query, err = b.query.Build()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("error building query: %w", err))
+		case prefixPattern.MatchString(query):
+			errs = append(errs, fmt.Errorf("%w: %s", ErrNestedEvaluationWindow, query))
+		default:
+			query, err = metric.Forecast(b.algorithm, b.deviations).Wrap(query)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if !timeAggregations[b.aggregation] {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidAggregation, b.aggregation))
+	}
+	// Forecast windows look ahead rather than back but accept the same
+	// ranges as metric evaluation windows
+	if span, ok := strings.CutPrefix(b.window, "next_"); !ok || metric.ValidateEvaluationWindow("last_"+span) != nil {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidEvaluationWindow, b.window))
+	}
+	if b.comparator == "" {
+		errs = append(errs, ErrMissingThreshold)
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.aggregation)
+	sb.WriteByte('(')
+	sb.WriteString(b.window)
+	sb.WriteString("):")
+	sb.WriteString(query)
+	writeThreshold(&sb, b.comparator, b.threshold)
+	return sb.String(), nil
+}
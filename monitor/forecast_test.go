@@ -0,0 +1,110 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestForecastMonitorBuilder(t *testing.T) {
+	disk := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Aggregator("avg").
+			Metric("system.disk.in_use").
+			GroupBy("host")
+	}
+
+	tests := []struct {
+		name     string
+		builder  monitor.ForecastMonitorBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "default linear forecast",
+			builder:  monitor.NewForecastMonitorBuilder().Query(disk()).Window("next_1w").AboveOrEqual(0.9),
+			expected: "max(next_1w):forecast(avg:system.disk.in_use{*} by {host}, 'linear', 1) >= 0.9",
+		},
+		{
+			name:     "seasonal forecast",
+			builder:  monitor.NewForecastMonitorBuilder().Query(disk()).Forecast(metric.ForecastSeasonal, 2).Aggregation("avg").Window("next_3d").Above(0.8),
+			expected: "avg(next_3d):forecast(avg:system.disk.in_use{*} by {host}, 'seasonal', 2) > 0.8",
+		},
+		{
+			name:    "error - backward window",
+			builder: monitor.NewForecastMonitorBuilder().Query(disk()).Window("last_1w").Above(0.9),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - window too long",
+			builder: monitor.NewForecastMonitorBuilder().Query(disk()).Window("next_5w").Above(0.9),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - missing query",
+			builder: monitor.NewForecastMonitorBuilder().Window("next_1w").Above(0.9),
+			wantErr: monitor.ErrMissingQuery,
+		},
+		{
+			name:    "error - missing threshold",
+			builder: monitor.NewForecastMonitorBuilder().Query(disk()).Window("next_1w"),
+			wantErr: monitor.ErrMissingThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestForecastMonitorBuilderUnknownAlgorithm(t *testing.T) {
+	_, err := monitor.NewForecastMonitorBuilder().
+		Query(metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.disk.in_use")).
+		Forecast("exponential", 1).
+		Window("next_1w").
+		Above(0.9).
+		Build()
+	var vErr *metric.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Errorf("Build() error = %v, want *ValidationError", err)
+	}
+}
+
+func TestForecastWrapper(t *testing.T) {
+	query, err := metric.NewMetricQueryBuilder().
+		Aggregator("avg").
+		Metric("system.disk.in_use").
+		WrapWith(metric.Forecast(metric.ForecastLinear, 1.5)).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if expected := "forecast(avg:system.disk.in_use{*}, 'linear', 1.5)"; query != expected {
+		t.Errorf("Build() = %q, want %q", query, expected)
+	}
+
+	_, err = metric.NewMetricQueryBuilder().
+		Metric("system.disk.in_use").
+		WrapWith(metric.Forecast(metric.ForecastSeasonal, 0)).
+		Build()
+	var vErr *metric.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Errorf("Build() error = %v, want *ValidationError", err)
+	}
+}
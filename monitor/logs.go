@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jonwinton/ddqb/log"
+)
+
+// lastWindowPattern matches the .last("...") call ending a log or event
+// query, which their monitors require.
+var lastWindowPattern = regexp.MustCompile(`\.last\("[^"]*"\)$`)
+
+// thresholdPattern matches the threshold comparison ending a log or event
+// monitor query, after the closing parenthesis of its last call.
+var thresholdPattern = regexp.MustCompile(`^(.*\))\s*(>=|<=|>|<)\s*(\S+)\s*$`)
+
+// LogMonitorBuilder provides a fluent interface for building log monitor
+// queries of the form
+//
+//	logs("service:web status:error").index("main").rollup("count").by("host").last("5m") > 100
+type LogMonitorBuilder interface {
+	// Query sets the log analytics query to monitor. It must roll the
+	// logs up over an evaluation window with Last.
+	Query(q log.LogAnalyticsBuilder) LogMonitorBuilder
+
+	// Analytics returns the monitored query, so that a parsed monitor can
+	// be edited, or nil if none is set.
+	Analytics() log.LogAnalyticsBuilder
+
+	// Above alerts when the value is greater than threshold.
+	Above(threshold float64) LogMonitorBuilder
+
+	// AboveOrEqual alerts when the value is greater than or equal to
+	// threshold.
+	AboveOrEqual(threshold float64) LogMonitorBuilder
+
+	// Below alerts when the value is less than threshold.
+	Below(threshold float64) LogMonitorBuilder
+
+	// BelowOrEqual alerts when the value is less than or equal to
+	// threshold.
+	BelowOrEqual(threshold float64) LogMonitorBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// logMonitorBuilder is the concrete implementation of the
+// LogMonitorBuilder interface.
+type logMonitorBuilder struct {
+	query      log.LogAnalyticsBuilder
+	comparator Comparator
+	threshold  float64
+}
+
+// NewLogMonitorBuilder creates a new log monitor builder.
+func NewLogMonitorBuilder() LogMonitorBuilder {
+	return &logMonitorBuilder{}
+}
+
+// ParseLogMonitor parses a log monitor query, such as one exported from
+// the Datadog API, into a builder. The log analytics query is parsed with
+// log.ParseAnalyticsQuery and can be edited through Analytics.
+func ParseLogMonitor(query string) (LogMonitorBuilder, error) {
+	query, c, threshold, err := splitThreshold(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := log.ParseAnalyticsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	b := &logMonitorBuilder{query: q}
+	return b.compare(c, threshold), nil
+}
+
+// splitThreshold splits the threshold comparison from the end of a log or
+// event monitor query.
+func splitThreshold(query string) (string, Comparator, float64, error) {
+	m := thresholdPattern.FindStringSubmatch(query)
+	if m == nil {
+		return "", "", 0, fmt.Errorf("%w: %q", ErrMissingThreshold, query)
+	}
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("%w: %q", ErrInvalidThreshold, m[3])
+	}
+	return m[1], Comparator(m[2]), threshold, nil
+}
+
+// Query sets the log analytics query to monitor.
+func (b *logMonitorBuilder) Query(q log.LogAnalyticsBuilder) LogMonitorBuilder {
+	b.query = q
+	return b
+}
+
+// Analytics returns the monitored query.
+func (b *logMonitorBuilder) Analytics() log.LogAnalyticsBuilder {
+	return b.query
+}
+
+// Above alerts when the value is greater than threshold.
+func (b *logMonitorBuilder) Above(threshold float64) LogMonitorBuilder {
+	return b.compare(Above, threshold)
+}
+
+// AboveOrEqual alerts when the value is greater than or equal to threshold.
+func (b *logMonitorBuilder) AboveOrEqual(threshold float64) LogMonitorBuilder {
+	return b.compare(AboveOrEqual, threshold)
+}
+
+// Below alerts when the value is less than threshold.
+func (b *logMonitorBuilder) Below(threshold float64) LogMonitorBuilder {
+	return b.compare(Below, threshold)
+}
+
+// BelowOrEqual alerts when the value is less than or equal to threshold.
+func (b *logMonitorBuilder) BelowOrEqual(threshold float64) LogMonitorBuilder {
+	return b.compare(BelowOrEqual, threshold)
+}
+
+// compare sets the threshold comparison.
+func (b *logMonitorBuilder) compare(c Comparator, threshold float64) LogMonitorBuilder {
+	b.comparator = c
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *logMonitorBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	var query string
+	if b.query == nil {
+		errs = append(errs, ErrMissingQuery)
+	} else {
+		var err error
+		query, err = b.query.Build()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("error building query: %w", err))
+		case !lastWindowPattern.MatchString(query):
+			errs = append(errs, fmt.Errorf("%w: log monitors require last(...)", ErrInvalidEvaluationWindow))
+		}
+	}
+	if b.comparator == "" {
+		errs = append(errs, ErrMissingThreshold)
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(query)
+	writeThreshold(&sb, b.comparator, b.threshold)
+	return sb.String(), nil
+}
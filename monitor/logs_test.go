@@ -0,0 +1,99 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestLogMonitorBuilder(t *testing.T) {
+	errorLogs := func() log.LogAnalyticsBuilder {
+		return log.NewLogAnalyticsBuilder().
+			Search(log.NewLogQueryBuilder().Facet("service", "web").Facet("status", "error")).
+			Index("main").
+			GroupBy("host").
+			Last("5m")
+	}
+
+	tests := []struct {
+		name     string
+		builder  monitor.LogMonitorBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "count above threshold",
+			builder:  monitor.NewLogMonitorBuilder().Query(errorLogs()).Above(100),
+			expected: `logs("service:web status:error").index("main").rollup("count").by("host").last("5m") > 100`,
+		},
+		{
+			name:    "error - no query",
+			builder: monitor.NewLogMonitorBuilder().Above(100),
+			wantErr: monitor.ErrMissingQuery,
+		},
+		{
+			name:    "error - no window",
+			builder: monitor.NewLogMonitorBuilder().Query(log.NewLogAnalyticsBuilder()).Above(100),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - no threshold",
+			builder: monitor.NewLogMonitorBuilder().Query(errorLogs()),
+			wantErr: monitor.ErrMissingThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseLogMonitor(t *testing.T) {
+	const query = `logs("service:web status:error").index("main").rollup("count").by("host").last("5m") >= 100.5`
+
+	b, err := monitor.ParseLogMonitor(query)
+	if err != nil {
+		t.Fatalf("ParseLogMonitor() error = %v", err)
+	}
+	if got, err := b.Build(); err != nil || got != query {
+		t.Errorf("Build() = %s, %v, want %s", got, err, query)
+	}
+
+	b.Analytics().RemoveIndex("main").Index("archive")
+	got, err := b.Below(10).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if want := `logs("service:web status:error").index("archive").rollup("count").by("host").last("5m") < 10`; got != want {
+		t.Errorf("Build() = %s, want %s", got, want)
+	}
+
+	for _, tt := range []struct {
+		query   string
+		wantErr error
+	}{
+		{query: `logs("*").rollup("count").last("5m")`, wantErr: monitor.ErrMissingThreshold},
+		{query: `logs("*").rollup("count").last("5m") > high`, wantErr: monitor.ErrInvalidThreshold},
+		{query: `logs("*").rollup("count").top("5m") > 1`, wantErr: log.ErrInvalidQuery},
+	} {
+		if _, err := monitor.ParseLogMonitor(tt.query); !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseLogMonitor(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
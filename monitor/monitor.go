@@ -0,0 +1,182 @@
+// Package monitor provides builders for creating Datadog metric, log,
+// event and APM trace analytics monitor queries.
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// Comparator is the comparison between the monitored value and its
+// threshold.
+type Comparator string
+
+const (
+	// Above alerts when the value is greater than the threshold.
+	Above Comparator = ">"
+	// AboveOrEqual alerts when the value is greater than or equal to the
+	// threshold.
+	AboveOrEqual Comparator = ">="
+	// Below alerts when the value is less than the threshold.
+	Below Comparator = "<"
+	// BelowOrEqual alerts when the value is less than or equal to the
+	// threshold.
+	BelowOrEqual Comparator = "<="
+)
+
+// timeAggregations lists the supported time aggregations.
+var timeAggregations = map[string]bool{"avg": true, "sum": true, "min": true, "max": true}
+
+// prefixPattern matches an aggregation(window): prefix on a query.
+var prefixPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*\([^)]*\):`)
+
+// MonitorBuilder provides a fluent interface for building metric monitor
+// queries of the form
+//
+//	avg(last_5m):avg:system.cpu.user{env:prod} by {host} > 80
+type MonitorBuilder interface {
+	// Query sets the metric query or expression to monitor. The query must
+	// not carry a time window of its own.
+	Query(q metric.QueryBuilder) MonitorBuilder
+
+	// Aggregation sets how values are aggregated over the evaluation
+	// window: "avg" (the default), "sum", "min" or "max".
+	Aggregation(agg string) MonitorBuilder
+
+	// Window sets the evaluation window (e.g. "last_5m").
+	Window(window string) MonitorBuilder
+
+	// Above alerts when the value is greater than threshold.
+	Above(threshold float64) MonitorBuilder
+
+	// AboveOrEqual alerts when the value is greater than or equal to
+	// threshold.
+	AboveOrEqual(threshold float64) MonitorBuilder
+
+	// Below alerts when the value is less than threshold.
+	Below(threshold float64) MonitorBuilder
+
+	// BelowOrEqual alerts when the value is less than or equal to
+	// threshold.
+	BelowOrEqual(threshold float64) MonitorBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// monitorBuilder is the concrete implementation of the MonitorBuilder
+// interface.
+type monitorBuilder struct {
+	query       metric.QueryBuilder
+	aggregation string
+	window      string
+	comparator  Comparator
+	threshold   float64
+}
+
+// NewMonitorBuilder creates a new metric monitor builder.
+func NewMonitorBuilder() MonitorBuilder {
+	return &monitorBuilder{aggregation: "avg"}
+}
+
+// Query sets the metric query or expression to monitor.
+func (b *monitorBuilder) Query(q metric.QueryBuilder) MonitorBuilder {
+	b.query = q
+	return b
+}
+
+// Aggregation sets how values are aggregated over the evaluation window.
+func (b *monitorBuilder) Aggregation(agg string) MonitorBuilder {
+	b.aggregation = agg
+	return b
+}
+
+// Window sets the evaluation window, which must be one Datadog accepts
+// (see metric.ValidateEvaluationWindow).
+func (b *monitorBuilder) Window(window string) MonitorBuilder {
+	b.window = window
+	return b
+}
+
+// Above alerts when the value is greater than threshold.
+func (b *monitorBuilder) Above(threshold float64) MonitorBuilder {
+	return b.compare(Above, threshold)
+}
+
+// AboveOrEqual alerts when the value is greater than or equal to threshold.
+func (b *monitorBuilder) AboveOrEqual(threshold float64) MonitorBuilder {
+	return b.compare(AboveOrEqual, threshold)
+}
+
+// Below alerts when the value is less than threshold.
+func (b *monitorBuilder) Below(threshold float64) MonitorBuilder {
+	return b.compare(Below, threshold)
+}
+
+// BelowOrEqual alerts when the value is less than or equal to threshold.
+func (b *monitorBuilder) BelowOrEqual(threshold float64) MonitorBuilder {
+	return b.compare(BelowOrEqual, threshold)
+}
+
+// compare sets the threshold comparison.
+func (b *monitorBuilder) compare(c Comparator, threshold float64) MonitorBuilder {
+	b.comparator = c
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *monitorBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	var query string
+	if b.query == nil {
+		errs = append(errs, ErrMissingQuery)
+	} else {
+		var err error
+		query, err = b.query.Build()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("error building query: %w", err))
+		case prefixPattern.MatchString(query):
+			errs = append(errs, fmt.Errorf("%w: %s", ErrNestedEvaluationWindow, query))
+		}
+	}
+
+	if !timeAggregations[b.aggregation] {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidAggregation, b.aggregation))
+	}
+	if err := metric.ValidateEvaluationWindow(b.window); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidEvaluationWindow, err))
+	}
+	if b.comparator == "" {
+		errs = append(errs, ErrMissingThreshold)
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.aggregation)
+	sb.WriteByte('(')
+	sb.WriteString(b.window)
+	sb.WriteString("):")
+	sb.WriteString(query)
+	writeThreshold(&sb, b.comparator, b.threshold)
+	return sb.String(), nil
+}
+
+// writeThreshold writes the threshold comparison that ends a monitor query.
+func writeThreshold(sb *strings.Builder, c Comparator, threshold float64) {
+	sb.WriteByte(' ')
+	sb.WriteString(string(c))
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatFloat(threshold, 'f', -1, 64))
+}
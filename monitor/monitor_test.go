@@ -0,0 +1,106 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestMonitorBuilder(t *testing.T) {
+	cpu := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Aggregator("avg").
+			Metric("system.cpu.user").
+			Filter(metric.NewFilterBuilder("env").Equal("prod")).
+			GroupBy("host")
+	}
+
+	tests := []struct {
+		name     string
+		builder  monitor.MonitorBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "above",
+			builder:  monitor.NewMonitorBuilder().Query(cpu()).Window("last_5m").Above(80),
+			expected: "avg(last_5m):avg:system.cpu.user{env:prod} by {host} > 80",
+		},
+		{
+			name:     "above or equal",
+			builder:  monitor.NewMonitorBuilder().Query(cpu()).Aggregation("max").Window("last_15m").AboveOrEqual(95.5),
+			expected: "max(last_15m):avg:system.cpu.user{env:prod} by {host} >= 95.5",
+		},
+		{
+			name:     "below",
+			builder:  monitor.NewMonitorBuilder().Query(cpu()).Aggregation("min").Window("last_1h").Below(0.5),
+			expected: "min(last_1h):avg:system.cpu.user{env:prod} by {host} < 0.5",
+		},
+		{
+			name:     "below or equal",
+			builder:  monitor.NewMonitorBuilder().Query(cpu()).Aggregation("sum").Window("last_1d").BelowOrEqual(0),
+			expected: "sum(last_1d):avg:system.cpu.user{env:prod} by {host} <= 0",
+		},
+		{
+			name: "expression",
+			builder: func() monitor.MonitorBuilder {
+				q, err := metric.ParseQuery("sum:errors{*} / sum:hits{*} * 100")
+				if err != nil {
+					t.Fatalf("unexpected parse error: %v", err)
+				}
+				return monitor.NewMonitorBuilder().Query(q).Window("last_10m").Above(5)
+			}(),
+			expected: "avg(last_10m):sum:errors{*} / sum:hits{*} * 100 > 5",
+		},
+		{
+			name:    "error - missing query",
+			builder: monitor.NewMonitorBuilder().Window("last_5m").Above(80),
+			wantErr: monitor.ErrMissingQuery,
+		},
+		{
+			name:    "error - invalid query",
+			builder: monitor.NewMonitorBuilder().Query(metric.NewMetricQueryBuilder()).Window("last_5m").Above(80),
+			wantErr: metric.ErrMissingMetric,
+		},
+		{
+			name:    "error - query with its own time window",
+			builder: monitor.NewMonitorBuilder().Query(cpu().TimeWindow("5m")).Window("last_5m").Above(80),
+			wantErr: monitor.ErrNestedEvaluationWindow,
+		},
+		{
+			name:    "error - invalid aggregation",
+			builder: monitor.NewMonitorBuilder().Query(cpu()).Aggregation("p95").Window("last_5m").Above(80),
+			wantErr: monitor.ErrInvalidAggregation,
+		},
+		{
+			name:    "error - missing window",
+			builder: monitor.NewMonitorBuilder().Query(cpu()).Above(80),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - missing threshold",
+			builder: monitor.NewMonitorBuilder().Query(cpu()).Window("last_5m"),
+			wantErr: monitor.ErrMissingThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
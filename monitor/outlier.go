@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// OutlierMonitorBuilder provides a fluent interface for building outlier
+// monitor queries of the form
+//
+//	avg(last_1h):outliers(avg:system.cpu.user{*} by {host}, 'DBSCAN', 3) > 0
+//
+// The monitor alerts whenever any group is an outlier, so it has no
+// threshold of its own.
+type OutlierMonitorBuilder interface {
+	// Query sets the metric query to check. The query must not carry a
+	// time window of its own and should be grouped, since outliers are
+	// found among its groups.
+	Query(q metric.QueryBuilder) OutlierMonitorBuilder
+
+	// Outliers selects the outlier algorithm, its tolerance and, for the
+	// MAD algorithms, an optional pct, as metric.Outliers. The default is
+	// DBSCAN with a tolerance of 3.
+	Outliers(algorithm metric.OutlierAlgorithm, tolerance float64, pct ...float64) OutlierMonitorBuilder
+
+	// Aggregation sets how values are aggregated over the evaluation
+	// window: "avg" (the default), "sum", "min" or "max".
+	Aggregation(agg string) OutlierMonitorBuilder
+
+	// Window sets the evaluation window (e.g. "last_1h").
+	Window(window string) OutlierMonitorBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// outlierMonitorBuilder is the concrete implementation of the
+// OutlierMonitorBuilder interface.
+type outlierMonitorBuilder struct {
+	query       metric.QueryBuilder
+	algorithm   metric.OutlierAlgorithm
+	tolerance   float64
+	pct         []float64
+	aggregation string
+	window      string
+}
+
+// NewOutlierMonitorBuilder creates a new outlier monitor builder.
+func NewOutlierMonitorBuilder() OutlierMonitorBuilder {
+	return &outlierMonitorBuilder{
+		algorithm:   metric.OutlierDBSCAN,
+		tolerance:   3,
+		aggregation: "avg",
+	}
+}
+
+// Query sets the metric query to check.
+func (b *outlierMonitorBuilder) Query(q metric.QueryBuilder) OutlierMonitorBuilder {
+	b.query = q
+	return b
+}
+
+// Outliers selects the outlier algorithm, tolerance and pct.
+func (b *outlierMonitorBuilder) Outliers(algorithm metric.OutlierAlgorithm, tolerance float64, pct ...float64) OutlierMonitorBuilder {
+	b.algorithm = algorithm
+	b.tolerance = tolerance
+	b.pct = pct
+	return b
+}
+
+// Aggregation sets how values are aggregated over the evaluation window.
+func (b *outlierMonitorBuilder) Aggregation(agg string) OutlierMonitorBuilder {
+	b.aggregation = agg
+	return b
+}
+
+// Window sets the evaluation window.
+func (b *outlierMonitorBuilder) Window(window string) OutlierMonitorBuilder {
+	b.window = window
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *outlierMonitorBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	var query string
+	if b.query == nil {
+		errs = append(errs, ErrMissingQuery)
+	} else {
+		var err error
+		query, err = b.query.Build()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("error building query: %w", err))
+		case prefixPattern.MatchString(query):
+			errs = append(errs, fmt.Errorf("%w: %s", ErrNestedEvaluationWindow, query))
+		default:
+			query, err = metric.Outliers(b.algorithm, b.tolerance, b.pct...).Wrap(query)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if !timeAggregations[b.aggregation] {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidAggregation, b.aggregation))
+	}
+	if err := metric.ValidateEvaluationWindow(b.window); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidEvaluationWindow, err))
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.aggregation)
+	sb.WriteByte('(')
+	sb.WriteString(b.window)
+	sb.WriteString("):")
+	sb.WriteString(query)
+	sb.WriteString(" > 0")
+	return sb.String(), nil
+}
@@ -0,0 +1,81 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestOutlierMonitorBuilder(t *testing.T) {
+	cpu := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().
+			Aggregator("avg").
+			Metric("system.cpu.user").
+			GroupBy("host")
+	}
+
+	tests := []struct {
+		name     string
+		builder  monitor.OutlierMonitorBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "default DBSCAN",
+			builder:  monitor.NewOutlierMonitorBuilder().Query(cpu()).Window("last_1h"),
+			expected: "avg(last_1h):outliers(avg:system.cpu.user{*} by {host}, 'DBSCAN', 3) > 0",
+		},
+		{
+			name:     "MAD with pct",
+			builder:  monitor.NewOutlierMonitorBuilder().Query(cpu()).Outliers(metric.OutlierMAD, 3, 20).Aggregation("max").Window("last_15m"),
+			expected: "max(last_15m):outliers(avg:system.cpu.user{*} by {host}, 'MAD', 3, 20) > 0",
+		},
+		{
+			name:    "error - invalid window",
+			builder: monitor.NewOutlierMonitorBuilder().Query(cpu()).Window("1h"),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - missing query",
+			builder: monitor.NewOutlierMonitorBuilder().Window("last_1h"),
+			wantErr: monitor.ErrMissingQuery,
+		},
+		{
+			name:    "error - invalid aggregation",
+			builder: monitor.NewOutlierMonitorBuilder().Query(cpu()).Aggregation("count").Window("last_1h"),
+			wantErr: monitor.ErrInvalidAggregation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Build() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOutlierMonitorBuilderInvalidTolerance(t *testing.T) {
+	_, err := monitor.NewOutlierMonitorBuilder().
+		Query(metric.NewMetricQueryBuilder().Aggregator("avg").Metric("system.cpu.user").GroupBy("host")).
+		Outliers(metric.OutlierDBSCAN, 0).
+		Window("last_1h").
+		Build()
+	var vErr *metric.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Errorf("Build() error = %v, want *ValidationError", err)
+	}
+}
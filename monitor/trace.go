@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonwinton/ddqb/log"
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// traceRollups lists the rollups supported by trace analytics monitors,
+// which share their aggregations with log analytics.
+var traceRollups = map[log.Aggregation]bool{
+	log.Count: true, log.Cardinality: true, log.Sum: true, log.Min: true, log.Max: true, log.Avg: true,
+	log.P50: true, log.P75: true, log.P90: true, log.P95: true, log.P98: true, log.P99: true,
+}
+
+// TraceAnalyticsBuilder provides a fluent interface for building APM trace
+// analytics monitor queries of the form
+//
+//	trace-analytics("service:web @duration:>2s").rollup("count").by("resource_name").last("10m") > 50
+type TraceAnalyticsBuilder interface {
+	// Search sets the span search selecting the spans to aggregate, in
+	// Datadog's trace search syntax. Without one every span is aggregated.
+	Search(search string) TraceAnalyticsBuilder
+
+	// Count counts matching spans. This is the default rollup.
+	Count() TraceAnalyticsBuilder
+
+	// Cardinality counts the unique values of facet.
+	Cardinality(facet string) TraceAnalyticsBuilder
+
+	// Rollup applies agg to measure, e.g. Rollup(log.P95, "@duration").
+	Rollup(agg log.Aggregation, measure string) TraceAnalyticsBuilder
+
+	// GroupBy groups the results by the given facets.
+	GroupBy(facets ...string) TraceAnalyticsBuilder
+
+	// Last sets the evaluation window (e.g. "10m", "1h").
+	Last(window string) TraceAnalyticsBuilder
+
+	// Above alerts when the value is greater than threshold.
+	Above(threshold float64) TraceAnalyticsBuilder
+
+	// AboveOrEqual alerts when the value is greater than or equal to
+	// threshold.
+	AboveOrEqual(threshold float64) TraceAnalyticsBuilder
+
+	// Below alerts when the value is less than threshold.
+	Below(threshold float64) TraceAnalyticsBuilder
+
+	// BelowOrEqual alerts when the value is less than or equal to
+	// threshold.
+	BelowOrEqual(threshold float64) TraceAnalyticsBuilder
+
+	// Build returns the built monitor query as a string.
+	Build() (string, error)
+}
+
+// traceAnalyticsBuilder is the concrete implementation of the
+// TraceAnalyticsBuilder interface.
+type traceAnalyticsBuilder struct {
+	search     string
+	rollup     log.Aggregation
+	measure    string
+	groupBy    []string
+	window     string
+	comparator Comparator
+	threshold  float64
+}
+
+// NewTraceAnalyticsBuilder creates a new trace analytics monitor builder.
+func NewTraceAnalyticsBuilder() TraceAnalyticsBuilder {
+	return &traceAnalyticsBuilder{
+		rollup:  log.Count,
+		groupBy: make([]string, 0),
+	}
+}
+
+// Search sets the span search selecting the spans to aggregate.
+func (b *traceAnalyticsBuilder) Search(search string) TraceAnalyticsBuilder {
+	b.search = search
+	return b
+}
+
+// Count counts matching spans.
+func (b *traceAnalyticsBuilder) Count() TraceAnalyticsBuilder {
+	return b.Rollup(log.Count, "")
+}
+
+// Cardinality counts the unique values of facet.
+func (b *traceAnalyticsBuilder) Cardinality(facet string) TraceAnalyticsBuilder {
+	return b.Rollup(log.Cardinality, facet)
+}
+
+// Rollup applies agg to measure.
+func (b *traceAnalyticsBuilder) Rollup(agg log.Aggregation, measure string) TraceAnalyticsBuilder {
+	b.rollup = agg
+	b.measure = measure
+	return b
+}
+
+// GroupBy groups the results by the given facets.
+func (b *traceAnalyticsBuilder) GroupBy(facets ...string) TraceAnalyticsBuilder {
+	b.groupBy = append(b.groupBy, facets...)
+	return b
+}
+
+// Last sets the evaluation window.
+func (b *traceAnalyticsBuilder) Last(window string) TraceAnalyticsBuilder {
+	b.window = window
+	return b
+}
+
+// Above alerts when the value is greater than threshold.
+func (b *traceAnalyticsBuilder) Above(threshold float64) TraceAnalyticsBuilder {
+	return b.compare(Above, threshold)
+}
+
+// AboveOrEqual alerts when the value is greater than or equal to threshold.
+func (b *traceAnalyticsBuilder) AboveOrEqual(threshold float64) TraceAnalyticsBuilder {
+	return b.compare(AboveOrEqual, threshold)
+}
+
+// Below alerts when the value is less than threshold.
+func (b *traceAnalyticsBuilder) Below(threshold float64) TraceAnalyticsBuilder {
+	return b.compare(Below, threshold)
+}
+
+// BelowOrEqual alerts when the value is less than or equal to threshold.
+func (b *traceAnalyticsBuilder) BelowOrEqual(threshold float64) TraceAnalyticsBuilder {
+	return b.compare(BelowOrEqual, threshold)
+}
+
+// compare sets the threshold comparison.
+func (b *traceAnalyticsBuilder) compare(c Comparator, threshold float64) TraceAnalyticsBuilder {
+	b.comparator = c
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built monitor query as a string.
+func (b *traceAnalyticsBuilder) Build() (string, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	switch {
+	case !traceRollups[b.rollup]:
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidRollup, b.rollup))
+	case b.rollup != log.Count && b.measure == "":
+		errs = append(errs, fmt.Errorf("%w: %s", ErrMissingMeasure, b.rollup))
+	}
+
+	// Trace analytics windows are written without the last_ prefix but
+	// accept the same ranges as metric evaluation windows
+	if err := metric.ValidateEvaluationWindow("last_" + b.window); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidEvaluationWindow, b.window))
+	}
+	if b.comparator == "" {
+		errs = append(errs, ErrMissingThreshold)
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	search := b.search
+	if search == "" {
+		search = "*"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("trace-analytics(")
+	writeQuoted(&sb, search)
+	sb.WriteString(").rollup(")
+	writeQuoted(&sb, string(b.rollup))
+	if b.measure != "" {
+		sb.WriteString(", ")
+		writeQuoted(&sb, b.measure)
+	}
+	sb.WriteByte(')')
+
+	if len(b.groupBy) > 0 {
+		sb.WriteString(".by(")
+		writeQuoted(&sb, strings.Join(b.groupBy, ","))
+		sb.WriteByte(')')
+	}
+
+	sb.WriteString(".last(")
+	writeQuoted(&sb, b.window)
+	sb.WriteByte(')')
+
+	writeThreshold(&sb, b.comparator, b.threshold)
+	return sb.String(), nil
+}
+
+// writeQuoted writes s to sb as a double-quoted string, escaping quotes and
+// backslashes.
+func writeQuoted(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, c := range s {
+		if c == '"' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('"')
+}
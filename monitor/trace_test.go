@@ -0,0 +1,87 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/log"
+	"github.com/jonwinton/ddqb/monitor"
+)
+
+func TestTraceAnalyticsBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  monitor.TraceAnalyticsBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "count",
+			builder:  monitor.NewTraceAnalyticsBuilder().Search("service:web @duration:>2s").Last("10m").Above(50),
+			expected: `trace-analytics("service:web @duration:>2s").rollup("count").last("10m") > 50`,
+		},
+		{
+			name:     "match all spans",
+			builder:  monitor.NewTraceAnalyticsBuilder().Count().Last("5m").AboveOrEqual(1000),
+			expected: `trace-analytics("*").rollup("count").last("5m") >= 1000`,
+		},
+		{
+			name:     "cardinality grouped",
+			builder:  monitor.NewTraceAnalyticsBuilder().Search("env:prod").Cardinality("@usr.id").GroupBy("service", "resource_name").Last("1h").Below(10),
+			expected: `trace-analytics("env:prod").rollup("cardinality", "@usr.id").by("service,resource_name").last("1h") < 10`,
+		},
+		{
+			name:     "percentile",
+			builder:  monitor.NewTraceAnalyticsBuilder().Search("service:web").Rollup(log.P95, "@duration").Last("15m").BelowOrEqual(0.5),
+			expected: `trace-analytics("service:web").rollup("pc95", "@duration").last("15m") <= 0.5`,
+		},
+		{
+			name:     "quotes are escaped",
+			builder:  monitor.NewTraceAnalyticsBuilder().Search(`resource_name:"GET /"`).Last("5m").Above(1),
+			expected: `trace-analytics("resource_name:\"GET /\"").rollup("count").last("5m") > 1`,
+		},
+		{
+			name:    "error - invalid rollup",
+			builder: monitor.NewTraceAnalyticsBuilder().Rollup("median", "@duration").Last("5m").Above(1),
+			wantErr: monitor.ErrInvalidRollup,
+		},
+		{
+			name:    "error - missing measure",
+			builder: monitor.NewTraceAnalyticsBuilder().Rollup(log.Avg, "").Last("5m").Above(1),
+			wantErr: monitor.ErrMissingMeasure,
+		},
+		{
+			name:    "error - missing window",
+			builder: monitor.NewTraceAnalyticsBuilder().Above(1),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - window too long",
+			builder: monitor.NewTraceAnalyticsBuilder().Last("5w").Above(1),
+			wantErr: monitor.ErrInvalidEvaluationWindow,
+		},
+		{
+			name:    "error - missing threshold",
+			builder: monitor.NewTraceAnalyticsBuilder().Last("5m"),
+			wantErr: monitor.ErrMissingThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
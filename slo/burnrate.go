@@ -0,0 +1,162 @@
+// Package slo provides builders for creating Datadog SLO alert queries.
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLongWindow is the longest long window Datadog accepts for burn rate
+// alerts.
+const maxLongWindow = 48 * time.Hour
+
+var (
+	// sloIDPattern matches an SLO ID.
+	sloIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	// windowPattern matches a burn rate window such as 5m, 1h or 2d.
+	windowPattern = regexp.MustCompile(`^([1-9][0-9]*)([mhd])$`)
+)
+
+// timeWindows lists the SLO time windows burn rates can be computed over.
+var timeWindows = map[string]bool{"7d": true, "30d": true, "90d": true}
+
+// windowUnits maps window suffixes to their durations.
+var windowUnits = map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}
+
+// BurnRateBuilder provides a fluent interface for building SLO burn rate
+// alert queries:
+//
+//	burn_rate("slo_id").over("7d").long_window("1h").short_window("5m") > 14.4
+type BurnRateBuilder interface {
+	// Over sets the SLO time window the burn rate is computed against:
+	// "7d", "30d" or "90d".
+	Over(timeWindow string) BurnRateBuilder
+
+	// LongWindow sets the long alerting window (e.g. "1h"), at most 48h.
+	LongWindow(window string) BurnRateBuilder
+
+	// ShortWindow sets the optional short alerting window (e.g. "5m"),
+	// which must be shorter than the long window.
+	ShortWindow(window string) BurnRateBuilder
+
+	// Above sets the burn rate that triggers the alert.
+	Above(threshold float64) BurnRateBuilder
+
+	// Build returns the built query as a string.
+	Build() (string, error)
+}
+
+// burnRateBuilder is the concrete implementation of the BurnRateBuilder
+// interface.
+type burnRateBuilder struct {
+	sloID       string
+	timeWindow  string
+	longWindow  string
+	shortWindow string
+	threshold   float64
+}
+
+// NewBurnRateBuilder creates a new burn rate alert builder for the SLO
+// with the given ID.
+func NewBurnRateBuilder(sloID string) BurnRateBuilder {
+	return &burnRateBuilder{sloID: sloID}
+}
+
+// Over sets the SLO time window the burn rate is computed against.
+func (b *burnRateBuilder) Over(timeWindow string) BurnRateBuilder {
+	b.timeWindow = timeWindow
+	return b
+}
+
+// LongWindow sets the long alerting window.
+func (b *burnRateBuilder) LongWindow(window string) BurnRateBuilder {
+	b.longWindow = window
+	return b
+}
+
+// ShortWindow sets the optional short alerting window.
+func (b *burnRateBuilder) ShortWindow(window string) BurnRateBuilder {
+	b.shortWindow = window
+	return b
+}
+
+// Above sets the burn rate that triggers the alert.
+func (b *burnRateBuilder) Above(threshold float64) BurnRateBuilder {
+	b.threshold = threshold
+	return b
+}
+
+// Build returns the built query as a string.
+func (b *burnRateBuilder) Build() (string, error) {
+	if err := b.validate(); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "burn_rate(%q).over(%q).long_window(%q)", b.sloID, b.timeWindow, b.longWindow)
+	if b.shortWindow != "" {
+		fmt.Fprintf(&sb, ".short_window(%q)", b.shortWindow)
+	}
+	sb.WriteString(" > ")
+	sb.WriteString(strconv.FormatFloat(b.threshold, 'f', -1, 64))
+	return sb.String(), nil
+}
+
+// validate collects every problem with the query rather than stopping at
+// the first.
+func (b *burnRateBuilder) validate() error {
+	var errs []error
+
+	switch {
+	case b.sloID == "":
+		errs = append(errs, ErrMissingSLOID)
+	case !sloIDPattern.MatchString(b.sloID):
+		errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidSLOID, b.sloID))
+	}
+
+	if !timeWindows[b.timeWindow] {
+		errs = append(errs, fmt.Errorf("%w: got %q", ErrInvalidTimeWindow, b.timeWindow))
+	}
+
+	long, err := parseWindow("long", b.longWindow)
+	if err != nil {
+		errs = append(errs, err)
+	} else if long > maxLongWindow {
+		errs = append(errs, fmt.Errorf("%w: long window %q exceeds 48h", ErrInvalidWindow, b.longWindow))
+	}
+
+	if b.shortWindow != "" {
+		short, shortErr := parseWindow("short", b.shortWindow)
+		switch {
+		case shortErr != nil:
+			errs = append(errs, shortErr)
+		case err == nil && short >= long:
+			errs = append(errs, fmt.Errorf("%w: short %q, long %q", ErrInvalidWindowPair, b.shortWindow, b.longWindow))
+		}
+	}
+
+	if !(b.threshold > 0) {
+		errs = append(errs, fmt.Errorf("%w: got %v", ErrInvalidThreshold, b.threshold))
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseWindow converts a window such as "5m", "1h" or "2d" to a duration.
+// name identifies the window in errors.
+func parseWindow(name, window string) (time.Duration, error) {
+	m := windowPattern.FindStringSubmatch(window)
+	if m == nil {
+		return 0, fmt.Errorf("%w: %s window %q must be a number of minutes, hours or days (e.g. 5m, 1h)", ErrInvalidWindow, name, window)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s window %q: %v", ErrInvalidWindow, name, window, err)
+	}
+	return time.Duration(n) * windowUnits[m[2]], nil
+}
@@ -0,0 +1,91 @@
+package slo_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/slo"
+)
+
+func TestBurnRateBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  slo.BurnRateBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "long window only",
+			builder:  slo.NewBurnRateBuilder("abc123").Over("30d").LongWindow("1h").Above(14.4),
+			expected: `burn_rate("abc123").over("30d").long_window("1h") > 14.4`,
+		},
+		{
+			name:     "long and short window",
+			builder:  slo.NewBurnRateBuilder("abc123").Over("7d").LongWindow("6h").ShortWindow("30m").Above(6),
+			expected: `burn_rate("abc123").over("7d").long_window("6h").short_window("30m") > 6`,
+		},
+		{
+			name:     "longest long window",
+			builder:  slo.NewBurnRateBuilder("abc123").Over("90d").LongWindow("2d").ShortWindow("4h").Above(1),
+			expected: `burn_rate("abc123").over("90d").long_window("2d").short_window("4h") > 1`,
+		},
+		{
+			name:    "error - missing SLO ID",
+			builder: slo.NewBurnRateBuilder("").Over("7d").LongWindow("1h").Above(14.4),
+			wantErr: slo.ErrMissingSLOID,
+		},
+		{
+			name:    "error - invalid SLO ID",
+			builder: slo.NewBurnRateBuilder(`abc"123`).Over("7d").LongWindow("1h").Above(14.4),
+			wantErr: slo.ErrInvalidSLOID,
+		},
+		{
+			name:    "error - unsupported time window",
+			builder: slo.NewBurnRateBuilder("abc123").Over("14d").LongWindow("1h").Above(14.4),
+			wantErr: slo.ErrInvalidTimeWindow,
+		},
+		{
+			name:    "error - missing long window",
+			builder: slo.NewBurnRateBuilder("abc123").Over("7d").Above(14.4),
+			wantErr: slo.ErrInvalidWindow,
+		},
+		{
+			name:    "error - long window over 48h",
+			builder: slo.NewBurnRateBuilder("abc123").Over("30d").LongWindow("3d").Above(1),
+			wantErr: slo.ErrInvalidWindow,
+		},
+		{
+			name:    "error - malformed short window",
+			builder: slo.NewBurnRateBuilder("abc123").Over("7d").LongWindow("1h").ShortWindow("5 minutes").Above(14.4),
+			wantErr: slo.ErrInvalidWindow,
+		},
+		{
+			name:    "error - short window not shorter than long window",
+			builder: slo.NewBurnRateBuilder("abc123").Over("7d").LongWindow("1h").ShortWindow("60m").Above(14.4),
+			wantErr: slo.ErrInvalidWindowPair,
+		},
+		{
+			name:    "error - missing threshold",
+			builder: slo.NewBurnRateBuilder("abc123").Over("7d").LongWindow("1h"),
+			wantErr: slo.ErrInvalidThreshold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Build() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
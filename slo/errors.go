@@ -0,0 +1,30 @@
+package slo
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the builder. Use errors.Is
+// to test for them.
+var (
+	// ErrMissingSLOID is returned when a query is built without an SLO ID.
+	ErrMissingSLOID = errors.New("SLO ID is required")
+
+	// ErrInvalidSLOID is returned when an SLO ID contains characters other
+	// than letters, digits, '-' and '_'.
+	ErrInvalidSLOID = errors.New("invalid SLO ID")
+
+	// ErrInvalidTimeWindow is returned when the SLO time window is not one
+	// of 7d, 30d or 90d.
+	ErrInvalidTimeWindow = errors.New("SLO time window must be 7d, 30d or 90d")
+
+	// ErrInvalidWindow is returned when a long or short window is missing,
+	// malformed, or outside the range Datadog allows.
+	ErrInvalidWindow = errors.New("invalid burn rate window")
+
+	// ErrInvalidWindowPair is returned when the short window is not shorter
+	// than the long window.
+	ErrInvalidWindowPair = errors.New("short window must be shorter than long window")
+
+	// ErrInvalidThreshold is returned when the burn rate threshold is
+	// missing or not positive.
+	ErrInvalidThreshold = errors.New("burn rate threshold must be positive")
+)
@@ -0,0 +1,235 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// DashboardRequest is a dashboard widget request in the formulas and
+// functions format of the v2 dashboard JSON:
+//
+//	{
+//	  "queries": [
+//	    {"data_source": "metrics", "name": "a", "query": "sum:trace.http.request.errors{env:prod}"},
+//	    {"data_source": "metrics", "name": "b", "query": "sum:trace.http.request.hits{env:prod}"}
+//	  ],
+//	  "formulas": [{"formula": "a / b * 100", "alias": "error rate"}],
+//	  "response_format": "timeseries"
+//	}
+//
+// Metric queries are parsed into builders that can be edited; queries of
+// other data sources, and every field the request carries besides the
+// queries and formulas, are kept and written back unchanged. Marshal it
+// with encoding/json to re-emit the request with the edited queries.
+type DashboardRequest struct {
+	Queries  []DashboardQuery
+	Formulas []DashboardFormula
+
+	// extra holds the fields of the request other than queries and
+	// formulas.
+	extra map[string]json.RawMessage
+}
+
+// DashboardQuery is a named query of a DashboardRequest.
+type DashboardQuery struct {
+	// Name is the name formulas use to refer to the query.
+	Name string
+	// DataSource is the data source of the query, such as
+	// DataSourceMetrics or "logs".
+	DataSource string
+	// Query is the parsed metric query. It is nil for queries of other
+	// data sources, which are written back as they were read.
+	Query metric.QueryBuilder
+
+	// fields holds every field of the query as it was read.
+	fields map[string]json.RawMessage
+}
+
+// DashboardFormula is a formula of a DashboardRequest.
+type DashboardFormula struct {
+	// Formula combines the named queries, e.g. "a / b * 100".
+	Formula string
+
+	// fields holds every field of the formula as it was read, such as
+	// its alias, limit or number format.
+	fields map[string]json.RawMessage
+}
+
+// ParseDashboardRequest parses data, a dashboard widget request in the
+// formulas and functions format, parsing its metric queries with opts.
+// Every query that fails to parse is reported, prefixed with its name, in
+// a single joined error.
+func ParseDashboardRequest(data []byte, opts ...metric.ParseOption) (*DashboardRequest, error) {
+	r := &DashboardRequest{}
+	if err := r.unmarshal(data, opts); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Query returns the builder of the metric query called name, or nil if
+// the request has no such metric query.
+func (r *DashboardRequest) Query(name string) metric.QueryBuilder {
+	for _, q := range r.Queries {
+		if q.Name == name {
+			return q.Query
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON parses data like ParseDashboardRequest, without parse
+// options, so that requests can be read as part of a larger dashboard
+// definition.
+func (r *DashboardRequest) UnmarshalJSON(data []byte) error {
+	return r.unmarshal(data, nil)
+}
+
+// unmarshal implements ParseDashboardRequest and UnmarshalJSON.
+func (r *DashboardRequest) unmarshal(data []byte, opts []metric.ParseOption) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var raw struct {
+		Queries  []map[string]json.RawMessage `json:"queries"`
+		Formulas []map[string]json.RawMessage `json:"formulas"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	delete(fields, "queries")
+	delete(fields, "formulas")
+
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	queries := make([]DashboardQuery, 0, len(raw.Queries))
+	for i, f := range raw.Queries {
+		q := DashboardQuery{fields: f}
+		if err := unmarshalField(f, "name", &q.Name); err != nil {
+			errs = append(errs, fmt.Errorf("query %d: %w", i, err))
+			continue
+		}
+		if err := unmarshalField(f, "data_source", &q.DataSource); err != nil {
+			errs = append(errs, fmt.Errorf("query %q: %w", q.Name, err))
+			continue
+		}
+		if q.DataSource == DataSourceMetrics {
+			var query string
+			if err := unmarshalField(f, "query", &query); err != nil {
+				errs = append(errs, fmt.Errorf("query %q: %w", q.Name, err))
+				continue
+			}
+			if query == "" {
+				errs = append(errs, fmt.Errorf("query %q: %w", q.Name, ErrMissingQuery))
+				continue
+			}
+			builder, err := metric.ParseQuery(query, opts...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query %q: %w", q.Name, err))
+				continue
+			}
+			q.Query = builder
+		}
+		queries = append(queries, q)
+	}
+
+	formulas := make([]DashboardFormula, 0, len(raw.Formulas))
+	for i, f := range raw.Formulas {
+		formula := DashboardFormula{fields: f}
+		if err := unmarshalField(f, "formula", &formula.Formula); err != nil {
+			errs = append(errs, fmt.Errorf("formula %d: %w", i, err))
+			continue
+		}
+		formulas = append(formulas, formula)
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	r.Queries, r.Formulas, r.extra = queries, formulas, fields
+	return nil
+}
+
+// MarshalJSON returns the request with every metric query built afresh.
+// Query names and formulas are checked as Build checks them; every
+// problem is reported in a single joined error.
+func (r *DashboardRequest) MarshalJSON() ([]byte, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	names := make([]string, 0, len(r.Queries))
+	seen := make(map[string]bool, len(r.Queries))
+	queries := make([]map[string]any, 0, len(r.Queries))
+	for _, q := range r.Queries {
+		switch {
+		case !queryNamePattern.MatchString(q.Name):
+			errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidQueryName, q.Name))
+		case seen[q.Name]:
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicateQueryName, q.Name))
+		}
+		seen[q.Name] = true
+		names = append(names, q.Name)
+
+		fields := cloneFields(q.fields)
+		fields["name"], fields["data_source"] = q.Name, q.DataSource
+		if q.Query != nil {
+			query, err := q.Query.Build()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query %q: %w", q.Name, err))
+				continue
+			}
+			fields["query"] = query
+		} else if q.DataSource == DataSourceMetrics {
+			errs = append(errs, fmt.Errorf("query %q: %w", q.Name, ErrMissingQuery))
+			continue
+		}
+		queries = append(queries, fields)
+	}
+
+	formulas := make([]map[string]any, 0, len(r.Formulas))
+	for _, f := range r.Formulas {
+		if err := ValidateFormula(f.Formula, names...); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fields := cloneFields(f.fields)
+		fields["formula"] = f.Formula
+		formulas = append(formulas, fields)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	out := cloneFields(r.extra)
+	out["queries"], out["formulas"] = queries, formulas
+	return json.Marshal(out)
+}
+
+// unmarshalField decodes fields[key] into v, leaving v unchanged if the
+// field is absent.
+func unmarshalField(fields map[string]json.RawMessage, key string, v any) error {
+	data, ok := fields[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("field %q: %w", key, err)
+	}
+	return nil
+}
+
+// cloneFields returns a copy of fields, never nil, to which fields with
+// new values can be added.
+func cloneFields(fields map[string]json.RawMessage) map[string]any {
+	out := make(map[string]any, len(fields)+2)
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out
+}
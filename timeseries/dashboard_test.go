@@ -0,0 +1,114 @@
+package timeseries_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/timeseries"
+)
+
+const dashboardRequest = `{
+  "queries": [
+    {"data_source": "metrics", "name": "a", "query": "sum:trace.http.request.errors{env:prod,service:web}.as_count()"},
+    {"data_source": "metrics", "name": "b", "query": "sum:trace.http.request.hits{env:prod,service:web}.as_count()"},
+    {"data_source": "logs", "name": "c", "compute": {"aggregation": "count"}, "search": {"query": "status:error"}, "indexes": ["*"]}
+  ],
+  "formulas": [{"formula": "a / b * 100", "alias": "error rate"}],
+  "response_format": "timeseries",
+  "display_type": "line"
+}`
+
+func TestDashboardRequest(t *testing.T) {
+	env := func() metric.FilterBuilder { return metric.NewFilterBuilder("env").Equal("staging") }
+
+	tests := []struct {
+		name     string
+		opts     []metric.ParseOption
+		modify   func(*timeseries.DashboardRequest)
+		expected string
+	}{
+		{
+			name:     "unmodified",
+			opts:     []metric.ParseOption{metric.PreserveFormatting()},
+			modify:   func(*timeseries.DashboardRequest) {},
+			expected: `{"display_type":"line","formulas":[{"alias":"error rate","formula":"a / b * 100"}],"queries":[{"data_source":"metrics","name":"a","query":"sum:trace.http.request.errors{env:prod,service:web}.as_count()"},{"data_source":"metrics","name":"b","query":"sum:trace.http.request.hits{env:prod,service:web}.as_count()"},{"compute":{"aggregation":"count"},"data_source":"logs","indexes":["*"],"name":"c","search":{"query":"status:error"}}],"response_format":"timeseries"}`,
+		},
+		{
+			name: "edited queries and formula",
+			modify: func(r *timeseries.DashboardRequest) {
+				r.Query("a").RemoveFilter("env").Filter(env())
+				r.Query("b").RemoveFilter("env").Filter(env())
+				r.Formulas[0].Formula = "(a + c) / b * 100"
+			},
+			expected: `{"display_type":"line","formulas":[{"alias":"error rate","formula":"(a + c) / b * 100"}],"queries":[{"data_source":"metrics","name":"a","query":"sum:trace.http.request.errors{service:web, env:staging}.as_count()"},{"data_source":"metrics","name":"b","query":"sum:trace.http.request.hits{service:web, env:staging}.as_count()"},{"compute":{"aggregation":"count"},"data_source":"logs","indexes":["*"],"name":"c","search":{"query":"status:error"}}],"response_format":"timeseries"}`,
+		},
+		{
+			name: "added query",
+			opts: []metric.ParseOption{metric.PreserveFormatting()},
+			modify: func(r *timeseries.DashboardRequest) {
+				r.Queries = append(r.Queries[:2], timeseries.DashboardQuery{
+					Name:       "d",
+					DataSource: timeseries.DataSourceMetrics,
+					Query:      metric.NewMetricQueryBuilder().Aggregator("sum").Metric("trace.http.request.retries").Filter(env()),
+				})
+				r.Formulas = append(r.Formulas, timeseries.DashboardFormula{Formula: "d"})
+			},
+			expected: `{"display_type":"line","formulas":[{"alias":"error rate","formula":"a / b * 100"},{"formula":"d"}],"queries":[{"data_source":"metrics","name":"a","query":"sum:trace.http.request.errors{env:prod,service:web}.as_count()"},{"data_source":"metrics","name":"b","query":"sum:trace.http.request.hits{env:prod,service:web}.as_count()"},{"data_source":"metrics","name":"d","query":"sum:trace.http.request.retries{env:staging}"}],"response_format":"timeseries"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := timeseries.ParseDashboardRequest([]byte(dashboardRequest), tt.opts...)
+			if err != nil {
+				t.Fatalf("ParseDashboardRequest() error = %v", err)
+			}
+			tt.modify(req)
+			got, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("unexpected marshal error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Marshal() =\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDashboardRequestEmbedded(t *testing.T) {
+	var widget struct {
+		Type     string                         `json:"type"`
+		Requests []*timeseries.DashboardRequest `json:"requests"`
+	}
+	if err := json.Unmarshal([]byte(`{"type":"timeseries","requests":[`+dashboardRequest+`]}`), &widget); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(widget.Requests) != 1 || len(widget.Requests[0].Queries) != 3 {
+		t.Fatalf("Unmarshal() = %+v, want one request with 3 queries", widget.Requests)
+	}
+	if q := widget.Requests[0].Query("c"); q != nil {
+		t.Errorf("Query(%q) = %v, want nil for a logs query", "c", q)
+	}
+}
+
+func TestDashboardRequestErrors(t *testing.T) {
+	_, err := timeseries.ParseDashboardRequest([]byte(`{"queries":[{"data_source":"metrics","name":"a","query":"sum:a{env:prod | x}"},{"data_source":"metrics","name":"b"}]}`))
+	var parseErr *metric.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("ParseDashboardRequest() error = %v, want a *metric.ParseError", err)
+	}
+	if !errors.Is(err, timeseries.ErrMissingQuery) {
+		t.Errorf("ParseDashboardRequest() error = %v, want %v", err, timeseries.ErrMissingQuery)
+	}
+
+	req, err := timeseries.ParseDashboardRequest([]byte(dashboardRequest))
+	if err != nil {
+		t.Fatalf("ParseDashboardRequest() error = %v", err)
+	}
+	req.Formulas[0].Formula = "a / e"
+	if _, err := json.Marshal(req); !errors.Is(err, timeseries.ErrUndefinedReference) {
+		t.Errorf("Marshal() error = %v, want %v", err, timeseries.ErrUndefinedReference)
+	}
+}
@@ -0,0 +1,37 @@
+package timeseries
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the builder. Use errors.Is
+// to test for them.
+var (
+	// ErrMissingQuery is returned when a request is built without any
+	// queries.
+	ErrMissingQuery = errors.New("at least one query is required")
+
+	// ErrInvalidQueryName is returned for query names that cannot be
+	// referenced from a formula.
+	ErrInvalidQueryName = errors.New("invalid query name")
+
+	// ErrDuplicateQueryName is returned when two queries share a name.
+	ErrDuplicateQueryName = errors.New("duplicate query name")
+
+	// ErrEmptyFormula is returned when an empty formula is added.
+	ErrEmptyFormula = errors.New("formula cannot be empty")
+
+	// ErrInvalidFormula is returned for formulas that cannot be parsed,
+	// such as those with unbalanced parentheses.
+	ErrInvalidFormula = errors.New("invalid formula")
+
+	// ErrUndefinedReference is returned when a formula refers to a query
+	// name that was not added to the request.
+	ErrUndefinedReference = errors.New("formula refers to an undefined query")
+
+	// ErrInvalidTimeRange is returned when the time range is missing or
+	// does not end after it starts.
+	ErrInvalidTimeRange = errors.New("invalid time range")
+
+	// ErrInvalidInterval is returned for negative or sub-millisecond
+	// intervals.
+	ErrInvalidInterval = errors.New("invalid interval")
+)
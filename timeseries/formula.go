@@ -0,0 +1,106 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidateFormula reports whether formula is well formed and refers only
+// to the given query names. Identifiers followed by an opening parenthesis
+// are function calls, such as abs(a) or top(a, 10, 'mean', 'desc'), and
+// are not treated as references; quoted arguments are skipped.
+func ValidateFormula(formula string, names ...string) error {
+	defined := make(map[string]bool, len(names))
+	for _, name := range names {
+		defined[name] = true
+	}
+
+	refs, err := formulaReferences(formula)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	reported := make(map[string]bool)
+	for _, ref := range refs {
+		if !defined[ref] && !reported[ref] {
+			errs = append(errs, fmt.Errorf("%w: %q in formula %q", ErrUndefinedReference, ref, formula))
+			reported[ref] = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// formulaReferences returns the query names formula refers to, in order
+// of appearance.
+func formulaReferences(formula string) ([]string, error) {
+	if strings.TrimSpace(formula) == "" {
+		return nil, ErrEmptyFormula
+	}
+
+	var refs []string
+	depth := 0
+	for i := 0; i < len(formula); {
+		c := formula[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(formula[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string in %q", ErrInvalidFormula, formula)
+			}
+			i += end + 2
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced parentheses in %q", ErrInvalidFormula, formula)
+			}
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(formula) && isIdentChar(formula[i]) {
+				i++
+			}
+			j := i
+			for j < len(formula) && formula[j] == ' ' {
+				j++
+			}
+			if j < len(formula) && formula[j] == '(' {
+				continue
+			}
+			refs = append(refs, formula[start:i])
+		case isDigit(c) || c == '.':
+			// Numbers may carry an exponent or unit suffix such as 1e3
+			for i < len(formula) && (isIdentChar(formula[i]) || formula[i] == '.') {
+				i++
+			}
+		case strings.IndexByte(" \t+-*/%,", c) >= 0:
+			i++
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidFormula, c, formula)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced parentheses in %q", ErrInvalidFormula, formula)
+	}
+	return refs, nil
+}
+
+// isIdentStart reports whether c can start a query name or function name.
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// isIdentChar reports whether c can continue a query name or function
+// name.
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
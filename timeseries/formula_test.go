@@ -0,0 +1,46 @@
+package timeseries_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonwinton/ddqb/timeseries"
+)
+
+func TestValidateFormula(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+		names   []string
+		wantErr error
+	}{
+		{name: "single reference", formula: "a", names: []string{"a"}},
+		{name: "arithmetic", formula: "(a - b) / a * 100", names: []string{"a", "b"}},
+		{name: "functions", formula: "abs(a) + top(b, 10, 'mean', 'desc')", names: []string{"a", "b"}},
+		{name: "function with space", formula: "log10 (a)", names: []string{"a"}},
+		{name: "multi-letter names", formula: "errors / hits", names: []string{"errors", "hits"}},
+		{name: "decimal constant", formula: "a * 0.5", names: []string{"a"}},
+		{name: "error - undefined reference", formula: "(a - c) / a", names: []string{"a", "b"}, wantErr: timeseries.ErrUndefinedReference},
+		{name: "error - undefined inside function", formula: "abs(b)", names: []string{"a"}, wantErr: timeseries.ErrUndefinedReference},
+		{name: "error - empty", formula: "", names: []string{"a"}, wantErr: timeseries.ErrEmptyFormula},
+		{name: "error - unbalanced", formula: "(a - b", names: []string{"a", "b"}, wantErr: timeseries.ErrInvalidFormula},
+		{name: "error - extra close", formula: "a - b)", names: []string{"a", "b"}, wantErr: timeseries.ErrInvalidFormula},
+		{name: "error - unterminated string", formula: "top(a, 10, 'mean)", names: []string{"a"}, wantErr: timeseries.ErrInvalidFormula},
+		{name: "error - unexpected character", formula: "a & b", names: []string{"a", "b"}, wantErr: timeseries.ErrInvalidFormula},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := timeseries.ValidateFormula(tt.formula, tt.names...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ValidateFormula() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package timeseries provides a builder for Datadog's v2 timeseries query
+// API (POST /api/v2/query/timeseries), turning metric query builders into
+// the named queries and formulas the endpoint expects.
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+)
+
+// RequestType is the JSON:API type of a timeseries request.
+const RequestType = "timeseries_request"
+
+// DataSourceMetrics is the data source of metric queries.
+const DataSourceMetrics = "metrics"
+
+// queryNamePattern matches names that formulas can reference.
+var queryNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Request is the body of a v2 timeseries query. Marshal it with
+// encoding/json to obtain the request payload.
+type Request struct {
+	Data RequestData `json:"data"`
+}
+
+// RequestData is the JSON:API data object of a Request.
+type RequestData struct {
+	// Type is always RequestType.
+	Type       string            `json:"type"`
+	Attributes RequestAttributes `json:"attributes"`
+}
+
+// RequestAttributes holds the queries, formulas and time range of a
+// Request.
+type RequestAttributes struct {
+	// From and To are the bounds of the time range in milliseconds since
+	// the Unix epoch.
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// Interval is the width of each point in milliseconds. Zero lets
+	// Datadog choose.
+	Interval int64     `json:"interval,omitempty"`
+	Queries  []Query   `json:"queries"`
+	Formulas []Formula `json:"formulas"`
+}
+
+// Query is a named metric query within a Request.
+type Query struct {
+	// DataSource is always DataSourceMetrics.
+	DataSource string `json:"data_source"`
+	Query      string `json:"query"`
+	Name       string `json:"name"`
+}
+
+// Formula combines the named queries of a Request, e.g. "a / b * 100".
+type Formula struct {
+	Formula string `json:"formula"`
+}
+
+// RequestBuilder provides a fluent interface for building v2 timeseries
+// requests:
+//
+//	timeseries.NewRequestBuilder().
+//		Query("a", errors).
+//		Query("b", hits).
+//		Formula("a / b * 100").
+//		From(start).To(end).
+//		Build()
+type RequestBuilder interface {
+	// Query adds q to the request under name, which formulas use to refer
+	// to it.
+	Query(name string, q metric.QueryBuilder) RequestBuilder
+
+	// Formula adds a formula over the named queries, e.g.
+	// "(a - b) / a * 100". Formulas may only refer to names added with
+	// Query. Without any formulas every query is returned on its own.
+	Formula(formula string) RequestBuilder
+
+	// From sets the start of the time range.
+	From(t time.Time) RequestBuilder
+
+	// To sets the end of the time range.
+	To(t time.Time) RequestBuilder
+
+	// Interval sets the width of each point. Without one Datadog chooses.
+	Interval(d time.Duration) RequestBuilder
+
+	// Build returns the request, building every query.
+	Build() (*Request, error)
+}
+
+// namedQuery is a query added to a requestBuilder.
+type namedQuery struct {
+	name  string
+	query metric.QueryBuilder
+}
+
+// requestBuilder is the concrete implementation of the RequestBuilder
+// interface.
+type requestBuilder struct {
+	queries  []namedQuery
+	formulas []string
+	from     time.Time
+	to       time.Time
+	interval time.Duration
+}
+
+// NewRequestBuilder creates a new timeseries request builder.
+func NewRequestBuilder() RequestBuilder {
+	return &requestBuilder{
+		queries:  make([]namedQuery, 0),
+		formulas: make([]string, 0),
+	}
+}
+
+// Query adds q to the request under name.
+func (b *requestBuilder) Query(name string, q metric.QueryBuilder) RequestBuilder {
+	b.queries = append(b.queries, namedQuery{name: name, query: q})
+	return b
+}
+
+// Formula adds a formula over the named queries.
+func (b *requestBuilder) Formula(formula string) RequestBuilder {
+	b.formulas = append(b.formulas, formula)
+	return b
+}
+
+// From sets the start of the time range.
+func (b *requestBuilder) From(t time.Time) RequestBuilder {
+	b.from = t
+	return b
+}
+
+// To sets the end of the time range.
+func (b *requestBuilder) To(t time.Time) RequestBuilder {
+	b.to = t
+	return b
+}
+
+// Interval sets the width of each point.
+func (b *requestBuilder) Interval(d time.Duration) RequestBuilder {
+	b.interval = d
+	return b
+}
+
+// Build returns the request, building every query.
+func (b *requestBuilder) Build() (*Request, error) {
+	// Collect every problem rather than stopping at the first
+	var errs []error
+
+	if len(b.queries) == 0 {
+		errs = append(errs, ErrMissingQuery)
+	}
+
+	queries := make([]Query, 0, len(b.queries))
+	seen := make(map[string]bool, len(b.queries))
+	for _, nq := range b.queries {
+		switch {
+		case !queryNamePattern.MatchString(nq.name):
+			errs = append(errs, fmt.Errorf("%w: %q", ErrInvalidQueryName, nq.name))
+		case seen[nq.name]:
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicateQueryName, nq.name))
+		}
+		seen[nq.name] = true
+
+		if nq.query == nil {
+			errs = append(errs, fmt.Errorf("query %q: %w", nq.name, ErrMissingQuery))
+			continue
+		}
+		query, err := nq.query.Build()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("query %q: %w", nq.name, err))
+			continue
+		}
+		queries = append(queries, Query{DataSource: DataSourceMetrics, Query: query, Name: nq.name})
+	}
+
+	names := make([]string, 0, len(b.queries))
+	for _, nq := range b.queries {
+		names = append(names, nq.name)
+	}
+	formulas := make([]Formula, 0, len(b.formulas))
+	for _, f := range b.formulas {
+		f = strings.TrimSpace(f)
+		if err := ValidateFormula(f, names...); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		formulas = append(formulas, Formula{Formula: f})
+	}
+
+	switch {
+	case b.from.IsZero() || b.to.IsZero():
+		errs = append(errs, fmt.Errorf("%w: from and to are required", ErrInvalidTimeRange))
+	case !b.to.After(b.from):
+		errs = append(errs, fmt.Errorf("%w: to must be after from", ErrInvalidTimeRange))
+	}
+
+	if b.interval < 0 || (b.interval > 0 && b.interval < time.Millisecond) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidInterval, b.interval))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// Return every query on its own when no formulas combine them
+	if len(formulas) == 0 {
+		for _, q := range queries {
+			formulas = append(formulas, Formula{Formula: q.Name})
+		}
+	}
+
+	return &Request{
+		Data: RequestData{
+			Type: RequestType,
+			Attributes: RequestAttributes{
+				From:     b.from.UnixMilli(),
+				To:       b.to.UnixMilli(),
+				Interval: b.interval.Milliseconds(),
+				Queries:  queries,
+				Formulas: formulas,
+			},
+		},
+	}, nil
+}
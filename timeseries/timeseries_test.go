@@ -0,0 +1,115 @@
+package timeseries_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonwinton/ddqb/metric"
+	"github.com/jonwinton/ddqb/timeseries"
+)
+
+var (
+	from = time.UnixMilli(1568899800000)
+	to   = time.UnixMilli(1568923200000)
+)
+
+func TestRequestBuilder(t *testing.T) {
+	errorsQuery := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().Aggregator("sum").Metric("trace.http.request.errors").Filter(metric.NewFilterBuilder("env").Equal("prod"))
+	}
+	hitsQuery := func() metric.QueryBuilder {
+		return metric.NewMetricQueryBuilder().Aggregator("sum").Metric("trace.http.request.hits").Filter(metric.NewFilterBuilder("env").Equal("prod"))
+	}
+
+	tests := []struct {
+		name     string
+		builder  timeseries.RequestBuilder
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "single query",
+			builder:  timeseries.NewRequestBuilder().Query("a", errorsQuery()).From(from).To(to),
+			expected: `{"data":{"type":"timeseries_request","attributes":{"from":1568899800000,"to":1568923200000,"queries":[{"data_source":"metrics","query":"sum:trace.http.request.errors{env:prod}","name":"a"}],"formulas":[{"formula":"a"}]}}}`,
+		},
+		{
+			name: "formula with interval",
+			builder: timeseries.NewRequestBuilder().
+				Query("errors", errorsQuery()).
+				Query("hits", hitsQuery()).
+				Formula("errors / hits * 100").
+				From(from).To(to).
+				Interval(5 * time.Second),
+			expected: `{"data":{"type":"timeseries_request","attributes":{"from":1568899800000,"to":1568923200000,"interval":5000,"queries":[{"data_source":"metrics","query":"sum:trace.http.request.errors{env:prod}","name":"errors"},{"data_source":"metrics","query":"sum:trace.http.request.hits{env:prod}","name":"hits"}],"formulas":[{"formula":"errors / hits * 100"}]}}}`,
+		},
+		{
+			name:    "error - no queries",
+			builder: timeseries.NewRequestBuilder().From(from).To(to),
+			wantErr: timeseries.ErrMissingQuery,
+		},
+		{
+			name:    "error - invalid name",
+			builder: timeseries.NewRequestBuilder().Query("A-1", errorsQuery()).From(from).To(to),
+			wantErr: timeseries.ErrInvalidQueryName,
+		},
+		{
+			name:    "error - duplicate name",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()).Query("a", hitsQuery()).From(from).To(to),
+			wantErr: timeseries.ErrDuplicateQueryName,
+		},
+		{
+			name:    "error - invalid query",
+			builder: timeseries.NewRequestBuilder().Query("a", metric.NewMetricQueryBuilder()).From(from).To(to),
+			wantErr: metric.ErrMissingMetric,
+		},
+		{
+			name:    "error - empty formula",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()).Formula(" ").From(from).To(to),
+			wantErr: timeseries.ErrEmptyFormula,
+		},
+		{
+			name:    "error - formula with undefined reference",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()).Query("b", hitsQuery()).Formula("(a - c) / a * 100").From(from).To(to),
+			wantErr: timeseries.ErrUndefinedReference,
+		},
+		{
+			name:    "error - missing time range",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()),
+			wantErr: timeseries.ErrInvalidTimeRange,
+		},
+		{
+			name:    "error - reversed time range",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()).From(to).To(from),
+			wantErr: timeseries.ErrInvalidTimeRange,
+		},
+		{
+			name:    "error - negative interval",
+			builder: timeseries.NewRequestBuilder().Query("a", errorsQuery()).From(from).To(to).Interval(-time.Second),
+			wantErr: timeseries.ErrInvalidInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.builder.Build()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("unexpected marshal error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Build() =\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}